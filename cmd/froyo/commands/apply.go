@@ -1,8 +1,13 @@
 package commands
 
 import (
+	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/openfroyo/openfroyo/pkg/engine"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
@@ -12,6 +17,21 @@ func newApplyCommand() *cobra.Command {
 		planFile    string
 		autoApprove bool
 		parallelism int
+		lockReason  string
+		where       string
+
+		concurrencyLimits []string
+		rollbackOnFailure bool
+
+		batchSize    int
+		batchPercent int
+		batchPause   time.Duration
+		maxFailRatio float64
+
+		canary         string
+		canaryChecks   []string
+		canarySoak     time.Duration
+		canaryRollback bool
 	)
 
 	cmd := &cobra.Command{
@@ -33,18 +53,103 @@ This command:
   froyo apply --plan plan.json --auto-approve
 
   # Apply with limited parallelism
-  froyo apply --plan plan.json --parallelism 5`,
+  froyo apply --plan plan.json --parallelism 5
+
+  # Undo everything that succeeded if any operation fails
+  froyo apply --plan plan.json --rollback-on-failure
+
+  # Run at most one unit per host and two per availability zone label at a time
+  froyo apply --plan plan.json --concurrency-limit host=1 --concurrency-limit label:zone=2
+
+  # Roll out to 25% of hosts at a time, aborting if over 10% of a batch fails
+  froyo apply --plan plan.json --batch-percent 25 --batch-pause 1m --max-fail-ratio 0.1
+
+  # Apply to two canary hosts, gate on an HTTP probe for 10 minutes, then continue
+  froyo apply --plan plan.json --canary 2 --canary-check http=http://localhost/healthz \
+    --canary-soak 10m --canary-rollback
+
+  # Use hosts labelled role=canary as canaries
+  froyo apply --plan plan.json --canary role=canary --canary-check "command=systemctl is-active nginx"
+
+  # Use web1 and web2 as canaries
+  froyo apply --plan plan.json --canary web1,web2 --canary-check port=443
+
+  # Only apply to the hosts whose cached facts match a query (see froyo facts query)
+  froyo apply --plan plan.json --where 'os.basic.distro == "ubuntu"'`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := engine.ScheduleOptions{
+				MaxParallel:       parallelism,
+				RollbackOnFailure: rollbackOnFailure,
+			}
+
+			for _, spec := range concurrencyLimits {
+				limit, err := parseConcurrencyLimit(spec)
+				if err != nil {
+					return err
+				}
+				opts.ConcurrencyLimits = append(opts.ConcurrencyLimits, limit)
+			}
+
+			// Roll out in host batches when a batch size is given
+			if batchSize > 0 || batchPercent > 0 {
+				opts.Rollout = &engine.RolloutOptions{
+					BatchSize:       batchSize,
+					BatchPercent:    batchPercent,
+					Pause:           batchPause,
+					MaxFailureRatio: maxFailRatio,
+				}
+				if err := opts.Rollout.Validate(); err != nil {
+					return fmt.Errorf("invalid rollout options: %w", err)
+				}
+			}
+
+			// Apply to canary hosts first when requested
+			if canary != "" {
+				canaryOpts, err := buildCanaryOptions(cmd.Context(), canary, canaryChecks)
+				if err != nil {
+					return err
+				}
+				canaryOpts.Soak = canarySoak
+				canaryOpts.Rollback = canaryRollback
+
+				if err := canaryOpts.Validate(); err != nil {
+					return fmt.Errorf("invalid canary options: %w", err)
+				}
+				opts.Canary = canaryOpts
+			}
+
+			// Resolve the fact query against the cached facts
+			var hosts []string
+			if where != "" {
+				var err error
+				hosts, err = selectHostsWhere(cmd.Context(), where)
+				if err != nil {
+					return err
+				}
+			}
+
 			log.Info().
 				Str("plan", planFile).
+				Strs("hosts", hosts).
 				Bool("auto_approve", autoApprove).
 				Int("parallelism", parallelism).
+				Interface("concurrency_limits", opts.ConcurrencyLimits).
+				Bool("rollback_on_failure", rollbackOnFailure).
+				Interface("rollout", opts.Rollout).
+				Interface("canary", opts.Canary).
 				Msg("Applying plan")
 
+			unlock, err := lockWorkspace(cmd, "apply", lockReason)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
 			// TODO: Implement apply
 			// - Load plan from planFile
 			// - Validate plan is current (no config changes since plan)
 			// - Show summary and prompt for approval (unless auto-approve)
+			// - Limit the plan to the units of the --where hosts, when given
 			// - Execute DAG with parallelism limit
 			// - For each PU:
 			//   - Load provider WASM
@@ -53,11 +158,15 @@ This command:
 			//   - Update state
 			//   - Log events
 			// - Trigger post-apply handlers
-			// - Run smoke tests if configured
+			// - On failure, roll back (--rollback-on-failure) or point at `froyo runs rollback`
+			// - Set a RunnerHealthChecker on the scheduler so the checks blocks of
+			//   resources and the workspace run after apply; failed checks fail the run
+			// - Set a DefaultHookRunner on the scheduler so workspace and resource
+			//   hooks run around the run, its batches and each resource
 
 			fmt.Println("Not implemented yet: plan execution")
-			fmt.Printf("Would apply plan=%s, auto_approve=%v, parallelism=%d\n",
-				planFile, autoApprove, parallelism)
+			fmt.Printf("Would apply plan=%s, auto_approve=%v, parallelism=%d, hosts=%v\n",
+				planFile, autoApprove, parallelism, hosts)
 
 			return nil
 		},
@@ -66,7 +175,149 @@ This command:
 	cmd.Flags().StringVarP(&planFile, "plan", "p", "plan.json", "plan file to execute")
 	cmd.Flags().BoolVar(&autoApprove, "auto-approve", false, "skip approval prompt")
 	cmd.Flags().IntVar(&parallelism, "parallelism", 10, "max parallel operations")
+	cmd.Flags().StringVar(&lockReason, "lock-reason", "", "reason recorded on the workspace lock")
+	cmd.Flags().StringVar(&where, "where", "", "only apply to hosts whose cached facts match a query expression")
+	cmd.Flags().StringArrayVar(&concurrencyLimits, "concurrency-limit", nil, "max concurrent operations per key: host=<n>, provider=<n> or label:<name>=<n> (repeatable)")
+	cmd.Flags().BoolVar(&rollbackOnFailure, "rollback-on-failure", false, "roll back the succeeded operations when the run fails")
+	cmd.Flags().IntVar(&batchSize, "batch-size", 0, "roll out to this many hosts at a time")
+	cmd.Flags().IntVar(&batchPercent, "batch-percent", 0, "roll out to this percentage of hosts at a time")
+	cmd.Flags().DurationVar(&batchPause, "batch-pause", 0, "pause between rollout batches")
+	cmd.Flags().Float64Var(&maxFailRatio, "max-fail-ratio", 0, "abort remaining batches when the failed host ratio in a batch exceeds this")
+	cmd.Flags().StringVar(&canary, "canary", "", "apply to canary hosts first: a host count, a label selector or host IDs")
+	cmd.Flags().StringArrayVar(&canaryChecks, "canary-check", nil, "canary health check: command=<cmd>, http=<url>, port=<n>, file=<path>[=<pattern>] or fact=<path>[=<value>] (repeatable)")
+	cmd.Flags().DurationVar(&canarySoak, "canary-soak", 0, "wait this long after the canary passes before checking again and continuing")
+	cmd.Flags().BoolVar(&canaryRollback, "canary-rollback", false, "roll the canary hosts back when the canary fails")
 	cmd.MarkFlagRequired("plan")
 
 	return cmd
 }
+
+// buildCanaryOptions resolves the --canary value into canary hosts and parses
+// the health checks. An integer picks that many hosts from the plan, a value
+// with key=value pairs is a label selector resolved against the inventory,
+// and anything else is a comma-separated list of host IDs.
+func buildCanaryOptions(ctx context.Context, canary string, checkSpecs []string) (*engine.CanaryOptions, error) {
+	opts := &engine.CanaryOptions{}
+
+	for _, spec := range checkSpecs {
+		check, err := parseHealthCheck(spec)
+		if err != nil {
+			return nil, err
+		}
+		opts.Checks = append(opts.Checks, check)
+	}
+
+	if count, err := strconv.Atoi(canary); err == nil {
+		opts.Count = count
+		return opts, nil
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	store, err := openWorkspaceStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	registry := engine.NewHostRegistry(store)
+
+	// Without a label pair the value names the canary hosts
+	if !strings.Contains(canary, "=") {
+		for _, hostID := range strings.Split(canary, ",") {
+			host, err := registry.GetHost(ctx, strings.TrimSpace(hostID))
+			if err != nil {
+				return nil, fmt.Errorf("invalid canary host: %w", err)
+			}
+			opts.Hosts = append(opts.Hosts, host.ID)
+		}
+		return opts, nil
+	}
+
+	// Every part of a selector must be a label pair, or it would be dropped
+	// and the selector would match more hosts than intended
+	for _, pair := range strings.Split(canary, ",") {
+		if key, _, ok := strings.Cut(pair, "="); !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid canary selector %q: expected key=value pairs", canary)
+		}
+	}
+
+	// Resolve the selector against the host inventory
+	hosts, err := registry.SelectHosts(ctx, canary)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select canary hosts: %w", err)
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("canary selector %q matched no hosts", canary)
+	}
+
+	for _, host := range hosts {
+		opts.Hosts = append(opts.Hosts, host.ID)
+	}
+
+	return opts, nil
+}
+
+// parseHealthCheck parses a --canary-check value of the form
+// command=<cmd>, http=<url>, port=<n>, file=<path>[=<pattern>] or fact=<path>[=<value>].
+func parseHealthCheck(spec string) (engine.HealthCheck, error) {
+	kind, value, ok := strings.Cut(spec, "=")
+	if !ok || value == "" {
+		return engine.HealthCheck{}, fmt.Errorf("invalid health check %q: expected <type>=<value>", spec)
+	}
+
+	check := engine.HealthCheck{
+		Name: spec,
+		Type: engine.HealthCheckType(kind),
+	}
+
+	switch check.Type {
+	case engine.HealthCheckCommand:
+		check.Command = value
+	case engine.HealthCheckHTTP:
+		check.URL = value
+	case engine.HealthCheckPort:
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return engine.HealthCheck{}, fmt.Errorf("invalid health check %q: %w", spec, err)
+		}
+		check.Port = port
+	case engine.HealthCheckFile:
+		check.Path, check.Pattern, _ = strings.Cut(value, "=")
+	case engine.HealthCheckFact:
+		check.Fact, check.Equals, _ = strings.Cut(value, "=")
+	default:
+		return engine.HealthCheck{}, fmt.Errorf("invalid health check %q: unknown type %q", spec, kind)
+	}
+
+	return check, nil
+}
+
+// parseConcurrencyLimit parses a --concurrency-limit value of the form
+// host=<n>, provider=<n> or label:<name>=<n>.
+func parseConcurrencyLimit(spec string) (engine.ConcurrencyLimit, error) {
+	scope, value, ok := strings.Cut(spec, "=")
+	if !ok {
+		return engine.ConcurrencyLimit{}, fmt.Errorf("invalid concurrency limit %q: expected <scope>=<n>", spec)
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return engine.ConcurrencyLimit{}, fmt.Errorf("invalid concurrency limit %q: %w", spec, err)
+	}
+
+	limit := engine.ConcurrencyLimit{Max: n}
+	if label, ok := strings.CutPrefix(scope, "label:"); ok {
+		limit.Scope = engine.ConcurrencyScopeLabel
+		limit.Label = label
+	} else {
+		limit.Scope = engine.ConcurrencyScope(scope)
+	}
+
+	if err := limit.Validate(); err != nil {
+		return engine.ConcurrencyLimit{}, fmt.Errorf("invalid concurrency limit %q: %w", spec, err)
+	}
+
+	return limit, nil
+}
@@ -59,6 +59,8 @@ Both components run in-process with shared SQLite database and queue.`,
 
 			// TODO: Implement dev mode
 			// - Initialize SQLite database
+			// - Start an engine.FactsSweeper to delete expired facts and old
+			//   fact versions, and stop it on shutdown
 			// - Start embedded queue
 			// - If controller or both:
 			//   - Start controller goroutine
@@ -84,8 +84,9 @@ This command:
 
 func newDriftReconcileCommand() *cobra.Command {
 	var (
-		targets []string
-		dryRun  bool
+		targets    []string
+		dryRun     bool
+		lockReason string
 	)
 
 	cmd := &cobra.Command{
@@ -108,6 +109,12 @@ This command restores actual state to match recorded state.`,
 				Bool("dry_run", dryRun).
 				Msg("Reconciling drift")
 
+			unlock, err := lockWorkspace(cmd, "drift-reconcile", lockReason)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
 			// TODO: Implement drift reconciliation
 			// - Load drift report
 			// - Generate corrective plan
@@ -124,6 +131,7 @@ This command restores actual state to match recorded state.`,
 
 	cmd.Flags().StringSliceVarP(&targets, "target", "t", nil, "target hosts/groups")
 	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "show what would be done without executing")
+	cmd.Flags().StringVar(&lockReason, "lock-reason", "", "reason recorded on the workspace lock")
 
 	return cmd
 }
@@ -2,12 +2,20 @@ package commands
 
 import (
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
-
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/openfroyo/openfroyo/pkg/config"
 	"github.com/openfroyo/openfroyo/pkg/engine"
-	"github.com/openfroyo/openfroyo/pkg/stores"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
@@ -23,23 +31,31 @@ Facts are structured data about systems, including:
   - Hardware specifications (CPU, memory, disk)
   - Network interfaces and configuration
   - Installed packages
-  - Running services
+  - Services, local users, listening ports and mounts
+  - Kernel parameters, timezone and locale
   - Custom application facts`,
 	}
 
 	cmd.AddCommand(newFactsCollectCommand())
 	cmd.AddCommand(newFactsListCommand())
 	cmd.AddCommand(newFactsShowCommand())
+	cmd.AddCommand(newFactsQueryCommand())
+	cmd.AddCommand(newFactsHistoryCommand())
+	cmd.AddCommand(newFactsDiffCommand())
+	cmd.AddCommand(newFactsPruneCommand())
 
 	return cmd
 }
 
 func newFactsCollectCommand() *cobra.Command {
 	var (
-		selector  string
-		targets   []string
-		factTypes []string
-		refresh   bool
+		selector     string
+		targets      []string
+		factTypes    []string
+		refresh      bool
+		parallelism  int
+		runnerBinary string
+		tracked      []string
 	)
 
 	cmd := &cobra.Command{
@@ -47,16 +63,32 @@ func newFactsCollectCommand() *cobra.Command {
 		Short: "Collect facts from targets",
 		Long: `Collect facts from target hosts.
 
-Facts are gathered using various collectors:
-  - os.basic: OS name, version, kernel
-  - hw.cpu: CPU model, cores, architecture
-  - hw.memory: RAM size, swap
-  - hw.disk: Disk devices, capacity, usage
-  - net.ifaces: Network interfaces, IPs, routes
-  - pkg.manifest: Installed packages
-  - svc.running: Active services
-
-Facts are cached with TTL and can be refreshed on demand.`,
+Facts are gathered by the registered collectors, each with its own TTL:
+  - os.basic: OS name, version, kernel (24h)
+  - hw.cpu: CPU model, cores, architecture (24h)
+  - hw.memory: RAM size, swap (1h)
+  - hw.disk: Disk devices, capacity, usage (1h)
+  - net.ifaces: Network interfaces, IPs, routes (1h)
+  - pkg.manifest: Installed packages (1h)
+  - svc.units: systemd services and their states (10m)
+  - os.users: Local users and groups (1h)
+  - net.ports: Listening sockets and their processes (10m)
+  - fs.mounts: Mounted filesystems and fstab (1h)
+  - os.sysctl: Kernel parameters (1h)
+  - os.locale: Timezone and locale (24h)
+  - custom: Facts hosts publish in /etc/froyo/facts.d (1h)
+
+Cached facts are reused until their TTL expires; --refresh collects them again.
+Each time a collected fact changes, a new version is kept in the fact history
+(see froyo facts history and froyo facts diff), and a fact_changed event with
+the changes is logged for the namespaces given with --track (all by default).
+
+The built-in facts are gathered natively by the micro-runner in a single round
+trip per host. Hosts the runner cannot be started on are collected from with
+SSH commands instead.
+
+Hosts are collected from in parallel. Unreachable hosts and failed fact types
+do not stop the collection; they are reported in the summary at the end.`,
 		Example: `  # Collect all facts from all hosts
   froyo facts collect
 
@@ -70,7 +102,13 @@ Facts are cached with TTL and can be refreshed on demand.`,
   froyo facts collect --selector 'env=prod,role=web'
 
   # Force refresh cached facts
-  froyo facts collect --refresh`,
+  froyo facts collect --refresh
+
+  # Collect from up to 50 production hosts at once
+  froyo facts collect --selector env=prod --parallelism 50
+
+  # Only report kernel and package changes
+  froyo facts collect --track os.basic --track pkg.manifest`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			log.Info().
 				Str("selector", selector).
@@ -81,29 +119,19 @@ Facts are cached with TTL and can be refreshed on demand.`,
 
 			ctx := context.Background()
 
-			// Load configuration
-			dataDir := "./data"
-			if configPath != "" {
-				dataDir = filepath.Join(filepath.Dir(configPath), "data")
-			}
-
-			// Initialize store
-			dbPath := filepath.Join(dataDir, "openfroyo.db")
-			store, err := stores.NewSQLiteStore(stores.Config{
-				Path: dbPath,
-			})
+			// Migrated so changed facts can be recorded in the fact history
+			store, err := openWorkspaceStore(ctx)
 			if err != nil {
-				return fmt.Errorf("failed to create store: %w", err)
-			}
-
-			if err := store.Init(ctx); err != nil {
-				return fmt.Errorf("failed to initialize store: %w", err)
+				return err
 			}
 			defer store.Close()
 
 			// Create host registry and facts collector
 			hostRegistry := engine.NewHostRegistry(store)
 			factsCollector := engine.NewFactsCollector(store, hostRegistry)
+			factsCollector.SetRunnerBinaryPath(runnerBinary)
+			factsCollector.SetEventPublisher(logEventPublisher{})
+			factsCollector.SetTrackedFacts(tracked)
 
 			// Resolve target hosts
 			var hostsToProcess []*engine.Host
@@ -138,29 +166,14 @@ Facts are cached with TTL and can be refreshed on demand.`,
 
 			fmt.Printf("Collecting facts from %d host(s)...\n\n", len(hostsToProcess))
 
-			// Collect facts from each host
-			successCount := 0
-			for _, host := range hostsToProcess {
-				fmt.Printf("📊 Collecting facts from %s (%s)...\n", host.Address, host.ID)
-
-				result, err := factsCollector.CollectFacts(ctx, host.ID, factTypes, refresh)
-				if err != nil {
-					log.Error().Err(err).Str("host", host.Address).Msg("Failed to collect facts")
-					fmt.Printf("   ❌ Error: %v\n\n", err)
-					continue
-				}
-
-				fmt.Printf("   ✓ Collected %d fact types in %v\n", result.FactsCount, result.Duration)
-				for factType := range result.Facts {
-					fmt.Printf("     - %s\n", factType)
-				}
-				fmt.Println()
-				successCount++
-			}
+			// Collect facts from the hosts in parallel, continuing past failures
+			results := factsCollector.CollectFactsFromHosts(ctx, hostsToProcess, factTypes, refresh, parallelism,
+				func(done, total int, result *engine.HostFactsResult) {
+					fmt.Fprintf(os.Stderr, "\r\033[K[%d/%d] %s %s", done, total, result.Host.Address, result.Status)
+				})
+			fmt.Fprintln(os.Stderr)
 
-			fmt.Printf("\n✅ Facts collection completed: %d/%d hosts successful\n", successCount, len(hostsToProcess))
-
-			return nil
+			return printFactsCollectionSummary(results)
 		},
 	}
 
@@ -168,10 +181,101 @@ Facts are cached with TTL and can be refreshed on demand.`,
 	cmd.Flags().StringSliceVarP(&targets, "target", "t", nil, "specific target hosts")
 	cmd.Flags().StringSliceVar(&factTypes, "type", nil, "specific fact types to collect")
 	cmd.Flags().BoolVar(&refresh, "refresh", false, "force refresh cached facts")
+	cmd.Flags().IntVar(&parallelism, "parallelism", 10, "max hosts to collect from at once")
+	cmd.Flags().StringVar(&runnerBinary, "runner-binary", filepath.Join("./bin", "micro-runner"),
+		"micro-runner binary used to gather facts in one round trip (empty to use SSH commands)")
+	cmd.Flags().StringSliceVar(&tracked, "track", nil,
+		"fact namespaces whose changes are reported as events (default all)")
 
 	return cmd
 }
 
+// logEventPublisher publishes engine events to the log. It does not support
+// subscriptions.
+type logEventPublisher struct{}
+
+func (logEventPublisher) Publish(ctx context.Context, event *engine.Event) error {
+	entry := log.Info()
+	switch event.Level {
+	case "warning":
+		entry = log.Warn()
+	case "error":
+		entry = log.Error()
+	}
+
+	entry.Str("event", string(event.Type)).
+		Str("resource_id", event.ResourceID).
+		Fields(event.Details).
+		Msg(event.Message)
+	return nil
+}
+
+func (logEventPublisher) Subscribe(ctx context.Context, filter engine.EventFilter) (<-chan engine.Event, error) {
+	return nil, fmt.Errorf("subscriptions are not supported")
+}
+
+func (logEventPublisher) Unsubscribe(ctx context.Context, subscriptionID string) error {
+	return nil
+}
+
+// printFactsCollectionSummary prints a table of the hosts facts were
+// collected from and the errors of failed fact types. It returns an error
+// when any host did not succeed.
+func printFactsCollectionSummary(results []*engine.HostFactsResult) error {
+	counts := make(map[engine.HostFactsStatus]int)
+
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tADDRESS\tSTATUS\tFACTS\tCACHED\tDURATION")
+	for _, result := range results {
+		counts[result.Status]++
+
+		facts, cached, duration := "-", "-", "-"
+		if result.Result != nil {
+			facts = fmt.Sprintf("%d", result.Result.FactsCount)
+			cached = fmt.Sprintf("%d", len(result.Result.Cached))
+			duration = result.Result.Duration.Round(time.Millisecond).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			result.Host.ID, result.Host.Address, result.Status, facts, cached, duration)
+	}
+	w.Flush()
+
+	// Report why hosts and fact types failed
+	printedHeader := false
+	for _, result := range results {
+		if result.Status == engine.HostFactsSucceeded {
+			continue
+		}
+		if !printedHeader {
+			fmt.Println("\nErrors:")
+			printedHeader = true
+		}
+		if result.Error != "" {
+			fmt.Printf("  %s: %s\n", result.Host.Address, result.Error)
+			continue
+		}
+
+		namespaces := make([]string, 0, len(result.Result.Errors))
+		for namespace := range result.Result.Errors {
+			namespaces = append(namespaces, namespace)
+		}
+		sort.Strings(namespaces)
+		for _, namespace := range namespaces {
+			fmt.Printf("  %s %s: %s\n", result.Host.Address, namespace, result.Result.Errors[namespace])
+		}
+	}
+
+	fmt.Printf("\n%d succeeded, %d failed, %d unreachable\n",
+		counts[engine.HostFactsSucceeded], counts[engine.HostFactsFailed], counts[engine.HostFactsUnreachable])
+
+	if failed := len(results) - counts[engine.HostFactsSucceeded]; failed > 0 {
+		return fmt.Errorf("facts collection did not succeed on %d of %d hosts", failed, len(results))
+	}
+
+	return nil
+}
+
 func newFactsListCommand() *cobra.Command {
 	var (
 		target    string
@@ -184,7 +288,9 @@ func newFactsListCommand() *cobra.Command {
 		Short: "List collected facts",
 		Long: `List facts stored in the database.
 
-Shows available facts with their age and validity status.`,
+Shows available facts with their age and validity status. Facts past their
+TTL are stale: they are hidden unless --show-stale is given and are
+collected again by the next froyo facts collect.`,
 		Example: `  # List all facts
   froyo facts list
 
@@ -203,15 +309,59 @@ Shows available facts with their age and validity status.`,
 				Bool("show_stale", showStale).
 				Msg("Listing facts")
 
-			// TODO: Implement facts listing
-			// - Query facts from database
-			// - Filter by target and/or type
-			// - Check TTL and mark stale facts
-			// - Format output (table or JSON)
+			ctx := context.Background()
+
+			store, err := openWorkspaceStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			var targetFilter, typeFilter *string
+			if target != "" {
+				targetFilter = &target
+			}
+			if factType != "" {
+				typeFilter = &factType
+			}
+
+			facts, err := store.ListFacts(ctx, targetFilter, typeFilter, 10000, 0)
+			if err != nil {
+				return fmt.Errorf("failed to list facts: %w", err)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "TARGET\tTYPE\tAGE\tEXPIRES\tSTATUS")
+
+			now := time.Now()
+			listed, stale := 0, 0
+			for _, fact := range facts {
+				status, expires := "fresh", "never"
+				if fact.ExpiresAt != nil {
+					if fact.ExpiresAt.After(now) {
+						expires = "in " + fact.ExpiresAt.Sub(now).Round(time.Second).String()
+					} else {
+						status = "stale"
+						expires = now.Sub(*fact.ExpiresAt).Round(time.Second).String() + " ago"
+						stale++
+						if !showStale {
+							continue
+						}
+					}
+				}
+
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", fact.TargetID, fact.Namespace,
+					now.Sub(fact.UpdatedAt).Round(time.Second), expires, status)
+				listed++
+			}
+			w.Flush()
 
-			fmt.Println("Not implemented yet: facts listing")
-			fmt.Printf("Would list facts: target=%s, type=%s, show_stale=%v\n",
-				target, factType, showStale)
+			if listed == 0 {
+				fmt.Println("\nNo facts found.")
+			}
+			if stale > 0 && !showStale {
+				fmt.Printf("\n%d stale facts hidden (use --show-stale, or refresh with froyo facts collect)\n", stale)
+			}
 
 			return nil
 		},
@@ -249,23 +399,9 @@ Shows the complete fact payload in JSON format.`,
 
 			ctx := context.Background()
 
-			// Load configuration
-			dataDir := "./data"
-			if configPath != "" {
-				dataDir = filepath.Join(filepath.Dir(configPath), "data")
-			}
-
-			// Initialize store
-			dbPath := filepath.Join(dataDir, "openfroyo.db")
-			store, err := stores.NewSQLiteStore(stores.Config{
-				Path: dbPath,
-			})
+			store, err := openWorkspaceStore(ctx)
 			if err != nil {
-				return fmt.Errorf("failed to create store: %w", err)
-			}
-
-			if err := store.Init(ctx); err != nil {
-				return fmt.Errorf("failed to initialize store: %w", err)
+				return err
 			}
 			defer store.Close()
 
@@ -317,3 +453,501 @@ Shows the complete fact payload in JSON format.`,
 
 	return cmd
 }
+
+func newFactsPruneCommand() *cobra.Command {
+	var historyRetention string
+
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Delete expired facts",
+		Long: `Delete facts whose TTL has expired from the database, and fact versions
+older than the history retention.
+
+Nothing sweeps expired facts in the background yet, so run this periodically
+(e.g. from cron). Host inventory records never expire and are kept, as is the
+latest version of each fact.`,
+		Example: `  # Delete expired facts
+  froyo facts prune
+
+  # Only keep a month of fact history
+  froyo facts prune --history-retention 30d`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			retention, err := parseFactsAge(historyRetention)
+			if err != nil {
+				return fmt.Errorf("invalid --history-retention: %w", err)
+			}
+
+			ctx := context.Background()
+
+			store, err := openWorkspaceStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			sweeper := engine.NewFactsSweeper(store, 0)
+			sweeper.SetHistoryRetention(retention)
+
+			deleted, err := sweeper.Sweep(ctx)
+			if err != nil {
+				return err
+			}
+
+			pruned, err := sweeper.PruneHistory(ctx)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Deleted %d expired facts and %d old fact versions\n", deleted, pruned)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&historyRetention, "history-retention", "90d", "how long to keep fact versions (e.g. 30d, 72h)")
+
+	return cmd
+}
+
+func newFactsQueryCommand() *cobra.Command {
+	var (
+		selector string
+		columns  []string
+		groupBy  []string
+		output   string
+		language string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "query [expression]",
+		Short: "Query hosts by their facts",
+		Long: `Find the hosts whose cached facts match an expression.
+
+The query runs entirely from the database: hosts are not contacted, so facts
+are as fresh as the last froyo facts collect. Fact namespaces are read as
+nested fields (os.basic.distro), and each host's inventory record as
+host.id, host.address and host.labels.<name>. Without an expression every
+host matches.
+
+Expressions are CUE by default (&&, ||, ==, <, =~ ...), or Starlark with
+--lang starlark. Hosts lacking a fact the expression reads do not match.
+
+Matching hosts are listed with the --select fact values, or counted by the
+--group-by fact values.`,
+		Example: `  # Ubuntu hosts with less than 4 GB of memory
+  froyo facts query 'hw.memory.total_mb < 4096 && os.basic.distro == "ubuntu"'
+
+  # With their kernel and memory, as CSV
+  froyo facts query 'os.basic.distro == "ubuntu"' --select os.basic.kernel,hw.memory.total_mb -o csv
+
+  # Count production hosts by distribution and version
+  froyo facts query 'host.labels.env == "prod"' --group-by os.basic.distro,os.basic.version
+
+  # The same with Starlark
+  froyo facts query --lang starlark 'hw.memory.total_mb < 4096 and os.basic.distro == "ubuntu"'`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if jsonOutput {
+				output = "json"
+			}
+			switch output {
+			case "table", "json", "csv":
+			default:
+				return fmt.Errorf("invalid --output %q: use table, json or csv", output)
+			}
+
+			query := &engine.FactQuery{Select: columns, GroupBy: groupBy}
+			if len(args) > 0 {
+				query.Where = &engine.Condition{
+					Expression: args[0],
+					Language:   engine.ConditionLanguage(language),
+				}
+			}
+
+			ctx := context.Background()
+
+			store, err := openWorkspaceStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			hostRegistry := engine.NewHostRegistry(store)
+			if selector == "" {
+				selector = "all"
+			}
+			hosts, err := hostRegistry.SelectHosts(ctx, selector)
+			if err != nil {
+				return fmt.Errorf("failed to select hosts: %w", err)
+			}
+
+			querier := engine.NewFactQuerier(engine.NewFactsCollector(store, hostRegistry), config.NewConditionEvaluator())
+			result, err := querier.Query(ctx, hosts, query)
+			if err != nil {
+				return err
+			}
+
+			// Hosts lacking facts are expected, so they are only detailed on request
+			if len(result.Errors) > 0 && !verbose {
+				fmt.Fprintf(os.Stderr, "%d host(s) skipped: the expression could not be evaluated on their facts (use --verbose for details)\n",
+					len(result.Errors))
+			} else if len(result.Errors) > 0 {
+				hostIDs := make([]string, 0, len(result.Errors))
+				for hostID := range result.Errors {
+					hostIDs = append(hostIDs, hostID)
+				}
+				sort.Strings(hostIDs)
+				for _, hostID := range hostIDs {
+					fmt.Fprintf(os.Stderr, "skipped %s: %s\n", hostID, result.Errors[hostID])
+				}
+			}
+
+			return printFactQueryResult(result, query, output)
+		},
+	}
+
+	cmd.Flags().StringVar(&selector, "selector", "", "only query hosts matching a label selector")
+	cmd.Flags().StringSliceVar(&columns, "select", nil, "fact paths to show for each host")
+	cmd.Flags().StringSliceVar(&groupBy, "group-by", nil, "fact paths to count hosts by")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "output format: table, json or csv")
+	cmd.Flags().StringVar(&language, "lang", string(engine.ConditionLanguageCUE), "expression language: cue or starlark")
+
+	return cmd
+}
+
+// printFactQueryResult prints the matching hosts of a fact query, or its
+// group counts when it groups, as a table, JSON or CSV.
+func printFactQueryResult(result *engine.FactQueryResult, query *engine.FactQuery, output string) error {
+	var header []string
+	var records [][]any
+	if len(query.GroupBy) > 0 {
+		header = append(append(header, query.GroupBy...), "count")
+		for _, group := range result.Groups {
+			records = append(records, append(append([]any{}, group.Values...), group.Count))
+		}
+	} else {
+		header = append([]string{"host", "address"}, query.Select...)
+		for _, row := range result.Rows {
+			records = append(records, append([]any{row.Host.ID, row.Host.Address}, row.Values...))
+		}
+	}
+
+	switch output {
+	case "json":
+		objects := make([]map[string]any, 0, len(records))
+		for _, record := range records {
+			object := make(map[string]any, len(header))
+			for i, column := range header {
+				object[column] = record[i]
+			}
+			objects = append(objects, object)
+		}
+		data, err := json.MarshalIndent(objects, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal query result: %w", err)
+		}
+		fmt.Println(string(data))
+
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		if err := w.Write(header); err != nil {
+			return fmt.Errorf("failed to write query result: %w", err)
+		}
+		for _, record := range records {
+			fields := make([]string, len(record))
+			for i, value := range record {
+				fields[i] = formatQueryValue(value)
+			}
+			if err := w.Write(fields); err != nil {
+				return fmt.Errorf("failed to write query result: %w", err)
+			}
+		}
+		w.Flush()
+		return w.Error()
+
+	default:
+		if len(records) == 0 {
+			fmt.Println("No hosts matched.")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		columns := make([]string, len(header))
+		for i, column := range header {
+			columns[i] = strings.ToUpper(column)
+		}
+		fmt.Fprintln(w, strings.Join(columns, "\t"))
+		for _, record := range records {
+			fields := make([]string, len(record))
+			for i, value := range record {
+				fields[i] = formatQueryValue(value)
+				if value == nil {
+					fields[i] = "-"
+				}
+			}
+			fmt.Fprintln(w, strings.Join(fields, "\t"))
+		}
+		w.Flush()
+
+		fmt.Printf("\n%d host(s) matched\n", len(result.Rows))
+	}
+
+	return nil
+}
+
+// formatQueryValue formats a fact value for a table or CSV cell: strings as
+// is, whole numbers without a fractional part and anything else as JSON.
+func formatQueryValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(data)
+	}
+}
+
+// selectHostsWhere returns the IDs of the hosts whose cached facts match a
+// fact query expression (CUE, as in froyo facts query). Hosts are not
+// contacted. It is used by the --where flags of plan, apply and run.
+func selectHostsWhere(ctx context.Context, where string) ([]string, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	store, err := openWorkspaceStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	hostRegistry := engine.NewHostRegistry(store)
+	hosts, err := hostRegistry.ListHosts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list hosts: %w", err)
+	}
+
+	querier := engine.NewFactQuerier(engine.NewFactsCollector(store, hostRegistry), config.NewConditionEvaluator())
+	selected, err := querier.SelectHosts(ctx, hosts, &engine.Condition{
+		Expression: where,
+		Language:   engine.ConditionLanguageCUE,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to select hosts where %q: %w", where, err)
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no hosts match %q", where)
+	}
+
+	ids := make([]string, 0, len(selected))
+	for _, host := range selected {
+		ids = append(ids, host.ID)
+	}
+	return ids, nil
+}
+
+// targetsWhere combines --target and --where: the hosts matching the fact
+// query, limited to the --target hosts when any are given.
+func targetsWhere(ctx context.Context, targets []string, where string) ([]string, error) {
+	selected, err := selectHostsWhere(ctx, where)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return selected, nil
+	}
+
+	matched := make([]string, 0, len(targets))
+	for _, target := range targets {
+		if slices.Contains(selected, target) {
+			matched = append(matched, target)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("none of the targets %s match %q", strings.Join(targets, ", "), where)
+	}
+	return matched, nil
+}
+
+func newFactsHistoryCommand() *cobra.Command {
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "history <host> <namespace>",
+		Short: "Show how a fact changed over time",
+		Long: `Show the versions of a fact of a host, newest first.
+
+A version is kept each time froyo facts collect finds the fact changed, with
+the changes from the previous version.`,
+		Example: `  # When did the kernel on web3 change?
+  froyo facts history web3 os.basic
+
+  # Only the last 5 versions
+  froyo facts history web3 pkg.manifest --limit 5`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hostID, namespace := args[0], args[1]
+			ctx := context.Background()
+
+			store, err := openWorkspaceStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			hostRegistry := engine.NewHostRegistry(store)
+			host, err := hostRegistry.GetHost(ctx, hostID)
+			if err != nil {
+				return fmt.Errorf("host not found: %s", hostID)
+			}
+
+			versions, err := engine.NewFactsCollector(store, hostRegistry).FactHistory(ctx, hostID, namespace, limit)
+			if err != nil {
+				return err
+			}
+
+			if len(versions) == 0 {
+				fmt.Printf("No history of %s for host %s.\n", namespace, hostID)
+				return nil
+			}
+
+			fmt.Printf("History of %s for host: %s (%s)\n\n", namespace, host.Address, host.ID)
+			for _, version := range versions {
+				collectedAt := version.CollectedAt.Local().Format("2006-01-02 15:04:05")
+				if version.Changes == nil {
+					fmt.Printf("%s  first collected\n", collectedAt)
+					continue
+				}
+				fmt.Printf("%s  %d change(s)\n", collectedAt, len(version.Changes))
+				printFactChanges(version.Changes)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&limit, "limit", 20, "max versions to show")
+
+	return cmd
+}
+
+func newFactsDiffCommand() *cobra.Command {
+	var (
+		since     string
+		factTypes []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "diff <host>",
+		Short: "Show how the facts of a host changed",
+		Long: `Show the structural changes of the facts of a host over a period.
+
+The latest version of each fact is compared against the version that was
+current at the start of the period. Lists of named items, such as packages and
+interfaces, are compared by name.`,
+		Example: `  # What changed on web3 in the last week?
+  froyo facts diff web3 --since 7d
+
+  # Only package changes over the last day
+  froyo facts diff web3 --since 24h --type pkg.manifest`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hostID := args[0]
+
+			age, err := parseFactsAge(since)
+			if err != nil {
+				return fmt.Errorf("invalid --since: %w", err)
+			}
+			from := time.Now().Add(-age)
+
+			ctx := context.Background()
+
+			store, err := openWorkspaceStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			hostRegistry := engine.NewHostRegistry(store)
+			host, err := hostRegistry.GetHost(ctx, hostID)
+			if err != nil {
+				return fmt.Errorf("host not found: %s", hostID)
+			}
+
+			diff, err := engine.NewFactsCollector(store, hostRegistry).DiffFactsSince(ctx, hostID, from, factTypes)
+			if err != nil {
+				return err
+			}
+
+			if len(diff) == 0 {
+				fmt.Printf("No fact changes for host %s since %s.\n", hostID, from.Local().Format("2006-01-02 15:04:05"))
+				return nil
+			}
+
+			fmt.Printf("Fact changes for host: %s (%s) since %s\n", host.Address, host.ID, from.Local().Format("2006-01-02 15:04:05"))
+			for _, changes := range diff {
+				fmt.Printf("\n%s (%d change(s), last collected %s)\n", changes.Namespace, len(changes.Changes),
+					changes.To.Local().Format("2006-01-02 15:04:05"))
+				printFactChanges(changes.Changes)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&since, "since", "24h", "period to diff over (e.g. 7d, 12h)")
+	cmd.Flags().StringSliceVar(&factTypes, "type", nil, "specific fact types to diff")
+
+	return cmd
+}
+
+// printFactChanges prints fact changes, one per line: + for added values, -
+// for removed values and ~ for changed values.
+func printFactChanges(changes []engine.Change) {
+	for _, change := range changes {
+		switch change.Action {
+		case engine.ChangeActionAdd:
+			fmt.Printf("  + %s: %s\n", change.Path, formatFactValue(change.After))
+		case engine.ChangeActionRemove:
+			fmt.Printf("  - %s: %s\n", change.Path, formatFactValue(change.Before))
+		default:
+			fmt.Printf("  ~ %s: %s -> %s\n", change.Path, formatFactValue(change.Before), formatFactValue(change.After))
+		}
+	}
+}
+
+// formatFactValue formats a fact value as compact JSON, shortened to fit on
+// a line.
+func formatFactValue(value any) string {
+	const maxLen = 80
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	if len(data) > maxLen {
+		return string(data[:maxLen-3]) + "..."
+	}
+	return string(data)
+}
+
+// parseFactsAge parses a duration that may also be given in days, e.g. 7d.
+func parseFactsAge(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number of days: %s", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
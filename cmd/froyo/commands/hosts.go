@@ -0,0 +1,460 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/openfroyo/openfroyo/pkg/engine"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func newHostsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "hosts",
+		Short: "Manage the host inventory",
+		Long: `Manage the inventory of hosts froyo connects to.
+
+Hosts are added by froyo onboard, or by hand with froyo hosts add for hosts
+that are already set up. Each host has its connection settings, labels that
+selectors such as --selector env=prod match, and groups. Its status records
+whether it could be reached when its facts were last collected.`,
+	}
+
+	cmd.AddCommand(newHostsListCommand())
+	cmd.AddCommand(newHostsShowCommand())
+	cmd.AddCommand(newHostsAddCommand())
+	cmd.AddCommand(newHostsRemoveCommand())
+	cmd.AddCommand(newHostsLabelCommand())
+	cmd.AddCommand(newHostsUnlabelCommand())
+
+	return cmd
+}
+
+func newHostsListCommand() *cobra.Command {
+	var (
+		selector string
+		group    string
+		status   string
+		output   string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List hosts",
+		Example: `  # List all hosts
+  froyo hosts list
+
+  # List the production web servers
+  froyo hosts list --selector env=prod,role=web
+
+  # List the hosts of a group that could not be reached
+  froyo hosts list --group dmz --status unreachable -o json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			output, err := hostsOutputFormat(output)
+			if err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+
+			store, err := openWorkspaceStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			hostRegistry := engine.NewHostRegistry(store)
+			var hosts []*engine.Host
+			if group != "" && (selector == "" || selector == "all") {
+				hosts, err = hostRegistry.ListHostsInGroup(ctx, group)
+			} else {
+				hosts, err = hostRegistry.SelectHosts(ctx, selector)
+			}
+			if err != nil {
+				return err
+			}
+
+			filtered := make([]*engine.Host, 0, len(hosts))
+			for _, host := range hosts {
+				if group != "" && !slices.Contains(host.Groups, group) {
+					continue
+				}
+				if status != "" && string(host.Status) != status {
+					continue
+				}
+				filtered = append(filtered, host)
+			}
+
+			if output == "json" {
+				return printHostsJSON(filtered)
+			}
+
+			if len(filtered) == 0 {
+				fmt.Println("No hosts found.")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tADDRESS\tUSER\tSTATUS\tGROUPS\tLABELS")
+			for _, host := range filtered {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+					host.ID, hostAddress(host), valueOrDash(host.User), host.Status,
+					valueOrDash(strings.Join(host.Groups, ",")), valueOrDash(formatHostLabels(host.Labels)))
+			}
+			w.Flush()
+
+			fmt.Printf("\n%d host(s)\n", len(filtered))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&selector, "selector", "", "label selector, e.g. env=prod,role=web")
+	cmd.Flags().StringVar(&group, "group", "", "only hosts in this group")
+	cmd.Flags().StringVar(&status, "status", "", "only hosts with this status (active, unreachable)")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "output format: table or json")
+
+	return cmd
+}
+
+func newHostsShowCommand() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "show <host>",
+		Short: "Show the details of a host",
+		Example: `  # Show a host
+  froyo hosts show web1
+
+  # As JSON
+  froyo hosts show web1 -o json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			output, err := hostsOutputFormat(output)
+			if err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+
+			store, err := openWorkspaceStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			host, err := engine.NewHostRegistry(store).GetHost(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			if output == "json" {
+				data, err := json.MarshalIndent(host, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal host: %w", err)
+				}
+				fmt.Println(string(data))
+				return nil
+			}
+
+			onboarded := "never"
+			if !host.OnboardedAt.IsZero() {
+				onboarded = host.OnboardedAt.Local().Format(time.RFC3339)
+			}
+
+			fmt.Printf("Host:      %s\n", host.ID)
+			fmt.Printf("Address:   %s\n", hostAddress(host))
+			fmt.Printf("User:      %s\n", valueOrDash(host.User))
+			fmt.Printf("Key:       %s\n", valueOrDash(host.KeyPath))
+			fmt.Printf("Status:    %s\n", host.Status)
+			fmt.Printf("Groups:    %s\n", valueOrDash(strings.Join(host.Groups, ", ")))
+			fmt.Printf("Onboarded: %s\n", onboarded)
+			fmt.Printf("Updated:   %s\n", host.UpdatedAt.Local().Format(time.RFC3339))
+
+			fmt.Println("Labels:")
+			if len(host.Labels) == 0 {
+				fmt.Println("  -")
+			}
+			for _, key := range sortedLabelKeys(host.Labels) {
+				fmt.Printf("  %s=%s\n", key, host.Labels[key])
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "output format: table or json")
+
+	return cmd
+}
+
+func newHostsAddCommand() *cobra.Command {
+	var (
+		address string
+		port    int
+		user    string
+		keyPath string
+		labels  []string
+		groups  []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "add <host>",
+		Short: "Add a host to the inventory",
+		Long: `Add a host that is already set up to the inventory, without onboarding it.
+
+Use froyo onboard to set up a new host: it installs a key and a user for froyo
+and adds the host itself.`,
+		Example: `  # Add a host reachable with an existing key
+  froyo hosts add web1 --address 10.0.0.1 --user froyo --key ~/.ssh/froyo \
+    --label env=prod --label role=web --group frontend`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hostID := args[0]
+
+			labelMap, err := parseHostLabels(labels)
+			if err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+
+			store, err := openWorkspaceStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			hostRegistry := engine.NewHostRegistry(store)
+			_, err = hostRegistry.GetHost(ctx, hostID)
+			if err == nil {
+				return fmt.Errorf("host %s already exists", hostID)
+			}
+			if !engine.IsNotFound(err) {
+				return err
+			}
+
+			host := &engine.Host{
+				ID:      hostID,
+				Address: address,
+				Port:    port,
+				User:    user,
+				KeyPath: keyPath,
+				Labels:  labelMap,
+				Groups:  groups,
+			}
+			if err := hostRegistry.AddHost(ctx, host); err != nil {
+				return err
+			}
+
+			log.Info().Str("host", hostID).Str("address", address).Msg("Host added")
+			fmt.Printf("✓ Added host %s (%s)\n", hostID, hostAddress(host))
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&address, "address", "", "host name or IP address")
+	cmd.Flags().IntVar(&port, "port", 22, "SSH port")
+	cmd.Flags().StringVar(&user, "user", "root", "SSH user")
+	cmd.Flags().StringVar(&keyPath, "key", "", "SSH private key path")
+	cmd.Flags().StringArrayVar(&labels, "label", nil, "label as key=value (repeatable)")
+	cmd.Flags().StringSliceVar(&groups, "group", nil, "group the host belongs to (repeatable)")
+	cmd.MarkFlagRequired("address")
+
+	return cmd
+}
+
+func newHostsRemoveCommand() *cobra.Command {
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:     "rm <host>...",
+		Aliases: []string{"remove"},
+		Short:   "Remove hosts from the inventory",
+		Long: `Remove hosts from the inventory, with their cached facts.
+
+Nothing is changed on the hosts themselves.`,
+		Example: `  # Remove a decommissioned host
+  froyo hosts rm web1 --yes`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !yes {
+				return fmt.Errorf("refusing to remove %d host(s) without --yes", len(args))
+			}
+
+			ctx := context.Background()
+
+			store, err := openWorkspaceStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			hostRegistry := engine.NewHostRegistry(store)
+			for _, hostID := range args {
+				if _, err := hostRegistry.GetHost(ctx, hostID); err != nil {
+					return err
+				}
+				if err := hostRegistry.DeleteHost(ctx, hostID); err != nil {
+					return err
+				}
+				fmt.Printf("✓ Removed host %s\n", hostID)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&yes, "yes", false, "confirm removing the hosts")
+
+	return cmd
+}
+
+func newHostsLabelCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "label <host> <key=value>...",
+		Short: "Set labels on a host",
+		Example: `  # Move a host to production
+  froyo hosts label web1 env=prod tier=1`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			labels, err := parseHostLabels(args[1:])
+			if err != nil {
+				return err
+			}
+
+			return updateHostLabels(args[0], func(hostLabels map[string]string) {
+				for key, value := range labels {
+					hostLabels[key] = value
+				}
+			})
+		},
+	}
+
+	return cmd
+}
+
+func newHostsUnlabelCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unlabel <host> <key>...",
+		Short: "Remove labels from a host",
+		Example: `  # Remove the tier label
+  froyo hosts unlabel web1 tier`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return updateHostLabels(args[0], func(hostLabels map[string]string) {
+				for _, key := range args[1:] {
+					delete(hostLabels, key)
+				}
+			})
+		},
+	}
+
+	return cmd
+}
+
+// updateHostLabels applies a change to the labels of a host and prints them.
+func updateHostLabels(hostID string, change func(map[string]string)) error {
+	ctx := context.Background()
+
+	store, err := openWorkspaceStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	hostRegistry := engine.NewHostRegistry(store)
+	host, err := hostRegistry.GetHost(ctx, hostID)
+	if err != nil {
+		return err
+	}
+
+	if host.Labels == nil {
+		host.Labels = make(map[string]string)
+	}
+	change(host.Labels)
+
+	if err := hostRegistry.UpdateHost(ctx, host); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Labels of %s: %s\n", hostID, valueOrDash(formatHostLabels(host.Labels)))
+	return nil
+}
+
+// hostsOutputFormat validates an --output format, forced to json by --json.
+func hostsOutputFormat(output string) (string, error) {
+	if jsonOutput {
+		return "json", nil
+	}
+	switch output {
+	case "table", "json":
+		return output, nil
+	default:
+		return "", fmt.Errorf("invalid --output %q: use table or json", output)
+	}
+}
+
+// printHostsJSON prints hosts as a JSON array.
+func printHostsJSON(hosts []*engine.Host) error {
+	data, err := json.MarshalIndent(hosts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal hosts: %w", err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// parseHostLabels parses key=value labels.
+func parseHostLabels(args []string) (map[string]string, error) {
+	labels := make(map[string]string, len(args))
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label %q: use key=value", arg)
+		}
+		labels[key] = strings.TrimSpace(value)
+	}
+	return labels, nil
+}
+
+// formatHostLabels formats labels as sorted key=value pairs.
+func formatHostLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, key := range sortedLabelKeys(labels) {
+		pairs = append(pairs, key+"="+labels[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// sortedLabelKeys returns the keys of labels in order.
+func sortedLabelKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// hostAddress formats the address of a host with its port.
+func hostAddress(host *engine.Host) string {
+	return fmt.Sprintf("%s:%d", host.Address, host.Port)
+}
+
+// valueOrDash returns the value, or "-" when it is empty.
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,204 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/openfroyo/openfroyo/pkg/engine"
+	"github.com/openfroyo/openfroyo/pkg/stores"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func newLockCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Inspect and manage the workspace lock",
+		Long: `Inspect and manage the workspace lock.
+
+plan, apply and drift reconcile hold a lock on the workspace while they run, so
+two operators cannot change the same workspace at the same time. The lock is
+kept alive by a heartbeat and expires on its own when its holder stops renewing
+it, for example after a crash.`,
+	}
+
+	cmd.AddCommand(newLockStatusCommand())
+	cmd.AddCommand(newLockForceUnlockCommand())
+
+	return cmd
+}
+
+func newLockStatusCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show who holds the workspace lock",
+		Example: `  # Show the lock of the default workspace
+  froyo lock status
+
+  # Show the lock of another workspace
+  froyo lock status --workspace prod`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			store, err := openWorkspaceStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			lock, err := engine.NewWorkspaceLocker(store, 0).Status(ctx, workspace)
+			if err != nil {
+				return err
+			}
+
+			if lock == nil {
+				fmt.Printf("Workspace %s is not locked\n", workspace)
+				return nil
+			}
+
+			fmt.Println(engine.DescribeWorkspaceLock(lock))
+			fmt.Printf("  Lock ID:        %s\n", lock.LockID)
+			fmt.Printf("  Last heartbeat: %s\n", lock.HeartbeatAt.Local().Format(time.RFC3339))
+
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func newLockForceUnlockCommand() *cobra.Command {
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "force-unlock",
+		Short: "Remove the workspace lock regardless of its holder",
+		Long: `Remove the workspace lock regardless of its holder.
+
+Only use this when the holder is known to be gone and you cannot wait for the
+lease to expire. A holder that is still running loses the lock on its next
+heartbeat and reports it when it finishes.`,
+		Example: `  # Remove a stale lock after confirming the holder has stopped
+  froyo lock force-unlock --yes`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			if !yes {
+				return fmt.Errorf("refusing to force-unlock workspace %s without --yes", workspace)
+			}
+
+			store, err := openWorkspaceStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			lock, err := engine.NewWorkspaceLocker(store, 0).ForceUnlock(ctx, workspace)
+			if err != nil {
+				return err
+			}
+
+			log.Warn().
+				Str("workspace", workspace).
+				Str("owner", lock.Owner).
+				Str("operation", lock.Operation).
+				Msg("Workspace lock force-released")
+
+			fmt.Printf("✓ Removed lock on workspace %s held by %s for %s\n",
+				workspace, lock.Owner, lock.Operation)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&yes, "yes", false, "confirm removing the lock")
+
+	return cmd
+}
+
+// openWorkspaceStore opens and migrates the state store of the workspace.
+func openWorkspaceStore(ctx context.Context) (*stores.SQLiteStore, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	dataDir := "./data"
+	if configPath != "" {
+		dataDir = filepath.Join(filepath.Dir(configPath), "data")
+	}
+
+	store, err := stores.NewSQLiteStore(stores.Config{
+		Path: filepath.Join(dataDir, "openfroyo.db"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create store: %w", err)
+	}
+
+	if err := store.Init(ctx); err != nil {
+		return nil, fmt.Errorf("failed to initialize store: %w", err)
+	}
+
+	if err := store.Migrate(ctx); err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	}
+
+	return store, nil
+}
+
+// lockWorkspace acquires the workspace lock for an operation and returns a
+// function that releases it and closes the store. The command's context is
+// replaced by one that is cancelled when the lock is lost, so the operation
+// must run under cmd.Context() taken after locking.
+func lockWorkspace(cmd *cobra.Command, operation, reason string) (func(), error) {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	store, err := openWorkspaceStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	leaseCtx, lease, err := engine.NewWorkspaceLocker(store, 0).Acquire(ctx, workspace, lockOwner(), operation, reason)
+	if err != nil {
+		store.Close()
+		var engineErr *engine.EngineError
+		if errors.As(err, &engineErr) && engine.IsConflict(err) {
+			return nil, fmt.Errorf("%s; wait for it to finish, or run 'froyo lock force-unlock --yes' if the holder is gone",
+				engineErr.Message)
+		}
+		return nil, err
+	}
+
+	release := func() {
+		if err := lease.Release(context.Background()); err != nil {
+			log.Error().Err(err).Str("workspace", workspace).Msg("Failed to release workspace lock")
+		}
+		store.Close()
+	}
+	cmd.SetContext(leaseCtx)
+
+	return release, nil
+}
+
+// lockOwner identifies the operator holding a lock as user@host.
+func lockOwner() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return name + "@" + host
+}
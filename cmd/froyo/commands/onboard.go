@@ -7,7 +7,6 @@ import (
 	"strings"
 
 	"github.com/openfroyo/openfroyo/pkg/engine"
-	"github.com/openfroyo/openfroyo/pkg/stores"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
@@ -93,17 +92,10 @@ This command:
 				dataDir = filepath.Join(filepath.Dir(configPath), "data")
 			}
 
-			// Initialize store
-			dbPath := filepath.Join(dataDir, "openfroyo.db")
-			store, err := stores.NewSQLiteStore(stores.Config{
-				Path: dbPath,
-			})
+			// Migrated so the host can be registered in the inventory
+			store, err := openWorkspaceStore(ctx)
 			if err != nil {
-				return fmt.Errorf("failed to create store: %w", err)
-			}
-
-			if err := store.Init(ctx); err != nil {
-				return fmt.Errorf("failed to initialize store: %w", err)
+				return err
 			}
 			defer store.Close()
 
@@ -12,8 +12,10 @@ func newPlanCommand() *cobra.Command {
 		outFile    string
 		dotFile    string
 		targets    []string
+		where      string
 		refresh    bool
 		noRefresh  bool
+		lockReason string
 	)
 
 	cmd := &cobra.Command{
@@ -35,9 +37,21 @@ The plan:
   # Plan for specific targets only
   froyo plan --out plan.json --target host1 --target host2
 
+  # Plan for the Ubuntu hosts with less than 4 GB of memory (see froyo facts query)
+  froyo plan --out plan.json --where 'hw.memory.total_mb < 4096 && os.basic.distro == "ubuntu"'
+
   # Plan without refreshing facts (use cached)
   froyo plan --out plan.json --no-refresh`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			// Resolve the fact query against the cached facts, within --target
+			if where != "" {
+				hosts, err := targetsWhere(cmd.Context(), targets, where)
+				if err != nil {
+					return err
+				}
+				targets = hosts
+			}
+
 			log.Info().
 				Str("out", outFile).
 				Str("dot", dotFile).
@@ -45,14 +59,26 @@ The plan:
 				Bool("refresh", refresh && !noRefresh).
 				Msg("Generating plan")
 
+			unlock, err := lockWorkspace(cmd, "plan", lockReason)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
 			// TODO: Implement planning
-			// - Load and evaluate CUE configs
+			// - Load and evaluate CUE configs, per host for configs reading facts
+			//   (config.CUEParser.EvaluateForHost with the host's cached facts)
 			// - Collect facts (unless --no-refresh)
+			// - Expand resource targets over the host inventory
+			//   (engine.DefaultPlanner.SetHosts with engine.NewHostRegistry)
+			// - Evaluate resource `when` conditions against cached facts
+			//   (engine.DefaultPlanner.SetConditionEvaluator with config.NewConditionEvaluator)
 			// - Compute diffs (desired vs actual)
 			// - Build DAG respecting dependencies
 			// - Validate DAG (no cycles)
 			// - Persist plan to outFile (JSON)
 			// - Generate DOT graph if requested
+			// - List resources skipped by condition alongside the changes
 
 			fmt.Println("Not implemented yet: plan generation")
 			fmt.Printf("Would create plan: out=%s, dot=%s, targets=%v, refresh=%v\n",
@@ -65,8 +91,10 @@ The plan:
 	cmd.Flags().StringVarP(&outFile, "out", "o", "plan.json", "output plan file path")
 	cmd.Flags().StringVar(&dotFile, "dot", "", "output DOT graph file (optional)")
 	cmd.Flags().StringSliceVarP(&targets, "target", "t", nil, "limit plan to specific targets")
+	cmd.Flags().StringVar(&where, "where", "", "limit plan to hosts whose cached facts match a query expression")
 	cmd.Flags().BoolVar(&refresh, "refresh", true, "refresh facts before planning")
 	cmd.Flags().BoolVar(&noRefresh, "no-refresh", false, "skip facts refresh (use cached)")
+	cmd.Flags().StringVar(&lockReason, "lock-reason", "", "reason recorded on the workspace lock")
 	cmd.MarkFlagRequired("out")
 
 	return cmd
@@ -12,6 +12,7 @@ var (
 	configPath string
 	verbose    bool
 	jsonOutput bool
+	workspace  string
 )
 
 // Execute runs the root command
@@ -41,6 +42,7 @@ Features:
 	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "", "config file path")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "enable verbose output")
 	rootCmd.PersistentFlags().BoolVar(&jsonOutput, "json", false, "output in JSON format")
+	rootCmd.PersistentFlags().StringVar(&workspace, "workspace", "default", "workspace name used for run locking")
 
 	// Add subcommands
 	rootCmd.AddCommand(newInitCommand())
@@ -48,12 +50,16 @@ Features:
 	rootCmd.AddCommand(newPlanCommand())
 	rootCmd.AddCommand(newApplyCommand())
 	rootCmd.AddCommand(newRunCommand())
+	rootCmd.AddCommand(newRunsCommand())
+	rootCmd.AddCommand(newLockCommand())
+	rootCmd.AddCommand(newStateCommand())
 	rootCmd.AddCommand(newDriftCommand())
 	rootCmd.AddCommand(newOnboardCommand())
 	rootCmd.AddCommand(newBackupCommand())
 	rootCmd.AddCommand(newRestoreCommand())
 	rootCmd.AddCommand(newDevCommand())
 	rootCmd.AddCommand(newFactsCommand())
+	rootCmd.AddCommand(newHostsCommand())
 
 	return rootCmd
 }
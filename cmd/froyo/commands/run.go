@@ -12,6 +12,7 @@ func newRunCommand() *cobra.Command {
 		params    []string
 		extraVars map[string]string
 		targets   []string
+		where     string
 	)
 
 	cmd := &cobra.Command{
@@ -32,6 +33,9 @@ Runbooks are sequences of actions with conditional logic.`,
   # Run action on specific targets
   froyo run health-check --target web1 --target web2
 
+  # Run action on the hosts whose cached facts match a query (see froyo facts query)
+  froyo run apt-upgrade --where 'os.basic.distro == "ubuntu"'
+
   # Run action with parameters
   froyo run deploy --param version=1.2.3 --param env=production
 
@@ -41,6 +45,15 @@ Runbooks are sequences of actions with conditional logic.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			action := args[0]
 
+			// Resolve the fact query against the cached facts, within --target
+			if where != "" {
+				hosts, err := targetsWhere(cmd.Context(), targets, where)
+				if err != nil {
+					return err
+				}
+				targets = hosts
+			}
+
 			log.Info().
 				Str("action", action).
 				Strs("params", params).
@@ -67,6 +80,7 @@ Runbooks are sequences of actions with conditional logic.`,
 	cmd.Flags().StringSliceVarP(&params, "param", "p", nil, "action parameters (key=value)")
 	cmd.Flags().StringToStringVarP(&extraVars, "extra-vars", "e", nil, "extra variables")
 	cmd.Flags().StringSliceVarP(&targets, "target", "t", nil, "target hosts/groups")
+	cmd.Flags().StringVar(&where, "where", "", "target hosts whose cached facts match a query expression")
 
 	return cmd
 }
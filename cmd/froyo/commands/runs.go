@@ -0,0 +1,85 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/openfroyo/openfroyo/pkg/engine"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func newRunsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "runs",
+		Short: "Inspect and manage plan runs",
+		Long: `Inspect and manage the runs created by froyo apply.
+
+Each run records the plan it executed and the result of every operation,
+which is what allows a finished run to be rolled back.`,
+	}
+
+	cmd.AddCommand(newRunsRollbackCommand())
+
+	return cmd
+}
+
+func newRunsRollbackCommand() *cobra.Command {
+	var (
+		autoApprove bool
+		parallelism int
+		dryRun      bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "rollback <run-id>",
+		Short: "Roll back a finished run",
+		Long: `Execute the compensating plan of a finished run.
+
+The rollback plan is built from the state captured before the run for every
+operation that succeeded and changed something:
+  - Updated resources get their previous state re-applied
+  - Created resources are deleted
+  - Deleted resources are recreated
+
+Operations are undone in reverse dependency order. A run can only be rolled
+back once.`,
+		Example: `  # Roll back a failed run
+  froyo runs rollback 4f1c2b7e-0d3a-4c5e-9a1b-2e8f6d7c9b10
+
+  # Show what would be rolled back
+  froyo runs rollback 4f1c2b7e-0d3a-4c5e-9a1b-2e8f6d7c9b10 --dry-run`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runID := args[0]
+
+			opts := engine.ScheduleOptions{
+				MaxParallel: parallelism,
+				DryRun:      dryRun,
+			}
+
+			log.Info().
+				Str("run", runID).
+				Bool("auto_approve", autoApprove).
+				Interface("options", opts).
+				Msg("Rolling back run")
+
+			// TODO: Implement rollback
+			// - Open the state store for the workspace
+			// - Show the plan from engine.BuildRollbackPlan and prompt for approval
+			//   (unless auto-approve)
+			// - Execute it with ParallelScheduler.Rollback and stream events
+
+			fmt.Println("Not implemented yet: run rollback")
+			fmt.Printf("Would roll back run=%s, parallelism=%d, dry_run=%v\n",
+				runID, parallelism, dryRun)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&autoApprove, "auto-approve", false, "skip approval prompt")
+	cmd.Flags().IntVar(&parallelism, "parallelism", 10, "max parallel operations")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "simulate the rollback without making changes")
+
+	return cmd
+}
@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/openfroyo/openfroyo/pkg/engine"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func newStateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "state",
+		Short: "Inspect and modify recorded resource state",
+		Long: `Inspect and modify the resource state recorded by apply.
+
+Resource addresses name a resource ("users") or one of its for_each
+instances ("users[alice]").`,
+	}
+
+	cmd.AddCommand(newStateMvCommand())
+
+	return cmd
+}
+
+func newStateMvCommand() *cobra.Command {
+	var resourceType string
+
+	cmd := &cobra.Command{
+		Use:   "mv <from> <to>",
+		Short: "Move resource state to a new address",
+		Long: `Move the recorded state of a resource to a new address.
+
+Use this after renaming a resource or changing its for_each keys, so the
+next plan adopts the existing state instead of destroying and recreating it.
+
+Moving an instance moves only that instance. Moving a whole resource also
+moves each of its for_each instances, keeping their keys. Nothing is moved
+if any destination already has state.`,
+		Example: `  # Re-key an instance after switching for_each from a list index to a name
+  froyo state mv --type linux.user 'users[0]' 'users[alice]'
+
+  # Rename a resource together with all of its instances
+  froyo state mv --type linux.user users accounts
+
+  # Move a standalone resource into a for_each
+  froyo state mv --type linux.user alice 'users[alice]'`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			from, to := args[0], args[1]
+
+			log.Info().
+				Str("type", resourceType).
+				Str("from", from).
+				Str("to", to).
+				Msg("Moving resource state")
+
+			unlock, err := lockWorkspace(cmd, "state-mv", fmt.Sprintf("%s -> %s", from, to))
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			// Move under the lock's context, which is cancelled if the lock is lost
+			ctx := cmd.Context()
+
+			store, err := openWorkspaceStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			moves, err := engine.MoveResourceState(ctx, store, resourceType, from, to)
+			if err != nil {
+				return err
+			}
+			for _, move := range moves {
+				fmt.Printf("✓ Moved %s to %s\n", move.From, move.To)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&resourceType, "type", "", "resource type of the state to move (e.g., linux.user)")
+	cmd.MarkFlagRequired("type")
+
+	return cmd
+}
@@ -88,13 +88,16 @@ func (r *runner) sendReady() error {
 		Arch:     runtime.GOARCH,
 		PID:      os.Getpid(),
 		Caps: map[string]bool{
-			"exec":            true,
-			"file.write":      true,
-			"file.read":       true,
-			"pkg.ensure":      true,
-			"service.reload":  true,
-			"sudoers.ensure":  true,
-			"sshd.harden":     true,
+			"exec":           true,
+			"file.write":     true,
+			"file.read":      true,
+			"pkg.ensure":     true,
+			"service.reload": true,
+			"sudoers.ensure": true,
+			"sshd.harden":    true,
+			"http.probe":     true,
+			"port.probe":     true,
+			"facts.gather":   true,
 		},
 		Metadata: map[string]string{
 			"ttl": ttl.String(),
@@ -238,6 +241,42 @@ func (r *runner) handleCommand(ctx context.Context, cmd *protocol.CommandMessage
 		}
 		return json.Marshal(result)
 
+	case protocol.CommandTypeHTTPProbe:
+		var params protocol.HTTPProbeParams
+		if err := protocol.ParseParams(cmd.Params, &params); err != nil {
+			return nil, err
+		}
+		handler := &handlers.HTTPProbeHandler{}
+		result, err := handler.Handle(ctx, &params, eventCh)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(result)
+
+	case protocol.CommandTypePortProbe:
+		var params protocol.PortProbeParams
+		if err := protocol.ParseParams(cmd.Params, &params); err != nil {
+			return nil, err
+		}
+		handler := &handlers.PortProbeHandler{}
+		result, err := handler.Handle(ctx, &params, eventCh)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(result)
+
+	case protocol.CommandTypeFactsGather:
+		var params protocol.FactsGatherParams
+		if err := protocol.ParseParams(cmd.Params, &params); err != nil {
+			return nil, err
+		}
+		handler := &handlers.FactsGatherHandler{}
+		result, err := handler.Handle(ctx, &params, eventCh)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(result)
+
 	default:
 		return nil, fmt.Errorf("unsupported command type: %s", cmd.Type)
 	}
@@ -0,0 +1,195 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"cuelang.org/go/cue/parser"
+	"github.com/openfroyo/openfroyo/pkg/engine"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+// maxConditionSteps bounds the work a Starlark condition may do.
+const maxConditionSteps = 100000
+
+// ConditionEvaluator evaluates resource when conditions against host facts.
+// It implements engine.ConditionEvaluator.
+//
+// Fact namespaces are exposed as nested fields: the "os.basic" namespace is
+// read as os.basic in both Starlark and CUE expressions.
+type ConditionEvaluator struct {
+	// mu serializes use of the CUE context, which is not safe for concurrent use
+	mu  sync.Mutex
+	ctx *cue.Context
+}
+
+// NewConditionEvaluator creates a new condition evaluator.
+func NewConditionEvaluator() *ConditionEvaluator {
+	return &ConditionEvaluator{
+		ctx: cuecontext.New(),
+	}
+}
+
+// Compile checks that the condition is valid and its expression parses.
+func (ce *ConditionEvaluator) Compile(condition *engine.Condition) error {
+	if err := condition.Validate(); err != nil {
+		return err
+	}
+
+	switch condition.Language {
+	case engine.ConditionLanguageCUE:
+		if _, err := parser.ParseExpr("when", condition.Expression); err != nil {
+			return fmt.Errorf("failed to parse CUE expression: %w", err)
+		}
+	default:
+		if _, err := syntax.ParseExpr("when", condition.Expression, 0); err != nil {
+			return fmt.Errorf("failed to parse Starlark expression: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// EvaluateCondition reports whether the condition holds for the given facts,
+// keyed by namespace. The expression must evaluate to a boolean.
+func (ce *ConditionEvaluator) EvaluateCondition(
+	ctx context.Context,
+	condition *engine.Condition,
+	facts map[string]interface{},
+) (bool, error) {
+	if err := ce.Compile(condition); err != nil {
+		return false, err
+	}
+
+	env := nestFacts(facts)
+
+	if condition.Language == engine.ConditionLanguageCUE {
+		return ce.evaluateCUE(condition.Expression, env)
+	}
+	return ce.evaluateStarlark(ctx, condition.Expression, env)
+}
+
+// evaluateStarlark evaluates a Starlark expression with the facts as globals.
+func (ce *ConditionEvaluator) evaluateStarlark(ctx context.Context, expr string, facts map[string]interface{}) (bool, error) {
+	env := make(starlark.StringDict, len(facts))
+	for key, val := range facts {
+		starlarkVal, err := toStarlarkFact(val)
+		if err != nil {
+			return false, fmt.Errorf("failed to convert fact %s: %w", key, err)
+		}
+		env[key] = starlarkVal
+	}
+
+	thread := &starlark.Thread{
+		Name:  "when",
+		Print: func(_ *starlark.Thread, msg string) {},
+	}
+	thread.SetMaxExecutionSteps(maxConditionSteps)
+
+	// Stop the evaluation when the context is cancelled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			thread.Cancel(ctx.Err().Error())
+		case <-done:
+		}
+	}()
+
+	result, err := starlark.Eval(thread, "when", expr, env)
+	if err != nil {
+		return false, fmt.Errorf("starlark evaluation failed: %w", err)
+	}
+
+	holds, ok := result.(starlark.Bool)
+	if !ok {
+		return false, fmt.Errorf("condition must evaluate to a boolean, got %s", result.Type())
+	}
+
+	return bool(holds), nil
+}
+
+// evaluateCUE evaluates a CUE expression in the scope of the facts.
+func (ce *ConditionEvaluator) evaluateCUE(expr string, facts map[string]interface{}) (bool, error) {
+	data, err := json.Marshal(facts)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal facts: %w", err)
+	}
+
+	ce.mu.Lock()
+	defer ce.mu.Unlock()
+
+	scope := ce.ctx.CompileBytes(data)
+	if err := scope.Err(); err != nil {
+		return false, fmt.Errorf("failed to compile facts: %w", err)
+	}
+
+	result := ce.ctx.CompileString(expr, cue.Scope(scope), cue.InferBuiltins(true))
+	if err := result.Err(); err != nil {
+		return false, fmt.Errorf("cue evaluation failed: %w", err)
+	}
+
+	holds, err := result.Bool()
+	if err != nil {
+		return false, fmt.Errorf("condition must evaluate to a boolean: %w", err)
+	}
+
+	return holds, nil
+}
+
+// nestFacts turns facts keyed by dotted namespace into nested maps, so that
+// {"os.basic": {...}} becomes {"os": {"basic": {...}}}.
+func nestFacts(facts map[string]interface{}) map[string]interface{} {
+	nested := make(map[string]interface{})
+	for namespace, data := range facts {
+		parts := strings.Split(namespace, ".")
+		node := nested
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := node[part].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				node[part] = child
+			}
+			node = child
+		}
+		node[parts[len(parts)-1]] = data
+	}
+	return nested
+}
+
+// toStarlarkFact converts fact data to a Starlark value. Objects become
+// structs so that their fields can be read with dot notation.
+func toStarlarkFact(v interface{}) (starlark.Value, error) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		fields := make(starlark.StringDict, len(val))
+		for k, item := range val {
+			field, err := toStarlarkFact(item)
+			if err != nil {
+				return nil, err
+			}
+			fields[k] = field
+		}
+		return starlarkstruct.FromStringDict(starlarkstruct.Default, fields), nil
+	case []interface{}:
+		list := make([]starlark.Value, len(val))
+		for i, item := range val {
+			elem, err := toStarlarkFact(item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = elem
+		}
+		return starlark.NewList(list), nil
+	default:
+		return toStarlarkValue(v)
+	}
+}
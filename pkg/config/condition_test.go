@@ -0,0 +1,78 @@
+package config
+
+import (
+	"context"
+	"testing"
+
+	"github.com/openfroyo/openfroyo/pkg/engine"
+)
+
+func TestConditionEvaluator_EvaluateCondition(t *testing.T) {
+	evaluator := NewConditionEvaluator()
+	ctx := context.Background()
+
+	facts := map[string]interface{}{
+		"os.basic": map[string]interface{}{
+			"distro": "rhel",
+			"arch":   "x86_64",
+		},
+		"hw.cpu": map[string]interface{}{
+			"cores": float64(8),
+		},
+	}
+
+	tests := []struct {
+		name     string
+		language engine.ConditionLanguage
+		expr     string
+		want     bool
+		wantErr  bool
+	}{
+		{"starlark equality", engine.ConditionLanguageStarlark, `os.basic.distro == "rhel"`, true, false},
+		{"starlark default language", "", `os.basic.distro == "debian"`, false, false},
+		{"starlark numeric", "", `hw.cpu.cores >= 4 and os.basic.arch == "x86_64"`, true, false},
+		{"starlark hasattr", "", `hasattr(os.basic, "kernel")`, false, false},
+		{"starlark missing fact", "", `os.basic.kernel == "6.1"`, false, true},
+		{"starlark non-boolean", "", `os.basic.distro`, false, true},
+		{"cue equality", engine.ConditionLanguageCUE, `os.basic.distro == "rhel"`, true, false},
+		{"cue numeric", engine.ConditionLanguageCUE, `hw.cpu.cores > 16`, false, false},
+		{"cue non-boolean", engine.ConditionLanguageCUE, `os.basic.distro`, false, true},
+		{"invalid syntax", "", `os.basic.distro ==`, false, true},
+		{"unknown language", "rego", `true`, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := evaluator.EvaluateCondition(ctx, &engine.Condition{
+				Expression: tt.expr,
+				Language:   tt.language,
+			}, facts)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EvaluateCondition() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("EvaluateCondition() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNestFacts(t *testing.T) {
+	nested := nestFacts(map[string]interface{}{
+		"os.basic":  map[string]interface{}{"distro": "rhel"},
+		"hw.cpu":    map[string]interface{}{"cores": float64(2)},
+		"hw.memory": map[string]interface{}{"total_mb": float64(2048)},
+	})
+
+	hw, ok := nested["hw"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected hw namespace, got %v", nested)
+	}
+	if _, ok := hw["cpu"]; !ok {
+		t.Error("Expected hw.cpu to be nested under hw")
+	}
+	if _, ok := hw["memory"]; !ok {
+		t.Error("Expected hw.memory to be nested under hw")
+	}
+}
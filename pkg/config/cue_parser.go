@@ -19,19 +19,21 @@ import (
 
 // CUEParser parses and validates CUE configuration files.
 type CUEParser struct {
-	ctx              *cue.Context
-	schemaRegistry   *SchemaRegistry
-	starlarkEvaluator *StarlarkEvaluator
-	validator        *validator.Validate
+	ctx                *cue.Context
+	schemaRegistry     *SchemaRegistry
+	starlarkEvaluator  *StarlarkEvaluator
+	conditionEvaluator *ConditionEvaluator
+	validator          *validator.Validate
 }
 
 // NewCUEParser creates a new CUE parser.
 func NewCUEParser() *CUEParser {
 	return &CUEParser{
-		ctx:              cuecontext.New(),
-		schemaRegistry:   NewSchemaRegistry(),
-		starlarkEvaluator: NewStarlarkEvaluator(30 * time.Second),
-		validator:        validator.New(),
+		ctx:                cuecontext.New(),
+		schemaRegistry:     NewSchemaRegistry(),
+		starlarkEvaluator:  NewStarlarkEvaluator(30 * time.Second),
+		conditionEvaluator: NewConditionEvaluator(),
+		validator:          validator.New(),
 	}
 }
 
@@ -50,7 +52,23 @@ func (cp *CUEParser) Evaluate(ctx context.Context, sources []string) (*engine.Co
 	}
 
 	// Convert to engine.Config
-	return parsedConfig.ToEngineConfig(), nil
+	return parsedConfig.ToEngineConfig()
+}
+
+// EvaluateForHost parses CUE configuration files for a single host, with the
+// host's facts keyed by namespace exposed as the facts value.
+// This implements the engine.HostEvaluator interface.
+func (cp *CUEParser) EvaluateForHost(ctx context.Context, sources []string, facts map[string]interface{}) (*engine.Config, error) {
+	parsedConfig, err := cp.ParseForHost(ctx, sources, facts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(parsedConfig.Errors) > 0 {
+		return nil, fmt.Errorf("validation errors: %v", parsedConfig.Errors)
+	}
+
+	return parsedConfig.ToEngineConfig()
 }
 
 // Validate validates a configuration against schemas and policies.
@@ -90,6 +108,22 @@ func (cp *CUEParser) EvaluateStarlark(ctx context.Context, script string, input
 	return result.Output, nil
 }
 
+// EvaluateStarlarkForHost executes a Starlark script for a single host, with
+// the host's facts available through the facts() built-in.
+// This implements the engine.HostEvaluator interface.
+func (cp *CUEParser) EvaluateStarlarkForHost(ctx context.Context, script string, input, facts map[string]interface{}) (map[string]interface{}, error) {
+	result, err := cp.starlarkEvaluator.EvaluateWithFacts(ctx, script, input, facts)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Error != "" {
+		return nil, fmt.Errorf("starlark error: %s", result.Error)
+	}
+
+	return result.Output, nil
+}
+
 // MergeConfigs merges multiple configurations into a single configuration.
 // This implements the engine.Evaluator interface.
 func (cp *CUEParser) MergeConfigs(ctx context.Context, configs []*engine.Config) (*engine.Config, error) {
@@ -145,6 +179,39 @@ func (cp *CUEParser) MergeConfigs(ctx context.Context, configs []*engine.Config)
 
 // Parse parses CUE configuration from the given sources.
 func (cp *CUEParser) Parse(ctx context.Context, sources []string) (*ParsedConfig, error) {
+	return cp.parse(sources)
+}
+
+// ParseForHost parses CUE configuration from the given sources for a single
+// host. The host's facts, keyed by namespace, are exposed as the facts value
+// with namespaces as nested fields, so that a configuration can read
+// facts.os.basic.distro or facts.hw.memory.total_mb. Configurations reading
+// facts can only be parsed this way.
+func (cp *CUEParser) ParseForHost(ctx context.Context, sources []string, facts map[string]interface{}) (*ParsedConfig, error) {
+	scope, err := cp.factsScope(facts)
+	if err != nil {
+		return nil, err
+	}
+	return cp.parse(sources, cue.Scope(scope))
+}
+
+// factsScope compiles the facts into a scope resolving the facts identifier.
+func (cp *CUEParser) factsScope(facts map[string]interface{}) (cue.Value, error) {
+	data, err := json.Marshal(map[string]interface{}{"facts": nestFacts(facts)})
+	if err != nil {
+		return cue.Value{}, fmt.Errorf("failed to marshal facts: %w", err)
+	}
+
+	scope := cp.ctx.CompileBytes(data)
+	if err := scope.Err(); err != nil {
+		return cue.Value{}, fmt.Errorf("failed to compile facts: %w", err)
+	}
+	return scope, nil
+}
+
+// parse parses CUE configuration from the given sources, building them with
+// the given options.
+func (cp *CUEParser) parse(sources []string, options ...cue.BuildOption) (*ParsedConfig, error) {
 	if len(sources) == 0 {
 		return nil, fmt.Errorf("no sources provided")
 	}
@@ -162,7 +229,7 @@ func (cp *CUEParser) Parse(ctx context.Context, sources []string) (*ParsedConfig
 
 		if info.IsDir() {
 			// Load directory as CUE package
-			val, files, errs := cp.loadDirectory(source)
+			val, files, errs := cp.loadDirectory(source, options...)
 			if len(errs) > 0 {
 				parseErrors = append(parseErrors, errs...)
 			}
@@ -176,7 +243,7 @@ func (cp *CUEParser) Parse(ctx context.Context, sources []string) (*ParsedConfig
 			sourceFiles = append(sourceFiles, files...)
 		} else {
 			// Load single file
-			val, errs := cp.loadFile(source)
+			val, errs := cp.loadFile(source, options...)
 			if len(errs) > 0 {
 				parseErrors = append(parseErrors, errs...)
 			}
@@ -220,7 +287,7 @@ func (cp *CUEParser) Parse(ctx context.Context, sources []string) (*ParsedConfig
 }
 
 // loadDirectory loads a directory as a CUE package.
-func (cp *CUEParser) loadDirectory(dir string) (cue.Value, []string, []ValidationError) {
+func (cp *CUEParser) loadDirectory(dir string, options ...cue.BuildOption) (cue.Value, []string, []ValidationError) {
 	// Load the package
 	buildInstances := load.Instances([]string{dir}, nil)
 	if len(buildInstances) == 0 {
@@ -236,7 +303,7 @@ func (cp *CUEParser) loadDirectory(dir string) (cue.Value, []string, []Validatio
 		return cue.Value{}, nil, cp.convertCUEErrors(inst.Err)
 	}
 
-	val := cp.ctx.BuildInstance(inst)
+	val := cp.ctx.BuildInstance(inst, options...)
 	if err := val.Err(); err != nil {
 		return cue.Value{}, nil, cp.convertCUEErrors(err)
 	}
@@ -253,7 +320,7 @@ func (cp *CUEParser) loadDirectory(dir string) (cue.Value, []string, []Validatio
 }
 
 // loadFile loads a single CUE file.
-func (cp *CUEParser) loadFile(path string) (cue.Value, []ValidationError) {
+func (cp *CUEParser) loadFile(path string, options ...cue.BuildOption) (cue.Value, []ValidationError) {
 	content, err := os.ReadFile(path)
 	if err != nil {
 		return cue.Value{}, []ValidationError{{
@@ -263,7 +330,7 @@ func (cp *CUEParser) loadFile(path string) (cue.Value, []ValidationError) {
 		}}
 	}
 
-	val := cp.ctx.CompileString(string(content), cue.Filename(path))
+	val := cp.ctx.CompileString(string(content), append([]cue.BuildOption{cue.Filename(path)}, options...)...)
 	if err := val.Err(); err != nil {
 		return cue.Value{}, cp.convertCUEErrors(err)
 	}
@@ -291,6 +358,54 @@ func (cp *CUEParser) extractConfig(val cue.Value, sourceFiles []string) (*Parsed
 		} else {
 			parsedConfig.Workspace = workspace
 		}
+
+		// Validate workspace checks
+		for i := range workspace.Checks {
+			if err := cp.validateCheck(&workspace.Checks[i]); err != nil {
+				parsedConfig.Errors = append(parsedConfig.Errors, ValidationError{
+					Path:     fmt.Sprintf("workspace.checks[%d]", i),
+					Message:  err.Error(),
+					Severity: "error",
+				})
+			}
+		}
+
+		// Validate workspace hooks
+		if hooks := workspace.Hooks; hooks != nil {
+			for _, event := range []struct {
+				name  string
+				hooks []HookConfig
+			}{
+				{"before_run", hooks.BeforeRun},
+				{"after_run", hooks.AfterRun},
+				{"before_batch", hooks.BeforeBatch},
+				{"after_batch", hooks.AfterBatch},
+			} {
+				for i := range event.hooks {
+					if err := cp.validateHook(&event.hooks[i]); err != nil {
+						parsedConfig.Errors = append(parsedConfig.Errors, ValidationError{
+							Path:     fmt.Sprintf("workspace.hooks.%s[%d]", event.name, i),
+							Message:  err.Error(),
+							Severity: "error",
+						})
+					}
+				}
+			}
+		}
+
+		// Validate provider retry blocks
+		for i, provider := range workspace.Providers {
+			if provider.Retry == nil {
+				continue
+			}
+			if _, err := provider.Retry.ToEngineRetry(); err != nil {
+				parsedConfig.Errors = append(parsedConfig.Errors, ValidationError{
+					Path:     fmt.Sprintf("workspace.providers[%d].retry", i),
+					Message:  err.Error(),
+					Severity: "error",
+				})
+			}
+		}
 	}
 
 	// Extract resources
@@ -348,6 +463,43 @@ func (cp *CUEParser) extractConfig(val cue.Value, sourceFiles []string) (*Parsed
 		}
 	}
 
+	// Extract data sources
+	dataVal := val.LookupPath(cue.ParsePath("data"))
+	if dataVal.Exists() {
+		iter, err := dataVal.Fields(cue.All())
+		if err != nil {
+			parsedConfig.Errors = append(parsedConfig.Errors, ValidationError{
+				Path:     "data",
+				Message:  fmt.Sprintf("failed to iterate data sources: %v", err),
+				Severity: "error",
+			})
+		} else {
+			for iter.Next() {
+				dataSource, err := cp.extractDataSource(iter.Selector().String(), iter.Value())
+				if err != nil {
+					parsedConfig.Errors = append(parsedConfig.Errors, ValidationError{
+						Path:     fmt.Sprintf("data.%s", iter.Selector()),
+						Message:  err.Error(),
+						Severity: "error",
+					})
+				} else {
+					parsedConfig.DataSources = append(parsedConfig.DataSources, dataSource)
+				}
+			}
+		}
+	}
+
+	// Validate for_each blocks, which may reference workspace variables
+	for _, resource := range parsedConfig.Resources {
+		if _, err := parsedConfig.toEngineForEach(resource.ForEach); err != nil {
+			parsedConfig.Errors = append(parsedConfig.Errors, ValidationError{
+				Path:     fmt.Sprintf("resources.%s.for_each", resource.ID),
+				Message:  err.Error(),
+				Severity: "error",
+			})
+		}
+	}
+
 	// Extract provider namespace resources (e.g., linux: pkg: nginx: {})
 	// This enables concise syntax: linux: pkg: nginx: {} instead of verbose resource blocks
 	nsResources, nsErrors := cp.extractProviderNamespaces(val)
@@ -376,9 +528,88 @@ func (cp *CUEParser) extractResource(id string, val cue.Value) (ResourceConfig,
 		return resource, fmt.Errorf("validation failed: %w", err)
 	}
 
+	if resource.Retry != nil {
+		if _, err := resource.Retry.ToEngineRetry(); err != nil {
+			return resource, fmt.Errorf("validation failed: %w", err)
+		}
+	}
+
+	if resource.When != nil {
+		if err := cp.conditionEvaluator.Compile(resource.When.ToEngineCondition()); err != nil {
+			return resource, fmt.Errorf("invalid when condition: %w", err)
+		}
+	}
+
+	if resource.Type == engine.WaitResourceType {
+		if _, err := engine.ParseWaitCondition(resource.Config); err != nil {
+			return resource, fmt.Errorf("invalid wait: %w", err)
+		}
+	}
+
+	for i := range resource.Checks {
+		if err := cp.validateCheck(&resource.Checks[i]); err != nil {
+			return resource, fmt.Errorf("invalid check %d: %w", i, err)
+		}
+	}
+
+	if hooks := resource.Hooks; hooks != nil {
+		for i := range hooks.Before {
+			if err := cp.validateHook(&hooks.Before[i]); err != nil {
+				return resource, fmt.Errorf("invalid before hook %d: %w", i, err)
+			}
+		}
+		for i := range hooks.After {
+			if err := cp.validateHook(&hooks.After[i]); err != nil {
+				return resource, fmt.Errorf("invalid after hook %d: %w", i, err)
+			}
+		}
+	}
+
 	return resource, nil
 }
 
+// validateCheck validates a check block.
+func (cp *CUEParser) validateCheck(check *CheckConfig) error {
+	if err := cp.validator.Struct(check); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+	if _, err := check.ToEngineCheck(); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+	return nil
+}
+
+// validateHook validates a hook block.
+func (cp *CUEParser) validateHook(hook *HookConfig) error {
+	if err := cp.validator.Struct(hook); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+	if _, err := hook.ToEngineHook(); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+	return nil
+}
+
+// extractDataSource extracts a data source configuration from a CUE value.
+func (cp *CUEParser) extractDataSource(id string, val cue.Value) (DataSourceConfig, error) {
+	var dataSource DataSourceConfig
+
+	if err := val.Decode(&dataSource); err != nil {
+		return dataSource, fmt.Errorf("failed to decode data source: %w", err)
+	}
+
+	// The key is the ID unless one is given
+	if dataSource.ID == "" {
+		dataSource.ID = id
+	}
+
+	if err := cp.validator.Struct(dataSource); err != nil {
+		return dataSource, fmt.Errorf("validation failed: %w", err)
+	}
+
+	return dataSource, nil
+}
+
 // extractProviderNamespaces extracts resources from provider-specific namespaces.
 // Supports concise syntax like: linux: pkg: nginx: {}
 func (cp *CUEParser) extractProviderNamespaces(val cue.Value) ([]ResourceConfig, []ValidationError) {
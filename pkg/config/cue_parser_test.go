@@ -2,9 +2,11 @@ package config
 
 import (
 	"context"
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/openfroyo/openfroyo/pkg/engine"
 )
@@ -213,6 +215,96 @@ resources: {
 	}
 }
 
+func TestCUEParser_EvaluateForHost(t *testing.T) {
+	parser := NewCUEParser()
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "config.cue")
+
+	content := `
+workspace: {
+	name: "facts"
+	version: "1.0"
+}
+
+resources: {
+	web: {
+		id: "web"
+		type: "linux.pkg"
+		name: "web"
+		config: {
+			if facts.os.basic.distro == "ubuntu" {
+				package: "apache2"
+			}
+			if facts.os.basic.distro != "ubuntu" {
+				package: "httpd"
+			}
+			workers: div(facts.hw.memory.total_mb, 512)
+		}
+	}
+}
+`
+
+	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		facts       map[string]interface{}
+		wantPackage string
+		wantWorkers int
+	}{
+		{
+			name: "ubuntu host",
+			facts: map[string]interface{}{
+				"os.basic":  map[string]interface{}{"distro": "ubuntu"},
+				"hw.memory": map[string]interface{}{"total_mb": 2048},
+			},
+			wantPackage: "apache2",
+			wantWorkers: 4,
+		},
+		{
+			name: "rhel host",
+			facts: map[string]interface{}{
+				"os.basic":  map[string]interface{}{"distro": "rhel"},
+				"hw.memory": map[string]interface{}{"total_mb": 8192},
+			},
+			wantPackage: "httpd",
+			wantWorkers: 16,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parser.EvaluateForHost(ctx, []string{testFile}, tt.facts)
+			if err != nil {
+				t.Fatalf("EvaluateForHost() error = %v", err)
+			}
+			if len(cfg.Resources) != 1 {
+				t.Fatalf("expected 1 resource, got %d", len(cfg.Resources))
+			}
+
+			var config map[string]interface{}
+			if err := json.Unmarshal(cfg.Resources[0].Config, &config); err != nil {
+				t.Fatalf("failed to decode resource config: %v", err)
+			}
+			if config["package"] != tt.wantPackage {
+				t.Errorf("package = %v, want %s", config["package"], tt.wantPackage)
+			}
+			if config["workers"] != float64(tt.wantWorkers) {
+				t.Errorf("workers = %v, want %d", config["workers"], tt.wantWorkers)
+			}
+		})
+	}
+
+	// Without facts the configuration cannot be evaluated
+	if _, err := parser.Evaluate(ctx, []string{testFile}); err == nil {
+		t.Error("expected Evaluate to fail on a configuration reading facts")
+	}
+}
+
 func TestCUEParser_MergeConfigs(t *testing.T) {
 	parser := NewCUEParser()
 	ctx := context.Background()
@@ -338,6 +430,574 @@ resources: {
 	}
 }
 
+func TestCUEParser_Lifecycle(t *testing.T) {
+	parser := NewCUEParser()
+	ctx := context.Background()
+
+	content := `
+workspace: {name: "lifecycle", version: "1.0"}
+
+resources: {
+	db: {
+		id: "db"
+		type: "linux.file"
+		name: "database config"
+		config: {path: "/etc/db.conf", content: "x"}
+		lifecycle: {
+			prevent_destroy: true
+			create_before_destroy: true
+			ignore_changes: ["content", "mode"]
+		}
+	}
+}
+`
+
+	pc, err := parser.ParseInline(ctx, content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(pc.Errors) > 0 {
+		t.Fatalf("unexpected validation errors: %v", pc.Errors)
+	}
+
+	lc := pc.Resources[0].Lifecycle
+	if lc == nil {
+		t.Fatal("expected lifecycle to be parsed")
+	}
+
+	if !lc.PreventDestroy || !lc.CreateBeforeDestroy {
+		t.Errorf("expected prevent_destroy and create_before_destroy, got %+v", lc)
+	}
+
+	if len(lc.IgnoreChanges) != 2 {
+		t.Errorf("expected 2 ignored paths, got %d", len(lc.IgnoreChanges))
+	}
+
+	engineCfg, err := pc.ToEngineConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if engineCfg.Resources[0].Lifecycle == nil || !engineCfg.Resources[0].Lifecycle.PreventDestroy {
+		t.Error("expected lifecycle to be carried into the engine config")
+	}
+}
+
+func TestCUEParser_Retry(t *testing.T) {
+	parser := NewCUEParser()
+	ctx := context.Background()
+
+	content := `
+workspace: {
+	name: "retry"
+	version: "1.0"
+	providers: [{
+		name: "linux.pkg"
+		retry: {max_attempts: 2, backoff: "constant", initial_delay: "5s"}
+	}]
+}
+
+resources: {
+	nginx: {
+		id: "nginx"
+		type: "linux.pkg"
+		name: "nginx"
+		config: {package: "nginx", state: "present"}
+	}
+
+	app: {
+		id: "app"
+		type: "linux.file"
+		name: "app config"
+		config: {path: "/etc/app.conf", content: "x"}
+		retry: {
+			max_attempts: 4
+			max_delay: "30s"
+			retry_on: ["throttled"]
+			attempt_timeout: "2m"
+		}
+	}
+}
+`
+
+	pc, err := parser.ParseInline(ctx, content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(pc.Errors) > 0 {
+		t.Fatalf("unexpected validation errors: %v", pc.Errors)
+	}
+
+	retries := make(map[string]*engine.RetryPolicy)
+	engineCfg, err := pc.ToEngineConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, resource := range engineCfg.Resources {
+		retries[resource.ID] = resource.Retry
+	}
+
+	// Resources without a retry block inherit their provider's
+	nginx := retries["nginx"]
+	if nginx == nil || nginx.MaxAttempts != 2 || nginx.Backoff != engine.BackoffConstant || nginx.InitialDelay != 5*time.Second {
+		t.Errorf("expected provider retry policy for nginx, got %+v", nginx)
+	}
+
+	app := retries["app"]
+	if app == nil || app.MaxAttempts != 4 || app.MaxDelay != 30*time.Second || app.AttemptTimeout != 2*time.Minute {
+		t.Fatalf("expected resource retry policy for app, got %+v", app)
+	}
+
+	if len(app.RetryOn) != 1 || app.RetryOn[0] != engine.ErrorClassThrottled {
+		t.Errorf("expected retry on throttled errors, got %v", app.RetryOn)
+	}
+
+	invalid := `
+workspace: {name: "retry", version: "1.0"}
+
+resources: {
+	app: {
+		id: "app"
+		type: "linux.file"
+		name: "app config"
+		config: {path: "/etc/app.conf", content: "x"}
+		retry: {max_attempts: 3, max_delay: "soon"}
+	}
+}
+`
+
+	pc, err = parser.ParseInline(ctx, invalid)
+	if err == nil && len(pc.Errors) == 0 {
+		t.Error("expected an error for an invalid retry duration")
+	}
+}
+
+func TestCUEParser_When(t *testing.T) {
+	parser := NewCUEParser()
+	ctx := context.Background()
+
+	content := `
+workspace: {name: "when", version: "1.0"}
+
+resources: {
+	firewalld: {
+		id: "firewalld"
+		type: "linux.pkg"
+		name: "firewalld"
+		config: {package: "firewalld", state: "present"}
+		when: {expr: #"os.basic.distro == "rhel""#}
+	}
+
+	ufw: {
+		id: "ufw"
+		type: "linux.pkg"
+		name: "ufw"
+		config: {package: "ufw", state: "present"}
+		when: {expr: #"os.basic.distro == "ubuntu""#, language: "cue"}
+	}
+}
+`
+
+	pc, err := parser.ParseInline(ctx, content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(pc.Errors) > 0 {
+		t.Fatalf("unexpected validation errors: %v", pc.Errors)
+	}
+
+	conditions := make(map[string]*engine.Condition)
+	engineCfg, err := pc.ToEngineConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, resource := range engineCfg.Resources {
+		conditions[resource.ID] = resource.When
+	}
+
+	if c := conditions["firewalld"]; c == nil || c.Expression != `os.basic.distro == "rhel"` || c.Language != "" {
+		t.Errorf("expected starlark condition for firewalld, got %+v", c)
+	}
+
+	if c := conditions["ufw"]; c == nil || c.Language != engine.ConditionLanguageCUE {
+		t.Errorf("expected cue condition for ufw, got %+v", c)
+	}
+
+	invalid := `
+workspace: {name: "when", version: "1.0"}
+
+resources: {
+	firewalld: {
+		id: "firewalld"
+		type: "linux.pkg"
+		name: "firewalld"
+		config: {package: "firewalld", state: "present"}
+		when: {expr: "os.basic.distro =="}
+	}
+}
+`
+
+	pc, err = parser.ParseInline(ctx, invalid)
+	if err == nil && len(pc.Errors) == 0 {
+		t.Error("expected an error for an invalid when expression")
+	}
+}
+
+func TestCUEParser_ForEach(t *testing.T) {
+	parser := NewCUEParser()
+	ctx := context.Background()
+
+	content := `
+workspace: {
+	name: "foreach"
+	version: "1.0"
+	variables: {
+		admins: ["alice", "bob"]
+	}
+}
+
+resources: {
+	admins: {
+		id: "admins"
+		type: "linux.user"
+		name: "admins"
+		config: {name: "${each.key}", groups: ["wheel"]}
+		for_each: {variable: "admins"}
+	}
+
+	mounts: {
+		id: "mounts"
+		type: "linux.mount"
+		name: "mounts"
+		config: {device: "${each.key}"}
+		for_each: {fact: "hw.disk.devices", key: "device"}
+	}
+
+	services: {
+		id: "services"
+		type: "linux.service"
+		name: "services"
+		config: {name: "${each.key}", enabled: "${each.value.enabled}"}
+		for_each: {items: {nginx: {enabled: true}, cron: {enabled: false}}}
+	}
+}
+`
+
+	pc, err := parser.ParseInline(ctx, content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(pc.Errors) > 0 {
+		t.Fatalf("unexpected validation errors: %v", pc.Errors)
+	}
+
+	forEach := make(map[string]*engine.ForEach)
+	engineCfg, err := pc.ToEngineConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, resource := range engineCfg.Resources {
+		forEach[resource.ID] = resource.ForEach
+	}
+
+	// Variable collections are resolved from the workspace
+	if fe := forEach["admins"]; fe == nil || fe.Items == nil {
+		t.Fatalf("expected admins to iterate over the variable, got %+v", fe)
+	}
+
+	if fe := forEach["mounts"]; fe == nil || fe.Fact != "hw.disk.devices" || fe.Key != "device" {
+		t.Errorf("expected mounts to iterate over disk facts, got %+v", fe)
+	}
+
+	for _, resource := range engineCfg.Resources {
+		if resource.ID != "services" {
+			continue
+		}
+		instances, err := engine.ExpandForEach(&resource, nil)
+		if err != nil {
+			t.Fatalf("failed to expand services: %v", err)
+		}
+		if len(instances) != 2 || instances[0].ID != "services[cron]" || instances[1].ID != "services[nginx]" {
+			t.Errorf("unexpected service instances: %+v", instances)
+		}
+	}
+
+	invalid := `
+workspace: {name: "foreach", version: "1.0"}
+
+resources: {
+	admins: {
+		id: "admins"
+		type: "linux.user"
+		name: "admins"
+		config: {name: "${each.key}"}
+		for_each: {variable: "missing"}
+	}
+}
+`
+
+	pc, err = parser.ParseInline(ctx, invalid)
+	if err == nil && len(pc.Errors) == 0 {
+		t.Error("expected an error for an undefined for_each variable")
+	}
+}
+
+func TestCUEParser_DataSources(t *testing.T) {
+	parser := NewCUEParser()
+	ctx := context.Background()
+
+	content := `
+workspace: {name: "data", version: "1.0"}
+
+data: {
+	latest_kernel: {
+		type: "linux.pkg::repo_package"
+		config: {package: "kernel"}
+		host: "web1"
+	}
+}
+
+resources: {
+	kernel: {
+		id: "kernel"
+		type: "linux.pkg"
+		name: "kernel"
+		config: {package: "kernel", version: "${data.latest_kernel.version}"}
+	}
+}
+`
+
+	pc, err := parser.ParseInline(ctx, content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(pc.Errors) > 0 {
+		t.Fatalf("unexpected validation errors: %v", pc.Errors)
+	}
+
+	engineCfg, err := pc.ToEngineConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dataSources := engineCfg.DataSources
+	if len(dataSources) != 1 {
+		t.Fatalf("expected 1 data source, got %d", len(dataSources))
+	}
+
+	ds := dataSources[0]
+	if ds.ID != "latest_kernel" || ds.Type != "linux.pkg::repo_package" || ds.TargetID != "web1" {
+		t.Errorf("unexpected data source: %+v", ds)
+	}
+
+	invalid := `
+workspace: {name: "data", version: "1.0"}
+
+data: latest_kernel: config: {package: "kernel"}
+`
+
+	pc, err = parser.ParseInline(ctx, invalid)
+	if err == nil && len(pc.Errors) == 0 {
+		t.Error("expected an error for a data source without a type")
+	}
+}
+
+func TestCUEParser_Checks(t *testing.T) {
+	parser := NewCUEParser()
+	ctx := context.Background()
+
+	content := `
+workspace: {
+	name: "checks"
+	version: "1.0"
+	checks: [{name: "ssh", type: "port", port: 22}]
+}
+
+resources: {
+	nginx: {
+		id: "nginx"
+		type: "linux.pkg"
+		name: "nginx"
+		config: {package: "nginx", state: "present"}
+		checks: [
+			{name: "homepage", type: "http", url: "http://localhost/", expect_status: 200, timeout: "5s"},
+			{name: "config", type: "file", path: "/etc/nginx/nginx.conf", pattern: "worker_processes"},
+		]
+	}
+}
+`
+
+	pc, err := parser.ParseInline(ctx, content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(pc.Errors) > 0 {
+		t.Fatalf("unexpected validation errors: %v", pc.Errors)
+	}
+
+	config, err := pc.ToEngineConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(config.Checks) != 1 || config.Checks[0].Type != engine.HealthCheckPort {
+		t.Errorf("expected one workspace port check, got %+v", config.Checks)
+	}
+
+	checks := config.Resources[0].Checks
+	if len(checks) != 2 {
+		t.Fatalf("expected 2 resource checks, got %d", len(checks))
+	}
+	if checks[0].Timeout != 5*time.Second || checks[1].Pattern != "worker_processes" {
+		t.Errorf("unexpected resource checks: %+v", checks)
+	}
+
+	invalid := `
+workspace: {name: "checks", version: "1.0"}
+
+resources: {
+	nginx: {
+		id: "nginx"
+		type: "linux.pkg"
+		name: "nginx"
+		config: {package: "nginx"}
+		checks: [{name: "homepage", type: "http"}]
+	}
+}
+`
+
+	pc, err = parser.ParseInline(ctx, invalid)
+	if err == nil && len(pc.Errors) == 0 {
+		t.Error("expected an error for an http check without a url")
+	}
+}
+
+func TestCUEParser_Hooks(t *testing.T) {
+	parser := NewCUEParser()
+	ctx := context.Background()
+
+	content := `
+workspace: {
+	name: "hooks"
+	version: "1.0"
+	hooks: {
+		before_run: [{name: "announce", type: "webhook", url: "https://chat.example.com/hook", headers: {"X-Token": "secret"}}]
+		before_batch: [{name: "drain", type: "remote", command: "lb-drain $FROYO_HOST", timeout: "30s"}]
+		after_batch: [{name: "undrain", type: "remote", command: "lb-add $FROYO_HOST"}]
+	}
+}
+
+resources: {
+	nginx: {
+		id: "nginx"
+		type: "linux.pkg"
+		name: "nginx"
+		config: {package: "nginx", state: "present"}
+		hooks: {
+			after: [{name: "notify", type: "local", command: "echo applied", continue_on_failure: true}]
+		}
+	}
+}
+`
+
+	pc, err := parser.ParseInline(ctx, content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(pc.Errors) > 0 {
+		t.Fatalf("unexpected validation errors: %v", pc.Errors)
+	}
+
+	config, err := pc.ToEngineConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.Hooks == nil || len(config.Hooks.BeforeRun) != 1 || len(config.Hooks.BeforeBatch) != 1 {
+		t.Fatalf("expected workspace hooks, got %+v", config.Hooks)
+	}
+	if config.Hooks.BeforeBatch[0].Type != engine.HookRemote || config.Hooks.BeforeBatch[0].Timeout != 30*time.Second {
+		t.Errorf("unexpected batch hook: %+v", config.Hooks.BeforeBatch[0])
+	}
+	if config.Hooks.BeforeRun[0].Headers["X-Token"] != "secret" {
+		t.Errorf("unexpected webhook: %+v", config.Hooks.BeforeRun[0])
+	}
+
+	hooks := config.Resources[0].Hooks
+	if hooks == nil || len(hooks.After) != 1 || !hooks.After[0].ContinueOnFailure {
+		t.Errorf("unexpected resource hooks: %+v", hooks)
+	}
+
+	invalid := `
+workspace: {
+	name: "hooks"
+	version: "1.0"
+	hooks: {before_run: [{name: "announce", type: "webhook"}]}
+}
+`
+
+	pc, err = parser.ParseInline(ctx, invalid)
+	if err == nil && len(pc.Errors) == 0 {
+		t.Error("expected an error for a webhook without a url")
+	}
+}
+
+func TestCUEParser_WaitResources(t *testing.T) {
+	parser := NewCUEParser()
+	ctx := context.Background()
+
+	content := `
+workspace: {name: "waits", version: "1.0"}
+
+resources: {
+	db_ready: {
+		id: "db_ready"
+		type: "wait"
+		name: "postgres accepts connections"
+		config: {type: "port", port: 5432, timeout: "2m", interval: "2s"}
+		dependencies: [{resource_id: "postgres", type: "require"}]
+	}
+	migrate: {
+		id: "migrate"
+		type: "linux.exec"
+		name: "migrate"
+		config: {command: "app migrate"}
+		dependencies: [{resource_id: "db_ready", type: "require"}]
+	}
+}
+`
+
+	pc, err := parser.ParseInline(ctx, content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(pc.Errors) > 0 {
+		t.Fatalf("unexpected validation errors: %v", pc.Errors)
+	}
+
+	invalid := `
+workspace: {name: "waits", version: "1.0"}
+
+resources: {
+	db_ready: {
+		id: "db_ready"
+		type: "wait"
+		name: "postgres accepts connections"
+		config: {type: "systemd"}
+	}
+}
+`
+
+	pc, err = parser.ParseInline(ctx, invalid)
+	if err == nil && len(pc.Errors) == 0 {
+		t.Error("expected an error for a systemd wait without a unit")
+	}
+}
+
 func TestCUEParser_TargetSelectors(t *testing.T) {
 	parser := NewCUEParser()
 	ctx := context.Background()
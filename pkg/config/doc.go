@@ -93,6 +93,12 @@
 //	        })
 //	    return servers
 //
+// Configurations and scripts evaluated for a host with EvaluateForHost and
+// EvaluateStarlarkForHost can read the host's facts, as the facts value in CUE
+// and the facts() built-in in Starlark:
+//
+//	cfg, err := parser.EvaluateForHost(ctx, sources, hostFacts)
+//
 // # Schema Validation
 //
 // Built-in schemas enforce configuration correctness:
@@ -139,6 +139,26 @@ const builtinResourceSchema = `
 		name:    string
 		version?: string
 	}
+
+	// Handler marks the resource as only running when notified
+	handler?: bool
+
+	// Lifecycle customizes how changes are planned
+	lifecycle?: {
+		prevent_destroy?:       bool
+		create_before_destroy?: bool
+		ignore_changes?: [...string]
+	}
+
+	// Retry declares retries, backoff and per-attempt timeout
+	retry?: {
+		max_attempts:     int & >=1
+		backoff?:         "constant" | "linear" | "exponential"
+		initial_delay?:   string
+		max_delay?:       string
+		retry_on?: [..."transient" | "throttled" | "conflict" | "permanent"]
+		attempt_timeout?: string
+	}
 }
 `
 
@@ -194,6 +214,16 @@ const builtinProviderSchema = `
 
 	// Capabilities are required capabilities
 	capabilities?: [...string]
+
+	// Retry is the default retry policy for the provider's resources
+	retry?: {
+		max_attempts:     int & >=1
+		backoff?:         "constant" | "linear" | "exponential"
+		initial_delay?:   string
+		max_delay?:       string
+		retry_on?: [..."transient" | "throttled" | "conflict" | "permanent"]
+		attempt_timeout?: string
+	}
 }
 `
 
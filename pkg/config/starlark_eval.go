@@ -3,6 +3,7 @@ package config
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"go.starlark.net/starlark"
@@ -26,6 +27,14 @@ func NewStarlarkEvaluator(timeout time.Duration) *StarlarkEvaluator {
 
 // Evaluate executes a Starlark script with the given input and returns the result.
 func (se *StarlarkEvaluator) Evaluate(ctx context.Context, script string, input map[string]interface{}) (*StarlarkResult, error) {
+	return se.EvaluateWithFacts(ctx, script, input, nil)
+}
+
+// EvaluateWithFacts executes a Starlark script for a single host, with the
+// host's facts keyed by namespace available through the facts() built-in:
+// facts() returns all facts, and facts("hw.memory.total_mb") returns a
+// namespace or a field of one, or the optional default when it is missing.
+func (se *StarlarkEvaluator) EvaluateWithFacts(ctx context.Context, script string, input, facts map[string]interface{}) (*StarlarkResult, error) {
 	startTime := time.Now()
 
 	// Create timeout context
@@ -37,7 +46,7 @@ func (se *StarlarkEvaluator) Evaluate(ctx context.Context, script string, input
 	errCh := make(chan error, 1)
 
 	go func() {
-		result, err := se.evaluateSync(script, input)
+		result, err := se.evaluateSync(script, input, facts)
 		if err != nil {
 			errCh <- err
 		} else {
@@ -64,7 +73,7 @@ func (se *StarlarkEvaluator) Evaluate(ctx context.Context, script string, input
 }
 
 // evaluateSync performs the actual Starlark evaluation synchronously.
-func (se *StarlarkEvaluator) evaluateSync(script string, input map[string]interface{}) (*StarlarkResult, error) {
+func (se *StarlarkEvaluator) evaluateSync(script string, input, facts map[string]interface{}) (*StarlarkResult, error) {
 	// Create thread
 	thread := &starlark.Thread{
 		Name: "openfroyo",
@@ -82,6 +91,7 @@ func (se *StarlarkEvaluator) evaluateSync(script string, input map[string]interf
 	predeclared["range"] = starlark.NewBuiltin("range", builtinRange)
 	predeclared["enumerate"] = starlark.NewBuiltin("enumerate", builtinEnumerate)
 	predeclared["zip"] = starlark.NewBuiltin("zip", builtinZip)
+	predeclared["facts"] = newFactsBuiltin(facts)
 
 	// Convert input to Starlark values and add to predeclared
 	for key, val := range input {
@@ -286,6 +296,45 @@ func builtinEnumerate(thread *starlark.Thread, b *starlark.Builtin, args starlar
 	return starlark.NewList(list), nil
 }
 
+// newFactsBuiltin returns the facts() built-in function reading the given
+// facts. Without facts, as when a script is not evaluated for a host, calling
+// it fails.
+func newFactsBuiltin(facts map[string]interface{}) *starlark.Builtin {
+	var nested map[string]interface{}
+	if facts != nil {
+		nested = nestFacts(facts)
+	}
+
+	return starlark.NewBuiltin("facts", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var path string
+		var def starlark.Value
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path?", &path, "default?", &def); err != nil {
+			return nil, err
+		}
+		if nested == nil {
+			return nil, fmt.Errorf("facts: facts are only available when evaluating for a host")
+		}
+		if path == "" {
+			return toStarlarkFact(nested)
+		}
+
+		var node interface{} = nested
+		for _, part := range strings.Split(path, ".") {
+			fields, ok := node.(map[string]interface{})
+			if ok {
+				node, ok = fields[part]
+			}
+			if !ok {
+				if def != nil {
+					return def, nil
+				}
+				return nil, fmt.Errorf("facts: fact %q not found", path)
+			}
+		}
+		return toStarlarkFact(node)
+	})
+}
+
 // builtinZip implements the zip() built-in function.
 func builtinZip(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	if len(args) == 0 {
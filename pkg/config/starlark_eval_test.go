@@ -187,6 +187,87 @@ result = undefined_variable
 	}
 }
 
+func TestStarlarkEvaluator_EvaluateWithFacts(t *testing.T) {
+	evaluator := NewStarlarkEvaluator(5 * time.Second)
+	ctx := context.Background()
+
+	facts := map[string]interface{}{
+		"os.basic": map[string]interface{}{
+			"distro": "ubuntu",
+		},
+		"hw.memory": map[string]interface{}{
+			"total_mb": float64(2048),
+		},
+	}
+
+	tests := []struct {
+		name    string
+		script  string
+		facts   map[string]interface{}
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name: "read a fact by path",
+			script: `
+package = "apache2" if facts("os.basic.distro") == "ubuntu" else "httpd"
+workers = int(facts("hw.memory.total_mb") // 512)
+`,
+			facts: facts,
+			want:  map[string]interface{}{"package": "apache2", "workers": int64(4)},
+		},
+		{
+			name: "read all facts",
+			script: `
+distro = facts().os.basic.distro
+`,
+			facts: facts,
+			want:  map[string]interface{}{"distro": "ubuntu"},
+		},
+		{
+			name: "missing fact with default",
+			script: `
+port = facts("app.web.port", 8080)
+`,
+			facts: facts,
+			want:  map[string]interface{}{"port": int64(8080)},
+		},
+		{
+			name: "missing fact without default",
+			script: `
+port = facts("app.web.port")
+`,
+			facts:   facts,
+			wantErr: true,
+		},
+		{
+			name: "no facts",
+			script: `
+distro = facts("os.basic.distro")
+`,
+			facts:   nil,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := evaluator.EvaluateWithFacts(ctx, tt.script, nil, tt.facts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EvaluateWithFacts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			for key, want := range tt.want {
+				if result.Output[key] != want {
+					t.Errorf("%s = %v, want %v", key, result.Output[key], want)
+				}
+			}
+		})
+	}
+}
+
 func TestStarlarkEvaluator_Timeout(t *testing.T) {
 	evaluator := NewStarlarkEvaluator(100 * time.Millisecond)
 	ctx := context.Background()
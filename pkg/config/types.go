@@ -2,6 +2,8 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/openfroyo/openfroyo/pkg/engine"
@@ -35,6 +37,204 @@ type ResourceConfig struct {
 
 	// Provider overrides the provider name and version for this resource.
 	Provider *ProviderOverride `json:"provider,omitempty"`
+
+	// Handler marks this resource as a handler that only runs when one of
+	// its notify dependencies changed something.
+	Handler bool `json:"handler,omitempty"`
+
+	// Lifecycle customizes how changes to this resource are planned.
+	Lifecycle *LifecycleConfig `json:"lifecycle,omitempty"`
+
+	// Retry declares how operations on this resource are retried.
+	// It overrides the retry block of the resource's provider.
+	Retry *RetryConfig `json:"retry,omitempty"`
+
+	// When is a condition on the facts of each target host. The resource is
+	// only planned on hosts where it holds.
+	When *ConditionConfig `json:"when,omitempty"`
+
+	// ForEach expands the resource into one instance per entry of a list,
+	// map, workspace variable or host fact.
+	ForEach *ForEachConfig `json:"for_each,omitempty"`
+
+	// Checks run against each target host after the resource is applied.
+	Checks []CheckConfig `json:"checks,omitempty"`
+
+	// Hooks run before and after the resource is applied on each target host.
+	Hooks *ResourceHooksConfig `json:"hooks,omitempty"`
+}
+
+// HookConfig declares a hook: a local command, a command run on the hosts
+// through the micro-runner, or a webhook.
+type HookConfig struct {
+	// Name identifies the hook in events.
+	Name string `json:"name" validate:"required"`
+
+	// Type is where the hook runs.
+	Type string `json:"type" validate:"required,oneof=local remote webhook"`
+
+	// Command is the shell command run by local and remote hooks.
+	Command string `json:"command,omitempty"`
+
+	// URL is the endpoint webhooks post the hook context to.
+	URL string `json:"url,omitempty"`
+
+	// Headers are added to webhook requests.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Timeout is the maximum duration of the hook (e.g., "30s").
+	Timeout string `json:"timeout,omitempty"`
+
+	// ContinueOnFailure records a failure without aborting the run.
+	ContinueOnFailure bool `json:"continue_on_failure,omitempty"`
+}
+
+// ResourceHooksConfig declares the hooks run around a resource.
+type ResourceHooksConfig struct {
+	// Before run before the resource is applied.
+	Before []HookConfig `json:"before,omitempty"`
+
+	// After run once the resource was applied, whether it succeeded or not.
+	After []HookConfig `json:"after,omitempty"`
+}
+
+// HooksConfig declares the hooks run around a run and its host batches.
+type HooksConfig struct {
+	// BeforeRun run before anything is applied.
+	BeforeRun []HookConfig `json:"before_run,omitempty"`
+
+	// AfterRun run once the run finished.
+	AfterRun []HookConfig `json:"after_run,omitempty"`
+
+	// BeforeBatch run before each host batch of a rollout or canary run.
+	BeforeBatch []HookConfig `json:"before_batch,omitempty"`
+
+	// AfterBatch run after each host batch of a rollout or canary run.
+	AfterBatch []HookConfig `json:"after_batch,omitempty"`
+}
+
+// CheckConfig declares a post-apply check. Which fields apply depends on the
+// type (command, http, port, file, fact).
+type CheckConfig struct {
+	// Name identifies the check in events and results.
+	Name string `json:"name" validate:"required"`
+
+	// Type is the kind of check.
+	Type string `json:"type" validate:"required,oneof=command http port file fact"`
+
+	// Command is the shell command run by command checks.
+	Command string `json:"command,omitempty"`
+
+	// ExpectExitCode is the exit code a command check must return.
+	ExpectExitCode int `json:"expect_exit_code,omitempty"`
+
+	// URL is the endpoint probed by http checks, as seen from the host.
+	URL string `json:"url,omitempty"`
+
+	// ExpectStatus is the status code an http check must return. Defaults to any 2xx.
+	ExpectStatus int `json:"expect_status,omitempty"`
+
+	// ExpectBody is a substring the http response body must contain.
+	ExpectBody string `json:"expect_body,omitempty"`
+
+	// Port is the TCP port probed by port checks.
+	Port int `json:"port,omitempty"`
+
+	// Address is the address port checks connect to. Defaults to 127.0.0.1.
+	Address string `json:"address,omitempty"`
+
+	// Path is the file read by file checks.
+	Path string `json:"path,omitempty"`
+
+	// Pattern is a regular expression the file content must match.
+	Pattern string `json:"pattern,omitempty"`
+
+	// Fact is the dotted fact path asserted by fact checks.
+	Fact string `json:"fact,omitempty"`
+
+	// Equals is the expected fact value.
+	Equals string `json:"equals,omitempty"`
+
+	// Timeout is the maximum duration of the check (e.g., "10s").
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// ForEachConfig declares the collection a resource is expanded over. Exactly
+// one of Items, Variable and Fact is set. Instances are keyed by map key,
+// scalar list value or the Key field of object list entries, and their config
+// may reference ${each.key}, ${each.value} and ${each.value.<field>}.
+type ForEachConfig struct {
+	// Items is a list or map of entries.
+	Items interface{} `json:"items,omitempty"`
+
+	// Variable names a workspace variable holding the entries.
+	Variable string `json:"variable,omitempty"`
+
+	// Fact is a dotted path into the facts of each target host (e.g., "hw.disk.devices").
+	Fact string `json:"fact,omitempty"`
+
+	// Key is the field of object entries used as the instance key.
+	Key string `json:"key,omitempty"`
+}
+
+// DataSourceConfig represents a data source read by its provider while
+// planning. Resource configs reference its output with ${data.<id>.<field>}.
+type DataSourceConfig struct {
+	// ID is the unique identifier for this data source (e.g., "latest_kernel").
+	ID string `json:"id" validate:"required"`
+
+	// Type is the data source type, "<provider>::<name>" (e.g., "linux.pkg::repo_package").
+	Type string `json:"type" validate:"required"`
+
+	// Config is the query passed to the provider.
+	Config json.RawMessage `json:"config,omitempty"`
+
+	// Host is the ID of the host the data source is read on, if any.
+	Host string `json:"host,omitempty"`
+}
+
+// ConditionConfig is a boolean expression over host facts, e.g.
+// `os.basic.distro == "rhel"`.
+type ConditionConfig struct {
+	// Expr is the expression. Fact namespaces are read as nested fields.
+	Expr string `json:"expr" validate:"required"`
+
+	// Language is the expression language (starlark, cue). Defaults to starlark.
+	Language string `json:"language,omitempty"`
+}
+
+// LifecycleConfig contains resource lifecycle meta-options.
+type LifecycleConfig struct {
+	// PreventDestroy makes plan validation fail if the resource would be deleted or recreated.
+	PreventDestroy bool `json:"prevent_destroy,omitempty"`
+
+	// CreateBeforeDestroy creates the replacement before destroying the existing resource.
+	CreateBeforeDestroy bool `json:"create_before_destroy,omitempty"`
+
+	// IgnoreChanges lists JSON paths within the resource config excluded from diffing.
+	IgnoreChanges []string `json:"ignore_changes,omitempty"`
+}
+
+// RetryConfig declares the retry, backoff and timeout policy of a resource or provider.
+// Durations use Go duration syntax (e.g., "5s", "2m").
+type RetryConfig struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int `json:"max_attempts"`
+
+	// Backoff is the delay curve between attempts (constant, linear, exponential).
+	Backoff string `json:"backoff,omitempty"`
+
+	// InitialDelay is the delay before the first retry.
+	InitialDelay string `json:"initial_delay,omitempty"`
+
+	// MaxDelay caps the delay between attempts.
+	MaxDelay string `json:"max_delay,omitempty"`
+
+	// RetryOn lists the retryable error classes (transient, throttled, conflict, permanent).
+	RetryOn []string `json:"retry_on,omitempty"`
+
+	// AttemptTimeout is the maximum duration of each attempt.
+	AttemptTimeout string `json:"attempt_timeout,omitempty"`
 }
 
 // DependencyConfig represents a dependency relationship between resources.
@@ -86,6 +286,9 @@ type ProviderConfig struct {
 
 	// Capabilities are the capabilities this provider requires.
 	Capabilities []string `json:"capabilities,omitempty"`
+
+	// Retry is the default retry policy for resources of this provider.
+	Retry *RetryConfig `json:"retry,omitempty"`
 }
 
 // WorkspaceConfig represents the workspace configuration.
@@ -108,6 +311,12 @@ type WorkspaceConfig struct {
 	// Policy configures policy enforcement.
 	Policy *PolicyConfig `json:"policy,omitempty"`
 
+	// Checks run against every host of a plan once it is applied.
+	Checks []CheckConfig `json:"checks,omitempty"`
+
+	// Hooks run around every run and host batch of the workspace.
+	Hooks *HooksConfig `json:"hooks,omitempty"`
+
 	// Metadata contains additional workspace metadata.
 	Metadata map[string]interface{} `json:"metadata,omitempty"`
 }
@@ -147,6 +356,10 @@ type ParsedConfig struct {
 	// Resources are all resources defined in the configuration.
 	Resources []ResourceConfig `json:"resources"`
 
+	// DataSources are the data sources defined in the configuration, in
+	// declaration order.
+	DataSources []DataSourceConfig `json:"data_sources,omitempty"`
+
 	// SourceFiles are the CUE files that were parsed.
 	SourceFiles []string `json:"source_files"`
 
@@ -250,10 +463,31 @@ type StarlarkResult struct {
 	Error string `json:"error,omitempty"`
 }
 
-// ToEngineConfig converts ParsedConfig to engine.Config.
-func (pc *ParsedConfig) ToEngineConfig() *engine.Config {
+// ToEngineConfig converts ParsedConfig to engine.Config. It fails on blocks
+// that cannot be converted, such as a retry block with an invalid delay.
+func (pc *ParsedConfig) ToEngineConfig() (*engine.Config, error) {
 	resources := make([]engine.Resource, len(pc.Resources))
 	for i, rc := range pc.Resources {
+		retry, err := pc.resolveRetry(rc)
+		if err != nil {
+			return nil, fmt.Errorf("resource %s: %w", rc.ID, err)
+		}
+
+		forEach, err := pc.toEngineForEach(rc.ForEach)
+		if err != nil {
+			return nil, fmt.Errorf("resource %s: %w", rc.ID, err)
+		}
+
+		checks, err := toEngineChecks(rc.Checks)
+		if err != nil {
+			return nil, fmt.Errorf("resource %s: %w", rc.ID, err)
+		}
+
+		hooks, err := rc.Hooks.ToEngineHooks()
+		if err != nil {
+			return nil, fmt.Errorf("resource %s: %w", rc.ID, err)
+		}
+
 		resources[i] = engine.Resource{
 			ID:           rc.ID,
 			Type:         rc.Type,
@@ -262,6 +496,15 @@ func (pc *ParsedConfig) ToEngineConfig() *engine.Config {
 			Labels:       rc.Labels,
 			Annotations:  rc.Annotations,
 			Dependencies: toDependencyIDs(rc.Dependencies),
+			Handler:      rc.Handler,
+			NotifiedBy:   toNotifierIDs(rc.Dependencies),
+			Lifecycle:    toEngineLifecycle(rc.Lifecycle),
+			Retry:        retry,
+			When:         rc.When.ToEngineCondition(),
+			ForEach:      forEach,
+			Checks:       checks,
+			Hooks:        hooks,
+			Target:       toEngineTarget(rc.Target),
 			Status:       engine.ResourceStatusUnknown,
 			CreatedAt:    pc.ParsedAt,
 			UpdatedAt:    pc.ParsedAt,
@@ -269,25 +512,331 @@ func (pc *ParsedConfig) ToEngineConfig() *engine.Config {
 		}
 	}
 
-	return &engine.Config{
-		ID:        pc.Workspace.Name,
-		Source:    formatSourceFiles(pc.SourceFiles),
-		ParsedAt:  pc.ParsedAt,
-		Resources: resources,
-		Variables: pc.Workspace.Variables,
-		Metadata:  pc.Workspace.Metadata,
+	var dataSources []engine.DataSource
+	for _, dc := range pc.DataSources {
+		dataSources = append(dataSources, engine.DataSource{
+			ID:       dc.ID,
+			Type:     dc.Type,
+			Config:   dc.Config,
+			TargetID: dc.Host,
+		})
+	}
+
+	checks, err := toEngineChecks(pc.Workspace.Checks)
+	if err != nil {
+		return nil, fmt.Errorf("workspace: %w", err)
 	}
+
+	hooks, err := pc.Workspace.Hooks.ToEngineHooks()
+	if err != nil {
+		return nil, fmt.Errorf("workspace: %w", err)
+	}
+
+	return &engine.Config{
+		ID:          pc.Workspace.Name,
+		Source:      formatSourceFiles(pc.SourceFiles),
+		ParsedAt:    pc.ParsedAt,
+		Resources:   resources,
+		DataSources: dataSources,
+		Checks:      checks,
+		Hooks:       hooks,
+		Variables:   pc.Workspace.Variables,
+		Metadata:    pc.Workspace.Metadata,
+	}, nil
 }
 
 // toDependencyIDs converts DependencyConfig slice to string slice.
+// Notify dependencies are returned separately by toNotifierIDs.
 func toDependencyIDs(deps []DependencyConfig) []string {
-	ids := make([]string, len(deps))
-	for i, dep := range deps {
-		ids[i] = dep.ResourceID
+	ids := make([]string, 0, len(deps))
+	for _, dep := range deps {
+		if dep.Type == engine.DependencyNotify {
+			continue
+		}
+		ids = append(ids, dep.ResourceID)
 	}
 	return ids
 }
 
+// toNotifierIDs returns the resource IDs of notify dependencies.
+func toNotifierIDs(deps []DependencyConfig) []string {
+	var ids []string
+	for _, dep := range deps {
+		if dep.Type == engine.DependencyNotify {
+			ids = append(ids, dep.ResourceID)
+		}
+	}
+	return ids
+}
+
+// toEngineLifecycle converts a LifecycleConfig to engine.Lifecycle.
+func toEngineLifecycle(lc *LifecycleConfig) *engine.Lifecycle {
+	if lc == nil {
+		return nil
+	}
+
+	return &engine.Lifecycle{
+		PreventDestroy:      lc.PreventDestroy,
+		CreateBeforeDestroy: lc.CreateBeforeDestroy,
+		IgnoreChanges:       lc.IgnoreChanges,
+	}
+}
+
+// toEngineTarget converts a TargetSelector to engine.TargetSelector. It
+// returns nil for a resource without targeting.
+func toEngineTarget(ts TargetSelector) *engine.TargetSelector {
+	target := &engine.TargetSelector{
+		Hosts:    ts.Hosts,
+		Labels:   ts.Labels,
+		Selector: ts.Selector,
+		All:      ts.All,
+	}
+	if target.IsEmpty() {
+		return nil
+	}
+
+	return target
+}
+
+// ToEngineCondition converts the condition to an engine.Condition.
+func (cc *ConditionConfig) ToEngineCondition() *engine.Condition {
+	if cc == nil {
+		return nil
+	}
+
+	return &engine.Condition{
+		Expression: cc.Expr,
+		Language:   engine.ConditionLanguage(cc.Language),
+	}
+}
+
+// toEngineForEach converts a for_each block to an engine.ForEach, reading
+// variable collections from the workspace.
+func (pc *ParsedConfig) toEngineForEach(fc *ForEachConfig) (*engine.ForEach, error) {
+	if fc == nil {
+		return nil, nil
+	}
+
+	forEach := &engine.ForEach{
+		Items: fc.Items,
+		Fact:  fc.Fact,
+		Key:   fc.Key,
+	}
+
+	if fc.Variable != "" {
+		if fc.Items != nil || fc.Fact != "" {
+			return nil, fmt.Errorf("for_each requires exactly one of items, variable and fact")
+		}
+
+		items, ok := pc.Workspace.Variables[fc.Variable]
+		if !ok {
+			return nil, fmt.Errorf("for_each variable %q is not defined", fc.Variable)
+		}
+		forEach.Items = items
+	}
+
+	if err := forEach.Validate(); err != nil {
+		return nil, err
+	}
+
+	return forEach, nil
+}
+
+// resolveRetry returns the engine retry policy of a resource, falling back to
+// the retry block of its provider.
+func (pc *ParsedConfig) resolveRetry(rc ResourceConfig) (*engine.RetryPolicy, error) {
+	retry := rc.Retry
+	if retry == nil {
+		// Namespaced resource types carry the provider before "::"
+		providerName, _, _ := strings.Cut(rc.Type, "::")
+		if rc.Provider != nil && rc.Provider.Name != "" {
+			providerName = rc.Provider.Name
+		}
+
+		for _, provider := range pc.Workspace.Providers {
+			if provider.Name == providerName {
+				retry = provider.Retry
+				break
+			}
+		}
+	}
+
+	if retry == nil {
+		return nil, nil
+	}
+
+	return retry.ToEngineRetry()
+}
+
+// ToEngineRetry converts the retry block to an engine.RetryPolicy.
+func (rc *RetryConfig) ToEngineRetry() (*engine.RetryPolicy, error) {
+	policy := &engine.RetryPolicy{
+		MaxAttempts: rc.MaxAttempts,
+		Backoff:     engine.BackoffCurve(rc.Backoff),
+	}
+
+	durations := []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"initial_delay", rc.InitialDelay, &policy.InitialDelay},
+		{"max_delay", rc.MaxDelay, &policy.MaxDelay},
+		{"attempt_timeout", rc.AttemptTimeout, &policy.AttemptTimeout},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retry %s %q: %w", d.name, d.value, err)
+		}
+		*d.dest = parsed
+	}
+
+	for _, class := range rc.RetryOn {
+		policy.RetryOn = append(policy.RetryOn, engine.ErrorClass(class))
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// toEngineChecks converts check blocks to engine health checks.
+func toEngineChecks(checks []CheckConfig) ([]engine.HealthCheck, error) {
+	var result []engine.HealthCheck
+	for i, cc := range checks {
+		check, err := cc.ToEngineCheck()
+		if err != nil {
+			return nil, fmt.Errorf("invalid check %d: %w", i, err)
+		}
+		result = append(result, check)
+	}
+	return result, nil
+}
+
+// ToEngineCheck converts the check block to an engine.HealthCheck.
+func (cc *CheckConfig) ToEngineCheck() (engine.HealthCheck, error) {
+	check := engine.HealthCheck{
+		Name:           cc.Name,
+		Type:           engine.HealthCheckType(cc.Type),
+		Command:        cc.Command,
+		ExpectExitCode: cc.ExpectExitCode,
+		URL:            cc.URL,
+		ExpectStatus:   cc.ExpectStatus,
+		ExpectBody:     cc.ExpectBody,
+		Port:           cc.Port,
+		Address:        cc.Address,
+		Path:           cc.Path,
+		Pattern:        cc.Pattern,
+		Fact:           cc.Fact,
+		Equals:         cc.Equals,
+	}
+
+	if cc.Timeout != "" {
+		timeout, err := time.ParseDuration(cc.Timeout)
+		if err != nil {
+			return check, fmt.Errorf("invalid check timeout %q: %w", cc.Timeout, err)
+		}
+		check.Timeout = timeout
+	}
+
+	if err := check.Validate(); err != nil {
+		return check, err
+	}
+
+	return check, nil
+}
+
+// hookGroup is a list of hook blocks and where its engine hooks go.
+type hookGroup struct {
+	name  string
+	hooks []HookConfig
+	dest  *[]engine.Hook
+}
+
+// toEngineHooks converts each group of hook blocks to engine hooks.
+func toEngineHooks(groups []hookGroup) error {
+	for _, group := range groups {
+		var result []engine.Hook
+		for i, hc := range group.hooks {
+			hook, err := hc.ToEngineHook()
+			if err != nil {
+				return fmt.Errorf("invalid %s hook %d: %w", group.name, i, err)
+			}
+			result = append(result, hook)
+		}
+		*group.dest = result
+	}
+	return nil
+}
+
+// ToEngineHooks converts the run hooks block to engine.RunHooks.
+func (hc *HooksConfig) ToEngineHooks() (*engine.RunHooks, error) {
+	if hc == nil {
+		return nil, nil
+	}
+
+	hooks := &engine.RunHooks{}
+	err := toEngineHooks([]hookGroup{
+		{"before_run", hc.BeforeRun, &hooks.BeforeRun},
+		{"after_run", hc.AfterRun, &hooks.AfterRun},
+		{"before_batch", hc.BeforeBatch, &hooks.BeforeBatch},
+		{"after_batch", hc.AfterBatch, &hooks.AfterBatch},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+// ToEngineHooks converts the resource hooks block to engine.ResourceHooks.
+func (rh *ResourceHooksConfig) ToEngineHooks() (*engine.ResourceHooks, error) {
+	if rh == nil {
+		return nil, nil
+	}
+
+	hooks := &engine.ResourceHooks{}
+	err := toEngineHooks([]hookGroup{
+		{"before", rh.Before, &hooks.Before},
+		{"after", rh.After, &hooks.After},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+// ToEngineHook converts the hook block to an engine.Hook.
+func (hc *HookConfig) ToEngineHook() (engine.Hook, error) {
+	hook := engine.Hook{
+		Name:              hc.Name,
+		Type:              engine.HookType(hc.Type),
+		Command:           hc.Command,
+		URL:               hc.URL,
+		Headers:           hc.Headers,
+		ContinueOnFailure: hc.ContinueOnFailure,
+	}
+
+	if hc.Timeout != "" {
+		timeout, err := time.ParseDuration(hc.Timeout)
+		if err != nil {
+			return hook, fmt.Errorf("invalid hook timeout %q: %w", hc.Timeout, err)
+		}
+		hook.Timeout = timeout
+	}
+
+	if err := hook.Validate(); err != nil {
+		return hook, err
+	}
+
+	return hook, nil
+}
+
 // formatSourceFiles formats source files for display.
 func formatSourceFiles(files []string) string {
 	if len(files) == 0 {
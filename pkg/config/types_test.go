@@ -0,0 +1,409 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/openfroyo/openfroyo/pkg/engine"
+)
+
+// staticHosts is a fixed host inventory.
+type staticHosts []*engine.Host
+
+func (h staticHosts) ListHosts(ctx context.Context) ([]*engine.Host, error) {
+	return h, nil
+}
+
+// emptyState is a state manager without any resources, so every resource
+// is planned for creation.
+type emptyState struct {
+	engine.StateManager
+}
+
+func (emptyState) GetResource(ctx context.Context, resourceID string) (*engine.Resource, error) {
+	return nil, errors.New("resource not found")
+}
+
+func (emptyState) GetResourceState(ctx context.Context, resourceID string) (json.RawMessage, error) {
+	return nil, errors.New("resource not found")
+}
+
+// cachedFacts serves fixed facts per host, keyed by namespace.
+type cachedFacts map[string]map[string]any
+
+func (f cachedFacts) GetFacts(ctx context.Context, hostID string, namespace *string) (map[string]any, error) {
+	return f[hostID], nil
+}
+
+// testHosts is the inventory the planning tests target.
+var testHosts = staticHosts{
+	{ID: "db1", Labels: map[string]string{"role": "db"}},
+	{ID: "web1", Labels: map[string]string{"role": "web", "env": "prod"}},
+	{ID: "web2", Labels: map[string]string{"role": "web", "env": "prod"}},
+	{ID: "web3", Labels: map[string]string{"role": "web", "env": "staging"}},
+}
+
+// planInline parses an inline configuration and plans it against testHosts.
+func planInline(t *testing.T, content string, setup func(*engine.DefaultPlanner)) *engine.Plan {
+	t.Helper()
+	ctx := context.Background()
+
+	pc, err := NewCUEParser().ParseInline(ctx, content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pc.Errors) > 0 {
+		t.Fatalf("unexpected validation errors: %v", pc.Errors)
+	}
+
+	planner := engine.NewPlanner(nil, emptyState{})
+	planner.SetHosts(testHosts)
+	if setup != nil {
+		setup(planner)
+	}
+
+	config, err := pc.ToEngineConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	diff, err := planner.ComputeDiff(ctx, config, nil)
+	if err != nil {
+		t.Fatalf("failed to compute diff: %v", err)
+	}
+
+	plan, err := planner.BuildPlan(ctx, diff)
+	if err != nil {
+		t.Fatalf("failed to build plan: %v", err)
+	}
+
+	if err := planner.ValidatePlan(ctx, plan); err != nil {
+		t.Fatalf("invalid plan: %v", err)
+	}
+
+	return plan
+}
+
+// unitsByResource indexes plan units by resource ID.
+func unitsByResource(plan *engine.Plan) map[string]engine.PlanUnit {
+	units := make(map[string]engine.PlanUnit, len(plan.Units))
+	for _, unit := range plan.Units {
+		units[unit.ResourceID] = unit
+	}
+	return units
+}
+
+func TestToEngineConfig_TargetsToRolloutBatches(t *testing.T) {
+	content := `
+workspace: {name: "rollout", version: "1.0"}
+
+resources: {
+	nginx: {
+		id: "nginx"
+		type: "linux.pkg"
+		name: "nginx"
+		config: {package: "nginx", state: "present"}
+		target: {selector: "role=web"}
+	}
+	motd: {
+		id: "motd"
+		type: "linux.file"
+		name: "motd"
+		config: {path: "/etc/motd", content: "managed by froyo"}
+		target: {hosts: ["web*"], labels: {env: "prod"}}
+	}
+}
+`
+
+	plan := planInline(t, content, nil)
+
+	units := unitsByResource(plan)
+	if len(units) != 5 {
+		t.Fatalf("expected 5 plan units, got %d", len(units))
+	}
+	expected := map[string]string{
+		"nginx@web1": "web1",
+		"nginx@web2": "web2",
+		"nginx@web3": "web3",
+		"motd@web1":  "web1",
+		"motd@web2":  "web2",
+	}
+	for id, host := range expected {
+		unit, ok := units[id]
+		if !ok {
+			t.Fatalf("expected a plan unit for %s", id)
+		}
+		if unit.TargetID != host {
+			t.Errorf("expected %s to target %s, got %q", id, host, unit.TargetID)
+		}
+	}
+
+	batches := (&engine.RolloutOptions{BatchSize: 2}).Batches(plan)
+	if len(batches) != 2 {
+		t.Fatalf("expected 2 batches, got %v", batches)
+	}
+	if batches[0][0] != "web1" || batches[0][1] != "web2" || batches[1][0] != "web3" {
+		t.Errorf("unexpected batches: %v", batches)
+	}
+}
+
+func TestToEngineConfig_TargetWithoutInventory(t *testing.T) {
+	ctx := context.Background()
+
+	pc, err := NewCUEParser().ParseInline(ctx, `
+workspace: {name: "rollout", version: "1.0"}
+
+resources: {
+	nginx: {
+		id: "nginx"
+		type: "linux.pkg"
+		name: "nginx"
+		config: {package: "nginx"}
+		target: {all: true}
+	}
+}
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	config, err := pc.ToEngineConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	planner := engine.NewPlanner(nil, emptyState{})
+	if _, err := planner.ComputeDiff(ctx, config, nil); err == nil {
+		t.Error("expected an error planning a targeted resource without a host inventory")
+	}
+}
+
+func TestToEngineConfig_DependenciesFollowTheConfig(t *testing.T) {
+	content := `
+workspace: {name: "handlers", version: "1.0"}
+
+resources: {
+	nginx_restart: {
+		id: "nginx_restart"
+		type: "linux.service"
+		name: "restart nginx"
+		config: {name: "nginx", state: "restarted"}
+		handler: true
+		target: {selector: "env=prod"}
+		dependencies: [{resource_id: "nginx_conf", type: "notify"}]
+	}
+	nginx_conf: {
+		id: "nginx_conf"
+		type: "linux.file"
+		name: "nginx.conf"
+		config: {path: "/etc/nginx/nginx.conf", content: "worker_processes auto;"}
+		target: {selector: "env=prod"}
+		dependencies: [{resource_id: "nginx_pkg", type: "require"}]
+	}
+	nginx_pkg: {
+		id: "nginx_pkg"
+		type: "linux.pkg"
+		name: "nginx"
+		config: {package: "nginx"}
+		target: {selector: "env=prod"}
+	}
+}
+`
+
+	// Nothing is in state yet, so every edge must come from the config
+	plan := planInline(t, content, nil)
+	units := unitsByResource(plan)
+
+	for _, host := range []string{"web1", "web2"} {
+		handler := units[engine.HostResourceID("nginx_restart", host)]
+		conf := units[engine.HostResourceID("nginx_conf", host)]
+		pkg := units[engine.HostResourceID("nginx_pkg", host)]
+
+		if handler.ProviderName != "linux.service" {
+			t.Errorf("expected the handler provider from the config, got %q", handler.ProviderName)
+		}
+		if len(handler.Dependencies) != 1 || handler.Dependencies[0].Type != engine.DependencyNotify ||
+			handler.Dependencies[0].TargetID != conf.ID {
+			t.Errorf("expected the handler on %s to be notified by nginx_conf on the same host, got %+v",
+				host, handler.Dependencies)
+		}
+		if len(conf.Dependencies) != 1 || conf.Dependencies[0].TargetID != pkg.ID {
+			t.Errorf("expected nginx_conf on %s to require nginx_pkg on the same host, got %+v",
+				host, conf.Dependencies)
+		}
+	}
+}
+
+func TestToEngineConfig_ConditionsAndFactExpansion(t *testing.T) {
+	content := `
+workspace: {name: "facts", version: "1.0"}
+
+resources: {
+	ufw: {
+		id: "ufw"
+		type: "linux.pkg"
+		name: "ufw"
+		config: {package: "ufw", state: "present"}
+		target: {selector: "role=web"}
+		when: {expr: #"os.basic.distro == "ubuntu""#}
+	}
+	mounts: {
+		id: "mounts"
+		type: "linux.mount"
+		name: "data mounts"
+		config: {device: "${each.key}", host: "${facts.os.basic.hostname}"}
+		target: {hosts: ["web1"]}
+		for_each: {fact: "hw.disk.devices", key: "device"}
+	}
+}
+`
+
+	facts := cachedFacts{
+		"web1": {
+			"os.basic": map[string]any{"distro": "ubuntu", "hostname": "web1.example.com"},
+			"hw.disk": map[string]any{"devices": []any{
+				map[string]any{"device": "sdb"},
+				map[string]any{"device": "sdc"},
+			}},
+		},
+		"web2": {"os.basic": map[string]any{"distro": "rhel"}},
+		"web3": {"os.basic": map[string]any{"distro": "ubuntu"}},
+	}
+
+	plan := planInline(t, content, func(planner *engine.DefaultPlanner) {
+		planner.SetConditionEvaluator(NewConditionEvaluator(), facts)
+	})
+	units := unitsByResource(plan)
+
+	// The condition is evaluated against each host's own facts
+	for id, planned := range map[string]bool{"ufw@web1": true, "ufw@web2": false, "ufw@web3": true} {
+		if _, ok := units[id]; ok != planned {
+			t.Errorf("expected %s planned = %v", id, planned)
+		}
+	}
+	if len(plan.Skipped) != 1 || plan.Skipped[0].ResourceID != "ufw@web2" || plan.Skipped[0].TargetID != "web2" {
+		t.Errorf("expected ufw to be skipped on web2, got %+v", plan.Skipped)
+	}
+
+	// for_each over facts expands per host after targets are resolved
+	unit, ok := units["mounts@web1[sdb]"]
+	if !ok || units["mounts@web1[sdc]"].TargetID != "web1" {
+		t.Fatalf("expected one mount per disk of web1, got %v", plan.Units)
+	}
+	if string(unit.DesiredState) != `{"device":"sdb","host":"web1.example.com"}` {
+		t.Errorf("unexpected rendered config: %s", unit.DesiredState)
+	}
+}
+
+func TestToEngineConfig_ChecksRunOnTargetHosts(t *testing.T) {
+	content := `
+workspace: {name: "checks", version: "1.0"}
+
+resources: {
+	nginx: {
+		id: "nginx"
+		type: "linux.pkg"
+		name: "nginx"
+		config: {package: "nginx", state: "present"}
+		target: {selector: "env=prod"}
+		checks: [{name: "homepage", type: "http", url: "http://localhost/", expect_status: 200}]
+	}
+}
+`
+
+	plan := planInline(t, content, nil)
+	if len(plan.Units) != 2 {
+		t.Fatalf("expected 2 plan units, got %d", len(plan.Units))
+	}
+	for _, unit := range plan.Units {
+		if unit.TargetID == "" || len(unit.Checks) != 1 {
+			t.Errorf("expected a check on a target host, got %+v", unit)
+		}
+	}
+}
+
+func TestToEngineConfig_RemoteHooksRunOnTargetHosts(t *testing.T) {
+	content := `
+workspace: {name: "hooks", version: "1.0"}
+
+resources: {
+	nginx: {
+		id: "nginx"
+		type: "linux.pkg"
+		name: "nginx"
+		config: {package: "nginx", state: "present"}
+		target: {hosts: ["web1"]}
+		hooks: {
+			after: [{name: "reload", type: "remote", command: "systemctl reload nginx"}]
+		}
+	}
+}
+`
+
+	plan := planInline(t, content, nil)
+	if len(plan.Units) != 1 || plan.Units[0].TargetID != "web1" || plan.Units[0].Hooks == nil {
+		t.Fatalf("expected one hooked unit on web1, got %+v", plan.Units)
+	}
+}
+
+func TestToEngineConfig_WaitsPollTargetHosts(t *testing.T) {
+	content := `
+workspace: {name: "waits", version: "1.0"}
+
+resources: {
+	app_ready: {
+		id: "app_ready"
+		type: "wait"
+		name: "app accepts connections"
+		config: {type: "port", port: 8080, timeout: "2m"}
+		target: {selector: "env=prod"}
+	}
+	smoke_test: {
+		id: "smoke_test"
+		type: "linux.exec"
+		name: "smoke test"
+		config: {command: "app smoke-test"}
+		target: {selector: "env=prod"}
+		dependencies: [{resource_id: "app_ready", type: "require"}]
+	}
+}
+`
+
+	plan := planInline(t, content, nil)
+	units := unitsByResource(plan)
+
+	for _, host := range []string{"web1", "web2"} {
+		wait := units[engine.HostResourceID("app_ready", host)]
+		if wait.Wait == nil || wait.TargetID != host {
+			t.Fatalf("expected a wait on %s, got %+v", host, wait)
+		}
+
+		smoke := units[engine.HostResourceID("smoke_test", host)]
+		if len(smoke.Dependencies) != 1 || smoke.Dependencies[0].TargetID != wait.ID {
+			t.Errorf("expected smoke_test on %s to wait on its own host, got %+v", host, smoke.Dependencies)
+		}
+	}
+}
+
+func TestToEngineConfig_InvalidBlocks(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource ResourceConfig
+	}{
+		{"retry", ResourceConfig{ID: "app", Retry: &RetryConfig{MaxAttempts: 3, InitialDelay: "soon"}}},
+		{"for_each", ResourceConfig{ID: "users", ForEach: &ForEachConfig{Variable: "users"}}},
+		{"check", ResourceConfig{ID: "app", Checks: []CheckConfig{{Name: "up", Type: "port"}}}},
+		{"hook", ResourceConfig{ID: "app", Hooks: &ResourceHooksConfig{Before: []HookConfig{{Name: "drain"}}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc := &ParsedConfig{Resources: []ResourceConfig{tt.resource}}
+			if _, err := pc.ToEngineConfig(); err == nil {
+				t.Error("expected an error converting an invalid block")
+			}
+		})
+	}
+}
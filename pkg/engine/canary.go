@@ -0,0 +1,204 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CanaryOptions configures a canary run. The plan is first applied to the
+// canary hosts, which must then pass every health check before and after the
+// soak period for the rest of the hosts to be changed.
+type CanaryOptions struct {
+	// Hosts are the IDs of the canary hosts.
+	Hosts []string `json:"hosts,omitempty"`
+
+	// Count picks the first Count hosts of the plan, in sorted order, as
+	// canaries. It is used when Hosts is empty.
+	Count int `json:"count,omitempty"`
+
+	// Checks are the health checks the canary hosts must pass.
+	Checks []HealthCheck `json:"checks,omitempty"`
+
+	// Soak is how long to wait after the first health checks before checking
+	// the canaries again and continuing.
+	Soak time.Duration `json:"soak,omitempty"`
+
+	// Rollback undoes the changes made to the canary hosts when the canary fails.
+	Rollback bool `json:"rollback,omitempty"`
+}
+
+// Validate checks that the canary options are consistent.
+func (c *CanaryOptions) Validate() error {
+	if len(c.Hosts) == 0 && c.Count <= 0 {
+		return NewPermanentError("canary requires hosts or a positive host count", nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	if c.Soak < 0 {
+		return NewPermanentError("canary soak cannot be negative", nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	for i := range c.Checks {
+		if err := c.Checks[i].Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// canaryHosts returns the sorted canary hosts targeted by the plan.
+func canaryHosts(plan *Plan, canary *CanaryOptions) []string {
+	wanted := make(map[string]bool, len(canary.Hosts))
+	for _, host := range canary.Hosts {
+		wanted[host] = true
+	}
+
+	seen := make(map[string]bool)
+	hosts := make([]string, 0)
+	for _, unit := range plan.Units {
+		if unit.TargetID == "" || seen[unit.TargetID] {
+			continue
+		}
+		if len(wanted) > 0 && !wanted[unit.TargetID] {
+			continue
+		}
+		seen[unit.TargetID] = true
+		hosts = append(hosts, unit.TargetID)
+	}
+
+	// Sort hosts so the same canaries are picked across runs
+	sort.Strings(hosts)
+
+	if len(wanted) == 0 && len(hosts) > canary.Count {
+		hosts = hosts[:canary.Count]
+	}
+
+	return hosts
+}
+
+// executeCanary applies the plan to the canary hosts, gates on their health
+// and then applies the remaining hosts, in batches when rolling out.
+// Units without a target host run with the canaries.
+func (s *ParallelScheduler) executeCanary(
+	ctx context.Context,
+	run *Run,
+	plan *Plan,
+	opts ScheduleOptions,
+) error {
+	canary := opts.Canary
+	hosts := canaryHosts(plan, canary)
+	if len(hosts) == 0 {
+		return NewPermanentError("no plan units target the canary hosts", nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	inCanary := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		inCanary[host] = true
+	}
+
+	// Step 1: Apply the canary hosts
+	s.publishEvent(ctx, run.ID, "", EventTypeInfo,
+		fmt.Sprintf("Starting canary on %d hosts: %s", len(hosts), strings.Join(hosts, ", ")), "info")
+
+	canaryUnits := buildUnitMap(plan, func(unit *PlanUnit) bool {
+		return inCanary[unit.TargetID] || unit.TargetID == ""
+	})
+
+	err := s.executeBatch(ctx, run, plan, canaryUnits, opts, hosts, 0)
+	if failed := s.countFailedHosts(plan, inCanary); err != nil || failed > 0 {
+		return s.abortCanary(ctx, run, plan, canaryUnits, opts,
+			fmt.Sprintf("%d of %d canary hosts failed to apply", failed, len(hosts)))
+	}
+
+	// Step 2: Gate on the canary health checks, before and after soaking
+	if failed := s.runHealthChecks(ctx, run, hosts, canary.Checks); failed > 0 {
+		return s.abortCanary(ctx, run, plan, canaryUnits, opts,
+			fmt.Sprintf("%d canary health checks failed", failed))
+	}
+
+	if canary.Soak > 0 {
+		s.publishEvent(ctx, run.ID, "", EventTypeInfo,
+			fmt.Sprintf("Soaking canary hosts for %s", canary.Soak), "info")
+
+		select {
+		case <-time.After(canary.Soak):
+		case <-ctx.Done():
+			return s.handleCancellation(ctx, run, plan)
+		}
+
+		if failed := s.runHealthChecks(ctx, run, hosts, canary.Checks); failed > 0 {
+			return s.abortCanary(ctx, run, plan, canaryUnits, opts,
+				fmt.Sprintf("%d canary health checks failed after soaking", failed))
+		}
+	}
+
+	s.publishEvent(ctx, run.ID, "", EventTypeInfo, "Canary passed, continuing with remaining hosts", "info")
+
+	// Step 3: Apply the remaining hosts
+	if opts.Rollout != nil {
+		return s.executeRollout(ctx, run, plan, opts, inCanary)
+	}
+
+	remaining := buildUnitMap(plan, func(unit *PlanUnit) bool {
+		return unit.TargetID != "" && !inCanary[unit.TargetID]
+	})
+
+	remainingHosts := make([]string, 0)
+	for _, host := range planHosts(plan) {
+		if !inCanary[host] {
+			remainingHosts = append(remainingHosts, host)
+		}
+	}
+
+	return s.executeBatch(ctx, run, plan, remaining, opts, remainingHosts, 1)
+}
+
+// runHealthChecks runs every check against every host, over one connection
+// per host, and returns the number of failed checks. Checks that cannot be
+// run count as failed.
+func (s *ParallelScheduler) runHealthChecks(
+	ctx context.Context,
+	run *Run,
+	hosts []string,
+	checks []HealthCheck,
+) int {
+	failed := 0
+	for _, host := range hosts {
+		for _, passed := range s.runChecks(ctx, run, nil, host, checks) {
+			if !passed {
+				failed++
+			}
+		}
+	}
+
+	return failed
+}
+
+// abortCanary cancels the rest of the run and, when requested, rolls back
+// the units that succeeded on the canary hosts.
+func (s *ParallelScheduler) abortCanary(
+	ctx context.Context,
+	run *Run,
+	plan *Plan,
+	canaryUnits map[string]*PlanUnit,
+	opts ScheduleOptions,
+	reason string,
+) error {
+	s.cancelPendingUnits(plan)
+
+	if opts.Canary.Rollback {
+		if err := s.rollbackUnits(ctx, run, plan, canaryUnits, opts); err != nil {
+			return NewPermanentError(fmt.Sprintf("canary failed: %s; rollback failed", reason), err).
+				WithCode(ErrCodeProviderFailed)
+		}
+	}
+
+	return NewPermanentError(fmt.Sprintf("canary failed: %s", reason), nil).
+		WithCode(ErrCodeProviderFailed)
+}
@@ -0,0 +1,246 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockHealthChecker fails the checks of the configured hosts.
+type mockHealthChecker struct {
+	mu        sync.Mutex
+	failHosts map[string]bool
+	checked   []string
+	sessions  int
+}
+
+func newMockHealthChecker() *mockHealthChecker {
+	return &mockHealthChecker{failHosts: make(map[string]bool)}
+}
+
+func (m *mockHealthChecker) RunCheck(ctx context.Context, hostID string, check HealthCheck) (*HealthCheckResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.checked = append(m.checked, hostID)
+	if m.failHosts[hostID] {
+		return &HealthCheckResult{Name: check.Name, HostID: hostID, Message: "unhealthy"}, nil
+	}
+	return &HealthCheckResult{Name: check.Name, HostID: hostID, Passed: true}, nil
+}
+
+func (m *mockHealthChecker) RunChecks(ctx context.Context, hostID string, checks []HealthCheck) []*HealthCheckResult {
+	m.mu.Lock()
+	m.sessions++
+	m.mu.Unlock()
+
+	results := make([]*HealthCheckResult, len(checks))
+	for i, check := range checks {
+		results[i], _ = m.RunCheck(ctx, hostID, check)
+	}
+	return results
+}
+
+func (m *mockHealthChecker) NewSession(hostID string) HealthCheckSession {
+	m.mu.Lock()
+	m.sessions++
+	m.mu.Unlock()
+
+	return &mockCheckSession{checker: m, hostID: hostID}
+}
+
+// mockCheckSession runs checks through a health checker's RunCheck.
+type mockCheckSession struct {
+	checker HealthChecker
+	hostID  string
+}
+
+func (s *mockCheckSession) RunCheck(ctx context.Context, check HealthCheck) (*HealthCheckResult, error) {
+	return s.checker.RunCheck(ctx, s.hostID, check)
+}
+
+func (s *mockCheckSession) Close(ctx context.Context) {}
+
+var testHealthCheck = HealthCheck{Name: "nginx", Type: HealthCheckHTTP, URL: "http://localhost/healthz"}
+
+func TestCanaryOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		canary  CanaryOptions
+		wantErr bool
+	}{
+		{"count", CanaryOptions{Count: 1}, false},
+		{"hosts", CanaryOptions{Hosts: []string{"web1"}, Checks: []HealthCheck{testHealthCheck}}, false},
+		{"no hosts", CanaryOptions{}, true},
+		{"negative soak", CanaryOptions{Count: 1, Soak: -time.Second}, true},
+		{"invalid check", CanaryOptions{Count: 1, Checks: []HealthCheck{{Name: "x", Type: HealthCheckCommand}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.canary.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCanaryHosts(t *testing.T) {
+	plan := newHostPlan(t, "web3", "web1", "web2")
+
+	hosts := canaryHosts(plan, &CanaryOptions{Count: 2})
+	if len(hosts) != 2 || hosts[0] != "web1" || hosts[1] != "web2" {
+		t.Errorf("Expected [web1 web2], got %v", hosts)
+	}
+
+	// Explicit hosts not targeted by the plan are ignored
+	hosts = canaryHosts(plan, &CanaryOptions{Hosts: []string{"web3", "db1"}})
+	if len(hosts) != 1 || hosts[0] != "web3" {
+		t.Errorf("Expected [web3], got %v", hosts)
+	}
+}
+
+func TestScheduler_Canary_ContinuesWhenHealthy(t *testing.T) {
+	executor := newMockExecutor()
+	checker := newMockHealthChecker()
+	stateMgr := newMockStateManager()
+	scheduler := NewParallelScheduler(5, executor, newMockEventPublisher(), stateMgr)
+	scheduler.SetHealthChecker(checker)
+
+	ctx := context.Background()
+	plan := newHostPlan(t, "web1", "web2", "web3")
+
+	runID, err := scheduler.Schedule(ctx, plan, ScheduleOptions{
+		Canary: &CanaryOptions{Count: 1, Checks: []HealthCheck{testHealthCheck}, Soak: 20 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(200 * time.Millisecond)
+
+	executor.mu.Lock()
+	executed := append([]string{}, executor.executedUnits...)
+	executor.mu.Unlock()
+
+	if len(executed) != 3 || executed[0] != "web1-pkg" {
+		t.Errorf("Expected canary web1 first then all hosts, got %v", executed)
+	}
+
+	// The canary is checked before and after soaking
+	checker.mu.Lock()
+	checks := len(checker.checked)
+	checker.mu.Unlock()
+	if checks != 2 {
+		t.Errorf("Expected 2 health checks, got %d", checks)
+	}
+
+	run, err := stateMgr.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("Failed to get run: %v", err)
+	}
+
+	if run.Status != RunStatusSucceeded {
+		t.Errorf("Expected run status SUCCEEDED, got %s", run.Status)
+	}
+}
+
+func TestScheduler_Canary_OneSessionPerHost(t *testing.T) {
+	executor := newMockExecutor()
+	checker := newMockHealthChecker()
+	scheduler := NewParallelScheduler(5, executor, newMockEventPublisher(), newMockStateManager())
+	scheduler.SetHealthChecker(checker)
+
+	ctx := context.Background()
+	plan := newHostPlan(t, "web1", "web2", "web3")
+
+	portCheck := HealthCheck{Name: "ssh", Type: HealthCheckPort, Port: 22}
+	_, err := scheduler.Schedule(ctx, plan, ScheduleOptions{
+		Canary: &CanaryOptions{Count: 2, Checks: []HealthCheck{testHealthCheck, portCheck}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(200 * time.Millisecond)
+
+	// Both checks of a canary host share one session
+	checker.mu.Lock()
+	defer checker.mu.Unlock()
+	if len(checker.checked) != 4 || checker.sessions != 2 {
+		t.Errorf("Expected 4 checks over 2 sessions, got %d checks over %d sessions",
+			len(checker.checked), checker.sessions)
+	}
+}
+
+func TestScheduler_Canary_StopsAndRollsBackWhenUnhealthy(t *testing.T) {
+	executor := newMockExecutor()
+	checker := newMockHealthChecker()
+	checker.failHosts["web1"] = true
+	stateMgr := newMockStateManager()
+	scheduler := NewParallelScheduler(5, executor, newMockEventPublisher(), stateMgr)
+	scheduler.SetHealthChecker(checker)
+
+	ctx := context.Background()
+	plan := newHostPlan(t, "web1", "web2", "web3")
+	for i := range plan.Units {
+		plan.Units[i].ActualState = json.RawMessage(`{"version": "1.0"}`)
+		plan.Units[i].DesiredState = json.RawMessage(`{"version": "2.0"}`)
+	}
+
+	runID, err := scheduler.Schedule(ctx, plan, ScheduleOptions{
+		Canary: &CanaryOptions{Hosts: []string{"web1"}, Checks: []HealthCheck{testHealthCheck}, Rollback: true},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(200 * time.Millisecond)
+
+	if count := countExecutions(executor, "web2-pkg") + countExecutions(executor, "web3-pkg"); count != 0 {
+		t.Errorf("Expected remaining hosts not to run, got %d executions", count)
+	}
+
+	// The canary unit ran once and was then rolled back
+	executor.mu.Lock()
+	executed := len(executor.executedUnits)
+	executor.mu.Unlock()
+	if executed != 2 {
+		t.Errorf("Expected canary apply and rollback, got %d executions", executed)
+	}
+
+	run, err := stateMgr.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("Failed to get run: %v", err)
+	}
+
+	if run.Status != RunStatusFailed {
+		t.Errorf("Expected run status FAILED, got %s", run.Status)
+	}
+
+	if run.Summary.Cancelled != 2 {
+		t.Errorf("Expected 2 cancelled units, got %d", run.Summary.Cancelled)
+	}
+
+	if _, ok := run.Metadata["rollback_plan_id"]; !ok {
+		t.Error("Expected rollback plan ID in run metadata")
+	}
+}
+
+func TestScheduler_Canary_RequiresHealthChecker(t *testing.T) {
+	scheduler := NewParallelScheduler(5, newMockExecutor(), newMockEventPublisher(), newMockStateManager())
+	plan := newHostPlan(t, "web1")
+
+	_, err := scheduler.Schedule(context.Background(), plan, ScheduleOptions{
+		Canary: &CanaryOptions{Count: 1, Checks: []HealthCheck{testHealthCheck}},
+	})
+	if err == nil {
+		t.Fatal("Expected error without a health checker, got nil")
+	}
+}
@@ -0,0 +1,153 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// planHasChecks reports whether the plan declares any post-apply checks.
+func planHasChecks(plan *Plan) bool {
+	if len(plan.Checks) > 0 {
+		return true
+	}
+	for i := range plan.Units {
+		if len(plan.Units[i].Checks) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// validatePlanChecks checks the post-apply checks of the plan and its units.
+func validatePlanChecks(plan *Plan) error {
+	for i := range plan.Checks {
+		if err := plan.Checks[i].Validate(); err != nil {
+			return err
+		}
+	}
+	for i := range plan.Units {
+		for j := range plan.Units[i].Checks {
+			if err := plan.Units[i].Checks[j].Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// planHosts returns the sorted IDs of the hosts targeted by the plan.
+func planHosts(plan *Plan) []string {
+	seen := make(map[string]bool)
+	hosts := make([]string, 0)
+	for _, unit := range plan.Units {
+		if unit.TargetID == "" || seen[unit.TargetID] {
+			continue
+		}
+		seen[unit.TargetID] = true
+		hosts = append(hosts, unit.TargetID)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// runUnitChecks runs the post-apply checks of a unit that succeeded against
+// its host. Deletes are not checked, since there is nothing left to verify.
+func (s *ParallelScheduler) runUnitChecks(ctx context.Context, run *Run, unit *PlanUnit, opts ScheduleOptions) {
+	if len(unit.Checks) == 0 || opts.DryRun || unit.Operation == OperationDelete {
+		return
+	}
+
+	for _, passed := range s.runChecks(ctx, run, unit, unit.TargetID, unit.Checks) {
+		s.recordCheck(run, passed)
+	}
+}
+
+// runWorkspaceChecks runs the workspace checks of the plan against every
+// host the plan targets.
+func (s *ParallelScheduler) runWorkspaceChecks(ctx context.Context, run *Run, plan *Plan, opts ScheduleOptions) {
+	if len(plan.Checks) == 0 || opts.DryRun {
+		return
+	}
+
+	hosts := planHosts(plan)
+	s.publishEvent(ctx, run.ID, "", EventTypeInfo,
+		fmt.Sprintf("Running %d workspace checks on %d hosts", len(plan.Checks), len(hosts)), "info")
+
+	for _, host := range hosts {
+		for _, passed := range s.runChecks(ctx, run, nil, host, plan.Checks) {
+			s.recordCheck(run, passed)
+		}
+	}
+}
+
+// recordCheck counts a post-apply check in the run summary.
+func (s *ParallelScheduler) recordCheck(run *Run, passed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if passed {
+		run.Summary.ChecksPassed++
+	} else {
+		run.Summary.ChecksFailed++
+	}
+}
+
+// runChecks runs checks against a host over one connection and publishes
+// each result as an event. It reports whether each check passed. The unit is
+// nil for checks that do not belong to a unit. Checks that cannot be run
+// count as failed.
+func (s *ParallelScheduler) runChecks(
+	ctx context.Context,
+	run *Run,
+	unit *PlanUnit,
+	host string,
+	checks []HealthCheck,
+) []bool {
+	results := s.healthChecker.RunChecks(ctx, host, checks)
+
+	passed := make([]bool, len(checks))
+	for i, check := range checks {
+		passed[i] = s.publishCheckResult(ctx, run, unit, host, check, results[i])
+	}
+
+	return passed
+}
+
+// publishCheckResult publishes the result of a check as an event and
+// reports whether the check passed.
+func (s *ParallelScheduler) publishCheckResult(
+	ctx context.Context,
+	run *Run,
+	unit *PlanUnit,
+	host string,
+	check HealthCheck,
+	result *HealthCheckResult,
+) bool {
+	details := map[string]interface{}{
+		"check":    check.Name,
+		"type":     check.Type,
+		"host_id":  host,
+		"passed":   result.Passed,
+		"duration": result.Duration.String(),
+	}
+	if result.Message != "" {
+		details["message"] = result.Message
+	}
+
+	unitID := ""
+	if unit != nil {
+		unitID = unit.ID
+		details["resource_id"] = unit.ResourceID
+	}
+
+	if result.Passed {
+		s.publishEventDetails(ctx, run.ID, unitID, EventTypeHealthCheckPassed,
+			fmt.Sprintf("Health check %s passed on %s", check.Name, host), "info", details)
+		return true
+	}
+
+	s.publishEventDetails(ctx, run.ID, unitID, EventTypeHealthCheckFailed,
+		fmt.Sprintf("Health check %s failed on %s: %s", check.Name, host, result.Message), "error", details)
+	return false
+}
@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestScheduler_PostApplyChecks_Pass(t *testing.T) {
+	checker := newMockHealthChecker()
+	publisher := newMockEventPublisher()
+	stateMgr := newMockStateManager()
+	scheduler := NewParallelScheduler(5, newMockExecutor(), publisher, stateMgr)
+	scheduler.SetHealthChecker(checker)
+
+	ctx := context.Background()
+	plan := newHostPlan(t, "web1", "web2")
+	plan.Units[0].Checks = []HealthCheck{testHealthCheck}
+	plan.Checks = []HealthCheck{{Name: "ssh", Type: HealthCheckPort, Port: 22}}
+
+	runID, err := scheduler.Schedule(ctx, plan, ScheduleOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(200 * time.Millisecond)
+
+	run, err := stateMgr.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("Failed to get run: %v", err)
+	}
+
+	if run.Status != RunStatusSucceeded {
+		t.Errorf("Expected run status SUCCEEDED, got %s", run.Status)
+	}
+
+	// One resource check on web1 and the workspace check on both hosts
+	if run.Summary.ChecksPassed != 3 || run.Summary.ChecksFailed != 0 {
+		t.Errorf("Expected 3 passed checks, got %+v", run.Summary)
+	}
+
+	// Results are recorded as events, resource checks against their unit
+	var unitCheck *Event
+	for _, event := range publisher.getEvents() {
+		if event.Type == EventTypeHealthCheckPassed && event.PlanUnitID == "web1-pkg" {
+			unitCheck = &event
+			break
+		}
+	}
+	if unitCheck == nil {
+		t.Fatal("Expected a health check event for web1-pkg")
+	}
+	if unitCheck.Details["check"] != "nginx" || unitCheck.Details["resource_id"] != "nginx_pkg" {
+		t.Errorf("Unexpected check event details: %v", unitCheck.Details)
+	}
+}
+
+func TestScheduler_PostApplyChecks_FailRun(t *testing.T) {
+	checker := newMockHealthChecker()
+	checker.failHosts["web2"] = true
+	stateMgr := newMockStateManager()
+	scheduler := NewParallelScheduler(5, newMockExecutor(), newMockEventPublisher(), stateMgr)
+	scheduler.SetHealthChecker(checker)
+
+	ctx := context.Background()
+	plan := newHostPlan(t, "web1", "web2")
+	for i := range plan.Units {
+		plan.Units[i].Checks = []HealthCheck{testHealthCheck}
+	}
+
+	runID, err := scheduler.Schedule(ctx, plan, ScheduleOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(200 * time.Millisecond)
+
+	run, err := stateMgr.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("Failed to get run: %v", err)
+	}
+
+	// The units themselves succeeded, but the failed check fails the run
+	if run.Summary.Succeeded != 2 || run.Summary.ChecksFailed != 1 {
+		t.Errorf("Expected 2 succeeded units and 1 failed check, got %+v", run.Summary)
+	}
+
+	if run.Status != RunStatusFailed {
+		t.Errorf("Expected run status FAILED, got %s", run.Status)
+	}
+}
+
+func TestScheduler_PostApplyChecks_SkippedOnDryRun(t *testing.T) {
+	stateMgr := newMockStateManager()
+	scheduler := NewParallelScheduler(5, newMockExecutor(), newMockEventPublisher(), stateMgr)
+
+	ctx := context.Background()
+	plan := newHostPlan(t, "web1")
+	plan.Units[0].Checks = []HealthCheck{testHealthCheck}
+
+	// Checks require a health checker, except on dry runs where they never run
+	if _, err := scheduler.Schedule(ctx, plan, ScheduleOptions{}); err == nil {
+		t.Fatal("Expected error for checks without a health checker, got nil")
+	}
+
+	runID, err := scheduler.Schedule(ctx, plan, ScheduleOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(200 * time.Millisecond)
+
+	run, err := stateMgr.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("Failed to get run: %v", err)
+	}
+
+	if run.Status != RunStatusSucceeded || run.Summary.ChecksPassed != 0 {
+		t.Errorf("Expected a succeeded run without checks, got %s %+v", run.Status, run.Summary)
+	}
+}
@@ -0,0 +1,239 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ConcurrencyScope selects which plan units share a concurrency key.
+type ConcurrencyScope string
+
+const (
+	// ConcurrencyScopeHost keys units by their target host.
+	ConcurrencyScopeHost ConcurrencyScope = "host"
+
+	// ConcurrencyScopeProvider keys units by their provider.
+	ConcurrencyScopeProvider ConcurrencyScope = "provider"
+
+	// ConcurrencyScopeLabel keys units by the value of one of their labels.
+	ConcurrencyScopeLabel ConcurrencyScope = "label"
+)
+
+// ConcurrencyLimit caps the number of plan units running at the same time
+// for each distinct value of a concurrency key, on top of MaxParallel.
+type ConcurrencyLimit struct {
+	// Scope selects the concurrency key.
+	Scope ConcurrencyScope `json:"scope"`
+
+	// Label is the unit label whose value forms the key for the label scope.
+	Label string `json:"label,omitempty"`
+
+	// Max is the maximum number of concurrent units per key value.
+	Max int `json:"max"`
+}
+
+// Validate checks that the concurrency limit is consistent.
+func (c *ConcurrencyLimit) Validate() error {
+	switch c.Scope {
+	case ConcurrencyScopeHost, ConcurrencyScopeProvider:
+	case ConcurrencyScopeLabel:
+		if c.Label == "" {
+			return NewPermanentError("label concurrency limit requires a label", nil).
+				WithCode(ErrCodeValidation)
+		}
+	default:
+		return NewPermanentError(fmt.Sprintf("invalid concurrency scope: %s", c.Scope), nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	if c.Max < 1 {
+		return NewPermanentError("concurrency limit must be at least 1", nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	return nil
+}
+
+// validateConcurrencyLimits validates each limit and rejects limits that
+// share a scope, since they would count the same keys.
+func validateConcurrencyLimits(limits []ConcurrencyLimit) error {
+	seen := make(map[ConcurrencyLimit]bool, len(limits))
+	for i := range limits {
+		if err := limits[i].Validate(); err != nil {
+			return err
+		}
+
+		scope := ConcurrencyLimit{Scope: limits[i].Scope, Label: limits[i].Label}
+		if seen[scope] {
+			name := string(scope.Scope)
+			if scope.Label != "" {
+				name += ":" + scope.Label
+			}
+			return NewPermanentError(fmt.Sprintf("duplicate concurrency limit: %s", name), nil).
+				WithCode(ErrCodeValidation)
+		}
+		seen[scope] = true
+	}
+
+	return nil
+}
+
+// key returns the concurrency key value of the unit, or false when the limit
+// does not apply to it.
+func (c *ConcurrencyLimit) key(unit *PlanUnit) (string, bool) {
+	switch c.Scope {
+	case ConcurrencyScopeHost:
+		return unit.TargetID, unit.TargetID != ""
+	case ConcurrencyScopeProvider:
+		return unit.ProviderName, unit.ProviderName != ""
+	case ConcurrencyScopeLabel:
+		value, ok := unit.Labels[c.Label]
+		return c.Label + "=" + value, ok
+	}
+	return "", false
+}
+
+// ConcurrencyMetrics records how long plan units wait on concurrency keys.
+// telemetry.Metrics implements it.
+type ConcurrencyMetrics interface {
+	// RecordConcurrencyWait records the time a unit waited for a slot on a key.
+	RecordConcurrencyWait(scope, key string, wait time.Duration)
+}
+
+// concurrencyKey is a key value of a concurrency limit.
+type concurrencyKey struct {
+	scope ConcurrencyScope
+	value string
+	max   int
+}
+
+// id returns the key used to count running units.
+func (k concurrencyKey) id() string {
+	return string(k.scope) + ":" + k.value
+}
+
+// concurrencyWait tracks a unit blocked on concurrency keys.
+type concurrencyWait struct {
+	since time.Time
+	keys  map[concurrencyKey]bool
+}
+
+// concurrencyLimiter enforces concurrency limits with fair queueing: blocked
+// units keep their place in the queue and hold on to every key they waited
+// on, so a later unit sharing one of those keys cannot start before them.
+// Units needing several keys are therefore not starved by units needing only
+// one. A nil limiter admits everything.
+type concurrencyLimiter struct {
+	mu      sync.Mutex
+	limits  []ConcurrencyLimit
+	running map[string]int
+	waiting map[string]*concurrencyWait
+	metrics ConcurrencyMetrics
+}
+
+// newConcurrencyLimiter creates a limiter for the given limits, or returns nil
+// when there are none.
+func newConcurrencyLimiter(limits []ConcurrencyLimit, metrics ConcurrencyMetrics) *concurrencyLimiter {
+	if len(limits) == 0 {
+		return nil
+	}
+
+	return &concurrencyLimiter{
+		limits:  limits,
+		running: make(map[string]int),
+		waiting: make(map[string]*concurrencyWait),
+		metrics: metrics,
+	}
+}
+
+// keys returns the concurrency keys that apply to the unit.
+func (l *concurrencyLimiter) keys(unit *PlanUnit) []concurrencyKey {
+	keys := make([]concurrencyKey, 0, len(l.limits))
+	for i := range l.limits {
+		if value, ok := l.limits[i].key(unit); ok {
+			keys = append(keys, concurrencyKey{
+				scope: l.limits[i].Scope,
+				value: value,
+				max:   l.limits[i].Max,
+			})
+		}
+	}
+	return keys
+}
+
+// admit acquires the keys of the first unit in queue that can start and
+// returns its index, or -1 when every unit is blocked.
+func (l *concurrencyLimiter) admit(queue []*PlanUnit) int {
+	if len(queue) == 0 {
+		return -1
+	}
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	held := make(map[string]bool)
+	for i, unit := range queue {
+		keys := l.keys(unit)
+
+		// Find the keys this unit would have to wait on, because they are
+		// full or held by an earlier blocked unit
+		full := make([]concurrencyKey, 0)
+		for _, key := range keys {
+			if l.running[key.id()] >= key.max || held[key.id()] {
+				full = append(full, key)
+			}
+		}
+
+		if len(full) > 0 {
+			wait := l.waiting[unit.ID]
+			if wait == nil {
+				wait = &concurrencyWait{since: now, keys: make(map[concurrencyKey]bool)}
+				l.waiting[unit.ID] = wait
+			}
+			for _, key := range full {
+				wait.keys[key] = true
+			}
+			for key := range wait.keys {
+				held[key.id()] = true
+			}
+			continue
+		}
+
+		for _, key := range keys {
+			l.running[key.id()]++
+		}
+
+		// Record the time spent waiting on each key that held the unit back
+		if wait := l.waiting[unit.ID]; wait != nil {
+			delete(l.waiting, unit.ID)
+			if l.metrics != nil {
+				for key := range wait.keys {
+					l.metrics.RecordConcurrencyWait(string(key.scope), key.value, now.Sub(wait.since))
+				}
+			}
+		}
+
+		return i
+	}
+
+	return -1
+}
+
+// release frees the keys held by a unit admitted earlier.
+func (l *concurrencyLimiter) release(unit *PlanUnit) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, key := range l.keys(unit) {
+		l.running[key.id()]--
+	}
+}
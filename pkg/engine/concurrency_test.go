@@ -0,0 +1,261 @@
+package engine
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// concurrencyExecutor records the peak number of concurrent units per host.
+type concurrencyExecutor struct {
+	*mockExecutor
+	running map[string]int
+	peak    map[string]int
+}
+
+func newConcurrencyExecutor() *concurrencyExecutor {
+	return &concurrencyExecutor{
+		mockExecutor: newMockExecutor(),
+		running:      make(map[string]int),
+		peak:         make(map[string]int),
+	}
+}
+
+func (e *concurrencyExecutor) ExecuteUnit(ctx context.Context, unit *PlanUnit) (*ExecutionResult, error) {
+	e.mu.Lock()
+	e.running[unit.TargetID]++
+	if e.running[unit.TargetID] > e.peak[unit.TargetID] {
+		e.peak[unit.TargetID] = e.running[unit.TargetID]
+	}
+	e.mu.Unlock()
+
+	defer func() {
+		e.mu.Lock()
+		e.running[unit.TargetID]--
+		e.mu.Unlock()
+	}()
+
+	return e.mockExecutor.ExecuteUnit(ctx, unit)
+}
+
+// mockConcurrencyMetrics records concurrency waits by key.
+type mockConcurrencyMetrics struct {
+	mu    sync.Mutex
+	waits map[string]int
+}
+
+func (m *mockConcurrencyMetrics) RecordConcurrencyWait(scope, key string, wait time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.waits[scope+":"+key]++
+}
+
+// newSharedHostPlan creates a plan with independent units on each host.
+func newSharedHostPlan(t *testing.T, unitsPerHost int, hosts ...string) *Plan {
+	t.Helper()
+
+	plan := &Plan{ID: "plan1", CreatedAt: time.Now()}
+	for _, host := range hosts {
+		for i := 0; i < unitsPerHost; i++ {
+			plan.Units = append(plan.Units, PlanUnit{
+				ID:           host + "-" + string(rune('a'+i)),
+				ResourceID:   "pkg",
+				TargetID:     host,
+				Operation:    OperationUpdate,
+				Status:       PlanStatusPending,
+				ProviderName: "linux.pkg",
+				Timeout:      time.Minute,
+			})
+		}
+	}
+
+	graph, err := NewDAGBuilder().BuildGraph(plan.Units)
+	if err != nil {
+		t.Fatalf("Failed to build graph: %v", err)
+	}
+	plan.Graph = graph
+
+	return plan
+}
+
+func TestConcurrencyLimit_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   ConcurrencyLimit
+		wantErr bool
+	}{
+		{"host", ConcurrencyLimit{Scope: ConcurrencyScopeHost, Max: 1}, false},
+		{"label", ConcurrencyLimit{Scope: ConcurrencyScopeLabel, Label: "zone", Max: 2}, false},
+		{"label without name", ConcurrencyLimit{Scope: ConcurrencyScopeLabel, Max: 2}, true},
+		{"unknown scope", ConcurrencyLimit{Scope: "region", Max: 1}, true},
+		{"zero max", ConcurrencyLimit{Scope: ConcurrencyScopeProvider}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.limit.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConcurrencyLimiter_Admit(t *testing.T) {
+	metrics := &mockConcurrencyMetrics{waits: make(map[string]int)}
+	limiter := newConcurrencyLimiter([]ConcurrencyLimit{
+		{Scope: ConcurrencyScopeHost, Max: 1},
+		{Scope: ConcurrencyScopeLabel, Label: "zone", Max: 2},
+	}, metrics)
+
+	web1a := &PlanUnit{ID: "web1-a", TargetID: "web1", Labels: map[string]string{"zone": "a"}}
+	web1b := &PlanUnit{ID: "web1-b", TargetID: "web1", Labels: map[string]string{"zone": "a"}}
+	web2 := &PlanUnit{ID: "web2-a", TargetID: "web2", Labels: map[string]string{"zone": "a"}}
+	web3 := &PlanUnit{ID: "web3-a", TargetID: "web3", Labels: map[string]string{"zone": "a"}}
+
+	if i := limiter.admit([]*PlanUnit{web1a, web1b, web2}); i != 0 {
+		t.Fatalf("Expected first unit to be admitted, got %d", i)
+	}
+
+	// web1 is busy, so the next unit on another host starts first
+	if i := limiter.admit([]*PlanUnit{web1b, web2, web3}); i != 1 {
+		t.Fatalf("Expected web2 to be admitted, got %d", i)
+	}
+
+	// Zone a is now full
+	if i := limiter.admit([]*PlanUnit{web1b, web3}); i != -1 {
+		t.Fatalf("Expected every unit to be blocked, got %d", i)
+	}
+
+	// The longest waiting unit on web1 gets the freed slot
+	limiter.release(web1a)
+	if i := limiter.admit([]*PlanUnit{web1b, web3}); i != 0 {
+		t.Fatalf("Expected web1-b to be admitted, got %d", i)
+	}
+
+	if metrics.waits["host:web1"] != 1 || metrics.waits["label:zone=a"] != 1 {
+		t.Errorf("Expected waits on host web1 and zone a, got %v", metrics.waits)
+	}
+
+	// A nil limiter admits the head of the queue
+	var unlimited *concurrencyLimiter
+	if i := unlimited.admit([]*PlanUnit{web3}); i != 0 {
+		t.Errorf("Expected nil limiter to admit, got %d", i)
+	}
+}
+
+func TestConcurrencyLimiter_Admit_NoStarvation(t *testing.T) {
+	limiter := newConcurrencyLimiter([]ConcurrencyLimit{
+		{Scope: ConcurrencyScopeHost, Max: 1},
+		{Scope: ConcurrencyScopeLabel, Label: "zone", Max: 1},
+	}, nil)
+
+	web1 := &PlanUnit{ID: "web1-b", TargetID: "web1", Labels: map[string]string{"zone": "b"}}
+	web2 := &PlanUnit{ID: "web2-a", TargetID: "web2", Labels: map[string]string{"zone": "a"}}
+	both := &PlanUnit{ID: "web1-a", TargetID: "web1", Labels: map[string]string{"zone": "a"}}
+	web3 := &PlanUnit{ID: "web3-a", TargetID: "web3", Labels: map[string]string{"zone": "a"}}
+
+	if i := limiter.admit([]*PlanUnit{web1, web2}); i != 0 {
+		t.Fatalf("Expected web1 to be admitted, got %d", i)
+	}
+	if i := limiter.admit([]*PlanUnit{web2}); i != 0 {
+		t.Fatalf("Expected web2 to be admitted, got %d", i)
+	}
+
+	// web1-a needs both web1 and zone a, which are busy
+	if i := limiter.admit([]*PlanUnit{both, web3}); i != -1 {
+		t.Fatalf("Expected every unit to be blocked, got %d", i)
+	}
+
+	// Zone a frees up first, but web1-a waited on it, so web3 may not take it
+	limiter.release(web2)
+	if i := limiter.admit([]*PlanUnit{both, web3}); i != -1 {
+		t.Fatalf("Expected web3 to wait behind web1-a, got %d", i)
+	}
+
+	limiter.release(web1)
+	if i := limiter.admit([]*PlanUnit{both, web3}); i != 0 {
+		t.Fatalf("Expected web1-a to be admitted, got %d", i)
+	}
+}
+
+func TestScheduler_ConcurrencyLimits(t *testing.T) {
+	for _, strategy := range []ScheduleStrategy{ScheduleStrategyReadyQueue, ScheduleStrategyLevels} {
+		t.Run(string(strategy), func(t *testing.T) {
+			executor := newConcurrencyExecutor()
+			metrics := &mockConcurrencyMetrics{waits: make(map[string]int)}
+			stateMgr := newMockStateManager()
+			scheduler := NewParallelScheduler(10, executor, newMockEventPublisher(), stateMgr)
+			scheduler.SetConcurrencyMetrics(metrics)
+
+			ctx := context.Background()
+			plan := newSharedHostPlan(t, 3, "web1", "web2")
+
+			runID, err := scheduler.Schedule(ctx, plan, ScheduleOptions{
+				Strategy:          strategy,
+				ConcurrencyLimits: []ConcurrencyLimit{{Scope: ConcurrencyScopeHost, Max: 1}},
+			})
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			// Wait for execution to complete
+			time.Sleep(200 * time.Millisecond)
+
+			executor.mu.Lock()
+			executed := len(executor.executedUnits)
+			peak := map[string]int{"web1": executor.peak["web1"], "web2": executor.peak["web2"]}
+			executor.mu.Unlock()
+
+			if executed != 6 {
+				t.Errorf("Expected 6 executions, got %d", executed)
+			}
+
+			for host, count := range peak {
+				if count != 1 {
+					t.Errorf("Expected at most 1 concurrent unit on %s, got %d", host, count)
+				}
+			}
+
+			metrics.mu.Lock()
+			waits := metrics.waits["host:web1"]
+			metrics.mu.Unlock()
+			if waits != 2 {
+				t.Errorf("Expected 2 waits on web1, got %d", waits)
+			}
+
+			run, err := stateMgr.GetRun(ctx, runID)
+			if err != nil {
+				t.Fatalf("Failed to get run: %v", err)
+			}
+
+			if run.Status != RunStatusSucceeded {
+				t.Errorf("Expected run status SUCCEEDED, got %s", run.Status)
+			}
+		})
+	}
+}
+
+func TestScheduler_Schedule_InvalidConcurrencyLimit(t *testing.T) {
+	scheduler := NewParallelScheduler(5, newMockExecutor(), newMockEventPublisher(), newMockStateManager())
+	plan := newHostPlan(t, "web1")
+
+	_, err := scheduler.Schedule(context.Background(), plan, ScheduleOptions{
+		ConcurrencyLimits: []ConcurrencyLimit{{Scope: ConcurrencyScopeHost}},
+	})
+	if err == nil {
+		t.Fatal("Expected error for invalid concurrency limit, got nil")
+	}
+
+	// Two limits on the same scope would count the same keys
+	_, err = scheduler.Schedule(context.Background(), plan, ScheduleOptions{
+		ConcurrencyLimits: []ConcurrencyLimit{
+			{Scope: ConcurrencyScopeLabel, Label: "zone", Max: 1},
+			{Scope: ConcurrencyScopeLabel, Label: "zone", Max: 2},
+		},
+	})
+	if err == nil {
+		t.Fatal("Expected error for duplicate concurrency limits, got nil")
+	}
+}
@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+)
+
+// ConditionLanguage is the expression language of a resource condition.
+type ConditionLanguage string
+
+const (
+	// ConditionLanguageStarlark evaluates the condition as a Starlark expression.
+	// This is the default.
+	ConditionLanguageStarlark ConditionLanguage = "starlark"
+
+	// ConditionLanguageCUE evaluates the condition as a CUE expression.
+	ConditionLanguageCUE ConditionLanguage = "cue"
+)
+
+// SkipReasonCondition is the reason reported for resources whose condition
+// does not hold on their host.
+const SkipReasonCondition = "skipped by condition"
+
+// Condition is a boolean expression over the facts of the host a resource
+// is applied to. Fact namespaces are exposed as nested fields, so the
+// "os.basic" namespace is read as os.basic.distro.
+type Condition struct {
+	// Expression is the boolean expression, e.g. `os.basic.distro == "rhel"`.
+	Expression string `json:"expression"`
+
+	// Language is the expression language. Defaults to ConditionLanguageStarlark.
+	Language ConditionLanguage `json:"language,omitempty"`
+}
+
+// Validate checks that the condition is consistent.
+func (c *Condition) Validate() error {
+	if c.Expression == "" {
+		return NewPermanentError("condition expression is empty", nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	switch c.Language {
+	case "", ConditionLanguageStarlark, ConditionLanguageCUE:
+	default:
+		return NewPermanentError(fmt.Sprintf("invalid condition language: %s", c.Language), nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	return nil
+}
+
+// ConditionEvaluator evaluates resource conditions against host facts.
+// config.ConditionEvaluator implements it.
+type ConditionEvaluator interface {
+	// EvaluateCondition reports whether the condition holds for the given
+	// facts, keyed by namespace.
+	EvaluateCondition(ctx context.Context, condition *Condition, facts map[string]interface{}) (bool, error)
+}
+
+// HostFactsSource returns the cached facts of a host keyed by namespace.
+// FactsCollector implements it.
+type HostFactsSource interface {
+	// GetFacts retrieves cached facts for a host, optionally limited to a namespace.
+	GetFacts(ctx context.Context, hostID string, namespace *string) (map[string]any, error)
+}
+
+// SkippedResource is a resource left out of a plan on a host.
+type SkippedResource struct {
+	// ResourceID is the ID of the skipped resource.
+	ResourceID string `json:"resource_id"`
+
+	// TargetID is the ID of the host the resource was skipped on.
+	TargetID string `json:"target_id,omitempty"`
+
+	// Reason explains why the resource was skipped.
+	Reason string `json:"reason"`
+
+	// Condition is the expression that did not hold, if any.
+	Condition string `json:"condition,omitempty"`
+}
@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DataSource is a read-only lookup evaluated by its provider while planning,
+// such as the latest version of a package in a repository. Resource configs
+// reference its output with ${data.<id>} or ${data.<id>.<field>}.
+type DataSource struct {
+	// ID is the unique identifier of the data source.
+	ID string `json:"id"`
+
+	// Type is the data source type, "<provider>::<name>" (e.g., "linux.pkg::repo_package").
+	Type string `json:"type"`
+
+	// Config is the query passed to the provider.
+	Config json.RawMessage `json:"config"`
+
+	// TargetID is the ID of the host the data source is read on, if any.
+	TargetID string `json:"target_id,omitempty"`
+}
+
+// providerAndName splits the data source type into its provider and data source name.
+func (d *DataSource) providerAndName() (string, string) {
+	provider, name, ok := strings.Cut(d.Type, "::")
+	if !ok {
+		return d.Type, d.Type
+	}
+	return provider, name
+}
+
+// dataSourceResults holds the decoded outputs of the data sources read for
+// one plan run, by data source ID.
+type dataSourceResults map[string]interface{}
+
+// resolve resolves a data reference such as "data.kernel.version".
+// References outside data are left for other placeholders.
+func (r dataSourceResults) resolve(ref string) (interface{}, bool, error) {
+	if !strings.HasPrefix(ref, "data.") {
+		return nil, false, nil
+	}
+
+	path := strings.Split(strings.TrimPrefix(ref, "data."), ".")
+	output, ok := r[path[0]]
+	if !ok {
+		return nil, true, fmt.Errorf("unknown data source: %s", path[0])
+	}
+
+	value, ok := lookupField(output, path[1:])
+	if !ok {
+		return nil, true, fmt.Errorf("%s not found in output of data source %s", ref, path[0])
+	}
+
+	return value, true, nil
+}
+
+// readDataSources reads each data source through its provider, in order.
+// A data source config may reference the data sources declared before it.
+// Identical queries are read once per plan run.
+func (p *DefaultPlanner) readDataSources(
+	ctx context.Context,
+	sources []DataSource,
+) (dataSourceResults, map[string]json.RawMessage, error) {
+	results := make(dataSourceResults, len(sources))
+	outputs := make(map[string]json.RawMessage, len(sources))
+	cache := make(map[string]json.RawMessage)
+
+	for i := range sources {
+		source := &sources[i]
+		if _, exists := outputs[source.ID]; exists {
+			return nil, nil, NewPermanentError(fmt.Sprintf("duplicate data source: %s", source.ID), nil).
+				WithCode(ErrCodeValidation)
+		}
+
+		config, err := renderConfig(source.Config, results.resolve)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to render config of data source %s: %w", source.ID, err)
+		}
+
+		cacheKey := source.Type + "\x00" + source.TargetID + "\x00" + string(config)
+		output, cached := cache[cacheKey]
+		if !cached {
+			output, err = p.readDataSource(ctx, source, config)
+			if err != nil {
+				return nil, nil, err
+			}
+			cache[cacheKey] = output
+		}
+
+		var decoded interface{}
+		if len(output) > 0 {
+			if err := json.Unmarshal(output, &decoded); err != nil {
+				return nil, nil, fmt.Errorf("failed to decode output of data source %s: %w", source.ID, err)
+			}
+		}
+
+		results[source.ID] = decoded
+		outputs[source.ID] = output
+	}
+
+	return results, outputs, nil
+}
+
+// readDataSource calls the provider's read for one data source.
+func (p *DefaultPlanner) readDataSource(ctx context.Context, source *DataSource, config json.RawMessage) (json.RawMessage, error) {
+	providerName, name := source.providerAndName()
+
+	provider, err := p.providerRegistry.Get(ctx, providerName, "latest")
+	if err != nil {
+		return nil, NewPermanentError(
+			fmt.Sprintf("provider %s for data source %s is not available", providerName, source.ID), err).
+			WithCode(ErrCodeNotFound)
+	}
+
+	// Providers that publish their data sources must publish this one
+	if schema, err := provider.Schema(); err == nil && schema != nil && len(schema.DataSources) > 0 {
+		if _, ok := schema.DataSources[name]; !ok {
+			return nil, NewPermanentError(
+				fmt.Sprintf("provider %s has no data source %s", providerName, name), nil).
+				WithCode(ErrCodeValidation)
+		}
+	}
+
+	resp, err := provider.Read(ctx, ReadRequest{
+		ResourceID: "data." + source.ID,
+		Config:     config,
+		Metadata: map[string]interface{}{
+			"data_source": name,
+			"target_id":   source.TargetID,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data source %s: %w", source.ID, err)
+	}
+	if !resp.Exists {
+		return nil, NewPermanentError(fmt.Sprintf("data source %s returned no result", source.ID), nil).
+			WithCode(ErrCodeNotFound)
+	}
+
+	return resp.State, nil
+}
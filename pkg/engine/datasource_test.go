@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+// mockDataProvider answers data source reads with the latest version of the
+// requested package and counts the reads.
+type mockDataProvider struct {
+	mockPlanProvider
+	reads int
+}
+
+func (m *mockDataProvider) Read(ctx context.Context, req ReadRequest) (*ReadResponse, error) {
+	m.reads++
+
+	var query struct {
+		Package string `json:"package"`
+	}
+	if err := json.Unmarshal(req.Config, &query); err != nil {
+		return nil, err
+	}
+
+	versions := map[string]string{"kernel": "6.1.0-18", "nginx": "1.24.0"}
+	version, ok := versions[query.Package]
+	if !ok {
+		return &ReadResponse{Exists: false}, nil
+	}
+
+	state, _ := json.Marshal(map[string]interface{}{"package": query.Package, "version": version})
+	return &ReadResponse{State: state, Exists: true}, nil
+}
+
+func (m *mockDataProvider) Schema() (*ProviderSchema, error) {
+	return &ProviderSchema{
+		DataSources: map[string]*DataSourceSchema{
+			"latest_package": {Name: "latest_package"},
+		},
+	}, nil
+}
+
+func TestPlanner_ComputeDiff_DataSources(t *testing.T) {
+	provider := &mockDataProvider{}
+	registry := &mockProviderRegistry{providers: map[string]Provider{"repo": provider}}
+	planner := NewPlanner(registry, newMockStateManager())
+
+	ctx := context.Background()
+
+	config := &Config{
+		ID: "test-config",
+		DataSources: []DataSource{
+			{ID: "kernel", Type: "repo::latest_package", Config: json.RawMessage(`{"package": "kernel"}`)},
+			// Same query as kernel, served from the run's cache
+			{ID: "kernel_again", Type: "repo::latest_package", Config: json.RawMessage(`{"package": "kernel"}`)},
+			// Data sources can reference earlier ones
+			{ID: "same", Type: "repo::latest_package", Config: json.RawMessage(`{"package": "${data.kernel.package}"}`)},
+		},
+		Resources: []Resource{
+			{
+				ID:     "kernel-pin",
+				Type:   "linux.file",
+				Config: json.RawMessage(`{"path": "/etc/kernel-pin", "content": "kernel-${data.kernel.version}"}`),
+			},
+		},
+	}
+
+	diff, err := planner.ComputeDiff(ctx, config, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if provider.reads != 1 {
+		t.Errorf("Expected identical queries to be read once, got %d reads", provider.reads)
+	}
+
+	if len(diff.DataSources) != 3 {
+		t.Errorf("Expected 3 data source outputs, got %d", len(diff.DataSources))
+	}
+
+	var desired map[string]string
+	if err := json.Unmarshal(diff.Resources[0].DesiredState, &desired); err != nil {
+		t.Fatalf("Failed to decode desired state: %v", err)
+	}
+	if desired["content"] != "kernel-6.1.0-18" {
+		t.Errorf("Expected data reference to be resolved, got %q", desired["content"])
+	}
+
+	// Outputs are recorded in the plan
+	plan, err := planner.BuildPlan(ctx, diff)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if _, ok := plan.DataSources["kernel"]; !ok {
+		t.Error("Expected plan to record the kernel data source output")
+	}
+}
+
+func TestPlanner_ComputeDiff_DataSourceErrors(t *testing.T) {
+	registry := &mockProviderRegistry{providers: map[string]Provider{"repo": &mockDataProvider{}}}
+	planner := NewPlanner(registry, newMockStateManager())
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		sources  []DataSource
+		resource string
+	}{
+		{
+			name:    "unknown provider",
+			sources: []DataSource{{ID: "x", Type: "apt::latest_package", Config: json.RawMessage(`{}`)}},
+		},
+		{
+			name:    "unknown data source",
+			sources: []DataSource{{ID: "x", Type: "repo::mirrors", Config: json.RawMessage(`{}`)}},
+		},
+		{
+			name:    "no result",
+			sources: []DataSource{{ID: "x", Type: "repo::latest_package", Config: json.RawMessage(`{"package": "missing"}`)}},
+		},
+		{
+			name:     "unknown reference",
+			resource: `{"version": "${data.nope.version}"}`,
+			sources:  []DataSource{{ID: "x", Type: "repo::latest_package", Config: json.RawMessage(`{"package": "nginx"}`)}},
+		},
+		{
+			name:     "unknown field",
+			resource: `{"version": "${data.x.checksum}"}`,
+			sources:  []DataSource{{ID: "x", Type: "repo::latest_package", Config: json.RawMessage(`{"package": "nginx"}`)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{ID: "test-config", DataSources: tt.sources}
+			if tt.resource != "" {
+				config.Resources = []Resource{{ID: "r", Type: "linux.file", Config: json.RawMessage(tt.resource)}}
+			}
+
+			if _, err := planner.ComputeDiff(ctx, config, nil); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
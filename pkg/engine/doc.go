@@ -44,7 +44,8 @@
 // The engine workflow is defined through specialized interfaces:
 //
 //   - Evaluator: Parses CUE configs and executes Starlark scripts
-//   - Discoverer: Collects facts from target systems
+//   - Discoverer: Collects facts from target systems through per-namespace
+//     FactCollectors (FactsCollector registers the built-ins)
 //   - Planner: Computes diffs and builds execution plans
 //   - Executor: Executes plans by running the DAG
 //   - StateManager: Persists resource state and run history
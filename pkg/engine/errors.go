@@ -187,6 +187,15 @@ func IsPermanent(err error) bool {
 	return false
 }
 
+// IsNotFound returns true if the error has the not found code.
+func IsNotFound(err error) bool {
+	var e *EngineError
+	if errors.As(err, &e) {
+		return e.Code == ErrCodeNotFound
+	}
+	return false
+}
+
 // IsRetryable returns true if the error can be retried.
 // Transient, throttled, and conflict errors are retryable.
 func IsRetryable(err error) bool {
@@ -205,4 +214,5 @@ const (
 	ErrCodeInternal         = "INTERNAL_ERROR"
 	ErrCodeProviderFailed   = "PROVIDER_FAILED"
 	ErrCodeDependencyFailed = "DEPENDENCY_FAILED"
+	ErrCodeUnreachable      = "UNREACHABLE"
 )
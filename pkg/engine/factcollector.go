@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// CommandFactFunc collects the facts of a namespace by running commands on
+// the target. The result is encoded as JSON.
+type CommandFactFunc func(ctx context.Context, exec CommandExecutor) (any, error)
+
+// CommandFactCollector is a FactCollector that gathers facts by running
+// commands over the target's connection. The built-in collectors are
+// command collectors, and it is the simplest way to add new namespaces.
+type CommandFactCollector struct {
+	namespace string
+	ttl       time.Duration
+	collect   CommandFactFunc
+}
+
+// NewCommandFactCollector creates a command fact collector for a namespace.
+// A non-positive TTL uses the facts collector's default.
+func NewCommandFactCollector(namespace string, ttl time.Duration, collect CommandFactFunc) *CommandFactCollector {
+	return &CommandFactCollector{
+		namespace: namespace,
+		ttl:       ttl,
+		collect:   collect,
+	}
+}
+
+// Collect runs the collect function against the target.
+func (c *CommandFactCollector) Collect(ctx context.Context, target TargetInfo) (json.RawMessage, error) {
+	if target.Exec == nil {
+		return nil, NewPermanentError(fmt.Sprintf("fact collector %s requires a connection to %s",
+			c.namespace, target.ID), nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	data, err := c.collect(ctx, target.Exec)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal fact data: %w", err)
+	}
+
+	return raw, nil
+}
+
+// Namespace returns the namespace this collector handles.
+func (c *CommandFactCollector) Namespace() string {
+	return c.namespace
+}
+
+// TTL returns how long the collected facts stay valid.
+func (c *CommandFactCollector) TTL() time.Duration {
+	return c.ttl
+}
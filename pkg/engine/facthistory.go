@@ -0,0 +1,451 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/openfroyo/openfroyo/pkg/stores"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultFactHistoryRetention is how long fact versions are kept by default.
+// The latest version of each fact is kept regardless.
+const DefaultFactHistoryRetention = 90 * 24 * time.Hour
+
+// maxFactSnapshots bounds the versions loaded to diff the facts of a host.
+const maxFactSnapshots = 10000
+
+// FactVersion is a version of a fact, recorded each time a collection finds
+// its value changed.
+type FactVersion struct {
+	// Namespace is the fact namespace (e.g., "os.basic").
+	Namespace string `json:"namespace"`
+
+	// CollectedAt is when this version was first collected.
+	CollectedAt time.Time `json:"collected_at"`
+
+	// Data is the fact value.
+	Data json.RawMessage `json:"data"`
+
+	// Changes are the changes from the previous version. The first known
+	// version has none.
+	Changes []Change `json:"changes,omitempty"`
+}
+
+// FactChanges are the changes of a fact namespace over a period.
+type FactChanges struct {
+	// Namespace is the fact namespace.
+	Namespace string `json:"namespace"`
+
+	// From is when the version compared against was collected. It is zero
+	// when the fact did not exist at the start of the period.
+	From time.Time `json:"from,omitempty"`
+
+	// To is when the current version was collected.
+	To time.Time `json:"to"`
+
+	// Changes are the structural changes between the two versions.
+	Changes []Change `json:"changes"`
+}
+
+// SetEventPublisher sets the publisher notified with an EventTypeFactChanged
+// event when a tracked fact changes.
+func (c *FactsCollector) SetEventPublisher(publisher EventPublisher) {
+	c.eventPublisher = publisher
+}
+
+// SetTrackedFacts sets the fact namespaces whose changes are published.
+// Every namespace is tracked when none are given. Changes of untracked facts
+// are still recorded in the fact history.
+func (c *FactsCollector) SetTrackedFacts(namespaces []string) {
+	c.trackedFacts = namespaces
+}
+
+// recordFactVersion records a new version of a fact when its value differs
+// from the latest recorded one, and publishes the change.
+func (c *FactsCollector) recordFactVersion(ctx context.Context, targetID, namespace string, data json.RawMessage, collectedAt time.Time) error {
+	value, hash, err := canonicalFact(data)
+	if err != nil {
+		return fmt.Errorf("failed to record fact history: %w", err)
+	}
+
+	latest, err := c.store.ListFactSnapshots(ctx, targetID, &namespace, 1, 0)
+	if err != nil {
+		return fmt.Errorf("failed to record fact history: %w", err)
+	}
+	if len(latest) > 0 && latest[0].Hash == hash {
+		return nil
+	}
+
+	snapshot := &stores.FactSnapshot{
+		TargetID:    targetID,
+		Namespace:   namespace,
+		Value:       string(value),
+		Hash:        hash,
+		CollectedAt: collectedAt,
+	}
+	if err := c.store.AppendFactSnapshot(ctx, snapshot); err != nil {
+		return fmt.Errorf("failed to record fact history: %w", err)
+	}
+
+	// The first version of a fact is not a change
+	if len(latest) == 0 {
+		return nil
+	}
+
+	changes, err := diffFactValues(json.RawMessage(latest[0].Value), value)
+	if err != nil {
+		return fmt.Errorf("failed to diff fact versions: %w", err)
+	}
+	c.publishFactChanged(ctx, targetID, namespace, changes)
+
+	return nil
+}
+
+// publishFactChanged publishes the changes of a tracked fact. Publishing
+// failures are logged and do not fail the collection.
+func (c *FactsCollector) publishFactChanged(ctx context.Context, targetID, namespace string, changes []Change) {
+	if c.eventPublisher == nil {
+		return
+	}
+	if len(c.trackedFacts) > 0 && !slices.Contains(c.trackedFacts, namespace) {
+		return
+	}
+
+	event := &Event{
+		ID:         uuid.New().String(),
+		Type:       EventTypeFactChanged,
+		Timestamp:  time.Now(),
+		ResourceID: targetID,
+		Message:    fmt.Sprintf("Fact %s changed on %s (%d changes)", namespace, targetID, len(changes)),
+		Details: map[string]interface{}{
+			"target_id": targetID,
+			"namespace": namespace,
+			"changes":   changes,
+		},
+		Level: EventTypeFactChanged.Severity(),
+	}
+
+	if err := c.eventPublisher.Publish(ctx, event); err != nil {
+		log.Warn().Err(err).Str("host", targetID).Str("namespace", namespace).Msg("Failed to publish fact change")
+	}
+}
+
+// FactHistory returns up to limit versions of a fact of a host, newest first,
+// each with its changes from the previous version.
+func (c *FactsCollector) FactHistory(ctx context.Context, hostID, namespace string, limit int) ([]*FactVersion, error) {
+	if limit <= 0 {
+		limit = maxFactSnapshots
+	}
+
+	// One more version is loaded to diff the oldest one returned against
+	snapshots, err := c.store.ListFactSnapshots(ctx, hostID, &namespace, limit+1, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list fact history: %w", err)
+	}
+
+	versions := make([]*FactVersion, 0, len(snapshots))
+	for i, snapshot := range snapshots {
+		if i == limit {
+			break
+		}
+
+		version := &FactVersion{
+			Namespace:   snapshot.Namespace,
+			CollectedAt: snapshot.CollectedAt,
+			Data:        json.RawMessage(snapshot.Value),
+		}
+		if i+1 < len(snapshots) {
+			version.Changes, err = diffFactValues(json.RawMessage(snapshots[i+1].Value), version.Data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to diff fact versions: %w", err)
+			}
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, nil
+}
+
+// DiffFactsSince returns the changes of the facts of a host since a time,
+// sorted by namespace. Each fact's latest version is compared against the
+// version that was current at that time. Only the given namespaces are
+// compared when any are given.
+func (c *FactsCollector) DiffFactsSince(ctx context.Context, hostID string, since time.Time, namespaces []string) ([]*FactChanges, error) {
+	snapshots, err := c.store.ListFactSnapshots(ctx, hostID, nil, maxFactSnapshots, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list fact history: %w", err)
+	}
+
+	wanted := make(map[string]bool, len(namespaces))
+	for _, namespace := range namespaces {
+		wanted[namespace] = true
+	}
+
+	// Snapshots are listed newest first, so the first of each namespace is
+	// the current version and the first not after since is the baseline
+	current := make(map[string]*stores.FactSnapshot)
+	baseline := make(map[string]*stores.FactSnapshot)
+	for _, snapshot := range snapshots {
+		if len(wanted) > 0 && !wanted[snapshot.Namespace] {
+			continue
+		}
+		if _, ok := current[snapshot.Namespace]; !ok {
+			current[snapshot.Namespace] = snapshot
+		}
+		if _, ok := baseline[snapshot.Namespace]; !ok && !snapshot.CollectedAt.After(since) {
+			baseline[snapshot.Namespace] = snapshot
+		}
+	}
+
+	result := make([]*FactChanges, 0)
+	for namespace, to := range current {
+		from := baseline[namespace]
+		if from == to {
+			continue // Unchanged since
+		}
+
+		entry := &FactChanges{Namespace: namespace, To: to.CollectedAt}
+		var before json.RawMessage
+		if from != nil {
+			entry.From = from.CollectedAt
+			before = json.RawMessage(from.Value)
+		}
+
+		entry.Changes, err = diffFactValues(before, json.RawMessage(to.Value))
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff %s: %w", namespace, err)
+		}
+		if len(entry.Changes) > 0 {
+			result = append(result, entry)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Namespace < result[j].Namespace
+	})
+
+	return result, nil
+}
+
+// canonicalFact re-encodes a fact value with sorted keys and returns it with
+// its SHA256, so equal values hash the same regardless of formatting.
+func canonicalFact(data json.RawMessage) (json.RawMessage, string, error) {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, "", fmt.Errorf("invalid fact value: %w", err)
+	}
+
+	canonical, err := json.Marshal(value)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode fact value: %w", err)
+	}
+
+	sum := sha256.Sum256(canonical)
+	return canonical, hex.EncodeToString(sum[:]), nil
+}
+
+// diffFactValues returns the structural changes between two fact values. A
+// nil before value means the fact was added.
+func diffFactValues(before, after json.RawMessage) ([]Change, error) {
+	var oldValue, newValue any
+	if len(before) > 0 {
+		if err := json.Unmarshal(before, &oldValue); err != nil {
+			return nil, fmt.Errorf("invalid fact value: %w", err)
+		}
+	}
+	if err := json.Unmarshal(after, &newValue); err != nil {
+		return nil, fmt.Errorf("invalid fact value: %w", err)
+	}
+
+	if len(before) == 0 {
+		return []Change{{Path: ".", After: newValue, Action: ChangeActionAdd}}, nil
+	}
+
+	changes := make([]Change, 0)
+	diffValues(".", oldValue, newValue, &changes)
+	return changes, nil
+}
+
+// diffValues appends the changes between two decoded JSON values at a path.
+// Objects are compared key by key. Lists of objects with unique names (such
+// as packages or interfaces) are matched by name, so an insertion does not
+// shift every later element, and lists of scalars (such as package names)
+// are compared as sets; other lists are compared by index.
+func diffValues(path string, before, after any, changes *[]Change) {
+	switch oldValue := before.(type) {
+	case map[string]any:
+		if newValue, ok := after.(map[string]any); ok {
+			diffObjects(path, oldValue, newValue, changes)
+			return
+		}
+	case []any:
+		if newValue, ok := after.([]any); ok {
+			oldNamed, oldOK := namedElements(oldValue)
+			newNamed, newOK := namedElements(newValue)
+			switch {
+			case oldOK && newOK:
+				diffNamedElements(path, oldNamed, newNamed, changes)
+			case scalarElements(oldValue) && scalarElements(newValue):
+				diffScalarSets(path, oldValue, newValue, changes)
+			default:
+				diffLists(path, oldValue, newValue, changes)
+			}
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(before, after) {
+		*changes = append(*changes, Change{Path: path, Before: before, After: after, Action: ChangeActionModify})
+	}
+}
+
+// diffObjects compares two objects key by key, in key order.
+func diffObjects(path string, before, after map[string]any, changes *[]Change) {
+	keys := make([]string, 0, len(before)+len(after))
+	for key := range before {
+		keys = append(keys, key)
+	}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		oldValue, inOld := before[key]
+		newValue, inNew := after[key]
+		diffMembers(childPath(path, "."+key), oldValue, inOld, newValue, inNew, changes)
+	}
+}
+
+// diffLists compares two lists by index.
+func diffLists(path string, before, after []any, changes *[]Change) {
+	for i := 0; i < len(before) || i < len(after); i++ {
+		var oldValue, newValue any
+		if i < len(before) {
+			oldValue = before[i]
+		}
+		if i < len(after) {
+			newValue = after[i]
+		}
+		diffMembers(childPath(path, "["+strconv.Itoa(i)+"]"), oldValue, i < len(before), newValue, i < len(after), changes)
+	}
+}
+
+// diffScalarSets compares two lists of scalars as sets. Each element missing
+// from after is removed and each new element is added, at the path of the
+// list, so reordering the list is not a change.
+func diffScalarSets(path string, before, after []any, changes *[]Change) {
+	unmatched := make(map[any]int, len(before))
+	for _, value := range before {
+		unmatched[value]++
+	}
+
+	added := make([]any, 0)
+	for _, value := range after {
+		if unmatched[value] > 0 {
+			unmatched[value]--
+			continue
+		}
+		added = append(added, value)
+	}
+
+	for _, value := range before {
+		if unmatched[value] > 0 {
+			unmatched[value]--
+			*changes = append(*changes, Change{Path: path, Before: value, Action: ChangeActionRemove})
+		}
+	}
+	for _, value := range added {
+		*changes = append(*changes, Change{Path: path, After: value, Action: ChangeActionAdd})
+	}
+}
+
+// diffNamedElements compares two lists of named objects by name, in name
+// order.
+func diffNamedElements(path string, before, after map[string]any, changes *[]Change) {
+	names := make([]string, 0, len(before)+len(after))
+	for name := range before {
+		names = append(names, name)
+	}
+	for name := range after {
+		if _, ok := before[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		oldValue, inOld := before[name]
+		newValue, inNew := after[name]
+		diffMembers(childPath(path, "[name="+name+"]"), oldValue, inOld, newValue, inNew, changes)
+	}
+}
+
+// diffMembers compares a member that may be missing on either side.
+func diffMembers(path string, before any, inBefore bool, after any, inAfter bool, changes *[]Change) {
+	switch {
+	case !inBefore:
+		*changes = append(*changes, Change{Path: path, After: after, Action: ChangeActionAdd})
+	case !inAfter:
+		*changes = append(*changes, Change{Path: path, Before: before, Action: ChangeActionRemove})
+	default:
+		diffValues(path, before, after, changes)
+	}
+}
+
+// namedElements indexes a list by the name field of its elements. It reports
+// false unless every element is an object with a unique, non-empty name.
+func namedElements(list []any) (map[string]any, bool) {
+	named := make(map[string]any, len(list))
+	for _, element := range list {
+		obj, ok := element.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		name, ok := obj["name"].(string)
+		if !ok || name == "" {
+			return nil, false
+		}
+		if _, ok := named[name]; ok {
+			return nil, false
+		}
+		named[name] = element
+	}
+
+	return named, true
+}
+
+// scalarElements reports whether no element of a list is an object or a list.
+func scalarElements(list []any) bool {
+	for _, element := range list {
+		switch element.(type) {
+		case map[string]any, []any:
+			return false
+		}
+	}
+	return true
+}
+
+// childPath appends a segment to a change path, e.g. .kernel or
+// .packages[name=openssl].version.
+func childPath(path, segment string) string {
+	if path == "." {
+		if segment[0] == '.' {
+			return segment
+		}
+		return "." + segment
+	}
+	return path + segment
+}
@@ -0,0 +1,228 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// FactQueryHostNamespace exposes the inventory record of each host to fact
+// queries, so that host.labels.env or host.address can be queried alongside
+// the collected facts.
+const FactQueryHostNamespace = "host"
+
+// FactQuery selects hosts by a condition over their cached facts and projects
+// fact values of the matching hosts. Fact paths are dotted, e.g.
+// "hw.memory.total_mb".
+type FactQuery struct {
+	// Where is the condition hosts must match. Nil matches every host.
+	Where *Condition `json:"where,omitempty"`
+
+	// Select lists the fact paths reported for each matching host.
+	Select []string `json:"select,omitempty"`
+
+	// GroupBy lists the fact paths the matching hosts are counted by.
+	GroupBy []string `json:"group_by,omitempty"`
+}
+
+// FactQueryRow is a host matching a fact query.
+type FactQueryRow struct {
+	// Host is the matching host.
+	Host *Host `json:"host"`
+
+	// Values are the values of the selected fact paths, in order. Facts the
+	// host does not have are nil.
+	Values []any `json:"values,omitempty"`
+}
+
+// FactQueryGroup counts the matching hosts sharing the values of the group-by
+// fact paths.
+type FactQueryGroup struct {
+	// Values are the values of the group-by fact paths, in order.
+	Values []any `json:"values"`
+
+	// Count is the number of matching hosts in the group.
+	Count int `json:"count"`
+}
+
+// FactQueryResult is the result of a fact query.
+type FactQueryResult struct {
+	// Rows are the matching hosts, in the order they were queried.
+	Rows []*FactQueryRow `json:"rows"`
+
+	// Groups are the group counts, largest first, when the query groups.
+	Groups []*FactQueryGroup `json:"groups,omitempty"`
+
+	// Errors are the hosts the condition could not be evaluated on, such as
+	// hosts lacking a fact it reads, keyed by host ID. They do not match.
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// FactQuerier runs fact queries against cached facts. It never contacts
+// hosts, so it is cheap enough to use as a host selector.
+type FactQuerier struct {
+	facts     HostFactsSource
+	evaluator ConditionEvaluator
+}
+
+// NewFactQuerier creates a fact querier reading facts from the given source
+// and evaluating conditions with the given evaluator.
+func NewFactQuerier(facts HostFactsSource, evaluator ConditionEvaluator) *FactQuerier {
+	return &FactQuerier{
+		facts:     facts,
+		evaluator: evaluator,
+	}
+}
+
+// Query runs a fact query over the given hosts.
+func (q *FactQuerier) Query(ctx context.Context, hosts []*Host, query *FactQuery) (*FactQueryResult, error) {
+	if err := q.compile(query.Where); err != nil {
+		return nil, err
+	}
+
+	result := &FactQueryResult{
+		Rows:   make([]*FactQueryRow, 0),
+		Errors: make(map[string]string),
+	}
+	groups := make(map[string]*FactQueryGroup)
+
+	for _, host := range hosts {
+		facts, err := q.hostFacts(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		if query.Where != nil {
+			holds, err := q.evaluator.EvaluateCondition(ctx, query.Where, facts)
+			if err != nil {
+				result.Errors[host.ID] = err.Error()
+				continue
+			}
+			if !holds {
+				continue
+			}
+		}
+
+		result.Rows = append(result.Rows, &FactQueryRow{
+			Host:   host,
+			Values: projectFacts(facts, query.Select),
+		})
+
+		if len(query.GroupBy) > 0 {
+			values := projectFacts(facts, query.GroupBy)
+			key, err := json.Marshal(values)
+			if err != nil {
+				return nil, fmt.Errorf("failed to group host %s: %w", host.ID, err)
+			}
+			group, ok := groups[string(key)]
+			if !ok {
+				group = &FactQueryGroup{Values: values}
+				groups[string(key)] = group
+			}
+			group.Count++
+		}
+	}
+
+	if len(query.GroupBy) > 0 {
+		keys := make([]string, 0, len(groups))
+		for key := range groups {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if groups[keys[i]].Count != groups[keys[j]].Count {
+				return groups[keys[i]].Count > groups[keys[j]].Count
+			}
+			return keys[i] < keys[j]
+		})
+
+		result.Groups = make([]*FactQueryGroup, 0, len(keys))
+		for _, key := range keys {
+			result.Groups = append(result.Groups, groups[key])
+		}
+	}
+
+	return result, nil
+}
+
+// SelectHosts returns the hosts whose cached facts match the condition.
+// Hosts the condition cannot be evaluated on do not match.
+func (q *FactQuerier) SelectHosts(ctx context.Context, hosts []*Host, where *Condition) ([]*Host, error) {
+	result, err := q.Query(ctx, hosts, &FactQuery{Where: where})
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make([]*Host, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		selected = append(selected, row.Host)
+	}
+	return selected, nil
+}
+
+// compile checks the condition once up front, so that an invalid expression
+// fails the query rather than every host. Evaluators that can compile
+// conditions without facts, such as config.ConditionEvaluator, also have
+// their syntax checked.
+func (q *FactQuerier) compile(where *Condition) error {
+	if where == nil {
+		return nil
+	}
+	if err := where.Validate(); err != nil {
+		return err
+	}
+	if q.evaluator == nil {
+		return NewPermanentError("fact queries need a condition evaluator", nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	compiler, ok := q.evaluator.(interface{ Compile(*Condition) error })
+	if !ok {
+		return nil
+	}
+	if err := compiler.Compile(where); err != nil {
+		return NewPermanentError("invalid fact query", err).WithCode(ErrCodeValidation)
+	}
+	return nil
+}
+
+// hostFacts returns the cached facts of a host keyed by namespace, with its
+// inventory record under FactQueryHostNamespace.
+func (q *FactQuerier) hostFacts(ctx context.Context, host *Host) (map[string]any, error) {
+	cached, err := q.facts.GetFacts(ctx, host.ID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get facts of host %s: %w", host.ID, err)
+	}
+
+	facts := make(map[string]any, len(cached)+1)
+	for namespace, data := range cached {
+		facts[namespace] = data
+	}
+
+	labels := make(map[string]any, len(host.Labels))
+	for key, value := range host.Labels {
+		labels[key] = value
+	}
+	facts[FactQueryHostNamespace] = map[string]any{
+		"id":      host.ID,
+		"address": host.Address,
+		"port":    host.Port,
+		"user":    host.User,
+		"labels":  labels,
+	}
+
+	return facts, nil
+}
+
+// projectFacts returns the values of fact paths, nil for missing facts.
+func projectFacts(facts map[string]any, paths []string) []any {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	values := make([]any, len(paths))
+	for i, path := range paths {
+		values[i], _ = lookupFact(facts, path)
+	}
+	return values
+}
@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestFactQuerier_Query(t *testing.T) {
+	ctx := context.Background()
+
+	hosts := []*Host{
+		{ID: "web1", Address: "10.0.0.1", Labels: map[string]string{"role": "web"}},
+		{ID: "web2", Address: "10.0.0.2", Labels: map[string]string{"role": "web"}},
+		{ID: "db1", Address: "10.0.0.3", Labels: map[string]string{"role": "db"}},
+		{ID: "new1", Address: "10.0.0.4"},
+	}
+	facts := mockHostFacts{
+		"web1": {"os.basic": map[string]any{"distro": "ubuntu"}, "hw.memory": map[string]any{"total_mb": float64(2048)}},
+		"web2": {"os.basic": map[string]any{"distro": "ubuntu"}, "hw.memory": map[string]any{"total_mb": float64(8192)}},
+		"db1":  {"os.basic": map[string]any{"distro": "rhel"}, "hw.memory": map[string]any{"total_mb": float64(2048)}},
+		// new1 has no facts collected yet
+	}
+
+	querier := NewFactQuerier(facts, &mockConditionEvaluator{})
+
+	result, err := querier.Query(ctx, hosts, &FactQuery{
+		Where:   &Condition{Expression: "ubuntu"},
+		Select:  []string{"hw.memory.total_mb", "host.labels.role", "pkg.manifest"},
+		GroupBy: []string{"hw.memory.total_mb"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(result.Rows) != 2 || result.Rows[0].Host.ID != "web1" || result.Rows[1].Host.ID != "web2" {
+		t.Fatalf("Expected web1 and web2 to match, got %+v", result.Rows)
+	}
+	if want := []any{float64(2048), "web", nil}; !reflect.DeepEqual(result.Rows[0].Values, want) {
+		t.Errorf("Expected values %v, got %v", want, result.Rows[0].Values)
+	}
+
+	// Hosts the condition cannot be evaluated on do not match
+	if _, ok := result.Errors["new1"]; !ok || len(result.Errors) != 1 {
+		t.Errorf("Expected an error for new1 only, got %v", result.Errors)
+	}
+
+	if len(result.Groups) != 2 || result.Groups[0].Count != 1 || result.Groups[0].Values[0] != float64(2048) {
+		t.Errorf("Expected a group per memory size, got %+v", result.Groups)
+	}
+
+	// Without a condition every host matches
+	result, err = querier.Query(ctx, hosts, &FactQuery{GroupBy: []string{"os.basic.distro"}})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	expected := []*FactQueryGroup{
+		{Values: []any{"ubuntu"}, Count: 2},
+		{Values: []any{"rhel"}, Count: 1},
+		{Values: []any{nil}, Count: 1},
+	}
+	if len(result.Rows) != 4 || !reflect.DeepEqual(result.Groups, expected) {
+		t.Errorf("Expected groups %+v, got %+v", expected, result.Groups)
+	}
+
+	// The cached facts are not modified
+	if _, ok := facts["web1"][FactQueryHostNamespace]; ok {
+		t.Error("Expected the host namespace not to be added to the cached facts")
+	}
+
+	selected, err := querier.SelectHosts(ctx, hosts, &Condition{Expression: "rhel"})
+	if err != nil || len(selected) != 1 || selected[0].ID != "db1" {
+		t.Errorf("Expected db1 to be selected, got %v, %v", selected, err)
+	}
+
+	if _, err := querier.Query(ctx, hosts, &FactQuery{Where: &Condition{}}); err == nil {
+		t.Error("Expected error for an empty condition, got nil")
+	}
+}
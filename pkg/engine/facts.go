@@ -3,23 +3,49 @@ package engine
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/openfroyo/openfroyo/pkg/micro_runner/protocol"
 	"github.com/openfroyo/openfroyo/pkg/stores"
 	"github.com/openfroyo/openfroyo/pkg/transports/ssh"
 	"github.com/rs/zerolog/log"
 )
 
-// FactsCollector collects facts from hosts.
+// FactsCollector collects facts from hosts through a registry of fact
+// collectors, one per namespace. The built-in collectors are registered by
+// NewFactsCollector and more can be added with RegisterFactCollector.
 type FactsCollector struct {
 	store        stores.Store
 	hostRegistry *HostRegistry
 	defaultTTL   int
+
+	// mu protects collectors and namespaces
+	mu         sync.RWMutex
+	collectors map[string]FactCollector
+
+	// namespaces lists the registered namespaces in registration order,
+	// which is the order they are collected in by default
+	namespaces []string
+
+	// runnerBinaryPath locates the micro-runner binaries used to gather
+	// facts in one round trip; empty collects over plain SSH commands
+	runnerBinaryPath string
+
+	// eventPublisher is notified when a collected fact changes
+	eventPublisher EventPublisher
+
+	// trackedFacts lists the namespaces whose changes are published; empty
+	// tracks every namespace
+	trackedFacts []string
 }
 
 // FactsCollectionResult contains the result of a facts collection operation.
@@ -30,80 +56,206 @@ type FactsCollectionResult struct {
 	CollectedAt  time.Time      `json:"collected_at"`
 	Duration     time.Duration  `json:"duration"`
 	Facts        map[string]any `json:"facts"`
-}
 
-// OSFacts contains OS information.
-type OSFacts struct {
-	Name     string `json:"name"`
-	Version  string `json:"version"`
-	Kernel   string `json:"kernel"`
-	Arch     string `json:"arch"`
-	Hostname string `json:"hostname"`
+	// Cached lists the namespaces served from the cache, and Errors the
+	// namespaces that failed, with their error.
+	Cached []string          `json:"cached,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
 }
 
-// CPUFacts contains CPU information.
-type CPUFacts struct {
-	Model    string `json:"model"`
-	Cores    int    `json:"cores"`
-	Threads  int    `json:"threads"`
-	Arch     string `json:"arch"`
-	Vendor   string `json:"vendor"`
-}
+// The built-in fact types are shared with the micro-runner, which gathers
+// them natively with facts.gather.
+type (
+	// OSFacts contains OS information.
+	OSFacts = protocol.OSFacts
+
+	// CPUFacts contains CPU information.
+	CPUFacts = protocol.CPUFacts
+
+	// MemoryFacts contains memory information.
+	MemoryFacts = protocol.MemoryFacts
+
+	// DiskFacts contains disk information.
+	DiskFacts = protocol.DiskFacts
+
+	// DiskDevice represents a disk device.
+	DiskDevice = protocol.DiskDevice
+
+	// NetworkFacts contains network information.
+	NetworkFacts = protocol.NetworkFacts
+
+	// NetworkInterface represents a network interface.
+	NetworkInterface = protocol.NetworkInterface
+
+	// PackageFacts contains package information.
+	PackageFacts = protocol.PackageFacts
+
+	// ServiceFacts contains the systemd service units.
+	ServiceFacts = protocol.ServiceFacts
+
+	// ServiceUnit represents a systemd unit and its state.
+	ServiceUnit = protocol.ServiceUnit
+
+	// UserFacts contains the local users and groups.
+	UserFacts = protocol.UserFacts
+
+	// LocalUser represents a local user.
+	LocalUser = protocol.LocalUser
+
+	// LocalGroup represents a local group.
+	LocalGroup = protocol.LocalGroup
+
+	// PortFacts contains the listening sockets.
+	PortFacts = protocol.PortFacts
 
-// MemoryFacts contains memory information.
-type MemoryFacts struct {
-	TotalMB    int64 `json:"total_mb"`
-	AvailableMB int64 `json:"available_mb"`
-	SwapTotalMB int64 `json:"swap_total_mb"`
-	SwapFreeMB  int64 `json:"swap_free_mb"`
+	// ListeningSocket represents a listening socket and its owning process.
+	ListeningSocket = protocol.ListeningSocket
+
+	// MountFacts contains the mounted filesystems and the fstab entries.
+	MountFacts = protocol.MountFacts
+
+	// MountEntry represents a line of a mount table.
+	MountEntry = protocol.MountEntry
+
+	// SysctlFacts contains the kernel parameters.
+	SysctlFacts = protocol.SysctlFacts
+
+	// LocaleFacts contains the timezone and locale settings.
+	LocaleFacts = protocol.LocaleFacts
+)
+
+// NewFactsCollector creates a new facts collector with the built-in
+// collectors registered.
+func NewFactsCollector(store stores.Store, hostRegistry *HostRegistry) *FactsCollector {
+	c := &FactsCollector{
+		store:        store,
+		hostRegistry: hostRegistry,
+		defaultTTL:   3600, // 1 hour default TTL
+		collectors:   make(map[string]FactCollector),
+	}
+
+	for _, collector := range c.builtinFactCollectors() {
+		if err := c.RegisterFactCollector(collector.Namespace(), collector); err != nil {
+			panic(fmt.Sprintf("failed to register built-in fact collector: %v", err))
+		}
+	}
+
+	return c
 }
 
-// DiskFacts contains disk information.
-type DiskFacts struct {
-	Devices []DiskDevice `json:"devices"`
+// builtinFactCollectors returns the collectors registered by default. Facts
+// that rarely change are kept longer than those that do.
+func (c *FactsCollector) builtinFactCollectors() []FactCollector {
+	return []FactCollector{
+		NewCommandFactCollector("os.basic", 24*time.Hour, func(ctx context.Context, exec CommandExecutor) (any, error) {
+			return c.collectOSFacts(ctx, exec)
+		}),
+		NewCommandFactCollector("hw.cpu", 24*time.Hour, func(ctx context.Context, exec CommandExecutor) (any, error) {
+			return c.collectCPUFacts(ctx, exec)
+		}),
+		NewCommandFactCollector("hw.memory", time.Hour, func(ctx context.Context, exec CommandExecutor) (any, error) {
+			return c.collectMemoryFacts(ctx, exec)
+		}),
+		NewCommandFactCollector("hw.disk", time.Hour, func(ctx context.Context, exec CommandExecutor) (any, error) {
+			return c.collectDiskFacts(ctx, exec)
+		}),
+		NewCommandFactCollector("net.ifaces", time.Hour, func(ctx context.Context, exec CommandExecutor) (any, error) {
+			return c.collectNetworkFacts(ctx, exec)
+		}),
+		NewCommandFactCollector("pkg.manifest", time.Hour, func(ctx context.Context, exec CommandExecutor) (any, error) {
+			return c.collectPackageFacts(ctx, exec)
+		}),
+		NewCommandFactCollector("svc.units", 10*time.Minute, func(ctx context.Context, exec CommandExecutor) (any, error) {
+			return c.collectServiceFacts(ctx, exec)
+		}),
+		NewCommandFactCollector("os.users", time.Hour, func(ctx context.Context, exec CommandExecutor) (any, error) {
+			return c.collectUserFacts(ctx, exec)
+		}),
+		NewCommandFactCollector("net.ports", 10*time.Minute, func(ctx context.Context, exec CommandExecutor) (any, error) {
+			return c.collectPortFacts(ctx, exec)
+		}),
+		NewCommandFactCollector("fs.mounts", time.Hour, func(ctx context.Context, exec CommandExecutor) (any, error) {
+			return c.collectMountFacts(ctx, exec)
+		}),
+		NewCommandFactCollector("os.sysctl", time.Hour, func(ctx context.Context, exec CommandExecutor) (any, error) {
+			return c.collectSysctlFacts(ctx, exec)
+		}),
+		NewCommandFactCollector("os.locale", 24*time.Hour, func(ctx context.Context, exec CommandExecutor) (any, error) {
+			return c.collectLocaleFacts(ctx, exec)
+		}),
+		NewCommandFactCollector(protocol.CustomFactsNamespace, time.Hour, func(ctx context.Context, exec CommandExecutor) (any, error) {
+			return c.collectCustomFacts(ctx, exec)
+		}),
+	}
 }
 
-// DiskDevice represents a disk device.
-type DiskDevice struct {
-	Device     string `json:"device"`
-	MountPoint string `json:"mount_point"`
-	FSType     string `json:"fs_type"`
-	TotalGB    int64  `json:"total_gb"`
-	UsedGB     int64  `json:"used_gb"`
-	AvailableGB int64  `json:"available_gb"`
-	UsePercent int    `json:"use_percent"`
+// RegisterFactCollector registers a fact collector for a namespace. The
+// namespace must match the collector's own and must not be registered yet.
+func (c *FactsCollector) RegisterFactCollector(namespace string, collector FactCollector) error {
+	if namespace == "" || collector == nil {
+		return NewPermanentError("fact collector requires a namespace and a collector", nil).
+			WithCode(ErrCodeValidation)
+	}
+	if collector.Namespace() != namespace {
+		return NewPermanentError(fmt.Sprintf("fact collector for %s reports namespace %s",
+			namespace, collector.Namespace()), nil).
+			WithCode(ErrCodeValidation)
+	}
+	// The host namespace exposes the inventory record in fact queries
+	if namespace == FactQueryHostNamespace || strings.HasPrefix(namespace, FactQueryHostNamespace+".") {
+		return NewPermanentError(fmt.Sprintf("fact namespace %s is reserved", namespace), nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.collectors[namespace]; exists {
+		return NewPermanentError(fmt.Sprintf("fact collector for %s is already registered", namespace), nil).
+			WithCode(ErrCodeAlreadyExists)
+	}
+
+	c.collectors[namespace] = collector
+	c.namespaces = append(c.namespaces, namespace)
+
+	return nil
 }
 
-// NetworkFacts contains network information.
-type NetworkFacts struct {
-	Interfaces []NetworkInterface `json:"interfaces"`
+// Namespaces returns the registered fact namespaces in registration order.
+func (c *FactsCollector) Namespaces() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]string(nil), c.namespaces...)
 }
 
-// NetworkInterface represents a network interface.
-type NetworkInterface struct {
-	Name       string   `json:"name"`
-	IPAddresses []string `json:"ip_addresses"`
-	MACAddress string   `json:"mac_address"`
-	State      string   `json:"state"`
+// collector returns the collector of a namespace, if any.
+func (c *FactsCollector) collector(namespace string) (FactCollector, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	collector, ok := c.collectors[namespace]
+	return collector, ok
 }
 
-// PackageFacts contains package information.
-type PackageFacts struct {
-	Manager   string   `json:"manager"`
-	Packages  []string `json:"packages"`
-	Count     int      `json:"count"`
+// SetRunnerBinaryPath makes the collector gather the built-in namespaces with
+// the micro-runner's facts.gather command, in one round trip per host, instead
+// of running and parsing shell commands. Binaries are looked up next to the
+// path as for onboarding. Hosts the runner cannot be started on fall back to
+// SSH commands.
+func (c *FactsCollector) SetRunnerBinaryPath(path string) {
+	c.runnerBinaryPath = path
 }
 
-// NewFactsCollector creates a new facts collector.
-func NewFactsCollector(store stores.Store, hostRegistry *HostRegistry) *FactsCollector {
-	return &FactsCollector{
-		store:        store,
-		hostRegistry: hostRegistry,
-		defaultTTL:   3600, // 1 hour default TTL
+// factTTL returns the TTL of a collector, or the default when it has none.
+func (c *FactsCollector) factTTL(collector FactCollector) time.Duration {
+	if ttl := collector.TTL(); ttl > 0 {
+		return ttl
 	}
+	return time.Duration(c.defaultTTL) * time.Second
 }
 
-// CollectFacts collects facts from a host.
+// CollectFacts collects facts from a host. Without fact types every
+// registered namespace is collected. Unless refreshing, namespaces whose
+// cached facts have not expired are returned from the cache instead.
 func (c *FactsCollector) CollectFacts(ctx context.Context, hostID string, factTypes []string, refresh bool) (*FactsCollectionResult, error) {
 	startTime := time.Now()
 
@@ -113,6 +265,11 @@ func (c *FactsCollector) CollectFacts(ctx context.Context, hostID string, factTy
 		return nil, fmt.Errorf("failed to get host: %w", err)
 	}
 
+	// Determine which fact types to collect
+	if len(factTypes) == 0 {
+		factTypes = c.Namespaces()
+	}
+
 	log.Info().
 		Str("host_id", hostID).
 		Str("host", host.Address).
@@ -120,76 +277,105 @@ func (c *FactsCollector) CollectFacts(ctx context.Context, hostID string, factTy
 		Bool("refresh", refresh).
 		Msg("Collecting facts")
 
-	// Check cache if not refreshing
-	if !refresh {
-		// Check if facts exist and are still valid
-		// For simplicity, we'll always collect for now
-	}
-
-	// Connect to host
-	sshConfig := &ssh.Config{
-		Host:                  host.Address,
-		Port:                  host.Port,
-		User:                  host.User,
-		AuthMethod:            ssh.AuthMethodKey,
-		PrivateKeyPath:        host.KeyPath,
-		StrictHostKeyChecking: false,
-		ConnectionTimeout:     30 * time.Second,
-		CommandTimeout:        2 * time.Minute,
-	}
-
-	transport, err := ssh.NewSSHClient(sshConfig)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create SSH client: %w", err)
-	}
-
-	if err := transport.Connect(ctx); err != nil {
-		return nil, fmt.Errorf("failed to connect to host: %w", err)
-	}
-	defer transport.Disconnect()
-
-	// Collect all facts
 	allFacts := make(map[string]any)
 	factsCount := 0
+	var fromCache []string
+	factErrors := make(map[string]string)
 
-	// Determine which fact types to collect
-	if len(factTypes) == 0 {
-		factTypes = []string{"os.basic", "hw.cpu", "hw.memory", "hw.disk", "net.ifaces", "pkg.manifest"}
+	// Serve unexpired facts from the cache if not refreshing
+	var cached map[string]*stores.Fact
+	if !refresh {
+		cached, err = c.cachedFacts(ctx, hostID)
+		if err != nil {
+			return nil, err
+		}
 	}
 
+	pending := make([]string, 0, len(factTypes))
 	for _, factType := range factTypes {
-		var factData any
-		var err error
-
-		switch factType {
-		case "os.basic":
-			factData, err = c.collectOSFacts(ctx, transport)
-		case "hw.cpu":
-			factData, err = c.collectCPUFacts(ctx, transport)
-		case "hw.memory":
-			factData, err = c.collectMemoryFacts(ctx, transport)
-		case "hw.disk":
-			factData, err = c.collectDiskFacts(ctx, transport)
-		case "net.ifaces":
-			factData, err = c.collectNetworkFacts(ctx, transport)
-		case "pkg.manifest":
-			factData, err = c.collectPackageFacts(ctx, transport)
-		default:
+		if fact, ok := cached[factType]; ok {
+			allFacts[factType] = json.RawMessage(fact.Value)
+			fromCache = append(fromCache, factType)
+			factsCount++
+			continue
+		}
+		if _, ok := c.collector(factType); !ok {
 			log.Warn().Str("type", factType).Msg("Unknown fact type")
+			factErrors[factType] = "unknown fact type"
 			continue
 		}
+		pending = append(pending, factType)
+	}
 
+	if len(pending) > 0 {
+		conn, err := c.connect(ctx, host)
 		if err != nil {
-			log.Error().Err(err).Str("type", factType).Msg("Failed to collect fact")
-			continue
+			return nil, err
+		}
+		defer conn.close()
+
+		// record stores collected facts and adds them to the result
+		record := func(factType string, factData json.RawMessage) {
+			allFacts[factType] = factData
+			factsCount++
+
+			collector, _ := c.collector(factType)
+			if err := c.storeFact(ctx, hostID, factType, factData, c.factTTL(collector)); err != nil {
+				log.Error().Err(err).Str("type", factType).Msg("Failed to store fact")
+				factErrors[factType] = err.Error()
+			}
+		}
+
+		// Gather what the micro-runner supports in one round trip, falling
+		// back to the per-namespace collectors when the gather fails
+		if gather, rest := conn.gatherable(pending); len(gather) > 0 {
+			gathered, err := conn.session.GatherFacts(ctx, gather)
+			if err != nil {
+				log.Warn().Err(err).Str("host_id", hostID).
+					Msg("Failed to gather facts, collecting each namespace")
+			} else {
+				for _, factType := range gather {
+					if factData, ok := gathered.Facts[factType]; ok {
+						record(factType, factData)
+						continue
+					}
+					message := gathered.Errors[factType]
+					if message == "" {
+						message = "not gathered"
+					}
+					log.Error().Str("type", factType).Str("error", message).Msg("Failed to gather fact")
+					factErrors[factType] = message
+				}
+				// Custom facts that failed are reported per file
+				for key, message := range gathered.Errors {
+					if strings.HasPrefix(key, protocol.CustomFactsNamespace+".") {
+						log.Error().Str("type", key).Str("error", message).Msg("Failed to gather fact")
+						factErrors[key] = message
+					}
+				}
+				pending = rest
+			}
+		}
+
+		target := TargetInfo{
+			ID:       host.ID,
+			Type:     "ssh",
+			Hostname: host.Address,
+			Labels:   host.Labels,
+			Exec:     conn.exec,
 		}
 
-		allFacts[factType] = factData
-		factsCount++
+		for _, factType := range pending {
+			collector, _ := c.collector(factType)
 
-		// Store fact
-		if err := c.storeFact(ctx, hostID, factType, factData); err != nil {
-			log.Error().Err(err).Str("type", factType).Msg("Failed to store fact")
+			factData, err := collector.Collect(ctx, target)
+			if err != nil {
+				log.Error().Err(err).Str("type", factType).Msg("Failed to collect fact")
+				factErrors[factType] = err.Error()
+				continue
+			}
+
+			record(factType, factData)
 		}
 	}
 
@@ -198,6 +384,7 @@ func (c *FactsCollector) CollectFacts(ctx context.Context, hostID string, factTy
 	log.Info().
 		Str("host_id", hostID).
 		Int("facts_count", factsCount).
+		Int("cached", len(fromCache)).
 		Dur("duration", duration).
 		Msg("Facts collection completed")
 
@@ -208,11 +395,222 @@ func (c *FactsCollector) CollectFacts(ctx context.Context, hostID string, factTy
 		CollectedAt: time.Now(),
 		Duration:    duration,
 		Facts:       allFacts,
+		Cached:      fromCache,
+		Errors:      factErrors,
 	}, nil
 }
 
+// factsConnection is the connection facts are collected over: a micro-runner
+// session when one could be started, or a plain SSH connection.
+type factsConnection struct {
+	exec    CommandExecutor
+	session *RunnerSession
+	close   func()
+}
+
+// gatherable splits namespaces into those the micro-runner gathers natively
+// and the rest, which are left to their collectors.
+func (f *factsConnection) gatherable(namespaces []string) (gather, rest []string) {
+	if f.session == nil || !f.session.Supports(protocol.CommandTypeFactsGather) {
+		return nil, namespaces
+	}
+
+	for _, namespace := range namespaces {
+		if slices.Contains(protocol.GatherFactNamespaces, namespace) {
+			gather = append(gather, namespace)
+		} else {
+			rest = append(rest, namespace)
+		}
+	}
+	return gather, rest
+}
+
+// connect opens the connection facts are collected over. A micro-runner
+// session is preferred when a runner binary is configured; if the runner
+// cannot be started, commands are run over SSH instead.
+func (c *FactsCollector) connect(ctx context.Context, host *Host) (*factsConnection, error) {
+	if c.runnerBinaryPath != "" {
+		session, err := OpenRunnerSession(ctx, host, c.runnerBinaryPath)
+		if err == nil {
+			return &factsConnection{
+				exec:    session,
+				session: session,
+				close:   func() { session.Close(ctx) },
+			}, nil
+		}
+		if isUnreachable(err) {
+			return nil, unreachableError(host, err)
+		}
+		log.Warn().Err(err).Str("host", host.Address).
+			Msg("Failed to start micro-runner, collecting facts over SSH")
+	}
+
+	transport, err := ssh.NewSSHClient(&ssh.Config{
+		Host:                  host.Address,
+		Port:                  host.Port,
+		User:                  host.User,
+		AuthMethod:            ssh.AuthMethodKey,
+		PrivateKeyPath:        host.KeyPath,
+		StrictHostKeyChecking: false,
+		ConnectionTimeout:     30 * time.Second,
+		CommandTimeout:        2 * time.Minute,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH client: %w", err)
+	}
+
+	if err := transport.Connect(ctx); err != nil {
+		if isUnreachable(err) {
+			return nil, unreachableError(host, err)
+		}
+		return nil, fmt.Errorf("failed to connect to host %s: %w", host.Address, err)
+	}
+
+	return &factsConnection{
+		exec:  transport,
+		close: func() { transport.Disconnect() },
+	}, nil
+}
+
+// isUnreachable reports whether a connection failed on the network. Bad keys
+// or rejected credentials are ordinary failures.
+func isUnreachable(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// unreachableError returns the error of a host that cannot be reached.
+func unreachableError(host *Host, err error) error {
+	return NewTransientError(fmt.Sprintf("host %s is unreachable", host.Address), err).
+		WithCode(ErrCodeUnreachable)
+}
+
+// HostFactsStatus is the outcome of collecting the facts of one host.
+type HostFactsStatus string
+
+const (
+	// HostFactsSucceeded means every requested namespace was collected.
+	HostFactsSucceeded HostFactsStatus = "succeeded"
+
+	// HostFactsFailed means the host was reached but some namespaces failed,
+	// or the collection failed for another reason.
+	HostFactsFailed HostFactsStatus = "failed"
+
+	// HostFactsUnreachable means the host could not be connected to.
+	HostFactsUnreachable HostFactsStatus = "unreachable"
+)
+
+// HostFactsResult is the result of collecting the facts of one host as part
+// of a collection across many hosts.
+type HostFactsResult struct {
+	// Host is the host the facts were collected from.
+	Host *Host `json:"host"`
+
+	// Status is the outcome of the collection.
+	Status HostFactsStatus `json:"status"`
+
+	// Result is the collection result, unless the collection failed as a whole.
+	Result *FactsCollectionResult `json:"result,omitempty"`
+
+	// Error is why the collection failed as a whole.
+	Error string `json:"error,omitempty"`
+}
+
+// FactsProgressFunc is called as each host of a collection finishes, with
+// the number of hosts done so far and the total.
+type FactsProgressFunc func(done, total int, result *HostFactsResult)
+
+// CollectFactsFromHosts collects facts from many hosts with at most
+// parallelism collections at a time. It continues past hosts that fail and
+// returns a result per host, in the order of hosts. Progress is optional and
+// called from one goroutine at a time.
+func (c *FactsCollector) CollectFactsFromHosts(
+	ctx context.Context,
+	hosts []*Host,
+	factTypes []string,
+	refresh bool,
+	parallelism int,
+	progress FactsProgressFunc,
+) []*HostFactsResult {
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+
+	results := make([]*HostFactsResult, len(hosts))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done := 0
+
+	for w := 0; w < parallelism && w < len(hosts); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				result := c.collectHostFacts(ctx, hosts[i], factTypes, refresh)
+				results[i] = result
+
+				mu.Lock()
+				done++
+				if progress != nil {
+					progress(done, len(hosts), result)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := range hosts {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+// collectHostFacts collects the facts of one host and classifies the outcome.
+func (c *FactsCollector) collectHostFacts(ctx context.Context, host *Host, factTypes []string, refresh bool) *HostFactsResult {
+	result, err := c.CollectFacts(ctx, host.ID, factTypes, refresh)
+	if err != nil {
+		status := HostFactsFailed
+		var engineErr *EngineError
+		if errors.As(err, &engineErr) && engineErr.Code == ErrCodeUnreachable {
+			status = HostFactsUnreachable
+		}
+		c.recordHostStatus(ctx, host, status)
+		return &HostFactsResult{Host: host, Status: status, Error: err.Error()}
+	}
+
+	status := HostFactsSucceeded
+	if len(result.Errors) > 0 {
+		status = HostFactsFailed
+	}
+	c.recordHostStatus(ctx, host, status)
+	return &HostFactsResult{Host: host, Status: status, Result: result}
+}
+
+// recordHostStatus marks a host unreachable in the inventory when facts could
+// not be collected for lack of a connection, and active again otherwise.
+func (c *FactsCollector) recordHostStatus(ctx context.Context, host *Host, status HostFactsStatus) {
+	hostStatus := HostStatusActive
+	if status == HostFactsUnreachable {
+		hostStatus = HostStatusUnreachable
+	}
+	if host.Status == hostStatus || c.hostRegistry == nil {
+		return
+	}
+
+	if err := c.hostRegistry.SetHostStatus(ctx, host.ID, hostStatus); err != nil {
+		log.Warn().Err(err).Str("host", host.ID).Msg("Failed to record host status")
+		return
+	}
+	host.Status = hostStatus
+}
+
 // collectOSFacts collects OS information.
-func (c *FactsCollector) collectOSFacts(ctx context.Context, transport *ssh.SSHClient) (*OSFacts, error) {
+func (c *FactsCollector) collectOSFacts(ctx context.Context, transport CommandExecutor) (*OSFacts, error) {
 	facts := &OSFacts{}
 
 	// Get OS name and version
@@ -222,6 +620,8 @@ func (c *FactsCollector) collectOSFacts(ctx context.Context, transport *ssh.SSHC
 		for _, line := range lines {
 			if strings.HasPrefix(line, "NAME=") {
 				facts.Name = strings.Trim(strings.TrimPrefix(line, "NAME="), "\"")
+			} else if strings.HasPrefix(line, "ID=") {
+				facts.Distro = strings.Trim(strings.TrimPrefix(line, "ID="), "\"")
 			} else if strings.HasPrefix(line, "VERSION=") {
 				facts.Version = strings.Trim(strings.TrimPrefix(line, "VERSION="), "\"")
 			}
@@ -250,7 +650,7 @@ func (c *FactsCollector) collectOSFacts(ctx context.Context, transport *ssh.SSHC
 }
 
 // collectCPUFacts collects CPU information.
-func (c *FactsCollector) collectCPUFacts(ctx context.Context, transport *ssh.SSHClient) (*CPUFacts, error) {
+func (c *FactsCollector) collectCPUFacts(ctx context.Context, transport CommandExecutor) (*CPUFacts, error) {
 	facts := &CPUFacts{}
 
 	// Get CPU info from /proc/cpuinfo
@@ -291,7 +691,7 @@ func (c *FactsCollector) collectCPUFacts(ctx context.Context, transport *ssh.SSH
 }
 
 // collectMemoryFacts collects memory information.
-func (c *FactsCollector) collectMemoryFacts(ctx context.Context, transport *ssh.SSHClient) (*MemoryFacts, error) {
+func (c *FactsCollector) collectMemoryFacts(ctx context.Context, transport CommandExecutor) (*MemoryFacts, error) {
 	facts := &MemoryFacts{}
 
 	// Get memory info from /proc/meminfo
@@ -325,7 +725,7 @@ func (c *FactsCollector) collectMemoryFacts(ctx context.Context, transport *ssh.
 }
 
 // collectDiskFacts collects disk information.
-func (c *FactsCollector) collectDiskFacts(ctx context.Context, transport *ssh.SSHClient) (*DiskFacts, error) {
+func (c *FactsCollector) collectDiskFacts(ctx context.Context, transport CommandExecutor) (*DiskFacts, error) {
 	facts := &DiskFacts{
 		Devices: make([]DiskDevice, 0),
 	}
@@ -373,7 +773,7 @@ func (c *FactsCollector) collectDiskFacts(ctx context.Context, transport *ssh.SS
 }
 
 // collectNetworkFacts collects network interface information.
-func (c *FactsCollector) collectNetworkFacts(ctx context.Context, transport *ssh.SSHClient) (*NetworkFacts, error) {
+func (c *FactsCollector) collectNetworkFacts(ctx context.Context, transport CommandExecutor) (*NetworkFacts, error) {
 	facts := &NetworkFacts{
 		Interfaces: make([]NetworkInterface, 0),
 	}
@@ -440,7 +840,7 @@ func (c *FactsCollector) collectNetworkFacts(ctx context.Context, transport *ssh
 }
 
 // collectPackageFacts collects installed package information.
-func (c *FactsCollector) collectPackageFacts(ctx context.Context, transport *ssh.SSHClient) (*PackageFacts, error) {
+func (c *FactsCollector) collectPackageFacts(ctx context.Context, transport CommandExecutor) (*PackageFacts, error) {
 	facts := &PackageFacts{
 		Packages: make([]string, 0),
 	}
@@ -482,24 +882,248 @@ func (c *FactsCollector) collectPackageFacts(ctx context.Context, transport *ssh
 	return facts, nil
 }
 
-// storeFact stores a fact in the database.
-func (c *FactsCollector) storeFact(ctx context.Context, targetID string, namespace string, data any) error {
-	// Marshal fact data to JSON
-	valueBytes, err := json.Marshal(data)
+// collectServiceFacts collects the systemd service units and their states.
+func (c *FactsCollector) collectServiceFacts(ctx context.Context, transport CommandExecutor) (*ServiceFacts, error) {
+	if _, _, err := transport.ExecuteCommand(ctx, "test -d /run/systemd/system"); err != nil {
+		return nil, fmt.Errorf("systemd is not running")
+	}
+
+	units, _, err := transport.ExecuteCommand(ctx,
+		"systemctl list-units --all --type=service --plain --no-legend --no-pager")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list units: %w", err)
+	}
+
+	unitFiles, _, err := transport.ExecuteCommand(ctx,
+		"systemctl list-unit-files --type=service --no-legend --no-pager")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unit files: %w", err)
+	}
+
+	return &ServiceFacts{Units: protocol.ParseSystemdUnits(units, unitFiles)}, nil
+}
+
+// collectUserFacts collects the local users and groups.
+func (c *FactsCollector) collectUserFacts(ctx context.Context, transport CommandExecutor) (*UserFacts, error) {
+	passwd, _, err := transport.ExecuteCommand(ctx, "cat /etc/passwd")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read /etc/passwd: %w", err)
+	}
+
+	group, _, err := transport.ExecuteCommand(ctx, "cat /etc/group")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read /etc/group: %w", err)
+	}
+
+	return protocol.ParseUserFacts([]byte(passwd), []byte(group)), nil
+}
+
+// ssProcessPattern matches the first process of an ss socket, e.g.
+// users:(("sshd",pid=812,fd=3)).
+var ssProcessPattern = regexp.MustCompile(`\("([^"]*)",pid=(\d+)`)
+
+// collectPortFacts collects the listening sockets and their owning processes.
+func (c *FactsCollector) collectPortFacts(ctx context.Context, transport CommandExecutor) (*PortFacts, error) {
+	facts := &PortFacts{Listening: make([]ListeningSocket, 0)}
+
+	// Netid State Recv-Q Send-Q Local:Port Peer:Port Process
+	stdout, _, err := transport.ExecuteCommand(ctx, "ss -H -tulnp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sockets: %w", err)
+	}
+
+	for _, line := range strings.Split(stdout, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+
+		sep := strings.LastIndex(fields[4], ":")
+		if sep < 0 {
+			continue
+		}
+		port, err := strconv.Atoi(fields[4][sep+1:])
+		if err != nil {
+			continue
+		}
+
+		// Strip brackets and interface scopes, e.g. [::1] or 127.0.0.53%lo
+		address := strings.Trim(fields[4][:sep], "[]")
+		address, _, _ = strings.Cut(address, "%")
+
+		socket := ListeningSocket{
+			Protocol: fields[0],
+			Address:  address,
+			Port:     port,
+		}
+		switch {
+		case address == "*":
+			socket.Address = "0.0.0.0"
+		case strings.Contains(address, ":"):
+			socket.Protocol += "6"
+		}
+
+		if match := ssProcessPattern.FindStringSubmatch(line); match != nil {
+			socket.Process = match[1]
+			socket.PID, _ = strconv.Atoi(match[2])
+		}
+
+		facts.Listening = append(facts.Listening, socket)
+	}
+
+	return facts, nil
+}
+
+// collectMountFacts collects the mounted filesystems and the fstab entries.
+func (c *FactsCollector) collectMountFacts(ctx context.Context, transport CommandExecutor) (*MountFacts, error) {
+	mounts, _, err := transport.ExecuteCommand(ctx, "cat /proc/self/mounts")
 	if err != nil {
-		return fmt.Errorf("failed to marshal fact data: %w", err)
+		return nil, fmt.Errorf("failed to read /proc/self/mounts: %w", err)
 	}
 
+	// Hosts without an fstab have no entries
+	fstab, _, err := transport.ExecuteCommand(ctx, "cat /etc/fstab 2>/dev/null || true")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read /etc/fstab: %w", err)
+	}
+
+	return &MountFacts{
+		Mounts: protocol.ParseMountTable([]byte(mounts)),
+		Fstab:  protocol.ParseMountTable([]byte(fstab)),
+	}, nil
+}
+
+// collectSysctlFacts collects the kernel parameters. Parameters that cannot
+// be read are left out.
+func (c *FactsCollector) collectSysctlFacts(ctx context.Context, transport CommandExecutor) (*SysctlFacts, error) {
+	stdout, _, err := transport.ExecuteCommand(ctx, "sysctl -a 2>/dev/null || true")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kernel parameters: %w", err)
+	}
+
+	facts := &SysctlFacts{Params: make(map[string]any)}
+	for _, line := range strings.Split(stdout, "\n") {
+		key, value, ok := strings.Cut(line, " = ")
+		if !ok {
+			continue
+		}
+		facts.Set(strings.TrimSpace(key), value)
+	}
+
+	return facts, nil
+}
+
+// collectLocaleFacts collects the timezone and the system locale.
+func (c *FactsCollector) collectLocaleFacts(ctx context.Context, transport CommandExecutor) (*LocaleFacts, error) {
+	link, _, err := transport.ExecuteCommand(ctx, "readlink /etc/localtime 2>/dev/null || true")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read /etc/localtime: %w", err)
+	}
+
+	timezone, _, err := transport.ExecuteCommand(ctx, "cat /etc/timezone 2>/dev/null || true")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read /etc/timezone: %w", err)
+	}
+
+	localeConf, _, err := transport.ExecuteCommand(ctx,
+		"cat /etc/locale.conf 2>/dev/null || cat /etc/default/locale 2>/dev/null || true")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the locale: %w", err)
+	}
+
+	return protocol.ParseLocaleFacts(link, timezone, localeConf), nil
+}
+
+// collectCustomFacts collects the facts the host publishes in its custom
+// facts directory, as facts.gather does natively. Failed files are logged
+// and left out.
+func (c *FactsCollector) collectCustomFacts(ctx context.Context, transport CommandExecutor) (map[string]json.RawMessage, error) {
+	dir := protocol.DefaultCustomFactsDir
+	facts := make(map[string]json.RawMessage)
+	seen := make(map[string]bool)
+
+	// List the files with their permissions
+	stdout, _, err := transport.ExecuteCommand(ctx, fmt.Sprintf(
+		"if [ -d %[1]s ]; then find %[1]s -maxdepth 1 -type f -printf '%%m %%f\\n'; fi", shellQuote(dir)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", dir, err)
+	}
+
+	for _, line := range strings.Split(stdout, "\n") {
+		modeField, file, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			continue
+		}
+
+		mode, err := strconv.ParseUint(modeField, 8, 32)
+		if err != nil {
+			continue
+		}
+		script := mode&0111 != 0
+		if !protocol.IsCustomFactFile(file, script) {
+			continue
+		}
+
+		name, ok, err := protocol.CustomFactName(file)
+		if err != nil {
+			log.Warn().Err(err).Str("file", file).Msg("Skipping custom fact")
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if seen[name] {
+			log.Warn().Str("fact", name).Msg("Custom fact is published by more than one file")
+			delete(facts, name)
+			continue
+		}
+		seen[name] = true
+
+		path := shellQuote(dir + "/" + file)
+		timeout := protocol.DefaultCustomFactTimeout
+
+		var content string
+		if script {
+			scriptCtx, cancel := context.WithTimeout(ctx, timeout+5*time.Second)
+			content, _, err = transport.ExecuteCommand(scriptCtx,
+				fmt.Sprintf("timeout %d %s", int(timeout.Seconds()), path))
+			cancel()
+		} else {
+			content, _, err = transport.ExecuteCommand(ctx, "cat "+path)
+		}
+		if err != nil {
+			log.Warn().Err(err).Str("file", file).Dur("timeout", timeout).Msg("Failed to read custom fact")
+			continue
+		}
+
+		data, err := protocol.DecodeCustomFact(file, []byte(content), script)
+		if err != nil {
+			log.Warn().Err(err).Str("file", file).Msg("Skipping custom fact")
+			continue
+		}
+		facts[name] = data
+	}
+
+	return facts, nil
+}
+
+// shellQuote quotes a string for use as a single shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// storeFact stores a fact in the database.
+func (c *FactsCollector) storeFact(ctx context.Context, targetID string, namespace string, data json.RawMessage, ttl time.Duration) error {
 	now := time.Now()
-	expiresAt := now.Add(time.Duration(c.defaultTTL) * time.Second)
+	expiresAt := now.Add(ttl)
 
 	fact := &stores.Fact{
 		ID:        uuid.New().String(),
 		TargetID:  targetID,
 		Namespace: namespace,
 		Key:       "data",
-		Value:     string(valueBytes),
-		TTL:       c.defaultTTL,
+		Value:     string(data),
+		TTL:       int(ttl.Seconds()),
 		ExpiresAt: &expiresAt,
 		CreatedAt: now,
 		UpdatedAt: now,
@@ -509,20 +1133,88 @@ func (c *FactsCollector) storeFact(ctx context.Context, targetID string, namespa
 		return fmt.Errorf("failed to store fact: %w", err)
 	}
 
-	return nil
+	return c.recordFactVersion(ctx, targetID, namespace, data, now)
 }
 
-// GetFacts retrieves cached facts for a host.
-func (c *FactsCollector) GetFacts(ctx context.Context, hostID string, namespace *string) (map[string]any, error) {
-	facts, err := c.store.ListFacts(ctx, &hostID, namespace, 1000, 0)
+// cachedFacts returns the unexpired facts of a host keyed by namespace.
+func (c *FactsCollector) cachedFacts(ctx context.Context, hostID string) (map[string]*stores.Fact, error) {
+	facts, err := c.store.ListFacts(ctx, &hostID, nil, 1000, 0)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list facts: %w", err)
 	}
 
+	now := time.Now()
+	result := make(map[string]*stores.Fact)
+	for _, fact := range facts {
+		if fact.ExpiresAt != nil && !fact.ExpiresAt.After(now) {
+			continue // Skip expired facts
+		}
+		result[fact.Namespace] = fact
+	}
+
+	return result, nil
+}
+
+// DiscoverFacts collects the given namespaces from a target, or every
+// registered namespace when none are given, bypassing the cache.
+func (c *FactsCollector) DiscoverFacts(ctx context.Context, targetID string, namespaces []string) (*Facts, error) {
+	if _, err := c.CollectFacts(ctx, targetID, namespaces, true); err != nil {
+		return nil, err
+	}
+	return c.GetCachedFacts(ctx, targetID)
+}
+
+// RefreshFacts collects the facts of a target whose cached facts expired,
+// or all of them when forced.
+func (c *FactsCollector) RefreshFacts(ctx context.Context, targetID string, force bool) (*Facts, error) {
+	if _, err := c.CollectFacts(ctx, targetID, nil, force); err != nil {
+		return nil, err
+	}
+	return c.GetCachedFacts(ctx, targetID)
+}
+
+// GetCachedFacts returns the unexpired cached facts of a target. The TTL of
+// the result is the time until the first of them expires.
+func (c *FactsCollector) GetCachedFacts(ctx context.Context, targetID string) (*Facts, error) {
+	cached, err := c.cachedFacts(ctx, targetID)
+	if err != nil {
+		return nil, err
+	}
+
+	facts := &Facts{
+		TargetID: targetID,
+		Data:     make(map[string]json.RawMessage, len(cached)),
+		Version:  "1",
+	}
+
+	now := time.Now()
+	for namespace, fact := range cached {
+		facts.Data[namespace] = json.RawMessage(fact.Value)
+
+		if facts.CollectedAt.IsZero() || fact.UpdatedAt.Before(facts.CollectedAt) {
+			facts.CollectedAt = fact.UpdatedAt
+		}
+		if fact.ExpiresAt != nil {
+			if remaining := fact.ExpiresAt.Sub(now); facts.TTL == 0 || remaining < facts.TTL {
+				facts.TTL = remaining
+			}
+		}
+	}
+
+	return facts, nil
+}
+
+// GetFacts retrieves the unexpired cached facts of a host.
+func (c *FactsCollector) GetFacts(ctx context.Context, hostID string, namespace *string) (map[string]any, error) {
+	facts, err := c.cachedFacts(ctx, hostID)
+	if err != nil {
+		return nil, err
+	}
+
 	result := make(map[string]any)
 	for _, fact := range facts {
-		if fact.Namespace == "host.metadata" || fact.Namespace == "host.labels" {
-			continue // Skip host metadata
+		if namespace != nil && fact.Namespace != *namespace {
+			continue
 		}
 
 		var data any
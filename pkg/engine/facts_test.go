@@ -0,0 +1,456 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeCommandExecutor answers commands from a map of canned outputs.
+type fakeCommandExecutor struct {
+	outputs map[string]string
+}
+
+func (f *fakeCommandExecutor) ExecuteCommand(ctx context.Context, cmd string) (string, string, error) {
+	return f.outputs[cmd], "", nil
+}
+
+// newDockerFactCollector returns a collector reporting the Docker version.
+func newDockerFactCollector() *CommandFactCollector {
+	return NewCommandFactCollector("app.docker", 10*time.Minute, func(ctx context.Context, exec CommandExecutor) (any, error) {
+		stdout, _, err := exec.ExecuteCommand(ctx, "docker version --format '{{.Server.Version}}'")
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{"version": strings.TrimSpace(stdout)}, nil
+	})
+}
+
+func TestFactsCollector_RegisterFactCollector(t *testing.T) {
+	var _ Discoverer = (*FactsCollector)(nil)
+
+	collector := NewFactsCollector(newTestSQLiteStore(t), nil)
+
+	builtins := []string{"os.basic", "hw.cpu", "hw.memory", "hw.disk", "net.ifaces", "pkg.manifest",
+		"svc.units", "os.users", "net.ports", "fs.mounts", "os.sysctl", "os.locale", "custom"}
+	if got := strings.Join(collector.Namespaces(), ","); got != strings.Join(builtins, ",") {
+		t.Errorf("Expected built-in namespaces %v, got %s", builtins, got)
+	}
+
+	if err := collector.RegisterFactCollector("app.docker", newDockerFactCollector()); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	namespaces := collector.Namespaces()
+	if namespaces[len(namespaces)-1] != "app.docker" {
+		t.Errorf("Expected app.docker to be collected last, got %v", namespaces)
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		collector FactCollector
+	}{
+		{"duplicate", "app.docker", newDockerFactCollector()},
+		{"built-in", "os.basic", NewCommandFactCollector("os.basic", 0, nil)},
+		{"mismatched namespace", "app.podman", newDockerFactCollector()},
+		{"reserved", "host.labels", NewCommandFactCollector("host.labels", 0, nil)},
+		{"nil collector", "app.nil", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := collector.RegisterFactCollector(tt.namespace, tt.collector); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestCommandFactCollector_Collect(t *testing.T) {
+	ctx := context.Background()
+	collector := newDockerFactCollector()
+
+	exec := &fakeCommandExecutor{outputs: map[string]string{
+		"docker version --format '{{.Server.Version}}'": "24.0.7\n",
+	}}
+
+	data, err := collector.Collect(ctx, TargetInfo{ID: "web1", Exec: exec})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if string(data) != `{"version":"24.0.7"}` {
+		t.Errorf("Unexpected facts: %s", data)
+	}
+
+	// Command collectors need the target's connection
+	if _, err := collector.Collect(ctx, TargetInfo{ID: "web1"}); err == nil {
+		t.Error("Expected error without a connection, got nil")
+	}
+}
+
+func TestFactsCollector_CachedFacts(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLiteStore(t)
+	hostRegistry := NewHostRegistry(store)
+
+	// The host is unreachable, so only cached facts can be returned
+	host := &Host{ID: "web1", Address: "127.0.0.1", Port: 1, User: "root", Labels: map[string]string{"role": "web"}}
+	if err := hostRegistry.AddHost(ctx, host); err != nil {
+		t.Fatalf("Failed to add host: %v", err)
+	}
+
+	collector := NewFactsCollector(store, hostRegistry)
+	if err := collector.storeFact(ctx, "web1", "os.basic", json.RawMessage(`{"distro":"ubuntu"}`), time.Hour); err != nil {
+		t.Fatalf("Failed to store fact: %v", err)
+	}
+	if err := collector.storeFact(ctx, "web1", "hw.memory", json.RawMessage(`{"total_mb":1024}`), -time.Minute); err != nil {
+		t.Fatalf("Failed to store fact: %v", err)
+	}
+
+	facts, err := collector.GetCachedFacts(ctx, "web1")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Expired facts are left out
+	if len(facts.Data) != 1 || string(facts.Data["os.basic"]) != `{"distro":"ubuntu"}` {
+		t.Errorf("Expected only os.basic, got %v", facts.Data)
+	}
+	if facts.TTL <= 0 || facts.TTL > time.Hour {
+		t.Errorf("Expected a TTL of up to an hour, got %s", facts.TTL)
+	}
+
+	values, err := collector.GetFacts(ctx, "web1", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if _, ok := values["hw.memory"]; ok || len(values) != 1 {
+		t.Errorf("Expected only os.basic, got %v", values)
+	}
+
+	namespace := "hw.memory"
+	if values, err := collector.GetFacts(ctx, "web1", &namespace); err != nil || len(values) != 0 {
+		t.Errorf("Expected no unexpired hw.memory facts, got %v, %v", values, err)
+	}
+
+	// Unexpired facts are served from the cache without connecting
+	result, err := collector.CollectFacts(ctx, "web1", []string{"os.basic"}, false)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if result.FactsCount != 1 || len(result.Cached) != 1 || result.Cached[0] != "os.basic" {
+		t.Errorf("Expected os.basic from the cache, got %+v", result)
+	}
+
+	// Expired facts have to be collected again
+	if _, err := collector.CollectFacts(ctx, "web1", []string{"hw.memory"}, false); err == nil {
+		t.Error("Expected error connecting to an unreachable host, got nil")
+	}
+}
+
+func TestFactsSweeper_Sweep(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLiteStore(t)
+	hostRegistry := NewHostRegistry(store)
+
+	if err := hostRegistry.AddHost(ctx, &Host{ID: "web1", Address: "10.0.0.1", Labels: map[string]string{"role": "web"}}); err != nil {
+		t.Fatalf("Failed to add host: %v", err)
+	}
+
+	collector := NewFactsCollector(store, hostRegistry)
+	if err := collector.storeFact(ctx, "web1", "os.basic", json.RawMessage(`{"distro":"ubuntu"}`), time.Hour); err != nil {
+		t.Fatalf("Failed to store fact: %v", err)
+	}
+	if err := collector.storeFact(ctx, "web1", "hw.memory", json.RawMessage(`{"total_mb":1024}`), -time.Minute); err != nil {
+		t.Fatalf("Failed to store fact: %v", err)
+	}
+
+	sweeper := NewFactsSweeper(store, 10*time.Millisecond)
+	sweeper.Start(ctx)
+	time.Sleep(50 * time.Millisecond)
+	sweeper.Stop()
+
+	// Only the expired fact is deleted; the host itself never expires
+	if _, err := hostRegistry.GetHost(ctx, "web1"); err != nil {
+		t.Errorf("Expected the host to be kept, got: %v", err)
+	}
+
+	facts, err := collector.GetFacts(ctx, "web1", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if _, ok := facts["hw.memory"]; ok {
+		t.Error("Expected the expired fact to be deleted")
+	}
+	if _, ok := facts["os.basic"]; !ok {
+		t.Error("Expected the unexpired fact to be kept")
+	}
+
+	deleted, err := sweeper.Sweep(ctx)
+	if err != nil || deleted != 0 {
+		t.Errorf("Expected nothing left to sweep, got %d, %v", deleted, err)
+	}
+}
+
+func TestFactsCollector_CollectFactsFromHosts(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLiteStore(t)
+	hostRegistry := NewHostRegistry(store)
+
+	keyPath, _, err := NewOnboardingService(store, t.TempDir(), "").ensureSSHKey("id_ed25519")
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	// Nothing listens on port 1, so web2 cannot be reached
+	hosts := []*Host{
+		{ID: "web1", Address: "127.0.0.1", Port: 1, User: "root"},
+		{ID: "web2", Address: "127.0.0.1", Port: 1, User: "root", KeyPath: keyPath},
+	}
+	for _, host := range hosts {
+		if err := hostRegistry.AddHost(ctx, host); err != nil {
+			t.Fatalf("Failed to add host: %v", err)
+		}
+	}
+	// Not in the registry
+	hosts = append(hosts, &Host{ID: "ghost", Address: "10.0.0.99"})
+
+	// web1 is served from the cache, web2 has to be reached
+	collector := NewFactsCollector(store, hostRegistry)
+	if err := collector.storeFact(ctx, "web1", "os.basic", json.RawMessage(`{"distro":"ubuntu"}`), time.Hour); err != nil {
+		t.Fatalf("Failed to store fact: %v", err)
+	}
+
+	var progress []int
+	results := collector.CollectFactsFromHosts(ctx, hosts, []string{"os.basic"}, false, 2,
+		func(done, total int, result *HostFactsResult) {
+			if total != 3 {
+				t.Errorf("Expected a total of 3, got %d", total)
+			}
+			progress = append(progress, done)
+		})
+
+	if len(progress) != 3 || progress[2] != 3 {
+		t.Errorf("Expected progress for every host, got %v", progress)
+	}
+
+	expected := []HostFactsStatus{HostFactsSucceeded, HostFactsUnreachable, HostFactsFailed}
+	for i, result := range results {
+		if result.Host != hosts[i] {
+			t.Errorf("Expected results in host order, got %s at %d", result.Host.ID, i)
+		}
+		if result.Status != expected[i] {
+			t.Errorf("Expected %s for %s, got %s (%s)", expected[i], result.Host.ID, result.Status, result.Error)
+		}
+	}
+
+	// Unreachable hosts are marked so in the inventory
+	for id, want := range map[string]HostStatus{"web1": HostStatusActive, "web2": HostStatusUnreachable} {
+		host, err := hostRegistry.GetHost(ctx, id)
+		if err != nil {
+			t.Fatalf("Failed to get host: %v", err)
+		}
+		if host.Status != want {
+			t.Errorf("Expected %s to be %s, got %s", id, want, host.Status)
+		}
+	}
+
+	// Namespace errors are reported rather than only logged
+	results = collector.CollectFactsFromHosts(ctx, hosts[:1], []string{"os.basic", "app.unknown"}, false, 1, nil)
+	if results[0].Status != HostFactsFailed || results[0].Result.Errors["app.unknown"] == "" {
+		t.Errorf("Expected app.unknown to fail, got %+v", results[0].Result)
+	}
+}
+
+func TestFactsCollector_CollectCustomFacts(t *testing.T) {
+	collector := NewFactsCollector(newTestSQLiteStore(t), nil)
+
+	// Custom facts fall back to SSH commands without the micro-runner
+	exec := &fakeCommandExecutor{outputs: map[string]string{
+		`if [ -d '/etc/froyo/facts.d' ]; then find '/etc/froyo/facts.d' -maxdepth 1 -type f -printf '%m %f\n'; fi`: "" +
+			"644 app.json\n755 rack.sh\n644 team.yaml\n644 broken.json\n644 README.txt\n644 .hidden.json\n644 my-app.json\n",
+		`cat '/etc/froyo/facts.d/app.json'`:       `{"version": "1.4.2"}`,
+		`timeout 10 '/etc/froyo/facts.d/rack.sh'`: `{"rack": "r12"}`,
+		`cat '/etc/froyo/facts.d/team.yaml'`:      "owner: payments\noncall: true\n",
+		`cat '/etc/froyo/facts.d/broken.json'`:    `{"version":`,
+	}}
+
+	facts, err := collector.collectCustomFacts(context.Background(), exec)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	expected := map[string]string{
+		"app":  `{"version": "1.4.2"}`,
+		"rack": `{"rack": "r12"}`,
+		"team": `{"oncall":true,"owner":"payments"}`,
+	}
+	if len(facts) != len(expected) {
+		t.Errorf("Expected facts %v, got %v", expected, facts)
+	}
+	for name, want := range expected {
+		if string(facts[name]) != want {
+			t.Errorf("Expected %s to be %s, got %s", name, want, facts[name])
+		}
+	}
+}
+
+func TestFactsCollector_CollectPortAndSysctlFacts(t *testing.T) {
+	ctx := context.Background()
+	collector := NewFactsCollector(newTestSQLiteStore(t), nil)
+
+	exec := &fakeCommandExecutor{outputs: map[string]string{
+		"ss -H -tulnp": "" +
+			"udp   UNCONN 0      0      127.0.0.53%lo:53        0.0.0.0:*    users:((\"systemd-resolve\",pid=611,fd=13))\n" +
+			"tcp   LISTEN 0      128          0.0.0.0:22        0.0.0.0:*    users:((\"sshd\",pid=812,fd=3))\n" +
+			"tcp   LISTEN 0      511             [::]:80           [::]:*    users:((\"nginx\",pid=930,fd=7),(\"nginx\",pid=931,fd=7))\n" +
+			"tcp   LISTEN 0      4096               *:9100             *:*\n",
+		"sysctl -a 2>/dev/null || true": "" +
+			"net.ipv4.ip_forward = 1\n" +
+			"net.ipv4.ip_local_port_range = 32768\t60999\n" +
+			"vm.swappiness = 60\n",
+	}}
+
+	ports, err := collector.collectPortFacts(ctx, exec)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	expected := []ListeningSocket{
+		{Protocol: "udp", Address: "127.0.0.53", Port: 53, PID: 611, Process: "systemd-resolve"},
+		{Protocol: "tcp", Address: "0.0.0.0", Port: 22, PID: 812, Process: "sshd"},
+		{Protocol: "tcp6", Address: "::", Port: 80, PID: 930, Process: "nginx"},
+		{Protocol: "tcp", Address: "0.0.0.0", Port: 9100},
+	}
+	if len(ports.Listening) != len(expected) {
+		t.Fatalf("Expected %d sockets, got %+v", len(expected), ports.Listening)
+	}
+	for i, want := range expected {
+		if ports.Listening[i] != want {
+			t.Errorf("Expected %+v, got %+v", want, ports.Listening[i])
+		}
+	}
+
+	sysctl, err := collector.collectSysctlFacts(ctx, exec)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if value, _ := sysctl.Get("net.ipv4.ip_forward"); value != "1" {
+		t.Errorf("Expected ip_forward to be 1, got %q", value)
+	}
+	if value, _ := sysctl.Get("net.ipv4.ip_local_port_range"); value != "32768 60999" {
+		t.Errorf("Expected the port range with collapsed whitespace, got %q", value)
+	}
+}
+
+func TestDiffFactValues_ScalarLists(t *testing.T) {
+	before := json.RawMessage(`{"names":["curl","openssl","vim"]}`)
+	after := json.RawMessage(`{"names":["bash","curl","vim"]}`)
+
+	changes, err := diffFactValues(before, after)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// An insertion does not shift the later elements
+	expected := []Change{
+		{Path: ".names", Before: "openssl", Action: ChangeActionRemove},
+		{Path: ".names", After: "bash", Action: ChangeActionAdd},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected changes %+v, got %+v", expected, changes)
+	}
+
+	// Reordering is not a change
+	changes, err = diffFactValues(before, json.RawMessage(`{"names":["vim","openssl","curl"]}`))
+	if err != nil || len(changes) != 0 {
+		t.Errorf("Expected no changes, got %+v, %v", changes, err)
+	}
+}
+
+func TestFactsCollector_FactHistory(t *testing.T) {
+	ctx := context.Background()
+	collector := NewFactsCollector(newTestSQLiteStore(t), nil)
+	publisher := newMockEventPublisher()
+	collector.SetEventPublisher(publisher)
+
+	now := time.Now()
+	versions := []struct {
+		namespace string
+		data      string
+		at        time.Time
+	}{
+		{"os.basic", `{"kernel":"6.1.0","distro":"ubuntu"}`, now.Add(-10 * 24 * time.Hour)},
+		// Same value, formatted differently: not a new version
+		{"os.basic", `{"distro": "ubuntu", "kernel": "6.1.0"}`, now.Add(-9 * 24 * time.Hour)},
+		{"pkg.manifest", `{"packages":[{"name":"curl","version":"8.5"},{"name":"openssl","version":"3.0.2"}]}`, now.Add(-10 * 24 * time.Hour)},
+		{"os.basic", `{"kernel":"6.5.0","distro":"ubuntu"}`, now.Add(-3 * 24 * time.Hour)},
+		{"pkg.manifest", `{"packages":[{"name":"bash","version":"5.2"},{"name":"curl","version":"8.5"},{"name":"openssl","version":"3.0.13"}]}`, now.Add(-2 * 24 * time.Hour)},
+		{"os.basic", `{"kernel":"6.8.0","distro":"ubuntu"}`, now},
+	}
+	for _, version := range versions {
+		if err := collector.recordFactVersion(ctx, "web3", version.namespace, json.RawMessage(version.data), version.at); err != nil {
+			t.Fatalf("Failed to record fact version: %v", err)
+		}
+	}
+
+	history, err := collector.FactHistory(ctx, "web3", "os.basic", 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("Expected 3 versions of os.basic, got %d", len(history))
+	}
+	latest := history[0].Changes
+	if len(latest) != 1 || latest[0].Path != ".kernel" || latest[0].Before != "6.5.0" || latest[0].After != "6.8.0" {
+		t.Errorf("Expected the kernel to change from 6.5.0 to 6.8.0, got %+v", latest)
+	}
+	if history[2].Changes != nil {
+		t.Errorf("Expected no changes for the first version, got %+v", history[2].Changes)
+	}
+
+	// Every change after the first version of a fact is published
+	events := publisher.getEvents()
+	if len(events) != 3 || events[0].Type != EventTypeFactChanged || events[0].ResourceID != "web3" {
+		t.Errorf("Expected 3 fact change events, got %+v", events)
+	}
+
+	// Over the last week, packages are matched by name rather than position
+	diff, err := collector.DiffFactsSince(ctx, "web3", now.Add(-7*24*time.Hour), nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(diff) != 2 || diff[0].Namespace != "os.basic" || diff[1].Namespace != "pkg.manifest" {
+		t.Fatalf("Expected os.basic and pkg.manifest to change, got %+v", diff)
+	}
+	if changes := diff[0].Changes; len(changes) != 1 || changes[0].Before != "6.1.0" || changes[0].After != "6.8.0" {
+		t.Errorf("Expected the kernel to change from 6.1.0 to 6.8.0, got %+v", changes)
+	}
+
+	expected := []Change{
+		{Path: ".packages[name=bash]", After: map[string]any{"name": "bash", "version": "5.2"}, Action: ChangeActionAdd},
+		{Path: ".packages[name=openssl].version", Before: "3.0.2", After: "3.0.13", Action: ChangeActionModify},
+	}
+	if got := diff[1].Changes; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected package changes %+v, got %+v", expected, got)
+	}
+
+	// Nothing changed in the last day
+	diff, err = collector.DiffFactsSince(ctx, "web3", now.Add(-24*time.Hour), []string{"pkg.manifest"})
+	if err != nil || len(diff) != 0 {
+		t.Errorf("Expected no changes, got %+v, %v", diff, err)
+	}
+
+	// Untracked facts are recorded without publishing their changes
+	collector.SetTrackedFacts([]string{"os.basic"})
+	if err := collector.recordFactVersion(ctx, "web3", "pkg.manifest",
+		json.RawMessage(`{"packages":[{"name":"bash","version":"5.2"}]}`), now); err != nil {
+		t.Fatalf("Failed to record fact version: %v", err)
+	}
+	if events := publisher.getEvents(); len(events) != 3 {
+		t.Errorf("Expected no event for an untracked fact, got %d events", len(events))
+	}
+}
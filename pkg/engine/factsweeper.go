@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/openfroyo/openfroyo/pkg/stores"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultFactsSweepInterval is how often expired facts are deleted by default.
+const DefaultFactsSweepInterval = 15 * time.Minute
+
+// FactsSweeper periodically deletes expired facts from the store, so the
+// cache only holds facts that can still be used. Host metadata and labels
+// never expire and are kept. It also prunes fact versions older than the
+// history retention.
+type FactsSweeper struct {
+	store    stores.Store
+	interval time.Duration
+
+	// mu protects historyRetention, which may be changed while the sweep
+	// loop runs
+	mu               sync.Mutex
+	historyRetention time.Duration
+
+	// stop ends the sweep loop and done is closed once it has exited
+	stop chan struct{}
+	done chan struct{}
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// NewFactsSweeper creates a new facts sweeper. A non-positive interval
+// defaults to DefaultFactsSweepInterval.
+func NewFactsSweeper(store stores.Store, interval time.Duration) *FactsSweeper {
+	if interval <= 0 {
+		interval = DefaultFactsSweepInterval
+	}
+
+	return &FactsSweeper{
+		store:            store,
+		interval:         interval,
+		historyRetention: DefaultFactHistoryRetention,
+		stop:             make(chan struct{}),
+		done:             make(chan struct{}),
+	}
+}
+
+// SetHistoryRetention sets how long fact versions are kept. A non-positive
+// retention defaults to DefaultFactHistoryRetention.
+func (s *FactsSweeper) SetHistoryRetention(retention time.Duration) {
+	if retention <= 0 {
+		retention = DefaultFactHistoryRetention
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.historyRetention = retention
+}
+
+// Sweep deletes the expired facts once and returns how many were deleted.
+func (s *FactsSweeper) Sweep(ctx context.Context) (int64, error) {
+	deleted, err := s.store.DeleteExpiredFacts(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired facts: %w", err)
+	}
+	return deleted, nil
+}
+
+// PruneHistory deletes the fact versions older than the history retention
+// once and returns how many were deleted. The latest version of each fact is
+// kept.
+func (s *FactsSweeper) PruneHistory(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	retention := s.historyRetention
+	s.mu.Unlock()
+
+	deleted, err := s.store.DeleteFactSnapshotsBefore(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune fact history: %w", err)
+	}
+	return deleted, nil
+}
+
+// Start sweeps at every interval in the background until Stop is called or
+// the context is done.
+func (s *FactsSweeper) Start(ctx context.Context) {
+	s.startOnce.Do(func() {
+		go s.run(ctx)
+	})
+}
+
+// Stop ends the background sweeps and waits for the current one to finish.
+// A sweeper stopped before it was started never starts.
+func (s *FactsSweeper) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	// Only wait when the loop was started
+	started := true
+	s.startOnce.Do(func() { started = false })
+	if started {
+		<-s.done
+	}
+}
+
+// run is the sweep loop.
+func (s *FactsSweeper) run(ctx context.Context) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := s.Sweep(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to sweep expired facts")
+			} else if deleted > 0 {
+				log.Debug().Int64("deleted", deleted).Msg("Swept expired facts")
+			}
+
+			pruned, err := s.PruneHistory(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to prune fact history")
+			} else if pruned > 0 {
+				log.Debug().Int64("deleted", pruned).Msg("Pruned fact history")
+			}
+		}
+	}
+}
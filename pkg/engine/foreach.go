@@ -0,0 +1,239 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ForEach expands one resource declaration into an instance per entry of a
+// collection. Instances are keyed by stable keys rather than positions, so
+// reordering the collection does not churn state.
+//
+// Exactly one of Items and Fact is set. Map entries are keyed by their map
+// key. List entries are keyed by their value when they are scalars, or by
+// their Key field when they are objects.
+type ForEach struct {
+	// Items is a list or map of entries.
+	Items interface{} `json:"items,omitempty"`
+
+	// Fact is a dotted path into the facts of the target host whose value is
+	// the collection, e.g. "hw.disk.devices".
+	Fact string `json:"fact,omitempty"`
+
+	// Key is the field of object entries used as the instance key.
+	Key string `json:"key,omitempty"`
+}
+
+// Validate checks that the for_each declaration is consistent.
+func (f *ForEach) Validate() error {
+	if (f.Items == nil) == (f.Fact == "") {
+		return NewPermanentError("for_each requires exactly one of items and fact", nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	if f.Items != nil {
+		if _, err := f.entries(f.Items); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// forEachEntry is one entry of a for_each collection.
+type forEachEntry struct {
+	key   string
+	value interface{}
+}
+
+// entries returns the keyed entries of a collection, sorted by key.
+func (f *ForEach) entries(collection interface{}) ([]forEachEntry, error) {
+	var entries []forEachEntry
+
+	switch items := collection.(type) {
+	case map[string]interface{}:
+		for key, value := range items {
+			entries = append(entries, forEachEntry{key: key, value: value})
+		}
+	case []interface{}:
+		for i, value := range items {
+			key, err := f.entryKey(value)
+			if err != nil {
+				return nil, fmt.Errorf("for_each entry %d: %w", i, err)
+			}
+			entries = append(entries, forEachEntry{key: key, value: value})
+		}
+	default:
+		return nil, NewPermanentError(fmt.Sprintf("for_each requires a list or map, got %T", collection), nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+
+	for i := 1; i < len(entries); i++ {
+		if entries[i].key == entries[i-1].key {
+			return nil, NewPermanentError(fmt.Sprintf("duplicate for_each key: %s", entries[i].key), nil).
+				WithCode(ErrCodeValidation)
+		}
+	}
+
+	return entries, nil
+}
+
+// entryKey returns the instance key of a list entry.
+func (f *ForEach) entryKey(value interface{}) (string, error) {
+	if object, ok := value.(map[string]interface{}); ok {
+		if f.Key == "" {
+			return "", NewPermanentError("object entries require a for_each key field", nil).
+				WithCode(ErrCodeValidation)
+		}
+		value, ok = object[f.Key]
+		if !ok {
+			return "", NewPermanentError(fmt.Sprintf("entry has no key field %q", f.Key), nil).
+				WithCode(ErrCodeValidation)
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return "", NewPermanentError("for_each key is empty", nil).
+				WithCode(ErrCodeValidation)
+		}
+		return v, nil
+	case bool, float64, int, int64:
+		return fmt.Sprint(v), nil
+	default:
+		return "", NewPermanentError(fmt.Sprintf("for_each key must be a scalar, got %T", value), nil).
+			WithCode(ErrCodeValidation)
+	}
+}
+
+// InstanceID returns the ID of the for_each instance of a resource with the given key.
+func InstanceID(resourceID, key string) string {
+	return resourceID + "[" + key + "]"
+}
+
+// ParseResourceAddress splits a resource address such as "users[alice]"
+// into the resource ID and the for_each instance key. The key is empty for
+// addresses of whole resources.
+func ParseResourceAddress(address string) (string, string, error) {
+	open := strings.IndexByte(address, '[')
+	if open < 0 {
+		if address == "" || strings.ContainsRune(address, ']') {
+			return "", "", NewPermanentError(fmt.Sprintf("invalid resource address: %q", address), nil).
+				WithCode(ErrCodeValidation)
+		}
+		return address, "", nil
+	}
+
+	if open == 0 || !strings.HasSuffix(address, "]") || len(address)-open < 3 {
+		return "", "", NewPermanentError(fmt.Sprintf("invalid resource address: %q", address), nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	return address[:open], address[open+1 : len(address)-1], nil
+}
+
+// ExpandForEach expands a resource with a for_each declaration into its
+// instances, sorted by key. Fact collections are read from the given facts
+// of the resource's host, keyed by namespace.
+//
+// Each instance gets the ID "<id>[<key>]" and a config in which the string
+// placeholders ${each.key}, ${each.value} and ${each.value.<field>} are
+// replaced. A string consisting of just one placeholder takes the value's
+// own type.
+func ExpandForEach(resource *Resource, facts map[string]interface{}) ([]Resource, error) {
+	if resource.ForEach == nil {
+		return []Resource{*resource}, nil
+	}
+
+	if err := resource.ForEach.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid for_each of resource %s: %w", resource.ID, err)
+	}
+
+	collection := resource.ForEach.Items
+	if resource.ForEach.Fact != "" {
+		value, ok := lookupFact(facts, resource.ForEach.Fact)
+		if !ok {
+			return nil, NewPermanentError(
+				fmt.Sprintf("fact %s of resource %s not found on host %s",
+					resource.ForEach.Fact, resource.ID, resource.TargetID), nil).
+				WithCode(ErrCodeNotFound)
+		}
+		collection = value
+	}
+
+	entries, err := resource.ForEach.entries(collection)
+	if err != nil {
+		return nil, fmt.Errorf("invalid for_each of resource %s: %w", resource.ID, err)
+	}
+
+	var config interface{}
+	if len(resource.Config) > 0 {
+		if err := json.Unmarshal(resource.Config, &config); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal config of resource %s: %w", resource.ID, err)
+		}
+	}
+
+	instances := make([]Resource, 0, len(entries))
+	for _, entry := range entries {
+		rendered, err := renderPlaceholders(config, entry.resolve)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render instance %s: %w", InstanceID(resource.ID, entry.key), err)
+		}
+
+		instanceConfig, err := json.Marshal(rendered)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal config of instance %s: %w",
+				InstanceID(resource.ID, entry.key), err)
+		}
+
+		instance := *resource
+		instance.ID = InstanceID(resource.ID, entry.key)
+		instance.Config = instanceConfig
+		instance.ForEach = nil
+		instances = append(instances, instance)
+	}
+
+	return instances, nil
+}
+
+// lookupField follows a field path through nested objects.
+func lookupField(value interface{}, path []string) (interface{}, bool) {
+	for _, field := range path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[field]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// resolve resolves an each reference such as "each.value.name". References
+// outside each are left for other placeholders.
+func (e forEachEntry) resolve(ref string) (interface{}, bool, error) {
+	switch {
+	case ref == "each.key":
+		return e.key, true, nil
+	case ref == "each.value":
+		return e.value, true, nil
+	case strings.HasPrefix(ref, "each.value."):
+		value, ok := lookupField(e.value, strings.Split(strings.TrimPrefix(ref, "each.value."), "."))
+		if !ok {
+			return nil, true, fmt.Errorf("%s not found in for_each entry %s", ref, e.key)
+		}
+		return value, true, nil
+	case ref == "each" || strings.HasPrefix(ref, "each."):
+		return nil, true, fmt.Errorf("unknown reference: %s", ref)
+	default:
+		return nil, false, nil
+	}
+}
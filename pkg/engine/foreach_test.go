@@ -0,0 +1,320 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/openfroyo/openfroyo/pkg/stores"
+)
+
+func TestExpandForEach(t *testing.T) {
+	tests := []struct {
+		name    string
+		forEach *ForEach
+		facts   map[string]interface{}
+		config  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "scalar list",
+			forEach: &ForEach{Items: []interface{}{"bob", "alice"}},
+			config:  `{"name": "${each.key}", "home": "/home/${each.value}"}`,
+			want: map[string]string{
+				"users[alice]": `{"home":"/home/alice","name":"alice"}`,
+				"users[bob]":   `{"home":"/home/bob","name":"bob"}`,
+			},
+		},
+		{
+			name: "object list with key",
+			forEach: &ForEach{Key: "name", Items: []interface{}{
+				map[string]interface{}{"name": "alice", "uid": float64(1001)},
+			}},
+			config: `{"name": "${each.key}", "uid": "${each.value.uid}"}`,
+			want: map[string]string{
+				"users[alice]": `{"name":"alice","uid":1001}`,
+			},
+		},
+		{
+			name: "map",
+			forEach: &ForEach{Items: map[string]interface{}{
+				"alice": map[string]interface{}{"shell": "/bin/zsh"},
+			}},
+			config: `{"name": "${each.key}", "shell": "${each.value.shell}"}`,
+			want: map[string]string{
+				"users[alice]": `{"name":"alice","shell":"/bin/zsh"}`,
+			},
+		},
+		{
+			name:    "fact",
+			forEach: &ForEach{Fact: "hw.disk.devices", Key: "name"},
+			facts: map[string]interface{}{
+				"hw.disk": map[string]interface{}{
+					"devices": []interface{}{
+						map[string]interface{}{"name": "sdb"},
+						map[string]interface{}{"name": "sda"},
+					},
+				},
+			},
+			config: `{"device": "/dev/${each.key}"}`,
+			want: map[string]string{
+				"users[sda]": `{"device":"/dev/sda"}`,
+				"users[sdb]": `{"device":"/dev/sdb"}`,
+			},
+		},
+		{
+			name:    "missing fact",
+			forEach: &ForEach{Fact: "hw.disk.devices"},
+			facts:   map[string]interface{}{},
+			config:  `{}`,
+			wantErr: true,
+		},
+		{
+			name:    "duplicate keys",
+			forEach: &ForEach{Items: []interface{}{"alice", "alice"}},
+			config:  `{}`,
+			wantErr: true,
+		},
+		{
+			name:    "object list without key",
+			forEach: &ForEach{Items: []interface{}{map[string]interface{}{"name": "alice"}}},
+			config:  `{}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown each reference",
+			forEach: &ForEach{Items: []interface{}{"alice"}},
+			config:  `{"name": "${each.index}"}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := &Resource{
+				ID:       "users",
+				Type:     "linux.user",
+				Config:   json.RawMessage(tt.config),
+				ForEach:  tt.forEach,
+				TargetID: "web1",
+			}
+
+			instances, err := ExpandForEach(resource, tt.facts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExpandForEach() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if len(instances) != len(tt.want) {
+				t.Fatalf("Expected %d instances, got %d", len(tt.want), len(instances))
+			}
+
+			for _, instance := range instances {
+				want, ok := tt.want[instance.ID]
+				if !ok {
+					t.Errorf("Unexpected instance %s", instance.ID)
+					continue
+				}
+				if string(instance.Config) != want {
+					t.Errorf("Instance %s config = %s, want %s", instance.ID, instance.Config, want)
+				}
+				if instance.ForEach != nil || instance.TargetID != "web1" {
+					t.Errorf("Instance %s not derived from its resource: %+v", instance.ID, instance)
+				}
+			}
+		})
+	}
+}
+
+func TestExpandForEach_StableAcrossReordering(t *testing.T) {
+	expand := func(items ...interface{}) []string {
+		instances, err := ExpandForEach(&Resource{
+			ID:      "users",
+			Config:  json.RawMessage(`{"name": "${each.key}"}`),
+			ForEach: &ForEach{Items: items},
+		}, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		ids := make([]string, len(instances))
+		for i, instance := range instances {
+			ids[i] = instance.ID
+		}
+		return ids
+	}
+
+	before := expand("carol", "alice", "bob")
+	after := expand("bob", "carol", "alice")
+
+	for i := range before {
+		if before[i] != after[i] {
+			t.Errorf("Instance IDs changed with order: %v vs %v", before, after)
+			break
+		}
+	}
+}
+
+func TestParseResourceAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		id      string
+		key     string
+		wantErr bool
+	}{
+		{"users", "users", "", false},
+		{"users[alice]", "users", "alice", false},
+		{"mounts[/dev/sdb]", "mounts", "/dev/sdb", false},
+		{"users[]", "", "", true},
+		{"[alice]", "", "", true},
+		{"users[alice", "", "", true},
+		{"", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			id, key, err := ParseResourceAddress(tt.address)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseResourceAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if id != tt.id || key != tt.key {
+				t.Errorf("ParseResourceAddress() = (%q, %q), want (%q, %q)", id, key, tt.id, tt.key)
+			}
+		})
+	}
+}
+
+func TestPlanner_ComputeDiff_ForEach(t *testing.T) {
+	registry := &mockProviderRegistry{providers: make(map[string]Provider)}
+	stateMgr := newMockStateManager()
+	planner := NewPlanner(registry, stateMgr)
+
+	ctx := context.Background()
+
+	// The existing instance keeps its state; only the new one is created
+	stateMgr.resources["users[alice]"] = &Resource{ID: "users[alice]"}
+	stateMgr.states["users[alice]"] = json.RawMessage(`{"name":"alice"}`)
+
+	config := &Config{
+		ID: "test-config",
+		Resources: []Resource{
+			{
+				ID:      "users",
+				Type:    "linux.user",
+				Config:  json.RawMessage(`{"name": "${each.key}"}`),
+				ForEach: &ForEach{Items: []interface{}{"bob", "alice"}},
+			},
+		},
+	}
+
+	diff, err := planner.ComputeDiff(ctx, config, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if diff.Summary.TotalResources != 2 || diff.Summary.ToCreate != 1 || diff.Summary.NoChange != 1 {
+		t.Errorf("Unexpected summary: %+v", diff.Summary)
+	}
+
+	// Iterating over facts needs a facts source
+	config.Resources[0].ForEach = &ForEach{Fact: "hw.disk.devices"}
+	config.Resources[0].TargetID = "web1"
+	if _, err := planner.ComputeDiff(ctx, config, nil); err == nil {
+		t.Error("Expected error without host facts, got nil")
+	}
+}
+
+func TestPlanner_BuildPlan_DependsOnForEachInstances(t *testing.T) {
+	registry := &mockProviderRegistry{providers: make(map[string]Provider)}
+	stateMgr := newMockStateManager()
+	planner := NewPlanner(registry, stateMgr)
+
+	diff := &DiffResult{
+		Resources: []ResourceDiff{
+			{ResourceID: "users[alice]", Operation: OperationCreate},
+			{ResourceID: "users[bob]", Operation: OperationCreate},
+			{ResourceID: "sudoers", Operation: OperationCreate, Dependencies: []string{"users"}},
+		},
+		Timestamp: time.Now(),
+	}
+
+	plan, err := planner.BuildPlan(context.Background(), diff)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	sudoers := plan.Units[2]
+	if len(sudoers.Dependencies) != 2 {
+		t.Errorf("Expected sudoers to depend on both user instances, got %+v", sudoers.Dependencies)
+	}
+}
+
+func TestMoveResourceState(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLiteStore(t)
+
+	now := time.Now()
+	if err := store.CreateRun(ctx, &stores.Run{
+		ID:        "run1",
+		PlanPath:  "plan.json",
+		Status:    stores.RunStatusCompleted,
+		StartedAt: now,
+		Metadata:  `{}`,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("Failed to create run: %v", err)
+	}
+
+	for _, name := range []string{"users[0]", "users[bob]", "admins[root]"} {
+		if err := store.UpsertResourceState(ctx, &stores.ResourceState{
+			ID:           name,
+			ResourceType: "linux.user",
+			ResourceName: name,
+			State:        `{}`,
+			Hash:         "hash",
+			LastRunID:    "run1",
+			LastApplied:  now,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}); err != nil {
+			t.Fatalf("Failed to upsert state: %v", err)
+		}
+	}
+
+	// Re-key a single instance
+	moves, err := MoveResourceState(ctx, store, "linux.user", "users[0]", "users[alice]")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(moves) != 1 || moves[0].To != "users[alice]" {
+		t.Errorf("Unexpected moves: %+v", moves)
+	}
+
+	// Rename the whole resource, keeping instance keys
+	moves, err = MoveResourceState(ctx, store, "linux.user", "users", "accounts")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(moves) != 2 {
+		t.Fatalf("Expected 2 moves, got %+v", moves)
+	}
+	for _, name := range []string{"accounts[alice]", "accounts[bob]"} {
+		if _, err := store.GetResourceState(ctx, "linux.user", name); err != nil {
+			t.Errorf("Expected state at %s: %v", name, err)
+		}
+	}
+
+	// Nothing is moved onto existing state
+	if _, err := MoveResourceState(ctx, store, "linux.user", "admins[root]", "accounts[bob]"); err == nil {
+		t.Error("Expected error when moving onto existing state, got nil")
+	}
+
+	if _, err := MoveResourceState(ctx, store, "linux.user", "users", "people"); err == nil {
+		t.Error("Expected error when moving missing state, got nil")
+	}
+}
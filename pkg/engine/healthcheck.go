@@ -0,0 +1,478 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openfroyo/openfroyo/pkg/micro_runner/protocol"
+)
+
+// HealthCheckType represents the kind of health check to run against a host.
+type HealthCheckType string
+
+const (
+	// HealthCheckCommand runs a command on the host and checks its exit code.
+	HealthCheckCommand HealthCheckType = "command"
+
+	// HealthCheckHTTP probes an HTTP endpoint from the host.
+	HealthCheckHTTP HealthCheckType = "http"
+
+	// HealthCheckFact asserts the value of a cached fact.
+	HealthCheckFact HealthCheckType = "fact"
+
+	// HealthCheckPort checks that a TCP port accepts connections from the host.
+	HealthCheckPort HealthCheckType = "port"
+
+	// HealthCheckFile matches the content of a file on the host.
+	HealthCheckFile HealthCheckType = "file"
+)
+
+// defaultHealthCheckTimeout is used when a health check has no timeout.
+const defaultHealthCheckTimeout = 30 * time.Second
+
+// maxFileCheckBytes limits how much of a file is read by file checks.
+const maxFileCheckBytes = 1 << 20
+
+// HealthCheck describes a check that must pass for a host to be considered healthy.
+type HealthCheck struct {
+	// Name identifies the check in events and results.
+	Name string `json:"name"`
+
+	// Type is the kind of check.
+	Type HealthCheckType `json:"type"`
+
+	// Command is the shell command run by command checks.
+	Command string `json:"command,omitempty"`
+
+	// ExpectExitCode is the exit code a command check must return.
+	ExpectExitCode int `json:"expect_exit_code,omitempty"`
+
+	// URL is the endpoint probed by HTTP checks, as seen from the host.
+	URL string `json:"url,omitempty"`
+
+	// ExpectStatus is the status code an HTTP check must return. Zero accepts any 2xx.
+	ExpectStatus int `json:"expect_status,omitempty"`
+
+	// ExpectBody is a substring the HTTP response body must contain.
+	ExpectBody string `json:"expect_body,omitempty"`
+
+	// Fact is the dotted fact path asserted by fact checks, e.g. "os.basic.distro".
+	Fact string `json:"fact,omitempty"`
+
+	// Equals is the expected fact value. When empty the fact only has to exist.
+	Equals string `json:"equals,omitempty"`
+
+	// Port is the TCP port probed by port checks.
+	Port int `json:"port,omitempty"`
+
+	// Address is the address port checks connect to, as seen from the host.
+	// Defaults to 127.0.0.1.
+	Address string `json:"address,omitempty"`
+
+	// Path is the file read by file checks.
+	Path string `json:"path,omitempty"`
+
+	// Pattern is a regular expression the file content must match. When
+	// empty the file only has to exist.
+	Pattern string `json:"pattern,omitempty"`
+
+	// Timeout is the maximum duration of the check.
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// Validate checks that the health check has the fields its type requires.
+func (c *HealthCheck) Validate() error {
+	var missing string
+	switch c.Type {
+	case HealthCheckCommand:
+		if c.Command == "" {
+			missing = "command"
+		}
+	case HealthCheckHTTP:
+		if c.URL == "" {
+			missing = "url"
+		}
+	case HealthCheckFact:
+		if c.Fact == "" {
+			missing = "fact"
+		}
+	case HealthCheckPort:
+		if c.Port <= 0 || c.Port > 65535 {
+			return NewPermanentError(fmt.Sprintf("port health check %q has invalid port %d", c.Name, c.Port), nil).
+				WithCode(ErrCodeValidation)
+		}
+	case HealthCheckFile:
+		if c.Path == "" {
+			missing = "path"
+		}
+		if _, err := regexp.Compile(c.Pattern); err != nil {
+			return NewPermanentError(fmt.Sprintf("file health check %q has invalid pattern", c.Name), err).
+				WithCode(ErrCodeValidation)
+		}
+	default:
+		return NewPermanentError(fmt.Sprintf("health check %q has invalid type %q", c.Name, c.Type), nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	if missing != "" {
+		return NewPermanentError(fmt.Sprintf("%s health check %q requires %s", c.Type, c.Name, missing), nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	return nil
+}
+
+// timeout returns the check timeout or the default.
+func (c *HealthCheck) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return defaultHealthCheckTimeout
+}
+
+// HealthCheckResult is the outcome of a health check on one host.
+type HealthCheckResult struct {
+	// Name is the name of the check.
+	Name string `json:"name"`
+
+	// HostID is the host the check ran against.
+	HostID string `json:"host_id"`
+
+	// Passed indicates whether the check passed.
+	Passed bool `json:"passed"`
+
+	// Message explains why the check failed.
+	Message string `json:"message,omitempty"`
+
+	// Duration is how long the check took.
+	Duration time.Duration `json:"duration"`
+}
+
+// HealthChecker runs health checks against hosts.
+type HealthChecker interface {
+	// RunCheck runs a check against a host. An error means the check could
+	// not be run at all; a failing check is reported in the result.
+	RunCheck(ctx context.Context, hostID string, check HealthCheck) (*HealthCheckResult, error)
+
+	// RunChecks runs checks against a host in order, sharing one connection
+	// to the host between them. Checks that cannot be run are returned as
+	// failed results whose message is the error.
+	RunChecks(ctx context.Context, hostID string, checks []HealthCheck) []*HealthCheckResult
+
+	// NewSession returns a session that runs checks against a host over one
+	// connection, so a check can be polled without reconnecting each time.
+	// The session must be closed.
+	NewSession(hostID string) HealthCheckSession
+}
+
+// HealthCheckSession runs checks against one host, reusing its connection
+// between checks.
+type HealthCheckSession interface {
+	// RunCheck runs a check against the session's host, as
+	// HealthChecker.RunCheck does.
+	RunCheck(ctx context.Context, check HealthCheck) (*HealthCheckResult, error)
+
+	// Close closes the connection to the host, if one was opened.
+	Close(ctx context.Context)
+}
+
+// RunnerHealthChecker runs command, HTTP, port and file checks through the
+// micro-runner and evaluates fact checks against cached facts.
+type RunnerHealthChecker struct {
+	hostRegistry     *HostRegistry
+	facts            *FactsCollector
+	runnerBinaryPath string
+}
+
+// NewRunnerHealthChecker creates a health checker backed by the micro-runner.
+func NewRunnerHealthChecker(hostRegistry *HostRegistry, facts *FactsCollector, runnerBinaryPath string) *RunnerHealthChecker {
+	return &RunnerHealthChecker{
+		hostRegistry:     hostRegistry,
+		facts:            facts,
+		runnerBinaryPath: runnerBinaryPath,
+	}
+}
+
+// RunCheck runs a health check against a host.
+func (c *RunnerHealthChecker) RunCheck(ctx context.Context, hostID string, check HealthCheck) (*HealthCheckResult, error) {
+	session := c.NewSession(hostID)
+	defer session.Close(ctx)
+
+	return session.RunCheck(ctx, check)
+}
+
+// NewSession returns a session that runs checks against a host through one
+// micro-runner session, started on the first check that needs it.
+func (c *RunnerHealthChecker) NewSession(hostID string) HealthCheckSession {
+	return &runnerCheckSession{checker: c, hostID: hostID}
+}
+
+// runnerCheckSession runs checks against a host through a micro-runner
+// session. A session that fails to run a check is closed and started again
+// on the next check, so polling survives the host dropping the connection.
+type runnerCheckSession struct {
+	checker *RunnerHealthChecker
+	hostID  string
+	session *RunnerSession
+}
+
+// RunCheck runs a health check against the session's host.
+func (s *runnerCheckSession) RunCheck(ctx context.Context, check HealthCheck) (*HealthCheckResult, error) {
+	if err := check.Validate(); err != nil {
+		return nil, err
+	}
+
+	if check.Type != HealthCheckFact && s.session == nil {
+		session, err := s.checker.openSession(ctx, s.hostID)
+		if err != nil {
+			return nil, err
+		}
+		s.session = session
+	}
+
+	result, err := s.checker.runCheck(ctx, s.session, s.hostID, &check)
+	if err != nil && check.Type != HealthCheckFact {
+		s.Close(ctx)
+	}
+	return result, err
+}
+
+// Close stops the micro-runner session, if one was started.
+func (s *runnerCheckSession) Close(ctx context.Context) {
+	if s.session != nil {
+		s.session.Close(ctx)
+		s.session = nil
+	}
+}
+
+// RunChecks runs health checks against a host in order, sharing one
+// micro-runner session between them.
+func (c *RunnerHealthChecker) RunChecks(ctx context.Context, hostID string, checks []HealthCheck) []*HealthCheckResult {
+	var (
+		session    *RunnerSession
+		sessionErr error
+	)
+	defer func() {
+		if session != nil {
+			session.Close(ctx)
+		}
+	}()
+
+	results := make([]*HealthCheckResult, len(checks))
+	for i := range checks {
+		check := &checks[i]
+
+		err := check.Validate()
+		if err == nil && check.Type != HealthCheckFact {
+			// Open the session on the first check that needs it
+			if session == nil && sessionErr == nil {
+				session, sessionErr = c.openSession(ctx, hostID)
+			}
+			err = sessionErr
+		}
+
+		var result *HealthCheckResult
+		if err == nil {
+			result, err = c.runCheck(ctx, session, hostID, check)
+		}
+		if err != nil {
+			result = &HealthCheckResult{Name: check.Name, HostID: hostID, Message: err.Error()}
+		}
+		results[i] = result
+	}
+
+	return results
+}
+
+// openSession opens a micro-runner session on a host.
+func (c *RunnerHealthChecker) openSession(ctx context.Context, hostID string) (*RunnerSession, error) {
+	host, err := c.hostRegistry.GetHost(ctx, hostID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get host: %w", err)
+	}
+
+	return OpenRunnerSession(ctx, host, c.runnerBinaryPath)
+}
+
+// runCheck runs a validated check, through the session unless it is a fact check.
+func (c *RunnerHealthChecker) runCheck(
+	ctx context.Context,
+	session *RunnerSession,
+	hostID string,
+	check *HealthCheck,
+) (*HealthCheckResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, check.timeout())
+	defer cancel()
+
+	start := time.Now()
+	result := &HealthCheckResult{Name: check.Name, HostID: hostID}
+
+	var err error
+	if check.Type == HealthCheckFact {
+		err = c.checkFact(ctx, hostID, check, result)
+	} else {
+		err = c.checkWithRunner(ctx, session, check, result)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result.Duration = time.Since(start)
+	return result, nil
+}
+
+// checkWithRunner runs a command, HTTP, port or file check through a micro-runner session.
+func (c *RunnerHealthChecker) checkWithRunner(ctx context.Context, session *RunnerSession, check *HealthCheck, result *HealthCheckResult) error {
+	var err error
+	switch check.Type {
+	case HealthCheckCommand:
+		var execResult protocol.ExecResult
+		err = session.Execute(ctx, protocol.CommandTypeExec, &protocol.ExecParams{
+			Command:    check.Command,
+			CaptureOut: true,
+			CaptureErr: true,
+		}, check.timeout(), &execResult)
+		if err != nil {
+			return err
+		}
+
+		result.Passed = execResult.ExitCode == check.ExpectExitCode
+		if !result.Passed {
+			result.Message = fmt.Sprintf("expected exit code %d, got %d: %s",
+				check.ExpectExitCode, execResult.ExitCode, strings.TrimSpace(execResult.Stderr))
+		}
+
+	case HealthCheckHTTP:
+		var probeResult protocol.HTTPProbeResult
+		err = session.Execute(ctx, protocol.CommandTypeHTTPProbe, &protocol.HTTPProbeParams{
+			URL:          check.URL,
+			ExpectStatus: check.ExpectStatus,
+			ExpectBody:   check.ExpectBody,
+		}, check.timeout(), &probeResult)
+		if err != nil {
+			return err
+		}
+
+		result.Passed = probeResult.Healthy
+		result.Message = probeResult.Message
+
+	case HealthCheckPort:
+		var probeResult protocol.PortProbeResult
+		err = session.Execute(ctx, protocol.CommandTypePortProbe, &protocol.PortProbeParams{
+			Host: check.Address,
+			Port: check.Port,
+		}, check.timeout(), &probeResult)
+		if err != nil {
+			return err
+		}
+
+		result.Passed = probeResult.Open
+		if !result.Passed {
+			result.Message = fmt.Sprintf("port %d is not open: %s", check.Port, probeResult.Message)
+		}
+
+	case HealthCheckFile:
+		var readResult protocol.FileReadResult
+		err = session.Execute(ctx, protocol.CommandTypeFileRead, &protocol.FileReadParams{
+			Path:     check.Path,
+			MaxBytes: maxFileCheckBytes,
+		}, check.timeout(), &readResult)
+		if err != nil {
+			// A missing file fails the check rather than erroring
+			result.Message = fmt.Sprintf("failed to read %s: %v", check.Path, err)
+			return nil
+		}
+
+		result.Passed = matchFileContent(check.Pattern, readResult.Content)
+		if !result.Passed {
+			result.Message = fmt.Sprintf("content of %s does not match %q", check.Path, check.Pattern)
+		}
+	}
+
+	return nil
+}
+
+// matchFileContent reports whether file content matches a pattern. An empty
+// pattern matches any content. Patterns are validated beforehand.
+func matchFileContent(pattern, content string) bool {
+	if pattern == "" {
+		return true
+	}
+	return regexp.MustCompile(pattern).MatchString(content)
+}
+
+// checkFact asserts a cached fact value.
+func (c *RunnerHealthChecker) checkFact(ctx context.Context, hostID string, check *HealthCheck, result *HealthCheckResult) error {
+	facts, err := c.facts.GetFacts(ctx, hostID, nil)
+	if err != nil {
+		return err
+	}
+
+	value, ok := lookupFact(facts, check.Fact)
+	switch {
+	case !ok:
+		result.Message = fmt.Sprintf("fact %s not found", check.Fact)
+	case check.Equals != "" && formatFactValue(value) != check.Equals:
+		result.Message = fmt.Sprintf("fact %s is %q, expected %q", check.Fact, formatFactValue(value), check.Equals)
+	default:
+		result.Passed = true
+	}
+
+	return nil
+}
+
+// lookupFact resolves a dotted path against facts keyed by namespace.
+// Namespaces contain dots themselves, so the longest namespace prefixing the
+// path is used and the remainder is walked through the decoded fact value.
+// Numeric segments index into lists.
+func lookupFact(facts map[string]any, path string) (any, bool) {
+	namespace := ""
+	for ns := range facts {
+		if (path == ns || strings.HasPrefix(path, ns+".")) && len(ns) > len(namespace) {
+			namespace = ns
+		}
+	}
+	if namespace == "" {
+		return nil, false
+	}
+
+	value := facts[namespace]
+	rest := strings.TrimPrefix(strings.TrimPrefix(path, namespace), ".")
+	if rest == "" {
+		return value, true
+	}
+
+	for _, segment := range strings.Split(rest, ".") {
+		switch node := value.(type) {
+		case map[string]any:
+			child, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			value = child
+		case []any:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			value = node[index]
+		default:
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// formatFactValue renders a decoded fact value for comparison.
+// Whole numbers are rendered without a fractional part.
+func formatFactValue(value any) string {
+	if number, ok := value.(float64); ok {
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
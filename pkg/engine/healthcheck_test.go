@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLookupFact(t *testing.T) {
+	var facts map[string]any
+	err := json.Unmarshal([]byte(`{
+		"os.basic": {"distro": "ubuntu", "version": "22.04"},
+		"os": {"basic": {"distro": "shadowed"}},
+		"hw.cpu": {"cores": 8},
+		"hw.disk": {"disks": [{"name": "sda"}]}
+	}`), &facts)
+	if err != nil {
+		t.Fatalf("Failed to decode facts: %v", err)
+	}
+
+	tests := []struct {
+		path  string
+		want  string
+		found bool
+	}{
+		{"os.basic.distro", "ubuntu", true},
+		{"hw.cpu.cores", "8", true},
+		{"hw.disk.disks.0.name", "sda", true},
+		{"hw.disk.disks.1.name", "", false},
+		{"hw.memory.total", "", false},
+		{"os.basic.kernel", "", false},
+	}
+
+	for _, tt := range tests {
+		value, ok := lookupFact(facts, tt.path)
+		if ok != tt.found {
+			t.Errorf("lookupFact(%q) found = %v, expected %v", tt.path, ok, tt.found)
+			continue
+		}
+		if ok && formatFactValue(value) != tt.want {
+			t.Errorf("lookupFact(%q) = %v, expected %s", tt.path, value, tt.want)
+		}
+	}
+}
+
+func TestHealthCheck_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		check   HealthCheck
+		wantErr bool
+	}{
+		{"command", HealthCheck{Type: HealthCheckCommand, Command: "true"}, false},
+		{"http", HealthCheck{Type: HealthCheckHTTP, URL: "http://localhost"}, false},
+		{"fact", HealthCheck{Type: HealthCheckFact, Fact: "os.basic.distro"}, false},
+		{"port", HealthCheck{Type: HealthCheckPort, Port: 443}, false},
+		{"file", HealthCheck{Type: HealthCheckFile, Path: "/etc/motd", Pattern: "^Welcome"}, false},
+		{"missing url", HealthCheck{Type: HealthCheckHTTP}, true},
+		{"invalid port", HealthCheck{Type: HealthCheckPort, Port: 70000}, true},
+		{"missing path", HealthCheck{Type: HealthCheckFile}, true},
+		{"invalid pattern", HealthCheck{Type: HealthCheckFile, Path: "/etc/motd", Pattern: "("}, true},
+		{"unknown type", HealthCheck{Type: "ping"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.check.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
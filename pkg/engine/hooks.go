@@ -0,0 +1,615 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openfroyo/openfroyo/pkg/micro_runner/protocol"
+)
+
+// HookType represents where a hook runs.
+type HookType string
+
+const (
+	// HookLocal runs a command on the machine running froyo.
+	HookLocal HookType = "local"
+
+	// HookRemote runs a command on each host the hook concerns through the micro-runner.
+	HookRemote HookType = "remote"
+
+	// HookWebhook posts the hook context as JSON to a URL.
+	HookWebhook HookType = "webhook"
+)
+
+// HookEvent identifies the point of a run at which a hook fires.
+type HookEvent string
+
+const (
+	// HookBeforeRun fires before any unit of the run executes.
+	HookBeforeRun HookEvent = "before_run"
+
+	// HookAfterRun fires once every unit of the run finished.
+	HookAfterRun HookEvent = "after_run"
+
+	// HookBeforeBatch fires before the units of a host batch execute.
+	HookBeforeBatch HookEvent = "before_batch"
+
+	// HookAfterBatch fires once the units of a host batch finished.
+	HookAfterBatch HookEvent = "after_batch"
+
+	// HookBeforeResource fires before the unit of a resource executes.
+	HookBeforeResource HookEvent = "before_resource"
+
+	// HookAfterResource fires once the unit of a resource finished.
+	HookAfterResource HookEvent = "after_resource"
+)
+
+// defaultHookTimeout is used when a hook has no timeout.
+const defaultHookTimeout = 5 * time.Minute
+
+// maxHookOutputBytes limits how much hook output is kept in events.
+const maxHookOutputBytes = 4096
+
+// Hook is a command or webhook run around a run, a host batch or a resource.
+type Hook struct {
+	// Name identifies the hook in events.
+	Name string `json:"name"`
+
+	// Type is where the hook runs.
+	Type HookType `json:"type"`
+
+	// Command is the shell command run by local and remote hooks.
+	Command string `json:"command,omitempty"`
+
+	// URL is the endpoint webhooks post to.
+	URL string `json:"url,omitempty"`
+
+	// Headers are added to webhook requests.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Timeout is the maximum duration of the hook.
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// ContinueOnFailure records a failure without aborting the run.
+	ContinueOnFailure bool `json:"continue_on_failure,omitempty"`
+}
+
+// Validate checks that the hook has the fields its type requires.
+func (h *Hook) Validate() error {
+	var missing string
+	switch h.Type {
+	case HookLocal, HookRemote:
+		if h.Command == "" {
+			missing = "command"
+		}
+	case HookWebhook:
+		if h.URL == "" {
+			missing = "url"
+		}
+	default:
+		return NewPermanentError(fmt.Sprintf("hook %q has invalid type %q", h.Name, h.Type), nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	if missing != "" {
+		return NewPermanentError(fmt.Sprintf("%s hook %q requires %s", h.Type, h.Name, missing), nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	if h.Timeout < 0 {
+		return NewPermanentError(fmt.Sprintf("hook %q has a negative timeout", h.Name), nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	return nil
+}
+
+// timeout returns the hook timeout or the default.
+func (h *Hook) timeout() time.Duration {
+	if h.Timeout > 0 {
+		return h.Timeout
+	}
+	return defaultHookTimeout
+}
+
+// RunHooks are the hooks fired around a whole run and around each host batch
+// of a rollout or canary run.
+type RunHooks struct {
+	// BeforeRun fire before any unit executes.
+	BeforeRun []Hook `json:"before_run,omitempty"`
+
+	// AfterRun fire once every unit finished, unless a before-run hook aborted the run.
+	AfterRun []Hook `json:"after_run,omitempty"`
+
+	// BeforeBatch fire before each host batch.
+	BeforeBatch []Hook `json:"before_batch,omitempty"`
+
+	// AfterBatch fire after each host batch.
+	AfterBatch []Hook `json:"after_batch,omitempty"`
+}
+
+// all returns every hook with the event it fires on.
+func (h *RunHooks) all() map[HookEvent][]Hook {
+	if h == nil {
+		return nil
+	}
+	return map[HookEvent][]Hook{
+		HookBeforeRun:   h.BeforeRun,
+		HookAfterRun:    h.AfterRun,
+		HookBeforeBatch: h.BeforeBatch,
+		HookAfterBatch:  h.AfterBatch,
+	}
+}
+
+// ResourceHooks are the hooks fired around the unit of a resource on its host.
+type ResourceHooks struct {
+	// Before fire before the unit executes.
+	Before []Hook `json:"before,omitempty"`
+
+	// After fire once the unit finished, whether it succeeded or not.
+	After []Hook `json:"after,omitempty"`
+}
+
+// all returns every hook with the event it fires on.
+func (h *ResourceHooks) all() map[HookEvent][]Hook {
+	if h == nil {
+		return nil
+	}
+	return map[HookEvent][]Hook{
+		HookBeforeResource: h.Before,
+		HookAfterResource:  h.After,
+	}
+}
+
+// HookContext describes what a hook fires for. Local hooks receive it as
+// FROYO_* environment variables and webhooks as the JSON request body.
+type HookContext struct {
+	// Event is the point of the run the hook fires at.
+	Event HookEvent `json:"event"`
+
+	// Hook is the name of the hook.
+	Hook string `json:"hook"`
+
+	// RunID is the ID of the run.
+	RunID string `json:"run_id"`
+
+	// PlanID is the ID of the plan being executed.
+	PlanID string `json:"plan_id"`
+
+	// Hosts are the hosts concerned: every host of the plan, the hosts of the
+	// batch or the host of the resource.
+	Hosts []string `json:"hosts,omitempty"`
+
+	// HostID is the host a remote hook runs on.
+	HostID string `json:"host_id,omitempty"`
+
+	// Batch is the 1-based number of the host batch, or zero for the canary batch.
+	Batch int `json:"batch,omitempty"`
+
+	// ResourceID is the resource of resource hooks.
+	ResourceID string `json:"resource_id,omitempty"`
+
+	// PlanUnitID is the plan unit of resource hooks.
+	PlanUnitID string `json:"plan_unit_id,omitempty"`
+}
+
+// env returns the context as environment variables.
+func (c *HookContext) env() map[string]string {
+	return map[string]string{
+		"FROYO_HOOK":         c.Hook,
+		"FROYO_HOOK_EVENT":   string(c.Event),
+		"FROYO_RUN_ID":       c.RunID,
+		"FROYO_PLAN_ID":      c.PlanID,
+		"FROYO_HOSTS":        strings.Join(c.Hosts, " "),
+		"FROYO_HOST":         c.HostID,
+		"FROYO_BATCH":        strconv.Itoa(c.Batch),
+		"FROYO_RESOURCE_ID":  c.ResourceID,
+		"FROYO_PLAN_UNIT_ID": c.PlanUnitID,
+	}
+}
+
+// HookResult is the outcome of a hook.
+type HookResult struct {
+	// Succeeded indicates whether the hook succeeded.
+	Succeeded bool `json:"succeeded"`
+
+	// Output is the captured output, truncated to a few kilobytes.
+	Output string `json:"output,omitempty"`
+
+	// Message explains why the hook failed.
+	Message string `json:"message,omitempty"`
+
+	// Duration is how long the hook took.
+	Duration time.Duration `json:"duration"`
+}
+
+// HookRunner runs hooks.
+type HookRunner interface {
+	// RunHook runs a hook. An error means the hook could not be run at all;
+	// a failing hook is reported in the result.
+	RunHook(ctx context.Context, hook Hook, hookCtx HookContext) (*HookResult, error)
+}
+
+// DefaultHookRunner runs local hooks with the shell, remote hooks through the
+// micro-runner and webhooks over HTTP.
+type DefaultHookRunner struct {
+	hostRegistry     *HostRegistry
+	runnerBinaryPath string
+	httpClient       *http.Client
+}
+
+// NewDefaultHookRunner creates a hook runner. The host registry and runner
+// binary are only needed for remote hooks.
+func NewDefaultHookRunner(hostRegistry *HostRegistry, runnerBinaryPath string) *DefaultHookRunner {
+	return &DefaultHookRunner{
+		hostRegistry:     hostRegistry,
+		runnerBinaryPath: runnerBinaryPath,
+		httpClient:       &http.Client{},
+	}
+}
+
+// RunHook runs a hook.
+func (r *DefaultHookRunner) RunHook(ctx context.Context, hook Hook, hookCtx HookContext) (*HookResult, error) {
+	if err := hook.Validate(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, hook.timeout())
+	defer cancel()
+
+	start := time.Now()
+	result := &HookResult{}
+
+	var err error
+	switch hook.Type {
+	case HookLocal:
+		err = r.runLocal(ctx, &hook, &hookCtx, result)
+	case HookRemote:
+		err = r.runRemote(ctx, &hook, &hookCtx, result)
+	case HookWebhook:
+		err = r.runWebhook(ctx, &hook, &hookCtx, result)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result.Duration = time.Since(start)
+	return result, nil
+}
+
+// runLocal runs a local hook with the shell.
+func (r *DefaultHookRunner) runLocal(ctx context.Context, hook *Hook, hookCtx *HookContext, result *HookResult) error {
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", hook.Command)
+	cmd.Env = os.Environ()
+	for key, value := range hookCtx.env() {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+
+	output, err := cmd.CombinedOutput()
+	result.Output = truncateHookOutput(string(output))
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		result.Succeeded = true
+	case errors.As(err, &exitErr):
+		result.Message = fmt.Sprintf("exited with code %d", exitErr.ExitCode())
+	default:
+		result.Message = err.Error()
+	}
+
+	return nil
+}
+
+// runRemote runs a remote hook on its host through a micro-runner session.
+func (r *DefaultHookRunner) runRemote(ctx context.Context, hook *Hook, hookCtx *HookContext, result *HookResult) error {
+	if r.hostRegistry == nil {
+		return NewPermanentError("remote hooks require a host registry", nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	host, err := r.hostRegistry.GetHost(ctx, hookCtx.HostID)
+	if err != nil {
+		return fmt.Errorf("failed to get host: %w", err)
+	}
+
+	session, err := OpenRunnerSession(ctx, host, r.runnerBinaryPath)
+	if err != nil {
+		return err
+	}
+	defer session.Close(ctx)
+
+	var execResult protocol.ExecResult
+	err = session.Execute(ctx, protocol.CommandTypeExec, &protocol.ExecParams{
+		Command:    hook.Command,
+		Env:        hookCtx.env(),
+		CaptureOut: true,
+		CaptureErr: true,
+	}, hook.timeout(), &execResult)
+	if err != nil {
+		return err
+	}
+
+	result.Output = truncateHookOutput(execResult.Stdout + execResult.Stderr)
+	result.Succeeded = execResult.ExitCode == 0
+	if !result.Succeeded {
+		result.Message = fmt.Sprintf("exited with code %d", execResult.ExitCode)
+	}
+
+	return nil
+}
+
+// runWebhook posts the hook context to the webhook URL. Any 2xx response succeeds.
+func (r *DefaultHookRunner) runWebhook(ctx context.Context, hook *Hook, hookCtx *HookContext, result *HookResult) error {
+	body, err := json.Marshal(hookCtx)
+	if err != nil {
+		return fmt.Errorf("failed to encode hook context: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range hook.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		// Unreachable endpoints fail the hook rather than erroring
+		result.Message = err.Error()
+		return nil
+	}
+	defer resp.Body.Close()
+
+	output, _ := io.ReadAll(io.LimitReader(resp.Body, maxHookOutputBytes))
+	result.Output = string(output)
+	result.Succeeded = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !result.Succeeded {
+		result.Message = fmt.Sprintf("webhook returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// truncateHookOutput keeps the end of the output, where errors usually are.
+func truncateHookOutput(output string) string {
+	if len(output) <= maxHookOutputBytes {
+		return output
+	}
+	return output[len(output)-maxHookOutputBytes:]
+}
+
+// planHasHooks reports whether the plan declares any hooks.
+func planHasHooks(plan *Plan) bool {
+	for _, hooks := range plan.Hooks.all() {
+		if len(hooks) > 0 {
+			return true
+		}
+	}
+	for i := range plan.Units {
+		for _, hooks := range plan.Units[i].Hooks.all() {
+			if len(hooks) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validatePlanHooks checks the hooks of the plan and its units.
+func validatePlanHooks(plan *Plan) error {
+	for _, hooks := range plan.Hooks.all() {
+		for i := range hooks {
+			if err := hooks[i].Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	for i := range plan.Units {
+		for _, hooks := range plan.Units[i].Hooks.all() {
+			for j := range hooks {
+				if err := hooks[j].Validate(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// runHooks runs the hooks of an event in order. Remote hooks run on every
+// host of the context. When a hook fails and does not continue on failure,
+// the remaining hooks are skipped, the run is aborted and the error is
+// returned. Hooks do not run on dry runs.
+func (s *ParallelScheduler) runHooks(
+	ctx context.Context,
+	run *Run,
+	opts ScheduleOptions,
+	event HookEvent,
+	hooks []Hook,
+	hookCtx HookContext,
+) error {
+	if len(hooks) == 0 || opts.DryRun {
+		return nil
+	}
+
+	hookCtx.Event = event
+	hookCtx.RunID = run.ID
+	hookCtx.PlanID = run.PlanID
+
+	for _, hook := range hooks {
+		hookCtx.Hook = hook.Name
+
+		var failure string
+		if hook.Type == HookRemote {
+			if len(hookCtx.Hosts) == 0 {
+				failure = "no hosts to run on"
+			}
+			for _, host := range hookCtx.Hosts {
+				hostCtx := hookCtx
+				hostCtx.HostID = host
+				if !s.runHook(ctx, run, hook, hostCtx) && failure == "" {
+					failure = fmt.Sprintf("failed on %s", host)
+				}
+			}
+		} else if !s.runHook(ctx, run, hook, hookCtx) {
+			failure = "failed"
+		}
+
+		if failure == "" || hook.ContinueOnFailure {
+			continue
+		}
+
+		err := NewPermanentError(fmt.Sprintf("%s hook %s %s", event, hook.Name, failure), nil).
+			WithCode(ErrCodeProviderFailed)
+		s.abortRun(err)
+		return err
+	}
+
+	return nil
+}
+
+// runHook runs a hook and publishes its result and output as an event.
+// Hooks that cannot be run count as failed.
+func (s *ParallelScheduler) runHook(ctx context.Context, run *Run, hook Hook, hookCtx HookContext) bool {
+	result, err := s.hookRunner.RunHook(ctx, hook, hookCtx)
+	if err != nil {
+		result = &HookResult{Message: err.Error()}
+	}
+
+	details := map[string]interface{}{
+		"hook":      hook.Name,
+		"type":      hook.Type,
+		"event":     hookCtx.Event,
+		"succeeded": result.Succeeded,
+		"duration":  result.Duration.String(),
+	}
+	if hookCtx.HostID != "" {
+		details["host_id"] = hookCtx.HostID
+	}
+	if hookCtx.ResourceID != "" {
+		details["resource_id"] = hookCtx.ResourceID
+	}
+	if result.Output != "" {
+		details["output"] = result.Output
+	}
+	if result.Message != "" {
+		details["message"] = result.Message
+	}
+
+	where := ""
+	if hookCtx.HostID != "" {
+		where = " on " + hookCtx.HostID
+	}
+
+	if result.Succeeded {
+		s.publishEventDetails(ctx, run.ID, hookCtx.PlanUnitID, EventTypeHookSucceeded,
+			fmt.Sprintf("Hook %s (%s) succeeded%s", hook.Name, hookCtx.Event, where), "info", details)
+		return true
+	}
+
+	level := "error"
+	if hook.ContinueOnFailure {
+		level = "warning"
+	}
+	s.publishEventDetails(ctx, run.ID, hookCtx.PlanUnitID, EventTypeHookFailed,
+		fmt.Sprintf("Hook %s (%s) failed%s: %s", hook.Name, hookCtx.Event, where, result.Message), level, details)
+	return false
+}
+
+// runResourceHooks runs the hooks of a unit for an event on the unit's host.
+func (s *ParallelScheduler) runResourceHooks(
+	ctx context.Context,
+	run *Run,
+	unit *PlanUnit,
+	opts ScheduleOptions,
+	event HookEvent,
+) error {
+	if unit.Hooks == nil {
+		return nil
+	}
+
+	hookCtx := HookContext{
+		ResourceID: unit.ResourceID,
+		PlanUnitID: unit.ID,
+	}
+	if unit.TargetID != "" {
+		hookCtx.Hosts = []string{unit.TargetID}
+	}
+
+	return s.runHooks(ctx, run, opts, event, unit.Hooks.all()[event], hookCtx)
+}
+
+// executeBatch executes the units of a host batch between the batch hooks.
+// It returns the abort error when a hook aborted the run during the batch.
+func (s *ParallelScheduler) executeBatch(
+	ctx context.Context,
+	run *Run,
+	plan *Plan,
+	unitMap map[string]*PlanUnit,
+	opts ScheduleOptions,
+	hosts []string,
+	batch int,
+) error {
+	hooks := plan.Hooks
+	if hooks == nil {
+		hooks = &RunHooks{}
+	}
+	hookCtx := HookContext{Hosts: hosts, Batch: batch}
+
+	if err := s.runHooks(ctx, run, opts, HookBeforeBatch, hooks.BeforeBatch, hookCtx); err != nil {
+		return err
+	}
+
+	err := s.executeUnits(ctx, run, plan, unitMap, opts)
+
+	if hookErr := s.runHooks(ctx, run, opts, HookAfterBatch, hooks.AfterBatch, hookCtx); hookErr != nil && err == nil {
+		err = hookErr
+	}
+
+	if err == nil {
+		err = s.abortError()
+	}
+
+	return err
+}
+
+// abortRun records the error that aborts the current run. Units that have
+// not started yet are cancelled instead of executed.
+func (s *ParallelScheduler) abortRun(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.abortErr == nil {
+		s.abortErr = err
+	}
+}
+
+// abortError returns the error that aborted the current run, if any.
+func (s *ParallelScheduler) abortError() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.abortErr
+}
+
+// takeAbortError returns and clears the error that aborted the current run.
+func (s *ParallelScheduler) takeAbortError() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.abortErr
+	s.abortErr = nil
+	return err
+}
@@ -0,0 +1,390 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockHookRunner records the hooks it runs and fails hooks by name.
+type mockHookRunner struct {
+	mu        sync.Mutex
+	failHooks map[string]bool
+	calls     []HookContext
+}
+
+func newMockHookRunner() *mockHookRunner {
+	return &mockHookRunner{failHooks: make(map[string]bool)}
+}
+
+func (m *mockHookRunner) RunHook(ctx context.Context, hook Hook, hookCtx HookContext) (*HookResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls = append(m.calls, hookCtx)
+	if m.failHooks[hook.Name] {
+		return &HookResult{Output: "drain refused", Message: "exited with code 1"}, nil
+	}
+	return &HookResult{Succeeded: true, Output: "ok"}, nil
+}
+
+func (m *mockHookRunner) getCalls() []HookContext {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]HookContext(nil), m.calls...)
+}
+
+func TestHook_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		hook    Hook
+		wantErr bool
+	}{
+		{"local", Hook{Name: "notify", Type: HookLocal, Command: "echo hi"}, false},
+		{"remote", Hook{Name: "drain", Type: HookRemote, Command: "lb-drain"}, false},
+		{"webhook", Hook{Name: "lb", Type: HookWebhook, URL: "http://lb/drain"}, false},
+		{"missing command", Hook{Name: "notify", Type: HookLocal}, true},
+		{"missing url", Hook{Name: "lb", Type: HookWebhook}, true},
+		{"invalid type", Hook{Name: "x", Type: "ftp", Command: "x"}, true},
+		{"negative timeout", Hook{Name: "notify", Type: HookLocal, Command: "x", Timeout: -time.Second}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.hook.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScheduler_Hooks_RunAndResource(t *testing.T) {
+	hookRunner := newMockHookRunner()
+	publisher := newMockEventPublisher()
+	stateMgr := newMockStateManager()
+	scheduler := NewParallelScheduler(5, newMockExecutor(), publisher, stateMgr)
+	scheduler.SetHookRunner(hookRunner)
+
+	ctx := context.Background()
+	plan := newHostPlan(t, "web1", "web2")
+	plan.Hooks = &RunHooks{
+		BeforeRun: []Hook{{Name: "announce", Type: HookWebhook, URL: "http://chat/hook"}},
+		AfterRun:  []Hook{{Name: "report", Type: HookLocal, Command: "true"}},
+	}
+	plan.Units[0].Hooks = &ResourceHooks{
+		Before: []Hook{{Name: "drain", Type: HookRemote, Command: "lb-drain"}},
+		After:  []Hook{{Name: "undrain", Type: HookRemote, Command: "lb-add"}},
+	}
+
+	runID, err := scheduler.Schedule(ctx, plan, ScheduleOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(200 * time.Millisecond)
+
+	run, err := stateMgr.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("Failed to get run: %v", err)
+	}
+
+	if run.Status != RunStatusSucceeded {
+		t.Errorf("Expected run status SUCCEEDED, got %s", run.Status)
+	}
+
+	calls := hookRunner.getCalls()
+	if len(calls) != 4 {
+		t.Fatalf("Expected 4 hook calls, got %d", len(calls))
+	}
+	if calls[0].Event != HookBeforeRun || calls[3].Event != HookAfterRun {
+		t.Errorf("Expected run hooks first and last, got %s and %s", calls[0].Event, calls[3].Event)
+	}
+	if strings.Join(calls[0].Hosts, ",") != "web1,web2" || calls[0].RunID != runID {
+		t.Errorf("Unexpected run hook context: %+v", calls[0])
+	}
+
+	// Remote resource hooks run on the unit's host
+	for _, call := range calls[1:3] {
+		if call.HostID != "web1" || call.PlanUnitID != "web1-pkg" {
+			t.Errorf("Unexpected resource hook context: %+v", call)
+		}
+	}
+
+	// Hook results and output are recorded as events
+	var drained *Event
+	for _, event := range publisher.getEvents() {
+		if event.Type == EventTypeHookSucceeded && event.Details["hook"] == "drain" {
+			drained = &event
+			break
+		}
+	}
+	if drained == nil {
+		t.Fatal("Expected a hook event for drain")
+	}
+	if drained.PlanUnitID != "web1-pkg" || drained.Details["output"] != "ok" {
+		t.Errorf("Unexpected hook event: %+v", drained)
+	}
+}
+
+func TestScheduler_Hooks_BeforeRunAborts(t *testing.T) {
+	hookRunner := newMockHookRunner()
+	hookRunner.failHooks["drain"] = true
+	executor := newMockExecutor()
+	stateMgr := newMockStateManager()
+	scheduler := NewParallelScheduler(5, executor, newMockEventPublisher(), stateMgr)
+	scheduler.SetHookRunner(hookRunner)
+
+	ctx := context.Background()
+	plan := newHostPlan(t, "web1", "web2")
+	plan.Hooks = &RunHooks{
+		BeforeRun: []Hook{{Name: "drain", Type: HookLocal, Command: "lb-drain"}},
+		AfterRun:  []Hook{{Name: "undrain", Type: HookLocal, Command: "lb-add"}},
+	}
+
+	runID, err := scheduler.Schedule(ctx, plan, ScheduleOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(200 * time.Millisecond)
+
+	run, err := stateMgr.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("Failed to get run: %v", err)
+	}
+
+	if run.Status != RunStatusFailed {
+		t.Errorf("Expected run status FAILED, got %s", run.Status)
+	}
+	if run.Summary.Cancelled != 2 {
+		t.Errorf("Expected 2 cancelled units, got %+v", run.Summary)
+	}
+
+	executor.mu.Lock()
+	executed := len(executor.executedUnits)
+	executor.mu.Unlock()
+	if executed != 0 {
+		t.Errorf("Expected no executions, got %d", executed)
+	}
+
+	// The after-run hooks do not fire for a run that never started
+	if calls := hookRunner.getCalls(); len(calls) != 1 {
+		t.Errorf("Expected 1 hook call, got %d", len(calls))
+	}
+}
+
+func TestScheduler_Hooks_ResourceFailureAborts(t *testing.T) {
+	hookRunner := newMockHookRunner()
+	hookRunner.failHooks["drain"] = true
+	executor := newMockExecutor()
+	stateMgr := newMockStateManager()
+	scheduler := NewParallelScheduler(1, executor, newMockEventPublisher(), stateMgr)
+	scheduler.SetHookRunner(hookRunner)
+
+	ctx := context.Background()
+	plan := newHostPlan(t, "web1", "web2", "web3")
+	plan.Units[0].Hooks = &ResourceHooks{
+		Before: []Hook{{Name: "drain", Type: HookRemote, Command: "lb-drain"}},
+	}
+
+	runID, err := scheduler.Schedule(ctx, plan, ScheduleOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(200 * time.Millisecond)
+
+	run, err := stateMgr.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("Failed to get run: %v", err)
+	}
+
+	if run.Status != RunStatusFailed {
+		t.Errorf("Expected run status FAILED, got %s", run.Status)
+	}
+
+	// The hooked unit fails without executing and the rest of the run stops
+	executor.mu.Lock()
+	defer executor.mu.Unlock()
+	for _, id := range executor.executedUnits {
+		if id == "web1-pkg" {
+			t.Error("Expected web1-pkg not to execute after its hook failed")
+		}
+	}
+	if run.Summary.Failed != 1 || run.Summary.Succeeded+run.Summary.Cancelled != 2 {
+		t.Errorf("Expected 1 failed unit and the rest succeeded or cancelled, got %+v", run.Summary)
+	}
+}
+
+func TestScheduler_Hooks_ContinueOnFailure(t *testing.T) {
+	hookRunner := newMockHookRunner()
+	hookRunner.failHooks["notify"] = true
+	publisher := newMockEventPublisher()
+	stateMgr := newMockStateManager()
+	scheduler := NewParallelScheduler(5, newMockExecutor(), publisher, stateMgr)
+	scheduler.SetHookRunner(hookRunner)
+
+	ctx := context.Background()
+	plan := newHostPlan(t, "web1")
+	plan.Hooks = &RunHooks{
+		BeforeRun: []Hook{{Name: "notify", Type: HookLocal, Command: "notify", ContinueOnFailure: true}},
+	}
+
+	runID, err := scheduler.Schedule(ctx, plan, ScheduleOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(200 * time.Millisecond)
+
+	run, err := stateMgr.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("Failed to get run: %v", err)
+	}
+
+	if run.Status != RunStatusSucceeded {
+		t.Errorf("Expected run status SUCCEEDED, got %s", run.Status)
+	}
+
+	found := false
+	for _, event := range publisher.getEvents() {
+		if event.Type == EventTypeHookFailed && event.Level == "warning" {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Error("Expected a warning event for the failed hook")
+	}
+}
+
+func TestScheduler_Hooks_RequireRunner(t *testing.T) {
+	scheduler := NewParallelScheduler(5, newMockExecutor(), newMockEventPublisher(), newMockStateManager())
+
+	ctx := context.Background()
+	plan := newHostPlan(t, "web1")
+	plan.Hooks = &RunHooks{
+		BeforeRun: []Hook{{Name: "notify", Type: HookLocal, Command: "notify"}},
+	}
+
+	// Hooks require a hook runner, except on dry runs where they never run
+	if _, err := scheduler.Schedule(ctx, plan, ScheduleOptions{}); err == nil {
+		t.Fatal("Expected error for hooks without a hook runner, got nil")
+	}
+	if _, err := scheduler.Schedule(ctx, plan, ScheduleOptions{DryRun: true}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	plan.Hooks.BeforeRun[0].Command = ""
+	if _, err := scheduler.Schedule(ctx, plan, ScheduleOptions{DryRun: true}); err == nil {
+		t.Fatal("Expected error for an invalid hook, got nil")
+	}
+}
+
+func TestScheduler_Hooks_Batches(t *testing.T) {
+	hookRunner := newMockHookRunner()
+	stateMgr := newMockStateManager()
+	scheduler := NewParallelScheduler(5, newMockExecutor(), newMockEventPublisher(), stateMgr)
+	scheduler.SetHookRunner(hookRunner)
+
+	ctx := context.Background()
+	plan := newHostPlan(t, "web1", "web2", "web3")
+	plan.Hooks = &RunHooks{
+		BeforeBatch: []Hook{{Name: "drain", Type: HookRemote, Command: "lb-drain"}},
+		AfterBatch:  []Hook{{Name: "undrain", Type: HookRemote, Command: "lb-add"}},
+	}
+
+	runID, err := scheduler.Schedule(ctx, plan, ScheduleOptions{
+		Rollout: &RolloutOptions{BatchSize: 2},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(200 * time.Millisecond)
+
+	run, err := stateMgr.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("Failed to get run: %v", err)
+	}
+
+	if run.Status != RunStatusSucceeded {
+		t.Errorf("Expected run status SUCCEEDED, got %s", run.Status)
+	}
+
+	// Remote batch hooks run on each host of their batch
+	var got []string
+	for _, call := range hookRunner.getCalls() {
+		got = append(got, string(call.Event)+":"+call.HostID)
+	}
+	expected := "before_batch:web1,before_batch:web2,after_batch:web1,after_batch:web2," +
+		"before_batch:web3,after_batch:web3"
+	if strings.Join(got, ",") != expected {
+		t.Errorf("Expected hook calls %s, got %s", expected, strings.Join(got, ","))
+	}
+}
+
+func TestDefaultHookRunner_LocalAndWebhook(t *testing.T) {
+	var received HookContext
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("drained"))
+	}))
+	defer server.Close()
+
+	runner := NewDefaultHookRunner(nil, "")
+	ctx := context.Background()
+	hookCtx := HookContext{Event: HookBeforeRun, Hook: "drain", RunID: "run1", Hosts: []string{"web1"}}
+
+	result, err := runner.RunHook(ctx, Hook{Name: "drain", Type: HookLocal, Command: "echo $FROYO_HOOK_EVENT $FROYO_HOSTS"}, hookCtx)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !result.Succeeded || strings.TrimSpace(result.Output) != "before_run web1" {
+		t.Errorf("Unexpected local hook result: %+v", result)
+	}
+
+	result, err = runner.RunHook(ctx, Hook{Name: "fail", Type: HookLocal, Command: "exit 3"}, hookCtx)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if result.Succeeded || result.Message != "exited with code 3" {
+		t.Errorf("Unexpected failed hook result: %+v", result)
+	}
+
+	webhook := Hook{Name: "lb", Type: HookWebhook, URL: server.URL, Headers: map[string]string{"X-Token": "secret"}}
+	result, err = runner.RunHook(ctx, webhook, hookCtx)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !result.Succeeded || result.Output != "drained" || received.RunID != "run1" {
+		t.Errorf("Unexpected webhook result: %+v, received %+v", result, received)
+	}
+
+	webhook.Headers = nil
+	result, err = runner.RunHook(ctx, webhook, hookCtx)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if result.Succeeded {
+		t.Error("Expected webhook without token to fail")
+	}
+}
@@ -2,7 +2,8 @@ package engine
 
 import (
 	"context"
-	"encoding/json"
+	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -11,6 +12,18 @@ import (
 	"github.com/openfroyo/openfroyo/pkg/stores"
 )
 
+// HostStatus is the reachability of a host, as last seen by fact collection.
+type HostStatus = stores.HostStatus
+
+const (
+	// HostStatusActive marks a host that was reachable when last contacted.
+	HostStatusActive = stores.HostStatusActive
+
+	// HostStatusUnreachable marks a host that could not be connected to when
+	// its facts were last collected.
+	HostStatusUnreachable = stores.HostStatusUnreachable
+)
+
 // Host represents a managed host in the inventory.
 type Host struct {
 	ID          string            `json:"id"`
@@ -18,12 +31,17 @@ type Host struct {
 	Port        int               `json:"port"`
 	User        string            `json:"user"`
 	KeyPath     string            `json:"key_path"`
+	Status      HostStatus        `json:"status"`
 	Labels      map[string]string `json:"labels"`
+	Groups      []string          `json:"groups"`
 	OnboardedAt time.Time         `json:"onboarded_at"`
 	CreatedAt   time.Time         `json:"created_at"`
 	UpdatedAt   time.Time         `json:"updated_at"`
 }
 
+// maxHosts bounds the hosts listed at once.
+const maxHosts = 100000
+
 // HostRegistry manages the host inventory.
 type HostRegistry struct {
 	store stores.Store
@@ -36,11 +54,18 @@ func NewHostRegistry(store stores.Store) *HostRegistry {
 	}
 }
 
-// AddHost adds a new host to the registry.
+// AddHost adds a host to the registry, replacing any host with the same ID.
+// Hosts default to port 22 and the active status.
 func (r *HostRegistry) AddHost(ctx context.Context, host *Host) error {
 	if host.ID == "" {
 		host.ID = uuid.New().String()
 	}
+	if host.Port == 0 {
+		host.Port = 22
+	}
+	if host.Status == "" {
+		host.Status = HostStatusActive
+	}
 
 	now := time.Now()
 	if host.CreatedAt.IsZero() {
@@ -48,109 +73,49 @@ func (r *HostRegistry) AddHost(ctx context.Context, host *Host) error {
 	}
 	host.UpdatedAt = now
 
-	// Marshal host data
-	hostData, err := json.Marshal(host)
-	if err != nil {
-		return fmt.Errorf("failed to marshal host data: %w", err)
-	}
-
-	// Store as fact
-	fact := &stores.Fact{
-		ID:        uuid.New().String(),
-		TargetID:  host.ID,
-		Namespace: "host.metadata",
-		Key:       "info",
-		Value:     string(hostData),
-		TTL:       0, // No expiry
-		CreatedAt: now,
-		UpdatedAt: now,
-	}
-
-	if err := r.store.UpsertFact(ctx, fact); err != nil {
+	if err := r.store.UpsertHost(ctx, toStoreHost(host)); err != nil {
 		return fmt.Errorf("failed to store host: %w", err)
 	}
 
-	// Store labels separately for easier querying
-	if len(host.Labels) > 0 {
-		labelsData, err := json.Marshal(host.Labels)
-		if err != nil {
-			return fmt.Errorf("failed to marshal labels: %w", err)
-		}
-
-		labelsFact := &stores.Fact{
-			ID:        uuid.New().String(),
-			TargetID:  host.ID,
-			Namespace: "host.labels",
-			Key:       "all",
-			Value:     string(labelsData),
-			TTL:       0,
-			CreatedAt: now,
-			UpdatedAt: now,
-		}
-
-		if err := r.store.UpsertFact(ctx, labelsFact); err != nil {
-			return fmt.Errorf("failed to store labels: %w", err)
-		}
-	}
-
 	return nil
 }
 
 // GetHost retrieves a host by ID.
 func (r *HostRegistry) GetHost(ctx context.Context, hostID string) (*Host, error) {
-	fact, err := r.store.GetFact(ctx, hostID, "host.metadata", "info")
-	if err != nil {
-		return nil, fmt.Errorf("host not found: %s", hostID)
+	host, err := r.store.GetHost(ctx, hostID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, NewPermanentError(fmt.Sprintf("host not found: %s", hostID), nil).
+			WithCode(ErrCodeNotFound)
 	}
-
-	var host Host
-	if err := json.Unmarshal([]byte(fact.Value), &host); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal host data: %w", err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get host %s: %w", hostID, err)
 	}
 
-	return &host, nil
+	return fromStoreHost(host), nil
 }
 
 // GetHostByAddress retrieves a host by address.
 func (r *HostRegistry) GetHostByAddress(ctx context.Context, address string) (*Host, error) {
-	// List all hosts and filter by address
-	hosts, err := r.ListHosts(ctx)
+	hosts, err := r.listHosts(ctx, stores.HostFilter{Address: &address})
 	if err != nil {
 		return nil, err
 	}
 
-	for _, host := range hosts {
-		if host.Address == address {
-			return host, nil
-		}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("host not found: %s", address)
 	}
 
-	return nil, fmt.Errorf("host not found: %s", address)
+	return hosts[0], nil
 }
 
-// ListHosts lists all registered hosts.
+// ListHosts lists all registered hosts, ordered by ID.
 func (r *HostRegistry) ListHosts(ctx context.Context) ([]*Host, error) {
-	namespace := "host.metadata"
-	facts, err := r.store.ListFacts(ctx, nil, &namespace, 1000, 0)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list hosts: %w", err)
-	}
-
-	hosts := make([]*Host, 0, len(facts))
-	for _, fact := range facts {
-		if fact.Key != "info" {
-			continue
-		}
-
-		var host Host
-		if err := json.Unmarshal([]byte(fact.Value), &host); err != nil {
-			continue // Skip invalid entries
-		}
-
-		hosts = append(hosts, &host)
-	}
+	return r.listHosts(ctx, stores.HostFilter{})
+}
 
-	return hosts, nil
+// ListHostsInGroup lists the hosts of a group, ordered by ID.
+func (r *HostRegistry) ListHostsInGroup(ctx context.Context, group string) ([]*Host, error) {
+	return r.listHosts(ctx, stores.HostFilter{Group: &group})
 }
 
 // SelectHosts selects hosts based on a selector.
@@ -160,93 +125,95 @@ func (r *HostRegistry) SelectHosts(ctx context.Context, selector string) ([]*Hos
 		return r.ListHosts(ctx)
 	}
 
-	// Parse selector into label map
-	labels := parseSelector(selector)
+	return r.listHosts(ctx, stores.HostFilter{Labels: parseSelector(selector)})
+}
 
-	// Get all hosts
-	allHosts, err := r.ListHosts(ctx)
+// listHosts lists the hosts matching a filter.
+func (r *HostRegistry) listHosts(ctx context.Context, filter stores.HostFilter) ([]*Host, error) {
+	storeHosts, err := r.store.ListHosts(ctx, filter, maxHosts, 0)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to list hosts: %w", err)
 	}
 
-	// Filter hosts by labels
-	selectedHosts := make([]*Host, 0)
-	for _, host := range allHosts {
-		if matchesLabels(host.Labels, labels) {
-			selectedHosts = append(selectedHosts, host)
-		}
+	hosts := make([]*Host, 0, len(storeHosts))
+	for _, host := range storeHosts {
+		hosts = append(hosts, fromStoreHost(host))
 	}
 
-	return selectedHosts, nil
+	return hosts, nil
 }
 
 // UpdateHost updates an existing host.
 func (r *HostRegistry) UpdateHost(ctx context.Context, host *Host) error {
-	host.UpdatedAt = time.Now()
-
-	// Marshal host data
-	hostData, err := json.Marshal(host)
-	if err != nil {
-		return fmt.Errorf("failed to marshal host data: %w", err)
+	if _, err := r.GetHost(ctx, host.ID); err != nil {
+		return err
 	}
 
-	// Update fact
-	fact := &stores.Fact{
-		ID:        uuid.New().String(),
-		TargetID:  host.ID,
-		Namespace: "host.metadata",
-		Key:       "info",
-		Value:     string(hostData),
-		TTL:       0,
-		UpdatedAt: host.UpdatedAt,
-	}
+	host.UpdatedAt = time.Now()
 
-	if err := r.store.UpsertFact(ctx, fact); err != nil {
+	if err := r.store.UpsertHost(ctx, toStoreHost(host)); err != nil {
 		return fmt.Errorf("failed to update host: %w", err)
 	}
 
-	// Update labels
-	if len(host.Labels) > 0 {
-		labelsData, err := json.Marshal(host.Labels)
-		if err != nil {
-			return fmt.Errorf("failed to marshal labels: %w", err)
-		}
-
-		labelsFact := &stores.Fact{
-			ID:        uuid.New().String(),
-			TargetID:  host.ID,
-			Namespace: "host.labels",
-			Key:       "all",
-			Value:     string(labelsData),
-			TTL:       0,
-			UpdatedAt: host.UpdatedAt,
-		}
+	return nil
+}
 
-		if err := r.store.UpsertFact(ctx, labelsFact); err != nil {
-			return fmt.Errorf("failed to update labels: %w", err)
-		}
+// SetHostStatus records the status of a host.
+func (r *HostRegistry) SetHostStatus(ctx context.Context, hostID string, status HostStatus) error {
+	if err := r.store.UpdateHostStatus(ctx, hostID, status); err != nil {
+		return fmt.Errorf("failed to update status of host %s: %w", hostID, err)
 	}
-
 	return nil
 }
 
-// DeleteHost removes a host from the registry.
+// DeleteHost removes a host from the registry, with its cached facts and
+// fact history.
 func (r *HostRegistry) DeleteHost(ctx context.Context, hostID string) error {
-	// Get all facts for this host
-	targetID := hostID
-	facts, err := r.store.ListFacts(ctx, &targetID, nil, 1000, 0)
-	if err != nil {
-		return fmt.Errorf("failed to list host facts: %w", err)
+	if err := r.store.DeleteHost(ctx, hostID); err != nil {
+		return fmt.Errorf("failed to delete host: %w", err)
 	}
+	return nil
+}
 
-	// Delete all facts
-	for _, fact := range facts {
-		if err := r.store.DeleteFact(ctx, fact.ID); err != nil {
-			return fmt.Errorf("failed to delete fact: %w", err)
-		}
+// toStoreHost converts a host to its stored form.
+func toStoreHost(host *Host) *stores.Host {
+	stored := &stores.Host{
+		ID:        host.ID,
+		Address:   host.Address,
+		Port:      host.Port,
+		User:      host.User,
+		KeyPath:   host.KeyPath,
+		Status:    host.Status,
+		Labels:    host.Labels,
+		Groups:    host.Groups,
+		CreatedAt: host.CreatedAt,
+		UpdatedAt: host.UpdatedAt,
 	}
+	if !host.OnboardedAt.IsZero() {
+		onboardedAt := host.OnboardedAt
+		stored.OnboardedAt = &onboardedAt
+	}
+	return stored
+}
 
-	return nil
+// fromStoreHost converts a stored host to a host.
+func fromStoreHost(stored *stores.Host) *Host {
+	host := &Host{
+		ID:        stored.ID,
+		Address:   stored.Address,
+		Port:      stored.Port,
+		User:      stored.User,
+		KeyPath:   stored.KeyPath,
+		Status:    stored.Status,
+		Labels:    stored.Labels,
+		Groups:    stored.Groups,
+		CreatedAt: stored.CreatedAt,
+		UpdatedAt: stored.UpdatedAt,
+	}
+	if stored.OnboardedAt != nil {
+		host.OnboardedAt = *stored.OnboardedAt
+	}
+	return host
 }
 
 // parseSelector parses a label selector string into a map.
@@ -270,19 +237,3 @@ func parseSelector(selector string) map[string]string {
 
 	return labels
 }
-
-// matchesLabels checks if host labels match the selector labels.
-func matchesLabels(hostLabels, selectorLabels map[string]string) bool {
-	if len(selectorLabels) == 0 {
-		return true
-	}
-
-	for key, value := range selectorLabels {
-		hostValue, ok := hostLabels[key]
-		if !ok || hostValue != value {
-			return false
-		}
-	}
-
-	return true
-}
@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestHostRegistry(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLiteStore(t)
+	registry := NewHostRegistry(store)
+
+	hosts := []*Host{
+		{ID: "web1", Address: "10.0.0.1", Labels: map[string]string{"env": "prod", "role": "web"}, Groups: []string{"frontend"}},
+		{ID: "web2", Address: "10.0.0.2", Port: 2222, Labels: map[string]string{"env": "staging", "role": "web"}},
+		{ID: "db1", Address: "10.0.0.3", Labels: map[string]string{"env": "prod", "role": "db"}},
+	}
+	for _, host := range hosts {
+		if err := registry.AddHost(ctx, host); err != nil {
+			t.Fatalf("Failed to add host: %v", err)
+		}
+	}
+
+	// Hosts default to port 22 and the active status
+	host, err := registry.GetHost(ctx, "web1")
+	if err != nil {
+		t.Fatalf("Failed to get host: %v", err)
+	}
+	if host.Port != 22 || host.Status != HostStatusActive || len(host.Groups) != 1 {
+		t.Errorf("Unexpected host: %+v", host)
+	}
+
+	host, err = registry.GetHostByAddress(ctx, "10.0.0.2")
+	if err != nil || host.ID != "web2" || host.Port != 2222 {
+		t.Errorf("Expected web2 by address, got %+v (%v)", host, err)
+	}
+
+	selected, err := registry.SelectHosts(ctx, "env=prod")
+	if err != nil {
+		t.Fatalf("Failed to select hosts: %v", err)
+	}
+	if len(selected) != 2 || selected[0].ID != "db1" || selected[1].ID != "web1" {
+		t.Errorf("Expected db1 and web1, got %d hosts", len(selected))
+	}
+
+	grouped, err := registry.ListHostsInGroup(ctx, "frontend")
+	if err != nil {
+		t.Fatalf("Failed to list group: %v", err)
+	}
+	if len(grouped) != 1 || grouped[0].ID != "web1" {
+		t.Errorf("Expected only web1 in frontend, got %d hosts", len(grouped))
+	}
+
+	// Updating an unknown host fails rather than adding it
+	if err := registry.UpdateHost(ctx, &Host{ID: "ghost", Address: "10.0.0.99"}); err == nil {
+		t.Error("Expected error updating an unknown host, got nil")
+	}
+
+	// Unknown hosts are reported as not found
+	if _, err := registry.GetHost(ctx, "ghost"); !IsNotFound(err) {
+		t.Errorf("Expected a not found error, got: %v", err)
+	}
+
+	// Deleting a host deletes its cached facts and fact history
+	collector := NewFactsCollector(store, registry)
+	if err := collector.storeFact(ctx, "db1", "os.basic", json.RawMessage(`{"distro":"rhel"}`), time.Hour); err != nil {
+		t.Fatalf("Failed to store fact: %v", err)
+	}
+	if err := registry.DeleteHost(ctx, "db1"); err != nil {
+		t.Fatalf("Failed to delete host: %v", err)
+	}
+	if _, err := registry.GetHost(ctx, "db1"); err == nil {
+		t.Error("Expected the host to be deleted")
+	}
+	facts, err := collector.GetFacts(ctx, "db1", nil)
+	if err != nil {
+		t.Fatalf("Failed to get facts: %v", err)
+	}
+	if len(facts) != 0 {
+		t.Errorf("Expected the facts of the host to be deleted, got %v", facts)
+	}
+	history, err := collector.FactHistory(ctx, "db1", "os.basic", 0)
+	if err != nil {
+		t.Fatalf("Failed to get fact history: %v", err)
+	}
+	if len(history) != 0 {
+		t.Errorf("Expected the fact history of the host to be deleted, got %d versions", len(history))
+	}
+}
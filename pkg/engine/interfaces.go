@@ -23,6 +23,17 @@ type Evaluator interface {
 	MergeConfigs(ctx context.Context, configs []*Config) (*Config, error)
 }
 
+// HostEvaluator evaluates configurations for a single host, so that resource
+// settings can be derived from the host's facts. Facts are keyed by namespace
+// and exposed as the facts value in CUE and the facts() built-in in Starlark.
+type HostEvaluator interface {
+	// EvaluateForHost parses CUE configuration files against the facts of a host.
+	EvaluateForHost(ctx context.Context, sources []string, facts map[string]interface{}) (*Config, error)
+
+	// EvaluateStarlarkForHost executes a Starlark script against the facts of a host.
+	EvaluateStarlarkForHost(ctx context.Context, script string, input, facts map[string]interface{}) (map[string]interface{}, error)
+}
+
 // Discoverer collects facts about target systems.
 // This is Phase 2: Facts discovery.
 type Discoverer interface {
@@ -67,6 +78,16 @@ type TargetInfo struct {
 
 	// Metadata contains additional target metadata.
 	Metadata map[string]interface{} `json:"metadata,omitempty"`
+
+	// Exec runs commands on the target over the connection opened for fact
+	// collection. It is only set while facts are being collected.
+	Exec CommandExecutor `json:"-"`
+}
+
+// CommandExecutor runs shell commands on a target.
+type CommandExecutor interface {
+	// ExecuteCommand runs a command and returns its standard output and error.
+	ExecuteCommand(ctx context.Context, cmd string) (stdout string, stderr string, err error)
 }
 
 // Planner computes differences and builds execution plans.
@@ -93,6 +114,18 @@ type DiffResult struct {
 	// Resources lists all resources and their differences.
 	Resources []ResourceDiff `json:"resources"`
 
+	// Skipped lists the resources skipped by their condition.
+	Skipped []SkippedResource `json:"skipped,omitempty"`
+
+	// DataSources holds the output of each data source read for the diff.
+	DataSources map[string]json.RawMessage `json:"data_sources,omitempty"`
+
+	// Checks are the workspace checks carried over to the plan.
+	Checks []HealthCheck `json:"checks,omitempty"`
+
+	// Hooks are the workspace hooks carried over to the plan.
+	Hooks *RunHooks `json:"hooks,omitempty"`
+
 	// Summary provides statistics about the diff.
 	Summary DiffSummary `json:"summary"`
 
@@ -105,6 +138,21 @@ type ResourceDiff struct {
 	// ResourceID is the ID of the resource.
 	ResourceID string `json:"resource_id"`
 
+	// TargetID is the ID of the host the resource is applied to, if any.
+	TargetID string `json:"target_id,omitempty"`
+
+	// ResourceType is the type of the resource, which names its provider.
+	ResourceType string `json:"resource_type,omitempty"`
+
+	// Labels are the labels of the resource.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Dependencies lists the IDs of the resources this resource requires.
+	Dependencies []string `json:"dependencies,omitempty"`
+
+	// NotifiedBy lists the IDs of the resources whose changes trigger this handler.
+	NotifiedBy []string `json:"notified_by,omitempty"`
+
 	// Operation is the required operation.
 	Operation OperationType `json:"operation"`
 
@@ -119,6 +167,24 @@ type ResourceDiff struct {
 
 	// RequiresRecreate indicates if recreation is needed.
 	RequiresRecreate bool `json:"requires_recreate"`
+
+	// Handler indicates the resource is a handler that only runs when notified.
+	Handler bool `json:"handler,omitempty"`
+
+	// Lifecycle carries the lifecycle options of the resource.
+	Lifecycle *Lifecycle `json:"lifecycle,omitempty"`
+
+	// Retry carries the retry policy of the resource.
+	Retry *RetryPolicy `json:"retry,omitempty"`
+
+	// Checks carries the post-apply checks of the resource.
+	Checks []HealthCheck `json:"checks,omitempty"`
+
+	// Hooks carries the hooks of the resource.
+	Hooks *ResourceHooks `json:"hooks,omitempty"`
+
+	// Wait is the condition of a wait resource.
+	Wait *WaitCondition `json:"wait,omitempty"`
 }
 
 // DiffSummary provides statistics about a diff.
@@ -140,6 +206,9 @@ type DiffSummary struct {
 
 	// NoChange is the number of resources with no changes.
 	NoChange int `json:"no_change"`
+
+	// Skipped is the number of resources skipped by their condition.
+	Skipped int `json:"skipped,omitempty"`
 }
 
 // Executor executes plans by running the DAG.
@@ -340,8 +409,41 @@ type ScheduleOptions struct {
 
 	// User is the user initiating the execution.
 	User string `json:"user,omitempty"`
+
+	// Strategy selects how units are ordered. Defaults to ScheduleStrategyReadyQueue.
+	Strategy ScheduleStrategy `json:"strategy,omitempty"`
+
+	// ConcurrencyLimits cap the number of concurrent units per host, provider
+	// or label value, in addition to MaxParallel.
+	ConcurrencyLimits []ConcurrencyLimit `json:"concurrency_limits,omitempty"`
+
+	// HandlerFlush controls when notified handler units are executed.
+	// Defaults to HandlerFlushRun.
+	HandlerFlush HandlerFlushMode `json:"handler_flush,omitempty"`
+
+	// Rollout executes per-host units in batches of hosts when set.
+	Rollout *RolloutOptions `json:"rollout,omitempty"`
+
+	// Canary applies the plan to a subset of hosts and gates the rest of the
+	// run on their health when set.
+	Canary *CanaryOptions `json:"canary,omitempty"`
+
+	// RollbackOnFailure executes the compensating plan of the succeeded units
+	// when the run fails.
+	RollbackOnFailure bool `json:"rollback_on_failure,omitempty"`
 }
 
+// HandlerFlushMode controls when notified handler units are executed.
+type HandlerFlushMode string
+
+const (
+	// HandlerFlushRun executes notified handlers after all other units have finished.
+	HandlerFlushRun HandlerFlushMode = "run"
+
+	// HandlerFlushLevel executes notified handlers at the end of their execution level.
+	HandlerFlushLevel HandlerFlushMode = "level"
+)
+
 // BackupManager handles backup and restore operations.
 type BackupManager interface {
 	// Backup creates a backup of all state data.
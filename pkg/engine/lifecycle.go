@@ -0,0 +1,170 @@
+package engine
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// replacedByKey is the plan unit metadata key linking a create-before-destroy
+// delete unit to the unit that creates its replacement.
+const replacedByKey = "replaced_by"
+
+// ignoresChanges reports whether the lifecycle excludes any paths from diffing.
+func (l *Lifecycle) ignoresChanges() bool {
+	return l != nil && len(l.IgnoreChanges) > 0
+}
+
+// isIgnored reports whether a change path is covered by one of the ignored paths.
+func (l *Lifecycle) isIgnored(path string) bool {
+	if !l.ignoresChanges() {
+		return false
+	}
+
+	normalized := normalizeChangePath(path)
+	for _, ignored := range l.IgnoreChanges {
+		ignored = normalizeChangePath(ignored)
+		if ignored == "" {
+			continue
+		}
+		if normalized == ignored || strings.HasPrefix(normalized, ignored+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filterChanges removes changes to ignored paths.
+func (l *Lifecycle) filterChanges(changes []Change) []Change {
+	if !l.ignoresChanges() {
+		return changes
+	}
+
+	filtered := make([]Change, 0, len(changes))
+	for _, change := range changes {
+		if !l.isIgnored(change.Path) {
+			filtered = append(filtered, change)
+		}
+	}
+
+	return filtered
+}
+
+// stripIgnored removes ignored paths from a JSON state so it can be compared
+// without them. The original state is returned if it is not a JSON object.
+func (l *Lifecycle) stripIgnored(state json.RawMessage) json.RawMessage {
+	if !l.ignoresChanges() || len(state) == 0 {
+		return state
+	}
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal(state, &obj); err != nil {
+		return state
+	}
+
+	for _, ignored := range l.IgnoreChanges {
+		ignored = normalizeChangePath(ignored)
+		if ignored == "" {
+			continue
+		}
+		deletePath(obj, strings.Split(ignored, "."))
+	}
+
+	stripped, err := json.Marshal(obj)
+	if err != nil {
+		return state
+	}
+
+	return stripped
+}
+
+// normalizeChangePath strips the leading dot and "config." prefix from a
+// change path so that ".config.version", "config.version" and "version" match.
+func normalizeChangePath(path string) string {
+	path = strings.TrimPrefix(path, ".")
+	path = strings.TrimPrefix(path, "config.")
+	return path
+}
+
+// deletePath removes a nested key from a decoded JSON object.
+func deletePath(obj map[string]interface{}, segments []string) {
+	if len(segments) == 0 {
+		return
+	}
+
+	if len(segments) == 1 {
+		delete(obj, segments[0])
+		return
+	}
+
+	if child, ok := obj[segments[0]].(map[string]interface{}); ok {
+		deletePath(child, segments[1:])
+	}
+}
+
+// newReplacementDestroyUnit creates the delete unit that removes the existing
+// resource after its replacement has been created.
+func newReplacementDestroyUnit(create *PlanUnit) PlanUnit {
+	return PlanUnit{
+		ID:           uuid.New().String(),
+		ResourceID:   create.ResourceID,
+		TargetID:     create.TargetID,
+		Operation:    OperationDelete,
+		Status:       PlanStatusPending,
+		ActualState:  create.ActualState,
+		ProviderName: create.ProviderName,
+		Timeout:      create.Timeout,
+		MaxRetries:   create.MaxRetries,
+		Labels:       create.Labels,
+		Retry:        create.Retry,
+		Lifecycle:    create.Lifecycle,
+		Dependencies: []Dependency{
+			{TargetID: create.ID, Type: DependencyRequire},
+		},
+		Metadata: map[string]interface{}{
+			replacedByKey: create.ID,
+		},
+	}
+}
+
+// isReplacementDestroy reports whether the unit deletes a resource that was
+// replaced using create-before-destroy.
+func isReplacementDestroy(unit *PlanUnit) bool {
+	if unit.Operation != OperationDelete || unit.Metadata == nil {
+		return false
+	}
+	_, ok := unit.Metadata[replacedByKey]
+	return ok
+}
+
+// wireCreateBeforeDestroy makes every create-before-destroy delete unit wait
+// for the units that depend on the replacement, so the old resource is only
+// removed once its dependents have moved over to the new one.
+func wireCreateBeforeDestroy(plan *Plan) {
+	for i := range plan.Units {
+		destroy := &plan.Units[i]
+		if !isReplacementDestroy(destroy) {
+			continue
+		}
+
+		createID, _ := destroy.Metadata[replacedByKey].(string)
+		for j := range plan.Units {
+			unit := &plan.Units[j]
+			if unit.ID == destroy.ID {
+				continue
+			}
+
+			for _, dep := range unit.Dependencies {
+				if dep.TargetID == createID {
+					destroy.Dependencies = append(destroy.Dependencies, Dependency{
+						TargetID: unit.ID,
+						Type:     DependencyOrder,
+					})
+					break
+				}
+			}
+		}
+	}
+}
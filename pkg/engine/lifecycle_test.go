@@ -0,0 +1,270 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// mockPlanProvider is a provider that returns a fixed plan response.
+type mockPlanProvider struct {
+	planResp *PlanResponse
+}
+
+func (m *mockPlanProvider) Init(ctx context.Context, config ProviderConfig) error {
+	return nil
+}
+
+func (m *mockPlanProvider) Read(ctx context.Context, req ReadRequest) (*ReadResponse, error) {
+	return &ReadResponse{State: req.Config, Exists: true}, nil
+}
+
+func (m *mockPlanProvider) Plan(ctx context.Context, req PlanRequest) (*PlanResponse, error) {
+	return m.planResp, nil
+}
+
+func (m *mockPlanProvider) Apply(ctx context.Context, req ApplyRequest) (*ApplyResponse, error) {
+	return &ApplyResponse{NewState: req.DesiredState}, nil
+}
+
+func (m *mockPlanProvider) Destroy(ctx context.Context, req DestroyRequest) (*DestroyResponse, error) {
+	return &DestroyResponse{Success: true}, nil
+}
+
+func (m *mockPlanProvider) Validate(ctx context.Context, config json.RawMessage) error {
+	return nil
+}
+
+func (m *mockPlanProvider) Schema() (*ProviderSchema, error) {
+	return &ProviderSchema{}, nil
+}
+
+func (m *mockPlanProvider) Metadata() ProviderMetadata {
+	return ProviderMetadata{Name: "mock"}
+}
+
+func TestLifecycle_IsIgnored(t *testing.T) {
+	lifecycle := &Lifecycle{IgnoreChanges: []string{"tags.owner", ".config.version"}}
+
+	tests := []struct {
+		path    string
+		ignored bool
+	}{
+		{".config.version", true},
+		{"version", true},
+		{".tags.owner", true},
+		{".tags.owner.email", true},
+		{".tags", false},
+		{".tags.ownership", false},
+		{".name", false},
+	}
+
+	for _, tt := range tests {
+		if got := lifecycle.isIgnored(tt.path); got != tt.ignored {
+			t.Errorf("isIgnored(%q) = %v, expected %v", tt.path, got, tt.ignored)
+		}
+	}
+
+	var nilLifecycle *Lifecycle
+	if nilLifecycle.isIgnored(".version") {
+		t.Error("Expected nil lifecycle to ignore nothing")
+	}
+}
+
+func TestPlanner_ComputeDiff_IgnoreChangesWithoutProvider(t *testing.T) {
+	registry := &mockProviderRegistry{providers: make(map[string]Provider)}
+	stateMgr := newMockStateManager()
+	planner := NewPlanner(registry, stateMgr)
+
+	ctx := context.Background()
+
+	stateMgr.states["db"] = json.RawMessage(`{"size": "large", "tags": {"owner": "alice", "env": "prod"}}`)
+
+	config := &Config{
+		Resources: []Resource{
+			{
+				ID:        "db",
+				Type:      "test.database",
+				Config:    json.RawMessage(`{"size": "large", "tags": {"owner": "bob", "env": "prod"}}`),
+				Lifecycle: &Lifecycle{IgnoreChanges: []string{"tags.owner"}},
+			},
+		},
+	}
+
+	diff, err := planner.ComputeDiff(ctx, config, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if diff.Resources[0].Operation != OperationNoop {
+		t.Errorf("Expected noop when only ignored paths differ, got %s", diff.Resources[0].Operation)
+	}
+}
+
+func TestPlanner_ComputeDiff_IgnoreChangesSuppressesRecreate(t *testing.T) {
+	provider := &mockPlanProvider{
+		planResp: &PlanResponse{
+			Operation: OperationUpdate,
+			Changes: []Change{
+				{Path: ".config.engine_version", Before: "14", After: "15", Action: ChangeActionModify},
+			},
+			RequiresRecreate: true,
+		},
+	}
+	registry := &mockProviderRegistry{providers: map[string]Provider{"test.database": provider}}
+	stateMgr := newMockStateManager()
+	planner := NewPlanner(registry, stateMgr)
+
+	ctx := context.Background()
+
+	stateMgr.states["db"] = json.RawMessage(`{"engine_version": "14"}`)
+
+	config := &Config{
+		Resources: []Resource{
+			{
+				ID:        "db",
+				Type:      "test.database",
+				Config:    json.RawMessage(`{"engine_version": "15"}`),
+				Lifecycle: &Lifecycle{IgnoreChanges: []string{"engine_version"}},
+			},
+		},
+	}
+
+	diff, err := planner.ComputeDiff(ctx, config, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	resourceDiff := diff.Resources[0]
+	if resourceDiff.Operation != OperationNoop {
+		t.Errorf("Expected noop, got %s", resourceDiff.Operation)
+	}
+
+	if resourceDiff.RequiresRecreate {
+		t.Error("Expected ignored changes not to require recreation")
+	}
+}
+
+func TestPlanner_BuildPlan_CreateBeforeDestroy(t *testing.T) {
+	registry := &mockProviderRegistry{providers: make(map[string]Provider)}
+	stateMgr := newMockStateManager()
+	planner := NewPlanner(registry, stateMgr)
+
+	ctx := context.Background()
+
+	diff := &DiffResult{
+		Resources: []ResourceDiff{
+			{
+				ResourceID:   "db",
+				Operation:    OperationRecreate,
+				DesiredState: json.RawMessage(`{"engine_version": "15"}`),
+				ActualState:  json.RawMessage(`{"engine_version": "14"}`),
+				Lifecycle:    &Lifecycle{CreateBeforeDestroy: true},
+			},
+			{
+				ResourceID:   "app",
+				ResourceType: "test.app",
+				Dependencies: []string{"db"},
+				Operation:    OperationUpdate,
+				DesiredState: json.RawMessage(`{"db": "new"}`),
+			},
+		},
+		Timestamp: time.Now(),
+	}
+
+	plan, err := planner.BuildPlan(ctx, diff)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(plan.Units) != 3 {
+		t.Fatalf("Expected 3 plan units, got %d", len(plan.Units))
+	}
+
+	create, destroy, app := plan.Units[0], plan.Units[1], plan.Units[2]
+
+	if create.Operation != OperationCreate {
+		t.Errorf("Expected first unit to create, got %s", create.Operation)
+	}
+
+	if destroy.Operation != OperationDelete || destroy.ResourceID != "db" {
+		t.Errorf("Expected second unit to delete db, got %s of %s", destroy.Operation, destroy.ResourceID)
+	}
+
+	// Dependents must follow the replacement, not the destroy unit
+	if len(app.Dependencies) != 1 || app.Dependencies[0].TargetID != create.ID {
+		t.Errorf("Expected app to depend on the create unit, got %v", app.Dependencies)
+	}
+
+	// The old resource is destroyed after the replacement and its dependents
+	dependsOn := make(map[string]bool)
+	for _, dep := range destroy.Dependencies {
+		dependsOn[dep.TargetID] = true
+	}
+	if !dependsOn[create.ID] || !dependsOn[app.ID] {
+		t.Errorf("Expected destroy to depend on create and app, got %v", destroy.Dependencies)
+	}
+
+	graph, err := planner.BuildDAG(ctx, plan)
+	if err != nil {
+		t.Fatalf("Expected valid DAG, got: %v", err)
+	}
+
+	if graph.Nodes[destroy.ID].Level != 2 {
+		t.Errorf("Expected destroy at level 2, got %d", graph.Nodes[destroy.ID].Level)
+	}
+}
+
+func TestPlanner_ValidatePlan_PreventDestroy(t *testing.T) {
+	registry := &mockProviderRegistry{providers: make(map[string]Provider)}
+	stateMgr := newMockStateManager()
+	planner := NewPlanner(registry, stateMgr)
+
+	ctx := context.Background()
+
+	for _, op := range []OperationType{OperationDelete, OperationRecreate} {
+		plan := &Plan{
+			ID: "plan1",
+			Units: []PlanUnit{
+				{
+					ID:         "unit1",
+					ResourceID: "db",
+					Operation:  op,
+					Status:     PlanStatusPending,
+					Timeout:    time.Minute,
+					Lifecycle:  &Lifecycle{PreventDestroy: true},
+				},
+			},
+		}
+
+		err := planner.ValidatePlan(ctx, plan)
+		if err == nil {
+			t.Errorf("Expected prevent_destroy to reject %s", op)
+			continue
+		}
+
+		if !IsPermanent(err) {
+			t.Errorf("Expected permanent error for %s, got %v", op, err)
+		}
+	}
+
+	// Updates are still allowed
+	plan := &Plan{
+		ID: "plan2",
+		Units: []PlanUnit{
+			{
+				ID:         "unit1",
+				ResourceID: "db",
+				Operation:  OperationUpdate,
+				Status:     PlanStatusPending,
+				Timeout:    time.Minute,
+				Lifecycle:  &Lifecycle{PreventDestroy: true},
+			},
+		},
+	}
+
+	if err := planner.ValidatePlan(ctx, plan); err != nil {
+		t.Errorf("Expected update to pass validation, got: %v", err)
+	}
+}
@@ -123,7 +123,7 @@ func (s *OnboardingService) OnboardHost(ctx context.Context, config *OnboardingC
 	log.Info().Msg("SSH connection established")
 
 	// Step 3: Detect target architecture
-	targetOS, targetArch, err := s.detectTargetArchitecture(ctx, transport)
+	targetOS, targetArch, err := detectTargetArchitecture(ctx, transport)
 	if err != nil {
 		return nil, fmt.Errorf("failed to detect target architecture: %w", err)
 	}
@@ -134,7 +134,7 @@ func (s *OnboardingService) OnboardHost(ctx context.Context, config *OnboardingC
 		Msg("Detected target architecture")
 
 	// Step 3.5: Select appropriate micro-runner binary
-	runnerBinaryPath, err := s.selectRunnerBinary(targetOS, targetArch)
+	runnerBinaryPath, err := selectRunnerBinary(s.runnerBinaryPath, targetOS, targetArch)
 	if err != nil {
 		return nil, fmt.Errorf("failed to select runner binary: %w", err)
 	}
@@ -156,10 +156,11 @@ func (s *OnboardingService) OnboardHost(ctx context.Context, config *OnboardingC
 	}
 
 	// Step 5: Start micro-runner
+	remotePath := newRemoteRunnerPath()
 	runnerClient, err := client.NewClient(&client.Config{
 		Transport:      runnerTransport,
 		RunnerPath:     runnerBinaryPath,
-		RemotePath:     "/tmp/froyo-micro-runner",
+		RemotePath:     remotePath,
 		StartupTimeout: 15 * time.Second,
 	})
 	if err != nil {
@@ -169,12 +170,12 @@ func (s *OnboardingService) OnboardHost(ctx context.Context, config *OnboardingC
 	if err := runnerClient.Start(ctx, &client.Config{
 		Transport:      runnerTransport,
 		RunnerPath:     runnerBinaryPath,
-		RemotePath:     "/tmp/froyo-micro-runner",
+		RemotePath:     remotePath,
 		StartupTimeout: 15 * time.Second,
 	}); err != nil {
 		return nil, fmt.Errorf("failed to start micro-runner: %w", err)
 	}
-	defer runnerClient.Close(ctx, "/tmp/froyo-micro-runner")
+	defer runnerClient.Close(ctx, remotePath)
 
 	log.Info().Msg("Micro-runner started")
 
@@ -485,47 +486,8 @@ func (s *OnboardingService) hardenSSH(ctx context.Context, runner *client.Client
 
 // registerHost stores host information in the database.
 func (s *OnboardingService) registerHost(ctx context.Context, host *Host) error {
-	// Store host as a fact with special namespace
-	labelsJSON, err := json.Marshal(host.Labels)
-	if err != nil {
-		return fmt.Errorf("failed to marshal labels: %w", err)
-	}
-
-	hostDataJSON, err := json.Marshal(host)
-	if err != nil {
-		return fmt.Errorf("failed to marshal host data: %w", err)
-	}
-
-	// Store host metadata
-	hostFact := &stores.Fact{
-		ID:        uuid.New().String(),
-		TargetID:  host.ID,
-		Namespace: "host.metadata",
-		Key:       "info",
-		Value:     string(hostDataJSON),
-		TTL:       0, // No expiry for host metadata
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	}
-
-	if err := s.store.UpsertFact(ctx, hostFact); err != nil {
-		return fmt.Errorf("failed to store host metadata: %w", err)
-	}
-
-	// Store labels separately for easier querying
-	labelsFact := &stores.Fact{
-		ID:        uuid.New().String(),
-		TargetID:  host.ID,
-		Namespace: "host.labels",
-		Key:       "all",
-		Value:     string(labelsJSON),
-		TTL:       0,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	}
-
-	if err := s.store.UpsertFact(ctx, labelsFact); err != nil {
-		return fmt.Errorf("failed to store host labels: %w", err)
+	if err := NewHostRegistry(s.store).AddHost(ctx, host); err != nil {
+		return err
 	}
 
 	// Create audit entry
@@ -648,7 +610,7 @@ func (a *sshTransportAdapter) Cleanup(ctx context.Context, remotePath string) er
 }
 
 // detectTargetArchitecture detects the OS and architecture of the remote host.
-func (s *OnboardingService) detectTargetArchitecture(ctx context.Context, transport *ssh.SSHClient) (string, string, error) {
+func detectTargetArchitecture(ctx context.Context, transport *ssh.SSHClient) (string, string, error) {
 	// Run 'uname -s' to get OS
 	osOutput, _, err := transport.ExecuteCommand(ctx, "uname -s")
 	if err != nil {
@@ -688,10 +650,11 @@ func normalizeArchitecture(arch string) string {
 }
 
 // selectRunnerBinary selects the appropriate micro-runner binary based on target OS and architecture.
-func (s *OnboardingService) selectRunnerBinary(targetOS, targetArch string) (string, error) {
+// Binaries are looked up next to runnerBinaryPath.
+func selectRunnerBinary(runnerBinaryPath, targetOS, targetArch string) (string, error) {
 	// Build the expected binary name
 	binaryName := fmt.Sprintf("micro-runner-%s-%s", targetOS, targetArch)
-	binaryPath := filepath.Join(filepath.Dir(s.runnerBinaryPath), binaryName)
+	binaryPath := filepath.Join(filepath.Dir(runnerBinaryPath), binaryName)
 
 	// Check if the specific binary exists
 	if _, err := os.Stat(binaryPath); err == nil {
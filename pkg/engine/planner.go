@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -19,6 +20,15 @@ type DefaultPlanner struct {
 
 	// stateManager is used to retrieve resource state
 	stateManager StateManager
+
+	// conditionEvaluator evaluates resource when conditions
+	conditionEvaluator ConditionEvaluator
+
+	// hostFacts provides the cached facts conditions are evaluated against
+	hostFacts HostFactsSource
+
+	// hosts lists the hosts resource targets are resolved against
+	hosts HostLister
 }
 
 // NewPlanner creates a new default planner implementation.
@@ -29,6 +39,26 @@ func NewPlanner(registry ProviderRegistry, stateMgr StateManager) *DefaultPlanne
 	}
 }
 
+// SetConditionEvaluator sets the evaluator and the facts source used for
+// resource when conditions. Planning a resource with a condition fails
+// until both are set.
+func (p *DefaultPlanner) SetConditionEvaluator(evaluator ConditionEvaluator, facts HostFactsSource) {
+	p.conditionEvaluator = evaluator
+	p.hostFacts = facts
+}
+
+// SetHostFacts sets the source of cached host facts used to expand for_each
+// declarations over facts.
+func (p *DefaultPlanner) SetHostFacts(facts HostFactsSource) {
+	p.hostFacts = facts
+}
+
+// SetHosts sets the host inventory that resource target selectors are
+// resolved against. Planning a resource with a target fails until it is set.
+func (p *DefaultPlanner) SetHosts(hosts HostLister) {
+	p.hosts = hosts
+}
+
 // ComputeDiff compares desired configuration with actual facts to determine required operations.
 func (p *DefaultPlanner) ComputeDiff(ctx context.Context, desired *Config, actual *Facts) (*DiffResult, error) {
 	if desired == nil {
@@ -36,14 +66,56 @@ func (p *DefaultPlanner) ComputeDiff(ctx context.Context, desired *Config, actua
 			WithCode(ErrCodeValidation)
 	}
 
+	// Expand targeted resources into one instance per host, then expand
+	// for_each declarations into their instances
+	resources, err := p.expandTargets(ctx, desired.Resources)
+	if err != nil {
+		return nil, err
+	}
+
+	resources, err = p.expandResources(ctx, resources)
+	if err != nil {
+		return nil, err
+	}
+
 	result := &DiffResult{
-		Resources: make([]ResourceDiff, 0, len(desired.Resources)),
+		Resources: make([]ResourceDiff, 0, len(resources)),
 		Summary: DiffSummary{
-			TotalResources: len(desired.Resources),
+			TotalResources: len(resources),
 		},
+		Checks:    desired.Checks,
+		Hooks:     desired.Hooks,
 		Timestamp: time.Now(),
 	}
 
+	// Read data sources and substitute their outputs into resource configs
+	if len(desired.DataSources) > 0 {
+		data, outputs, err := p.readDataSources(ctx, desired.DataSources)
+		if err != nil {
+			return nil, err
+		}
+		result.DataSources = outputs
+
+		for i := range resources {
+			if !bytes.Contains(resources[i].Config, []byte("${data.")) {
+				continue
+			}
+
+			config, err := renderConfig(resources[i].Config, data.resolve)
+			if err != nil {
+				return nil, NewPermanentError(
+					fmt.Sprintf("failed to resolve data references of resource %s", resources[i].ID), err).
+					WithCode(ErrCodeValidation)
+			}
+			resources[i].Config = config
+		}
+	}
+
+	// Substitute the facts of each resource's host into its config
+	if err := p.renderFactReferences(ctx, resources); err != nil {
+		return nil, err
+	}
+
 	// Build a map of actual state by resource ID from facts
 	actualStateMap := make(map[string]json.RawMessage)
 	if actual != nil {
@@ -52,7 +124,25 @@ func (p *DefaultPlanner) ComputeDiff(ctx context.Context, desired *Config, actua
 	}
 
 	// Process each desired resource
-	for _, resource := range desired.Resources {
+	for _, resource := range resources {
+		// Leave out resources whose condition does not hold on their host
+		if resource.When != nil {
+			holds, err := p.evaluateCondition(ctx, &resource)
+			if err != nil {
+				return nil, err
+			}
+			if !holds {
+				result.Skipped = append(result.Skipped, SkippedResource{
+					ResourceID: resource.ID,
+					TargetID:   resource.TargetID,
+					Reason:     SkipReasonCondition,
+					Condition:  resource.When.Expression,
+				})
+				result.Summary.Skipped++
+				continue
+			}
+		}
+
 		diff, err := p.computeResourceDiff(ctx, &resource, actualStateMap)
 		if err != nil {
 			return nil, fmt.Errorf("failed to compute diff for resource %s: %w", resource.ID, err)
@@ -78,6 +168,157 @@ func (p *DefaultPlanner) ComputeDiff(ctx context.Context, desired *Config, actua
 	return result, nil
 }
 
+// expandTargets expands resources with a target selector into one instance
+// per selected host of the inventory.
+func (p *DefaultPlanner) expandTargets(ctx context.Context, resources []Resource) ([]Resource, error) {
+	var (
+		hosts  []*Host
+		listed bool
+	)
+	expanded := make([]Resource, 0, len(resources))
+	for i := range resources {
+		resource := &resources[i]
+		if resource.Target.IsEmpty() {
+			expanded = append(expanded, *resource)
+			continue
+		}
+
+		if !listed {
+			if p.hosts == nil {
+				return nil, NewPermanentError(
+					fmt.Sprintf("resource %s has a target but no host inventory is configured", resource.ID), nil).
+					WithCode(ErrCodeValidation)
+			}
+
+			var err error
+			hosts, err = p.hosts.ListHosts(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list hosts: %w", err)
+			}
+			listed = true
+		}
+
+		instances, err := ExpandTargets(resource, hosts)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, instances...)
+	}
+
+	return expanded, nil
+}
+
+// expandResources expands resources with a for_each declaration into their
+// instances. Fact collections are read from the cached facts of each
+// resource's host.
+func (p *DefaultPlanner) expandResources(ctx context.Context, resources []Resource) ([]Resource, error) {
+	expanded := make([]Resource, 0, len(resources))
+	for i := range resources {
+		resource := &resources[i]
+		if resource.ForEach == nil {
+			expanded = append(expanded, *resource)
+			continue
+		}
+
+		var facts map[string]any
+		if resource.ForEach.Fact != "" {
+			if p.hostFacts == nil || resource.TargetID == "" {
+				return nil, NewPermanentError(
+					fmt.Sprintf("resource %s iterates over facts but has no target host or facts source", resource.ID), nil).
+					WithCode(ErrCodeValidation)
+			}
+
+			var err error
+			facts, err = p.hostFacts.GetFacts(ctx, resource.TargetID, nil)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get facts for host %s: %w", resource.TargetID, err)
+			}
+		}
+
+		instances, err := ExpandForEach(resource, facts)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, instances...)
+	}
+
+	return expanded, nil
+}
+
+// renderFactReferences replaces ${facts.<namespace>.<path>} references in
+// resource configs with the cached facts of each resource's host.
+func (p *DefaultPlanner) renderFactReferences(ctx context.Context, resources []Resource) error {
+	hostFacts := make(map[string]map[string]any)
+	for i := range resources {
+		resource := &resources[i]
+		if !bytes.Contains(resource.Config, []byte("${facts.")) {
+			continue
+		}
+
+		if p.hostFacts == nil || resource.TargetID == "" {
+			return NewPermanentError(
+				fmt.Sprintf("resource %s references facts but has no target host or facts source", resource.ID), nil).
+				WithCode(ErrCodeValidation)
+		}
+
+		facts, ok := hostFacts[resource.TargetID]
+		if !ok {
+			var err error
+			facts, err = p.hostFacts.GetFacts(ctx, resource.TargetID, nil)
+			if err != nil {
+				return fmt.Errorf("failed to get facts for host %s: %w", resource.TargetID, err)
+			}
+			hostFacts[resource.TargetID] = facts
+		}
+
+		config, err := renderConfig(resource.Config, factsResolver(facts))
+		if err != nil {
+			return NewPermanentError(
+				fmt.Sprintf("failed to resolve fact references of resource %s", resource.ID), err).
+				WithCode(ErrCodeValidation)
+		}
+		resource.Config = config
+	}
+
+	return nil
+}
+
+// evaluateCondition reports whether the when condition of a resource holds
+// on its host, using the host's cached facts.
+func (p *DefaultPlanner) evaluateCondition(ctx context.Context, resource *Resource) (bool, error) {
+	if p.conditionEvaluator == nil || p.hostFacts == nil {
+		return false, NewPermanentError(
+			fmt.Sprintf("resource %s has a when condition but no condition evaluator is configured", resource.ID), nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	if resource.TargetID == "" {
+		return false, NewPermanentError(
+			fmt.Sprintf("resource %s has a when condition but no target host; add a target selector", resource.ID), nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	facts, err := p.hostFacts.GetFacts(ctx, resource.TargetID, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to get facts for host %s: %w", resource.TargetID, err)
+	}
+	if len(facts) == 0 {
+		return false, NewPermanentError(
+			fmt.Sprintf("resource %s has a when condition but host %s has no cached facts; run 'froyo facts collect' first",
+				resource.ID, resource.TargetID), nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	holds, err := p.conditionEvaluator.EvaluateCondition(ctx, resource.When, facts)
+	if err != nil {
+		return false, NewPermanentError(
+			fmt.Sprintf("failed to evaluate when condition of resource %s on host %s", resource.ID, resource.TargetID), err).
+			WithCode(ErrCodeValidation)
+	}
+
+	return holds, nil
+}
+
 // computeResourceDiff computes the diff for a single resource.
 func (p *DefaultPlanner) computeResourceDiff(
 	ctx context.Context,
@@ -86,9 +327,30 @@ func (p *DefaultPlanner) computeResourceDiff(
 ) (*ResourceDiff, error) {
 	diff := &ResourceDiff{
 		ResourceID:       resource.ID,
+		TargetID:         resource.TargetID,
+		ResourceType:     resource.Type,
+		Labels:           resource.Labels,
+		Dependencies:     resource.Dependencies,
+		NotifiedBy:       resource.NotifiedBy,
 		DesiredState:     resource.Config,
 		Changes:          make([]Change, 0),
 		RequiresRecreate: false,
+		Handler:          resource.Handler,
+		Lifecycle:        resource.Lifecycle,
+		Retry:            resource.Retry,
+		Checks:           resource.Checks,
+		Hooks:            resource.Hooks,
+	}
+
+	// Wait resources have no state and poll their condition on every run
+	if resource.Type == WaitResourceType {
+		wait, err := ParseWaitCondition(resource.Config)
+		if err != nil {
+			return nil, fmt.Errorf("invalid wait resource %s: %w", resource.ID, err)
+		}
+		diff.Operation = OperationCreate
+		diff.Wait = wait
+		return diff, nil
 	}
 
 	// Try to get actual state from state manager
@@ -110,8 +372,8 @@ func (p *DefaultPlanner) computeResourceDiff(
 	// Get the provider to compute detailed diff
 	provider, err := p.providerRegistry.Get(ctx, resource.Type, "latest")
 	if err != nil {
-		// If provider not available, do a simple comparison
-		if p.statesEqual(resource.Config, actualState) {
+		// If provider not available, do a simple comparison without ignored paths
+		if p.statesEqual(resource.Lifecycle.stripIgnored(resource.Config), resource.Lifecycle.stripIgnored(actualState)) {
 			diff.Operation = OperationNoop
 			return diff, nil
 		}
@@ -136,10 +398,17 @@ func (p *DefaultPlanner) computeResourceDiff(
 	}
 
 	diff.Operation = planResp.Operation
-	diff.Changes = planResp.Changes
+	diff.Changes = resource.Lifecycle.filterChanges(planResp.Changes)
 	diff.RequiresRecreate = planResp.RequiresRecreate
 
-	if planResp.RequiresRecreate {
+	// If every change was to an ignored path there is nothing to do
+	if len(planResp.Changes) > 0 && len(diff.Changes) == 0 {
+		diff.Operation = OperationNoop
+		diff.RequiresRecreate = false
+		return diff, nil
+	}
+
+	if diff.RequiresRecreate {
 		diff.Operation = OperationRecreate
 	}
 
@@ -190,64 +459,135 @@ func (p *DefaultPlanner) BuildPlan(ctx context.Context, diff *DiffResult) (*Plan
 			ToDelete:       diff.Summary.ToDelete,
 			ToRecreate:     diff.Summary.ToRecreate,
 			NoChange:       diff.Summary.NoChange,
+			Skipped:        diff.Summary.Skipped,
 		},
-		Metadata: make(map[string]interface{}),
+		Skipped:     diff.Skipped,
+		DataSources: diff.DataSources,
+		Checks:      diff.Checks,
+		Hooks:       diff.Hooks,
+		Metadata:    make(map[string]interface{}),
 	}
 
 	// Create plan units from resource diffs
-	for _, resourceDiff := range diff.Resources {
-		// Skip resources that don't need any changes
-		if resourceDiff.Operation == OperationNoop {
+	resourceDiffs := make(map[string]*ResourceDiff, len(diff.Resources))
+	for i, resourceDiff := range diff.Resources {
+		// Skip resources that don't need any changes. Handlers are always
+		// planned since whether they run is decided by their notifiers.
+		if resourceDiff.Operation == OperationNoop && !resourceDiff.Handler {
 			continue
 		}
 
+		operation := resourceDiff.Operation
+		if operation == OperationNoop {
+			// A triggered handler re-applies its desired state
+			operation = OperationUpdate
+		}
+
 		unit := PlanUnit{
 			ID:           uuid.New().String(),
 			ResourceID:   resourceDiff.ResourceID,
-			Operation:    resourceDiff.Operation,
+			TargetID:     resourceDiff.TargetID,
+			Operation:    operation,
 			Status:       PlanStatusPending,
 			DesiredState: resourceDiff.DesiredState,
 			ActualState:  resourceDiff.ActualState,
 			Changes:      resourceDiff.Changes,
+			ProviderName: resourceDiff.ResourceType,
+			Labels:       resourceDiff.Labels,
 			Timeout:      5 * time.Minute, // Default timeout
 			MaxRetries:   3,                // Default max retries
+			Handler:      resourceDiff.Handler,
+			Lifecycle:    resourceDiff.Lifecycle,
+			Retry:        resourceDiff.Retry,
+			Checks:       resourceDiff.Checks,
+			Hooks:        resourceDiff.Hooks,
+			Wait:         resourceDiff.Wait,
 			Metadata:     make(map[string]interface{}),
 		}
 
-		// Get resource to extract dependencies
-		resource, err := p.stateManager.GetResource(ctx, resourceDiff.ResourceID)
-		if err == nil && resource != nil {
-			// Map resource dependencies to plan unit dependencies
-			unit.Dependencies = p.buildDependencies(ctx, resource.Dependencies, plan.Units)
-			unit.ProviderName = resource.Type
+		// Waits are bounded by their own timeout and are not retried
+		if unit.Wait != nil {
+			unit.Timeout = unit.Wait.timeout()
+			unit.MaxRetries = 0
+		}
+
+		// Apply the declared retry policy
+		if unit.Retry != nil {
+			unit.MaxRetries = unit.Retry.MaxAttempts - 1
+			if unit.Retry.AttemptTimeout > 0 {
+				unit.Timeout = unit.Retry.AttemptTimeout
+			}
+		}
+
+		resourceDiffs[unit.ID] = &diff.Resources[i]
+
+		// Split create-before-destroy recreates into a create followed by a delete
+		if unit.Operation == OperationRecreate &&
+			unit.Lifecycle != nil && unit.Lifecycle.CreateBeforeDestroy {
+			unit.Operation = OperationCreate
+			plan.Units = append(plan.Units, unit, newReplacementDestroyUnit(&unit))
+			continue
 		}
 
 		plan.Units = append(plan.Units, unit)
 	}
 
+	// Map the dependencies declared in the config to plan unit dependencies
+	// once every unit exists, so declaration order does not matter
+	for i := range plan.Units {
+		unit := &plan.Units[i]
+		resourceDiff, ok := resourceDiffs[unit.ID]
+		if !ok {
+			continue
+		}
+
+		unit.Dependencies = p.buildDependencies(ctx, unit.TargetID, resourceDiff.Dependencies, DependencyRequire, plan.Units)
+		unit.Dependencies = append(unit.Dependencies,
+			p.buildDependencies(ctx, unit.TargetID, resourceDiff.NotifiedBy, DependencyNotify, plan.Units)...)
+	}
+
+	// Delay destroying replaced resources until their dependents are done
+	wireCreateBeforeDestroy(plan)
+
 	return plan, nil
 }
 
-// buildDependencies converts resource IDs to plan unit dependencies.
+// buildDependencies converts resource IDs to plan unit dependencies of the given type.
+// A unit on a host depends on the instances of a resource on the same host
+// when there are any, and on all instances of the resource otherwise.
 func (p *DefaultPlanner) buildDependencies(
 	ctx context.Context,
+	targetID string,
 	resourceDeps []string,
+	depType DependencyType,
 	existingUnits []PlanUnit,
 ) []Dependency {
 	deps := make([]Dependency, 0, len(resourceDeps))
 
-	// Build a map of resource ID to plan unit ID
-	resourceToUnit := make(map[string]string)
+	// Build a map of resource ID to plan unit IDs. A dependency on a for_each
+	// or targeted resource is a dependency on every one of its instances.
+	resourceToUnits := make(map[string][]string)
 	for _, unit := range existingUnits {
-		resourceToUnit[unit.ResourceID] = unit.ID
+		// Dependents follow the replacement, not the unit destroying the old resource
+		if isReplacementDestroy(&unit) {
+			continue
+		}
+		for _, address := range resourceAddresses(unit.ResourceID) {
+			resourceToUnits[address] = append(resourceToUnits[address], unit.ID)
+		}
 	}
 
 	// Convert resource dependencies to plan unit dependencies
 	for _, resourceID := range resourceDeps {
-		if unitID, exists := resourceToUnit[resourceID]; exists {
+		unitIDs, ok := resourceToUnits[HostResourceID(resourceID, targetID)]
+		if targetID == "" || !ok {
+			unitIDs = resourceToUnits[resourceID]
+		}
+
+		for _, unitID := range unitIDs {
 			deps = append(deps, Dependency{
 				TargetID: unitID,
-				Type:     DependencyRequire, // Default to required dependency
+				Type:     depType,
 			})
 		}
 	}
@@ -344,6 +684,60 @@ func (p *DefaultPlanner) validatePlanUnit(unit *PlanUnit) error {
 			WithResource(unit.ID)
 	}
 
+	if unit.Retry != nil {
+		if err := unit.Retry.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for i := range unit.Checks {
+		if err := unit.Checks[i].Validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, hooks := range unit.Hooks.all() {
+		for i := range hooks {
+			if err := hooks[i].Validate(); err != nil {
+				return err
+			}
+			if hooks[i].Type == HookRemote && unit.TargetID == "" {
+				return NewPermanentError(
+					fmt.Sprintf("resource %s has remote hook %s but no target host; add a target selector",
+						unit.ResourceID, hooks[i].Name), nil).
+					WithCode(ErrCodeValidation).
+					WithResource(unit.ResourceID)
+			}
+		}
+	}
+
+	if unit.Wait != nil {
+		if err := unit.Wait.Validate(); err != nil {
+			return err
+		}
+		if unit.TargetID == "" {
+			return NewPermanentError(
+				fmt.Sprintf("wait resource %s has no target host; add a target selector", unit.ResourceID), nil).
+				WithCode(ErrCodeValidation).
+				WithResource(unit.ResourceID)
+		}
+	}
+
+	if len(unit.Checks) > 0 && unit.TargetID == "" {
+		return NewPermanentError(
+			fmt.Sprintf("resource %s has checks but no target host; add a target selector", unit.ResourceID), nil).
+			WithCode(ErrCodeValidation).
+			WithResource(unit.ResourceID)
+	}
+
+	if unit.Lifecycle != nil && unit.Lifecycle.PreventDestroy && unit.Operation.IsDestructive() {
+		return NewPermanentError(
+			fmt.Sprintf("resource %s has prevent_destroy set but the plan would %s it",
+				unit.ResourceID, unit.Operation),
+			nil,
+		).WithCode(ErrCodeValidation).WithResource(unit.ResourceID)
+	}
+
 	return nil
 }
 
@@ -391,9 +785,13 @@ func (p *DefaultPlanner) optimizeExecutionOrder(plan *Plan) {
 }
 
 // optimizeTimeouts adjusts timeouts based on operation type.
+// Units with a declared per-attempt timeout and waits are left alone.
 func (p *DefaultPlanner) optimizeTimeouts(plan *Plan) {
 	for i := range plan.Units {
 		unit := &plan.Units[i]
+		if unit.Retry != nil && unit.Retry.AttemptTimeout > 0 || unit.Wait != nil {
+			continue
+		}
 
 		// Adjust timeout based on operation type
 		switch unit.Operation {
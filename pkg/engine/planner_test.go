@@ -3,6 +3,7 @@ package engine
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"testing"
 	"time"
 )
@@ -433,6 +434,271 @@ func TestPlanner_BuildPlan_SkipNoopOperations(t *testing.T) {
 	}
 }
 
+func TestPlanner_BuildPlan_HandlerPlannedWithNotifyDependency(t *testing.T) {
+	registry := &mockProviderRegistry{providers: make(map[string]Provider)}
+	stateMgr := newMockStateManager()
+	planner := NewPlanner(registry, stateMgr)
+
+	ctx := context.Background()
+
+	// The stored state predates the notify declaration, which must still apply
+	stateMgr.resources["nginx_restart"] = &Resource{
+		ID:      "nginx_restart",
+		Type:    "linux.service",
+		Handler: true,
+	}
+
+	diff := &DiffResult{
+		Resources: []ResourceDiff{
+			{
+				ResourceID:   "nginx_restart",
+				ResourceType: "linux.service",
+				Operation:    OperationNoop,
+				DesiredState: json.RawMessage(`{"state": "restarted"}`),
+				Handler:      true,
+				NotifiedBy:   []string{"nginx_conf"},
+			},
+			{
+				ResourceID:   "nginx_conf",
+				Operation:    OperationUpdate,
+				DesiredState: json.RawMessage(`{"content": "new"}`),
+			},
+		},
+		Timestamp: time.Now(),
+	}
+
+	plan, err := planner.BuildPlan(ctx, diff)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Handlers are planned even when their own diff is a noop
+	if len(plan.Units) != 2 {
+		t.Fatalf("Expected 2 plan units, got %d", len(plan.Units))
+	}
+
+	// Handlers may be declared before their notifiers
+	handler, notifier := plan.Units[0], plan.Units[1]
+	if !handler.Handler {
+		t.Error("Expected handler unit to be marked as handler")
+	}
+
+	if handler.ProviderName != "linux.service" {
+		t.Errorf("Expected provider from the config, got %q", handler.ProviderName)
+	}
+
+	if handler.Operation != OperationUpdate {
+		t.Errorf("Expected handler operation update, got %s", handler.Operation)
+	}
+
+	if len(handler.Dependencies) != 1 {
+		t.Fatalf("Expected 1 dependency, got %d", len(handler.Dependencies))
+	}
+
+	if handler.Dependencies[0].Type != DependencyNotify {
+		t.Errorf("Expected notify dependency, got %s", handler.Dependencies[0].Type)
+	}
+
+	if handler.Dependencies[0].TargetID != notifier.ID {
+		t.Error("Expected handler to depend on the notifying unit")
+	}
+}
+
+func TestPlanner_BuildPlan_AppliesRetryPolicy(t *testing.T) {
+	registry := &mockProviderRegistry{providers: make(map[string]Provider)}
+	planner := NewPlanner(registry, newMockStateManager())
+
+	ctx := context.Background()
+
+	diff := &DiffResult{
+		Resources: []ResourceDiff{
+			{
+				ResourceID:   "nginx",
+				Operation:    OperationCreate,
+				DesiredState: json.RawMessage(`{"package": "nginx"}`),
+				Retry: &RetryPolicy{
+					MaxAttempts:    5,
+					Backoff:        BackoffLinear,
+					AttemptTimeout: 90 * time.Second,
+				},
+			},
+		},
+		Timestamp: time.Now(),
+	}
+
+	plan, err := planner.BuildPlan(ctx, diff)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	plan, err = planner.OptimizePlan(ctx, plan)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	unit := plan.Units[0]
+	if unit.MaxRetries != 4 {
+		t.Errorf("Expected 4 retries, got %d", unit.MaxRetries)
+	}
+
+	// The declared attempt timeout survives timeout optimization
+	if unit.Timeout != 90*time.Second {
+		t.Errorf("Expected 90s timeout, got %s", unit.Timeout)
+	}
+}
+
+// mockConditionEvaluator holds a condition when the host's distro fact
+// equals the condition's expression.
+type mockConditionEvaluator struct{}
+
+func (m *mockConditionEvaluator) EvaluateCondition(ctx context.Context, condition *Condition, facts map[string]interface{}) (bool, error) {
+	osFacts, ok := facts["os.basic"].(map[string]interface{})
+	if !ok {
+		return false, fmt.Errorf("missing os.basic facts")
+	}
+	return osFacts["distro"] == condition.Expression, nil
+}
+
+// mockHostFacts serves cached facts by host ID.
+type mockHostFacts map[string]map[string]any
+
+func (m mockHostFacts) GetFacts(ctx context.Context, hostID string, namespace *string) (map[string]any, error) {
+	return m[hostID], nil
+}
+
+func TestPlanner_ComputeDiff_WhenCondition(t *testing.T) {
+	registry := &mockProviderRegistry{providers: make(map[string]Provider)}
+	planner := NewPlanner(registry, newMockStateManager())
+	planner.SetConditionEvaluator(&mockConditionEvaluator{}, mockHostFacts{
+		"rhel1":   {"os.basic": map[string]interface{}{"distro": "rhel"}},
+		"ubuntu1": {"os.basic": map[string]interface{}{"distro": "ubuntu"}},
+	})
+
+	ctx := context.Background()
+
+	config := &Config{
+		ID: "test-config",
+		Resources: []Resource{
+			{
+				ID:       "firewalld-rhel1",
+				Type:     "linux.pkg",
+				Config:   json.RawMessage(`{"package": "firewalld"}`),
+				When:     &Condition{Expression: "rhel"},
+				TargetID: "rhel1",
+			},
+			{
+				ID:       "firewalld-ubuntu1",
+				Type:     "linux.pkg",
+				Config:   json.RawMessage(`{"package": "firewalld"}`),
+				When:     &Condition{Expression: "rhel"},
+				TargetID: "ubuntu1",
+			},
+		},
+	}
+
+	diff, err := planner.ComputeDiff(ctx, config, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(diff.Resources) != 1 || diff.Resources[0].ResourceID != "firewalld-rhel1" {
+		t.Fatalf("Expected only firewalld-rhel1 to be diffed, got %+v", diff.Resources)
+	}
+
+	if diff.Summary.Skipped != 1 || len(diff.Skipped) != 1 {
+		t.Fatalf("Expected 1 skipped resource, got %+v", diff.Skipped)
+	}
+
+	skipped := diff.Skipped[0]
+	if skipped.ResourceID != "firewalld-ubuntu1" || skipped.TargetID != "ubuntu1" || skipped.Reason != SkipReasonCondition {
+		t.Errorf("Unexpected skipped resource: %+v", skipped)
+	}
+
+	// Skipped resources are carried into the plan
+	plan, err := planner.BuildPlan(ctx, diff)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if plan.Summary.Skipped != 1 || len(plan.Skipped) != 1 || len(plan.Units) != 1 {
+		t.Errorf("Expected 1 unit and 1 skipped resource, got %d units and %+v", len(plan.Units), plan.Skipped)
+	}
+}
+
+func TestPlanner_ComputeDiff_WhenConditionWithoutFacts(t *testing.T) {
+	registry := &mockProviderRegistry{providers: make(map[string]Provider)}
+	ctx := context.Background()
+
+	config := &Config{
+		ID: "test-config",
+		Resources: []Resource{
+			{
+				ID:       "firewalld-web1",
+				Type:     "linux.pkg",
+				Config:   json.RawMessage(`{"package": "firewalld"}`),
+				When:     &Condition{Expression: "rhel"},
+				TargetID: "web1",
+			},
+		},
+	}
+
+	// No evaluator configured
+	planner := NewPlanner(registry, newMockStateManager())
+	if _, err := planner.ComputeDiff(ctx, config, nil); err == nil {
+		t.Error("Expected error without a condition evaluator, got nil")
+	}
+
+	// No cached facts for the host
+	planner.SetConditionEvaluator(&mockConditionEvaluator{}, mockHostFacts{})
+	if _, err := planner.ComputeDiff(ctx, config, nil); err == nil {
+		t.Error("Expected error without cached facts, got nil")
+	}
+}
+
+func TestPlanner_ComputeDiff_FactReferences(t *testing.T) {
+	registry := &mockProviderRegistry{providers: make(map[string]Provider)}
+	planner := NewPlanner(registry, newMockStateManager())
+	planner.SetHostFacts(mockHostFacts{
+		"web1": {
+			"os.basic": map[string]interface{}{"hostname": "web1.example.com"},
+			"custom":   map[string]interface{}{"app": map[string]interface{}{"port": float64(8080)}},
+		},
+	})
+
+	ctx := context.Background()
+
+	config := &Config{
+		ID: "test-config",
+		Resources: []Resource{
+			{
+				ID:       "app-config",
+				Type:     "linux.file",
+				Config:   json.RawMessage(`{"port": "${facts.custom.app.port}", "content": "server_name ${facts.os.basic.hostname};"}`),
+				TargetID: "web1",
+			},
+		},
+	}
+
+	diff, err := planner.ComputeDiff(ctx, config, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	var desired map[string]interface{}
+	if err := json.Unmarshal(diff.Resources[0].DesiredState, &desired); err != nil {
+		t.Fatalf("Failed to decode desired state: %v", err)
+	}
+	if desired["port"] != float64(8080) || desired["content"] != "server_name web1.example.com;" {
+		t.Errorf("Expected facts to be substituted, got %v", desired)
+	}
+
+	// Unknown facts fail planning
+	config.Resources[0].Config = json.RawMessage(`{"port": "${facts.custom.db.port}"}`)
+	if _, err := planner.ComputeDiff(ctx, config, nil); err == nil {
+		t.Error("Expected error for an unknown fact, got nil")
+	}
+}
+
 func TestPlanner_BuildDAG_NilPlan(t *testing.T) {
 	registry := &mockProviderRegistry{providers: make(map[string]Provider)}
 	stateMgr := newMockStateManager()
@@ -0,0 +1,284 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// ScheduleStrategy selects how the scheduler orders plan units.
+type ScheduleStrategy string
+
+const (
+	// ScheduleStrategyReadyQueue starts each unit as soon as its own
+	// dependencies have finished, bounded by the worker pool. This is the default.
+	ScheduleStrategyReadyQueue ScheduleStrategy = "ready_queue"
+
+	// ScheduleStrategyLevels executes the DAG level by level, waiting for every
+	// unit in a level before starting the next.
+	ScheduleStrategyLevels ScheduleStrategy = "levels"
+)
+
+// Validate checks if the schedule strategy is valid.
+func (s ScheduleStrategy) Validate() error {
+	switch s {
+	case "", ScheduleStrategyReadyQueue, ScheduleStrategyLevels:
+		return nil
+	default:
+		return NewPermanentError(fmt.Sprintf("invalid schedule strategy: %s", s), nil).
+			WithCode(ErrCodeValidation)
+	}
+}
+
+// executeUnits executes the units in unitMap using the strategy selected in opts.
+func (s *ParallelScheduler) executeUnits(
+	ctx context.Context,
+	run *Run,
+	plan *Plan,
+	unitMap map[string]*PlanUnit,
+	opts ScheduleOptions,
+) error {
+	if opts.Strategy == ScheduleStrategyLevels {
+		return s.executePlanLevels(ctx, run, plan, unitMap, opts)
+	}
+	return s.executeReadyQueue(ctx, run, plan, unitMap, opts)
+}
+
+// executeReadyQueue executes the units in unitMap as their dependencies finish.
+// When flushing handlers at the end of the run, handlers and the units that
+// depend on them are held back until every other unit has finished. When
+// flushing per level, a handler runs as soon as all of its notifiers finish.
+func (s *ParallelScheduler) executeReadyQueue(
+	ctx context.Context,
+	run *Run,
+	plan *Plan,
+	unitMap map[string]*PlanUnit,
+	opts ScheduleOptions,
+) error {
+	if opts.HandlerFlush == HandlerFlushLevel {
+		return s.drainReadyQueue(ctx, run, plan, unitMap, opts)
+	}
+
+	// Split off handlers and everything downstream of them
+	deferred := deferredHandlerClosure(unitMap)
+	regular := make(map[string]*PlanUnit, len(unitMap)-len(deferred))
+	for id, unit := range unitMap {
+		if deferred[id] == nil {
+			regular[id] = unit
+		}
+	}
+
+	if err := s.drainReadyQueue(ctx, run, plan, regular, opts); err != nil {
+		return err
+	}
+
+	if len(deferred) == 0 {
+		return nil
+	}
+
+	if err := s.drainReadyQueue(ctx, run, plan, deferred, opts); err != nil {
+		return fmt.Errorf("handlers failed: %w", err)
+	}
+
+	return nil
+}
+
+// deferredHandlerClosure returns the handler units in unitMap together with
+// every unit that transitively depends on one.
+func deferredHandlerClosure(unitMap map[string]*PlanUnit) map[string]*PlanUnit {
+	deferred := make(map[string]*PlanUnit)
+	for id, unit := range unitMap {
+		if unit.Handler {
+			deferred[id] = unit
+		}
+	}
+
+	// Propagate to dependents until nothing changes
+	for changed := len(deferred) > 0; changed; {
+		changed = false
+		for id, unit := range unitMap {
+			if deferred[id] != nil {
+				continue
+			}
+			for _, dep := range unit.Dependencies {
+				if deferred[dep.TargetID] != nil {
+					deferred[id] = unit
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	return deferred
+}
+
+// drainReadyQueue runs the units in unitMap on a bounded worker pool, starting
+// each one once all of its dependencies inside unitMap are terminal and its
+// concurrency keys have a free slot.
+// Dependencies outside unitMap are expected to have finished already.
+func (s *ParallelScheduler) drainReadyQueue(
+	ctx context.Context,
+	run *Run,
+	plan *Plan,
+	unitMap map[string]*PlanUnit,
+	opts ScheduleOptions,
+) error {
+	if len(unitMap) == 0 {
+		return nil
+	}
+
+	// Count the pending dependencies of each unit and index its dependents
+	waiting := make(map[string]int, len(unitMap))
+	dependents := make(map[string][]string, len(unitMap))
+	for id, unit := range unitMap {
+		seen := make(map[string]bool, len(unit.Dependencies))
+		for _, dep := range unit.Dependencies {
+			if unitMap[dep.TargetID] == nil || seen[dep.TargetID] {
+				continue
+			}
+			seen[dep.TargetID] = true
+			waiting[id]++
+			dependents[dep.TargetID] = append(dependents[dep.TargetID], id)
+		}
+	}
+
+	ready := make([]*PlanUnit, 0, len(unitMap))
+	for id, unit := range unitMap {
+		if waiting[id] == 0 {
+			ready = append(ready, unit)
+		}
+	}
+	sortByExecutionOrder(ready)
+
+	workerCount := s.maxParallel
+	if opts.MaxParallel > 0 && opts.MaxParallel < workerCount {
+		workerCount = opts.MaxParallel
+	}
+
+	limiter := s.currentLimiter()
+	done := make(chan readyQueueResult)
+	running := 0
+	stopped := false
+	var firstErr error
+
+	for len(ready) > 0 || running > 0 {
+		// Start as many ready units as there are free workers and concurrency slots
+		for !stopped && running < workerCount {
+			i := limiter.admit(ready)
+			if i < 0 {
+				break
+			}
+			unit := ready[i]
+			ready = append(ready[:i], ready[i+1:]...)
+			running++
+
+			go func(unit *PlanUnit) {
+				err := s.runReadyUnit(ctx, run, unit, opts)
+				limiter.release(unit)
+				done <- readyQueueResult{unit: unit, err: err}
+			}(unit)
+		}
+
+		if running == 0 {
+			break
+		}
+
+		var result readyQueueResult
+		select {
+		case result = <-done:
+		case <-ctx.Done():
+			stopped = true
+			result = <-done
+		}
+		running--
+
+		if result.err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("unit %s failed: %w", result.unit.ID, result.err)
+			}
+			if opts.FailFast {
+				stopped = true
+			}
+		}
+
+		// Release dependents whose dependencies are now all terminal
+		released := make([]*PlanUnit, 0)
+		for _, id := range dependents[result.unit.ID] {
+			waiting[id]--
+			if waiting[id] == 0 {
+				released = append(released, unitMap[id])
+			}
+		}
+		sortByExecutionOrder(released)
+		ready = append(ready, released...)
+	}
+
+	if ctx.Err() != nil {
+		return s.handleCancellation(ctx, run, plan)
+	}
+
+	if opts.FailFast {
+		if stopped {
+			// Units that were ready or still waiting never start
+			s.mu.Lock()
+			for id := range unitMap {
+				status := s.unitStatus[id]
+				if status == PlanStatusPending || status == PlanStatusBlocked {
+					s.unitStatus[id] = PlanStatusCancelled
+				}
+			}
+			s.mu.Unlock()
+		}
+		return firstErr
+	}
+
+	return nil
+}
+
+// readyQueueResult reports a finished unit to the ready-queue loop.
+type readyQueueResult struct {
+	unit *PlanUnit
+	err  error
+}
+
+// runReadyUnit executes a unit whose dependencies are terminal, skipping it
+// when a required dependency failed or, for handlers, when nothing notified it.
+// Units are cancelled instead once a hook aborted the run.
+func (s *ParallelScheduler) runReadyUnit(
+	ctx context.Context,
+	run *Run,
+	unit *PlanUnit,
+	opts ScheduleOptions,
+) error {
+	// Cancel the remaining units once a hook aborted the run
+	if s.abortError() != nil {
+		s.updateUnitStatus(unit.ID, PlanStatusCancelled)
+		return nil
+	}
+
+	if !s.checkDependencies(unit) {
+		s.markUnitSkipped(unit, "Dependencies failed")
+		return nil
+	}
+
+	if unit.Handler && !s.isNotified(unit) {
+		s.markHandlerNotNotified(unit)
+		s.publishEvent(ctx, run.ID, unit.ID, EventTypeInfo,
+			fmt.Sprintf("Handler %s not notified, skipping", unit.ResourceID), "info")
+		return nil
+	}
+
+	return s.executeUnit(ctx, run, unit, opts)
+}
+
+// sortByExecutionOrder sorts units by their topological order so that the
+// ready queue starts units deterministically.
+func sortByExecutionOrder(units []*PlanUnit) {
+	sort.SliceStable(units, func(i, j int) bool {
+		if units[i].ExecutionOrder != units[j].ExecutionOrder {
+			return units[i].ExecutionOrder < units[j].ExecutionOrder
+		}
+		return units[i].ID < units[j].ID
+	})
+}
@@ -0,0 +1,142 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// BackoffCurve determines how the delay between retry attempts grows.
+type BackoffCurve string
+
+const (
+	// BackoffConstant waits the initial delay before every retry.
+	BackoffConstant BackoffCurve = "constant"
+
+	// BackoffLinear grows the delay by the initial delay on every retry.
+	BackoffLinear BackoffCurve = "linear"
+
+	// BackoffExponential doubles the delay on every retry. This is the default.
+	BackoffExponential BackoffCurve = "exponential"
+)
+
+// defaultRetryInitialDelay is used when a retry policy has no initial delay.
+const defaultRetryInitialDelay = time.Second
+
+// RetryPolicy declares how a plan unit is retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int `json:"max_attempts"`
+
+	// Backoff is the delay curve between attempts. Defaults to BackoffExponential.
+	Backoff BackoffCurve `json:"backoff,omitempty"`
+
+	// InitialDelay is the delay before the first retry. Defaults to one second.
+	InitialDelay time.Duration `json:"initial_delay,omitempty"`
+
+	// MaxDelay caps the delay between attempts. Zero means no cap.
+	MaxDelay time.Duration `json:"max_delay,omitempty"`
+
+	// RetryOn lists the error classes that are retried. When empty, transient,
+	// throttled and conflict errors are retried.
+	RetryOn []ErrorClass `json:"retry_on,omitempty"`
+
+	// AttemptTimeout is the maximum duration of each attempt. Zero keeps the
+	// planner's timeout for the operation.
+	AttemptTimeout time.Duration `json:"attempt_timeout,omitempty"`
+}
+
+// Validate checks that the retry policy is consistent.
+func (r *RetryPolicy) Validate() error {
+	if r.MaxAttempts < 1 {
+		return NewPermanentError("retry max attempts must be at least 1", nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	switch r.Backoff {
+	case "", BackoffConstant, BackoffLinear, BackoffExponential:
+	default:
+		return NewPermanentError(fmt.Sprintf("invalid retry backoff: %s", r.Backoff), nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	if r.InitialDelay < 0 || r.MaxDelay < 0 || r.AttemptTimeout < 0 {
+		return NewPermanentError("retry delays and timeouts cannot be negative", nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	for _, class := range r.RetryOn {
+		switch class {
+		case ErrorClassTransient, ErrorClassThrottled, ErrorClassConflict, ErrorClassPermanent:
+		default:
+			return NewPermanentError(fmt.Sprintf("invalid retryable error class: %s", class), nil).
+				WithCode(ErrCodeValidation)
+		}
+	}
+
+	return nil
+}
+
+// Delay returns the delay before the retry following the given zero-based attempt.
+func (r *RetryPolicy) Delay(attempt int) time.Duration {
+	initial := r.InitialDelay
+	if initial <= 0 {
+		initial = defaultRetryInitialDelay
+	}
+
+	var delay time.Duration
+	switch r.Backoff {
+	case BackoffConstant:
+		delay = initial
+	case BackoffLinear:
+		delay = initial * time.Duration(attempt+1)
+	default:
+		// Cap before shifting, since a shifted delay can overflow to any value
+		limit := r.MaxDelay
+		if limit <= 0 {
+			limit = time.Duration(math.MaxInt64)
+		}
+		if attempt >= 63 || initial > limit>>attempt {
+			delay = limit
+		} else {
+			delay = initial << attempt
+		}
+	}
+
+	if r.MaxDelay > 0 && delay > r.MaxDelay {
+		delay = r.MaxDelay
+	}
+
+	return delay
+}
+
+// Retries reports whether the policy retries the given error.
+// A nil error is a failed result without an error and is always retried.
+// An attempt that ran out of time counts as a transient error.
+func (r *RetryPolicy) Retries(err error) bool {
+	if err == nil {
+		return true
+	}
+
+	class := ErrorClassPermanent
+	var engineErr *EngineError
+	if errors.As(err, &engineErr) {
+		class = engineErr.Class
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		class = ErrorClassTransient
+	}
+
+	if len(r.RetryOn) == 0 {
+		return class != ErrorClassPermanent
+	}
+
+	for _, retryable := range r.RetryOn {
+		if retryable == class {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,163 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		delays []time.Duration
+	}{
+		{
+			name:   "constant",
+			policy: RetryPolicy{Backoff: BackoffConstant, InitialDelay: 2 * time.Second},
+			delays: []time.Duration{2 * time.Second, 2 * time.Second, 2 * time.Second},
+		},
+		{
+			name:   "linear",
+			policy: RetryPolicy{Backoff: BackoffLinear, InitialDelay: time.Second},
+			delays: []time.Duration{time.Second, 2 * time.Second, 3 * time.Second},
+		},
+		{
+			name:   "exponential with cap",
+			policy: RetryPolicy{InitialDelay: time.Second, MaxDelay: 3 * time.Second},
+			delays: []time.Duration{time.Second, 2 * time.Second, 3 * time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for attempt, want := range tt.delays {
+				if got := tt.policy.Delay(attempt); got != want {
+					t.Errorf("Delay(%d) = %s, expected %s", attempt, got, want)
+				}
+			}
+		})
+	}
+
+	// Large attempt counts must not overflow into negative delays
+	policy := RetryPolicy{}
+	if delay := policy.Delay(100); delay <= 0 {
+		t.Errorf("Expected positive delay for large attempt, got %s", delay)
+	}
+
+	// Shifts that drop bits must still be capped rather than wrap to a short delay
+	capped := RetryPolicy{InitialDelay: time.Duration(1<<33 + 1), MaxDelay: time.Hour}
+	for attempt := 9; attempt < 70; attempt++ {
+		if delay := capped.Delay(attempt); delay != time.Hour {
+			t.Fatalf("Delay(%d) = %s, expected %s", attempt, delay, time.Hour)
+		}
+	}
+}
+
+func TestRetryPolicy_Retries(t *testing.T) {
+	throttledOnly := &RetryPolicy{MaxAttempts: 3, RetryOn: []ErrorClass{ErrorClassThrottled}}
+	defaults := &RetryPolicy{MaxAttempts: 3}
+
+	if !throttledOnly.Retries(NewThrottledError("rate limited", nil)) {
+		t.Error("Expected throttled error to be retried")
+	}
+	if throttledOnly.Retries(NewTransientError("connection reset", nil)) {
+		t.Error("Expected transient error not to be retried when only throttled is listed")
+	}
+	if !defaults.Retries(fmt.Errorf("wrapped: %w", NewConflictError("locked", nil))) {
+		t.Error("Expected wrapped conflict error to be retried by default")
+	}
+	if defaults.Retries(NewPermanentError("bad config", nil)) {
+		t.Error("Expected permanent error not to be retried by default")
+	}
+	if !defaults.Retries(context.DeadlineExceeded) {
+		t.Error("Expected attempt timeout to be retried")
+	}
+}
+
+func TestRetryPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		wantErr bool
+	}{
+		{"valid", RetryPolicy{MaxAttempts: 3, Backoff: BackoffLinear, RetryOn: []ErrorClass{ErrorClassTransient}}, false},
+		{"zero attempts", RetryPolicy{}, true},
+		{"unknown backoff", RetryPolicy{MaxAttempts: 1, Backoff: "fibonacci"}, true},
+		{"unknown class", RetryPolicy{MaxAttempts: 1, RetryOn: []ErrorClass{"fatal"}}, true},
+		{"negative delay", RetryPolicy{MaxAttempts: 1, MaxDelay: -time.Second}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScheduler_RetryPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		retry      *RetryPolicy
+		executions int
+		events     int
+	}{
+		{
+			name:       "retries up to max attempts",
+			retry:      &RetryPolicy{MaxAttempts: 3, Backoff: BackoffConstant, InitialDelay: time.Millisecond},
+			executions: 3,
+			events:     2,
+		},
+		{
+			name: "does not retry unlisted error classes",
+			retry: &RetryPolicy{
+				MaxAttempts:  3,
+				InitialDelay: time.Millisecond,
+				RetryOn:      []ErrorClass{ErrorClassThrottled},
+			},
+			executions: 1,
+			events:     0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := newMockExecutor()
+			executor.failUnits["c0-0"] = true
+			publisher := newMockEventPublisher()
+			scheduler := NewParallelScheduler(5, executor, publisher, newMockStateManager())
+
+			plan := newChainPlan(t, 1, 1)
+			plan.Units[0].Retry = tt.retry
+			plan.Units[0].MaxRetries = tt.retry.MaxAttempts - 1
+
+			if _, err := scheduler.Schedule(context.Background(), plan, ScheduleOptions{}); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			// Wait for execution to complete
+			time.Sleep(200 * time.Millisecond)
+
+			if count := countExecutions(executor, "c0-0"); count != tt.executions {
+				t.Errorf("Expected %d executions, got %d", tt.executions, count)
+			}
+
+			retries := 0
+			for _, event := range publisher.getEvents() {
+				if event.Type == EventTypePlanUnitRetrying {
+					retries++
+					if event.Details["error_class"] != ErrorClassTransient {
+						t.Errorf("Expected transient error class in retry event, got %v", event.Details["error_class"])
+					}
+				}
+			}
+			if retries != tt.events {
+				t.Errorf("Expected %d retry events, got %d", tt.events, retries)
+			}
+		})
+	}
+}
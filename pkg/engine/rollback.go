@@ -0,0 +1,283 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// rollbackOfKey is the plan unit metadata key linking a compensating unit to
+// the unit it undoes.
+const rollbackOfKey = "rollback_of"
+
+// rollbackPlanIDKey is the run metadata key recording the ID of the plan that
+// rolled the run back.
+const rollbackPlanIDKey = "rollback_plan_id"
+
+// rollbackRunIDKey is the run metadata key recording the ID of the run that
+// rolled the run back, when it was rolled back after finishing.
+const rollbackRunIDKey = "rollback_run_id"
+
+// newRollbackUnit creates the unit that undoes a completed unit using the
+// state captured before it ran. It returns false when the unit changed
+// nothing or there is no prior state to restore. A recreate is undone by a
+// recreate, since the change could not be applied in place either way.
+func newRollbackUnit(unit *PlanUnit) (PlanUnit, bool) {
+	rollback := PlanUnit{
+		ID:              uuid.New().String(),
+		ResourceID:      unit.ResourceID,
+		TargetID:        unit.TargetID,
+		Status:          PlanStatusPending,
+		ProviderName:    unit.ProviderName,
+		ProviderVersion: unit.ProviderVersion,
+		Timeout:         unit.Timeout,
+		MaxRetries:      unit.MaxRetries,
+		Labels:          unit.Labels,
+		Retry:           unit.Retry,
+		Metadata: map[string]interface{}{
+			rollbackOfKey: unit.ID,
+		},
+	}
+
+	switch unit.Operation {
+	case OperationCreate:
+		// Delete the resource that was created
+		rollback.Operation = OperationDelete
+		rollback.ActualState = unit.DesiredState
+		if unit.Result != nil && len(unit.Result.NewState) > 0 {
+			rollback.ActualState = unit.Result.NewState
+		}
+
+	case OperationUpdate, OperationRecreate:
+		// Re-apply the previous state the same way it was replaced
+		if len(unit.ActualState) == 0 {
+			return PlanUnit{}, false
+		}
+		rollback.Operation = unit.Operation
+		rollback.DesiredState = unit.ActualState
+		rollback.ActualState = unit.DesiredState
+
+	case OperationDelete:
+		// Recreate the deleted resource from its previous state
+		if len(unit.ActualState) == 0 {
+			return PlanUnit{}, false
+		}
+		rollback.Operation = OperationCreate
+		rollback.DesiredState = unit.ActualState
+
+	default:
+		return PlanUnit{}, false
+	}
+
+	return rollback, true
+}
+
+// BuildRollbackPlan builds the compensating plan of an executed plan from the
+// pre-run state of every mutating unit that succeeded and changed its target:
+// updated resources get their old state re-applied, created resources are
+// deleted and deleted resources are recreated, in reverse dependency order.
+func BuildRollbackPlan(plan *Plan) (*Plan, error) {
+	if plan == nil {
+		return nil, NewPermanentError("plan is nil", nil).WithCode(ErrCodeValidation)
+	}
+
+	succeeded := make([]*PlanUnit, 0, len(plan.Units))
+	for i := range plan.Units {
+		unit := &plan.Units[i]
+		if unit.Result != nil && unit.Result.Status == PlanStatusSucceeded {
+			succeeded = append(succeeded, unit)
+		}
+	}
+
+	return buildRollbackPlan(plan.ID, succeeded)
+}
+
+// buildRollbackPlan builds a compensating plan for the given completed units,
+// skipping units that do not mutate anything, waits, which only poll, and
+// units whose result reports no change. Dependencies are reversed,
+// so a unit is undone only after everything that depended on it has been undone.
+func buildRollbackPlan(planID string, units []*PlanUnit) (*Plan, error) {
+	rollbackIDs := make(map[string]string, len(units))
+	rollbackUnits := make([]PlanUnit, 0, len(units))
+
+	// Step 1: Create a compensating unit for each completed unit
+	for _, unit := range units {
+		if !unit.Operation.IsMutating() || unit.Wait != nil || (unit.Result != nil && !unit.Result.Changed) {
+			continue
+		}
+
+		rollback, ok := newRollbackUnit(unit)
+		if !ok {
+			continue
+		}
+		rollbackIDs[unit.ID] = rollback.ID
+		rollbackUnits = append(rollbackUnits, rollback)
+	}
+
+	// Step 2: Reverse the dependencies between rolled back units
+	index := make(map[string]int, len(rollbackUnits))
+	for i := range rollbackUnits {
+		index[rollbackUnits[i].ID] = i
+	}
+
+	for _, unit := range units {
+		dependentRollback, ok := rollbackIDs[unit.ID]
+		if !ok {
+			continue
+		}
+
+		for _, dep := range unit.Dependencies {
+			dependencyRollback, ok := rollbackIDs[dep.TargetID]
+			if !ok {
+				continue
+			}
+
+			target := &rollbackUnits[index[dependencyRollback]]
+			target.Dependencies = append(target.Dependencies, Dependency{
+				TargetID: dependentRollback,
+				Type:     DependencyRequire,
+			})
+		}
+	}
+
+	// Step 3: Build the execution graph
+	graph, err := NewDAGBuilder().BuildGraph(rollbackUnits)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Plan{
+		ID:        uuid.New().String(),
+		CreatedAt: time.Now(),
+		Units:     rollbackUnits,
+		Graph:     graph,
+		Metadata: map[string]interface{}{
+			rollbackOfKey: planID,
+		},
+	}, nil
+}
+
+// rollbackUnits executes a compensating plan for the succeeded units among
+// the given ones. The rollback plan ID is recorded in the run metadata.
+func (s *ParallelScheduler) rollbackUnits(
+	ctx context.Context,
+	run *Run,
+	plan *Plan,
+	units map[string]*PlanUnit,
+	opts ScheduleOptions,
+) error {
+	// Roll back even when a hook aborted the run; the caller has the abort error
+	s.takeAbortError()
+
+	// Collect succeeded units in plan order
+	s.mu.RLock()
+	succeeded := make([]*PlanUnit, 0, len(units))
+	for i := range plan.Units {
+		unit := &plan.Units[i]
+		if units[unit.ID] != nil && s.unitStatus[unit.ID] == PlanStatusSucceeded {
+			succeeded = append(succeeded, unit)
+		}
+	}
+	s.mu.RUnlock()
+
+	rollbackPlan, err := buildRollbackPlan(plan.ID, succeeded)
+	if err != nil {
+		return fmt.Errorf("failed to build rollback plan: %w", err)
+	}
+
+	if len(rollbackPlan.Units) == 0 {
+		return nil
+	}
+
+	s.publishEvent(ctx, run.ID, "", EventTypeWarning,
+		fmt.Sprintf("Rolling back %d units", len(rollbackPlan.Units)), "warning")
+
+	s.mu.Lock()
+	for _, unit := range rollbackPlan.Units {
+		s.unitStatus[unit.ID] = PlanStatusPending
+	}
+	s.mu.Unlock()
+
+	run.Metadata[rollbackPlanIDKey] = rollbackPlan.ID
+
+	// Roll back everything that can be, regardless of the run's fail-fast setting
+	rollbackOpts := ScheduleOptions{
+		MaxParallel:       opts.MaxParallel,
+		DryRun:            opts.DryRun,
+		Strategy:          opts.Strategy,
+		ConcurrencyLimits: opts.ConcurrencyLimits,
+		User:              opts.User,
+	}
+	if err := s.executeUnits(ctx, run, rollbackPlan, buildUnitMap(rollbackPlan, nil), rollbackOpts); err != nil {
+		return err
+	}
+
+	// Report units that could not be rolled back
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, unit := range rollbackPlan.Units {
+		if s.unitStatus[unit.ID] != PlanStatusSucceeded {
+			return fmt.Errorf("failed to roll back %s", unit.ResourceID)
+		}
+	}
+
+	return nil
+}
+
+// Rollback schedules the compensating plan of a finished run, undoing the
+// units that succeeded in it. The run's plan must have been saved with its
+// unit results, which the scheduler does when a run finishes. It returns the
+// ID of the rollback run.
+func (s *ParallelScheduler) Rollback(ctx context.Context, runID string, opts ScheduleOptions) (string, error) {
+	run, err := s.stateManager.GetRun(ctx, runID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get run: %w", err)
+	}
+
+	if !run.Status.IsTerminal() {
+		return "", NewPermanentError(fmt.Sprintf("run %s is still %s", runID, run.Status), nil).
+			WithCode(ErrCodeConflict)
+	}
+
+	if planID, ok := run.Metadata[rollbackPlanIDKey]; ok {
+		return "", NewPermanentError(fmt.Sprintf("run %s was already rolled back by plan %v", runID, planID), nil).
+			WithCode(ErrCodeConflict)
+	}
+
+	plan, err := s.stateManager.GetPlan(ctx, run.PlanID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get plan: %w", err)
+	}
+
+	rollbackPlan, err := BuildRollbackPlan(plan)
+	if err != nil {
+		return "", fmt.Errorf("failed to build rollback plan: %w", err)
+	}
+
+	if len(rollbackPlan.Units) == 0 {
+		return "", NewPermanentError(fmt.Sprintf("run %s changed nothing that can be rolled back", runID), nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	if err := s.stateManager.SavePlan(ctx, rollbackPlan); err != nil {
+		return "", fmt.Errorf("failed to save rollback plan: %w", err)
+	}
+
+	// A failed rollback is not rolled back in turn
+	opts.RollbackOnFailure = false
+
+	rollbackRunID, err := s.Schedule(ctx, rollbackPlan, opts)
+	if err != nil {
+		return "", err
+	}
+
+	run.Metadata[rollbackPlanIDKey] = rollbackPlan.ID
+	run.Metadata[rollbackRunIDKey] = rollbackRunID
+	if err := s.stateManager.SaveRun(ctx, run); err != nil {
+		return "", fmt.Errorf("failed to save run: %w", err)
+	}
+
+	return rollbackRunID, nil
+}
@@ -0,0 +1,222 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestBuildRollbackPlan(t *testing.T) {
+	pkg := &PlanUnit{
+		ID:           "pkg",
+		ResourceID:   "nginx_pkg",
+		Operation:    OperationCreate,
+		DesiredState: json.RawMessage(`{"name": "nginx"}`),
+	}
+	conf := &PlanUnit{
+		ID:           "conf",
+		ResourceID:   "nginx_conf",
+		Operation:    OperationUpdate,
+		ActualState:  json.RawMessage(`{"workers": 2}`),
+		DesiredState: json.RawMessage(`{"workers": 4}`),
+		Dependencies: []Dependency{{TargetID: "pkg", Type: DependencyRequire}},
+	}
+	noop := &PlanUnit{ID: "noop", ResourceID: "motd", Operation: OperationNoop}
+	db := &PlanUnit{
+		ID:           "db",
+		ResourceID:   "db",
+		Operation:    OperationRecreate,
+		ActualState:  json.RawMessage(`{"engine": "14"}`),
+		DesiredState: json.RawMessage(`{"engine": "15"}`),
+	}
+
+	plan, err := buildRollbackPlan("plan1", []*PlanUnit{pkg, conf, noop, db})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(plan.Units) != 3 {
+		t.Fatalf("Expected 3 rollback units, got %d", len(plan.Units))
+	}
+
+	undoPkg, undoConf, undoDB := plan.Units[0], plan.Units[1], plan.Units[2]
+
+	// A recreate cannot be undone in place either
+	if undoDB.Operation != OperationRecreate || string(undoDB.DesiredState) != `{"engine": "14"}` {
+		t.Errorf("Expected db to be recreated with its old state, got %s to %s", undoDB.Operation, undoDB.DesiredState)
+	}
+
+	if undoPkg.Operation != OperationDelete {
+		t.Errorf("Expected created package to be deleted, got %s", undoPkg.Operation)
+	}
+
+	if undoConf.Operation != OperationUpdate || string(undoConf.DesiredState) != `{"workers": 2}` {
+		t.Errorf("Expected config to be restored, got %s to %s", undoConf.Operation, undoConf.DesiredState)
+	}
+
+	// The package is removed only after its config is restored
+	if len(undoPkg.Dependencies) != 1 || undoPkg.Dependencies[0].TargetID != undoConf.ID {
+		t.Errorf("Expected package rollback to depend on config rollback, got %v", undoPkg.Dependencies)
+	}
+
+	if plan.Graph.Nodes[undoPkg.ID].Level != 1 {
+		t.Errorf("Expected package rollback at level 1, got %d", plan.Graph.Nodes[undoPkg.ID].Level)
+	}
+}
+
+func TestBuildRollbackPlan_SkipsWaits(t *testing.T) {
+	pkg := &PlanUnit{
+		ID:           "pkg",
+		ResourceID:   "app_pkg",
+		Operation:    OperationCreate,
+		DesiredState: json.RawMessage(`{"name": "app"}`),
+	}
+	ready := &PlanUnit{
+		ID:           "ready",
+		ResourceID:   "app_ready",
+		Operation:    OperationCreate,
+		Wait:         &WaitCondition{Type: WaitPort, Port: 8080},
+		Dependencies: []Dependency{{TargetID: "pkg", Type: DependencyRequire}},
+	}
+
+	plan, err := buildRollbackPlan("plan1", []*PlanUnit{pkg, ready})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// A wait changed nothing, so only the package is removed
+	if len(plan.Units) != 1 || plan.Units[0].ResourceID != "app_pkg" {
+		t.Fatalf("Expected only the package to be rolled back, got %+v", plan.Units)
+	}
+}
+
+func TestBuildRollbackPlan_FromExecutedPlan(t *testing.T) {
+	plan := newHostPlan(t, "web1", "web2", "web3")
+	for i := range plan.Units {
+		plan.Units[i].ActualState = json.RawMessage(`{"version": "1.0"}`)
+	}
+
+	// web1 was changed, web2 was already up to date and web3 failed
+	plan.Units[0].Result = &ExecutionResult{Status: PlanStatusSucceeded, Changed: true}
+	plan.Units[1].Result = &ExecutionResult{Status: PlanStatusSucceeded}
+	plan.Units[2].Result = &ExecutionResult{Status: PlanStatusFailed}
+
+	rollbackPlan, err := BuildRollbackPlan(plan)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(rollbackPlan.Units) != 1 || rollbackPlan.Units[0].TargetID != "web1" {
+		t.Fatalf("Expected only web1 to be rolled back, got %v", rollbackPlan.Units)
+	}
+
+	if rollbackPlan.Metadata[rollbackOfKey] != plan.ID {
+		t.Errorf("Expected rollback plan to reference plan %s, got %v", plan.ID, rollbackPlan.Metadata[rollbackOfKey])
+	}
+
+	if _, err := BuildRollbackPlan(nil); err == nil {
+		t.Error("Expected error for nil plan, got nil")
+	}
+}
+
+func TestScheduler_RollbackOnFailure(t *testing.T) {
+	executor := newMockExecutor()
+	executor.failUnits["web2-pkg"] = true
+	executor.unchangedUnits["web3-pkg"] = true
+	stateMgr := newMockStateManager()
+	scheduler := NewParallelScheduler(5, executor, newMockEventPublisher(), stateMgr)
+
+	ctx := context.Background()
+	plan := newHostPlan(t, "web1", "web2", "web3")
+	for i := range plan.Units {
+		plan.Units[i].ActualState = json.RawMessage(`{"version": "1.0"}`)
+		plan.Units[i].DesiredState = json.RawMessage(`{"version": "2.0"}`)
+	}
+
+	runID, err := scheduler.Schedule(ctx, plan, ScheduleOptions{RollbackOnFailure: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(200 * time.Millisecond)
+
+	// web1 ran and was rolled back, web2 failed and web3 was already up to date
+	if count := countExecutions(executor, "web2-pkg"); count != 1 {
+		t.Errorf("Expected web2 to run once, got %d", count)
+	}
+
+	executor.mu.Lock()
+	executed := len(executor.executedUnits)
+	executor.mu.Unlock()
+	if executed != 4 {
+		t.Errorf("Expected 3 executions and 1 rollback, got %d", executed)
+	}
+
+	run, err := stateMgr.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("Failed to get run: %v", err)
+	}
+
+	if _, ok := run.Metadata[rollbackPlanIDKey]; !ok {
+		t.Error("Expected rollback plan ID in run metadata")
+	}
+
+	if run.Summary.Failed != 1 {
+		t.Errorf("Expected 1 failed unit, got %d", run.Summary.Failed)
+	}
+}
+
+func TestScheduler_Rollback(t *testing.T) {
+	executor := newMockExecutor()
+	stateMgr := newMockStateManager()
+	scheduler := NewParallelScheduler(5, executor, newMockEventPublisher(), stateMgr)
+
+	ctx := context.Background()
+	plan := newHostPlan(t, "web1", "web2")
+	for i := range plan.Units {
+		plan.Units[i].ActualState = json.RawMessage(`{"version": "1.0"}`)
+		plan.Units[i].DesiredState = json.RawMessage(`{"version": "2.0"}`)
+	}
+
+	runID, err := scheduler.Schedule(ctx, plan, ScheduleOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(200 * time.Millisecond)
+
+	rollbackRunID, err := scheduler.Rollback(ctx, runID, ScheduleOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for the rollback to complete
+	time.Sleep(200 * time.Millisecond)
+
+	rollbackRun, err := stateMgr.GetRun(ctx, rollbackRunID)
+	if err != nil {
+		t.Fatalf("Failed to get rollback run: %v", err)
+	}
+
+	if rollbackRun.Status != RunStatusSucceeded || rollbackRun.Summary.Succeeded != 2 {
+		t.Errorf("Expected 2 units rolled back, got status %s with %d succeeded",
+			rollbackRun.Status, rollbackRun.Summary.Succeeded)
+	}
+
+	run, err := stateMgr.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("Failed to get run: %v", err)
+	}
+
+	if run.Metadata[rollbackRunIDKey] != rollbackRunID {
+		t.Errorf("Expected rollback run ID %s in run metadata, got %v", rollbackRunID, run.Metadata[rollbackRunIDKey])
+	}
+
+	// A run can only be rolled back once
+	if _, err := scheduler.Rollback(ctx, runID, ScheduleOptions{}); err == nil {
+		t.Error("Expected error rolling back twice, got nil")
+	}
+}
@@ -0,0 +1,207 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RolloutOptions configures serial, batched execution of per-host plan units.
+// Hosts are taken from PlanUnit.TargetID and split into batches; each batch
+// must finish before the next one starts.
+type RolloutOptions struct {
+	// BatchSize is the maximum number of hosts changed at once.
+	BatchSize int `json:"batch_size,omitempty"`
+
+	// BatchPercent is the batch size as a percentage of all hosts.
+	// It is used when BatchSize is zero.
+	BatchPercent int `json:"batch_percent,omitempty"`
+
+	// Pause is how long to wait between batches.
+	Pause time.Duration `json:"pause,omitempty"`
+
+	// MaxFailureRatio aborts the remaining batches when the ratio of failed
+	// hosts in a batch exceeds it (0.0 to 1.0). Zero aborts on any failure.
+	MaxFailureRatio float64 `json:"max_failure_ratio"`
+}
+
+// Validate checks that the rollout options are consistent.
+func (r *RolloutOptions) Validate() error {
+	if r.BatchSize < 0 {
+		return NewPermanentError("rollout batch size cannot be negative", nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	if r.BatchPercent < 0 || r.BatchPercent > 100 {
+		return NewPermanentError("rollout batch percent must be between 0 and 100", nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	if r.MaxFailureRatio < 0 || r.MaxFailureRatio > 1 {
+		return NewPermanentError("rollout max failure ratio must be between 0 and 1", nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	if r.Pause < 0 {
+		return NewPermanentError("rollout pause cannot be negative", nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	return nil
+}
+
+// batchSize returns the number of hosts per batch for the given host count.
+func (r *RolloutOptions) batchSize(hostCount int) int {
+	size := hostCount
+	if r.BatchSize > 0 {
+		size = r.BatchSize
+	} else if r.BatchPercent > 0 {
+		// Round up so that a small percentage still makes progress
+		size = (hostCount*r.BatchPercent + 99) / 100
+	}
+
+	if size < 1 {
+		size = 1
+	}
+
+	return size
+}
+
+// Batches returns the batches of hosts the plan would be rolled out in.
+func (r *RolloutOptions) Batches(plan *Plan) [][]string {
+	return rolloutBatches(plan, r, nil)
+}
+
+// rolloutBatches splits the hosts targeted by the plan into batches,
+// leaving out hosts in exclude.
+func rolloutBatches(plan *Plan, rollout *RolloutOptions, exclude map[string]bool) [][]string {
+	seen := make(map[string]bool)
+	hosts := make([]string, 0)
+	for _, unit := range plan.Units {
+		if unit.TargetID != "" && !seen[unit.TargetID] && !exclude[unit.TargetID] {
+			seen[unit.TargetID] = true
+			hosts = append(hosts, unit.TargetID)
+		}
+	}
+
+	// Sort hosts so batches are stable across runs
+	sort.Strings(hosts)
+
+	size := rollout.batchSize(len(hosts))
+	batches := make([][]string, 0, (len(hosts)+size-1)/size)
+	for start := 0; start < len(hosts); start += size {
+		end := start + size
+		if end > len(hosts) {
+			end = len(hosts)
+		}
+		batches = append(batches, hosts[start:end])
+	}
+
+	return batches
+}
+
+// executeRollout executes the plan batch by batch, skipping hosts that were
+// already applied (e.g. by a canary). Units without a target host run with
+// the first batch unless hosts were already applied. Units depending on hosts
+// in later batches are skipped, so cross-host dependencies must point to
+// earlier batches.
+func (s *ParallelScheduler) executeRollout(
+	ctx context.Context,
+	run *Run,
+	plan *Plan,
+	opts ScheduleOptions,
+	applied map[string]bool,
+) error {
+	rollout := opts.Rollout
+	batches := rolloutBatches(plan, rollout, applied)
+
+	// Plans without per-host units run as a single batch
+	if len(batches) == 0 {
+		if len(applied) > 0 {
+			return nil
+		}
+		return s.executeUnits(ctx, run, plan, buildUnitMap(plan, nil), opts)
+	}
+
+	for i, batch := range batches {
+		inBatch := make(map[string]bool, len(batch))
+		for _, host := range batch {
+			inBatch[host] = true
+		}
+
+		first := i == 0 && len(applied) == 0
+		unitMap := buildUnitMap(plan, func(unit *PlanUnit) bool {
+			return inBatch[unit.TargetID] || (first && unit.TargetID == "")
+		})
+
+		s.publishEvent(ctx, run.ID, "", EventTypeInfo,
+			fmt.Sprintf("Starting rollout batch %d/%d (%d hosts)", i+1, len(batches), len(batch)), "info")
+
+		err := s.executeBatch(ctx, run, plan, unitMap, opts, batch, i+1)
+		if abortErr := s.abortError(); abortErr != nil {
+			s.cancelPendingUnits(plan)
+			return fmt.Errorf("rollout batch %d aborted: %w", i+1, abortErr)
+		}
+		if err != nil && opts.FailFast {
+			s.cancelPendingUnits(plan)
+			return fmt.Errorf("rollout batch %d failed: %w", i+1, err)
+		}
+
+		// Abort remaining batches if too many hosts failed in this one
+		failed := s.countFailedHosts(plan, inBatch)
+		ratio := float64(failed) / float64(len(batch))
+		if failed > 0 && ratio > rollout.MaxFailureRatio {
+			s.cancelPendingUnits(plan)
+			return NewPermanentError(
+				fmt.Sprintf("rollout aborted: %d of %d hosts failed in batch %d (ratio %.2f exceeds %.2f)",
+					failed, len(batch), i+1, ratio, rollout.MaxFailureRatio),
+				nil,
+			).WithCode(ErrCodeProviderFailed)
+		}
+
+		// Pause before the next batch
+		if rollout.Pause > 0 && i < len(batches)-1 {
+			select {
+			case <-time.After(rollout.Pause):
+			case <-ctx.Done():
+				return s.handleCancellation(ctx, run, plan)
+			}
+		}
+	}
+
+	return nil
+}
+
+// countFailedHosts counts the hosts with a failed or dependency-skipped unit.
+func (s *ParallelScheduler) countFailedHosts(plan *Plan, hosts map[string]bool) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	failed := make(map[string]bool)
+	for _, unit := range plan.Units {
+		if !hosts[unit.TargetID] {
+			continue
+		}
+
+		status := s.unitStatus[unit.ID]
+		if status == PlanStatusFailed || (status == PlanStatusSkipped && !s.notNotified[unit.ID]) {
+			failed[unit.TargetID] = true
+		}
+	}
+
+	return len(failed)
+}
+
+// cancelPendingUnits marks every unit that has not started as cancelled.
+func (s *ParallelScheduler) cancelPendingUnits(plan *Plan) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, unit := range plan.Units {
+		status := s.unitStatus[unit.ID]
+		if status == PlanStatusPending || status == PlanStatusBlocked {
+			s.unitStatus[unit.ID] = PlanStatusCancelled
+		}
+	}
+}
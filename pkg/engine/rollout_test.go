@@ -0,0 +1,228 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newHostPlan builds a plan with one independent unit per host.
+func newHostPlan(t *testing.T, hosts ...string) *Plan {
+	t.Helper()
+
+	plan := &Plan{
+		ID:        "plan1",
+		CreatedAt: time.Now(),
+		Units:     make([]PlanUnit, 0, len(hosts)),
+	}
+
+	for _, host := range hosts {
+		plan.Units = append(plan.Units, PlanUnit{
+			ID:         fmt.Sprintf("%s-pkg", host),
+			ResourceID: "nginx_pkg",
+			TargetID:   host,
+			Operation:  OperationUpdate,
+			Status:     PlanStatusPending,
+			Timeout:    time.Minute,
+		})
+	}
+
+	graph, err := NewDAGBuilder().BuildGraph(plan.Units)
+	if err != nil {
+		t.Fatalf("Failed to build graph: %v", err)
+	}
+	plan.Graph = graph
+
+	return plan
+}
+
+func TestRolloutOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rollout RolloutOptions
+		wantErr bool
+	}{
+		{"batch size", RolloutOptions{BatchSize: 2}, false},
+		{"batch percent", RolloutOptions{BatchPercent: 25, MaxFailureRatio: 0.5}, false},
+		{"negative batch size", RolloutOptions{BatchSize: -1}, true},
+		{"percent above 100", RolloutOptions{BatchPercent: 150}, true},
+		{"ratio above 1", RolloutOptions{MaxFailureRatio: 1.5}, true},
+		{"negative pause", RolloutOptions{Pause: -time.Second}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rollout.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRolloutBatches(t *testing.T) {
+	plan := newHostPlan(t, "web5", "web1", "web3", "web2", "web4")
+
+	batches := rolloutBatches(plan, &RolloutOptions{BatchSize: 2}, nil)
+	if len(batches) != 3 {
+		t.Fatalf("Expected 3 batches, got %d", len(batches))
+	}
+	if batches[0][0] != "web1" || batches[0][1] != "web2" {
+		t.Errorf("Expected sorted first batch, got %v", batches[0])
+	}
+	if len(batches[2]) != 1 {
+		t.Errorf("Expected last batch of 1 host, got %v", batches[2])
+	}
+
+	// 20% of 5 hosts rounds to 1 host per batch
+	batches = rolloutBatches(plan, &RolloutOptions{BatchPercent: 20}, nil)
+	if len(batches) != 5 {
+		t.Errorf("Expected 5 batches, got %d", len(batches))
+	}
+
+	// 30% of 5 hosts rounds up to 2 hosts per batch
+	batches = rolloutBatches(plan, &RolloutOptions{BatchPercent: 30}, nil)
+	if len(batches) != 3 {
+		t.Errorf("Expected 3 batches, got %d", len(batches))
+	}
+
+	// Without a size all hosts go in one batch
+	batches = rolloutBatches(plan, &RolloutOptions{}, nil)
+	if len(batches) != 1 {
+		t.Errorf("Expected 1 batch, got %d", len(batches))
+	}
+}
+
+func TestScheduler_Rollout_ExecutesBatchesInOrder(t *testing.T) {
+	executor := newMockExecutor()
+	publisher := newMockEventPublisher()
+	stateMgr := newMockStateManager()
+	scheduler := NewParallelScheduler(5, executor, publisher, stateMgr)
+
+	ctx := context.Background()
+	plan := newHostPlan(t, "web1", "web2", "web3", "web4")
+
+	opts := ScheduleOptions{
+		Rollout: &RolloutOptions{BatchSize: 2, Pause: 20 * time.Millisecond},
+	}
+
+	runID, err := scheduler.Schedule(ctx, plan, opts)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(200 * time.Millisecond)
+
+	executor.mu.Lock()
+	executed := append([]string{}, executor.executedUnits...)
+	executor.mu.Unlock()
+
+	if len(executed) != 4 {
+		t.Fatalf("Expected 4 executed units, got %d", len(executed))
+	}
+
+	// The first batch must finish before the second starts
+	firstBatch := map[string]bool{"web1-pkg": true, "web2-pkg": true}
+	if !firstBatch[executed[0]] || !firstBatch[executed[1]] {
+		t.Errorf("Expected first batch to run first, got order %v", executed)
+	}
+
+	run, err := stateMgr.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("Failed to get run: %v", err)
+	}
+
+	if run.Status != RunStatusSucceeded {
+		t.Errorf("Expected run status SUCCEEDED, got %s", run.Status)
+	}
+}
+
+func TestScheduler_Rollout_AbortsOnFailureRatio(t *testing.T) {
+	executor := newMockExecutor()
+	executor.failUnits["web1-pkg"] = true
+	publisher := newMockEventPublisher()
+	stateMgr := newMockStateManager()
+	scheduler := NewParallelScheduler(5, executor, publisher, stateMgr)
+
+	ctx := context.Background()
+	plan := newHostPlan(t, "web1", "web2", "web3", "web4")
+
+	opts := ScheduleOptions{
+		Rollout: &RolloutOptions{BatchSize: 2, MaxFailureRatio: 0.4},
+	}
+
+	runID, err := scheduler.Schedule(ctx, plan, opts)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(200 * time.Millisecond)
+
+	if count := countExecutions(executor, "web3-pkg") + countExecutions(executor, "web4-pkg"); count != 0 {
+		t.Errorf("Expected second batch not to run, got %d executions", count)
+	}
+
+	run, err := stateMgr.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("Failed to get run: %v", err)
+	}
+
+	if run.Status != RunStatusFailed {
+		t.Errorf("Expected run status FAILED, got %s", run.Status)
+	}
+
+	if run.Summary.Cancelled != 2 {
+		t.Errorf("Expected 2 cancelled units, got %d", run.Summary.Cancelled)
+	}
+}
+
+func TestScheduler_Rollout_ToleratesFailuresBelowRatio(t *testing.T) {
+	executor := newMockExecutor()
+	executor.failUnits["web1-pkg"] = true
+	publisher := newMockEventPublisher()
+	stateMgr := newMockStateManager()
+	scheduler := NewParallelScheduler(5, executor, publisher, stateMgr)
+
+	ctx := context.Background()
+	plan := newHostPlan(t, "web1", "web2", "web3", "web4")
+
+	opts := ScheduleOptions{
+		Rollout: &RolloutOptions{BatchSize: 2, MaxFailureRatio: 0.5},
+	}
+
+	runID, err := scheduler.Schedule(ctx, plan, opts)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(200 * time.Millisecond)
+
+	run, err := stateMgr.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("Failed to get run: %v", err)
+	}
+
+	if run.Status != RunStatusPartial {
+		t.Errorf("Expected run status PARTIAL, got %s", run.Status)
+	}
+
+	if run.Summary.Succeeded != 3 {
+		t.Errorf("Expected 3 succeeded units, got %d", run.Summary.Succeeded)
+	}
+}
+
+func TestScheduler_Rollout_InvalidOptions(t *testing.T) {
+	scheduler := NewParallelScheduler(5, newMockExecutor(), newMockEventPublisher(), newMockStateManager())
+	plan := newHostPlan(t, "web1")
+
+	_, err := scheduler.Schedule(context.Background(), plan, ScheduleOptions{
+		Rollout: &RolloutOptions{BatchPercent: 200},
+	})
+	if err == nil {
+		t.Fatal("Expected error for invalid rollout options, got nil")
+	}
+}
@@ -0,0 +1,251 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/openfroyo/openfroyo/pkg/micro_runner/client"
+	"github.com/openfroyo/openfroyo/pkg/micro_runner/protocol"
+	"github.com/openfroyo/openfroyo/pkg/transports/ssh"
+)
+
+// remoteRunnerPath is the prefix of the paths the micro-runner binary is
+// uploaded to on target hosts.
+const remoteRunnerPath = "/tmp/froyo-micro-runner"
+
+// newRemoteRunnerPath returns a path to upload the micro-runner binary to that
+// no other session uses, so concurrent sessions to a host do not overwrite or
+// remove each other's binary.
+func newRemoteRunnerPath() string {
+	return remoteRunnerPath + "-" + uuid.New().String()
+}
+
+// runnerCommandTimeout bounds commands run on behalf of other components.
+const runnerCommandTimeout = 2 * time.Minute
+
+// RunnerSession is a micro-runner started on an onboarded host.
+// It must be closed to stop the runner and remove its binary.
+type RunnerSession struct {
+	transport  *ssh.SSHClient
+	client     *client.Client
+	remotePath string
+}
+
+// OpenRunnerSession connects to a host with its onboarding key and starts the
+// micro-runner binary matching the host's OS and architecture. Binaries are
+// looked up next to runnerBinaryPath.
+func OpenRunnerSession(ctx context.Context, host *Host, runnerBinaryPath string) (*RunnerSession, error) {
+	// Step 1: Connect with the host's key
+	transport, err := ssh.NewSSHClient(&ssh.Config{
+		Host:                  host.Address,
+		Port:                  host.Port,
+		User:                  host.User,
+		AuthMethod:            ssh.AuthMethodKey,
+		PrivateKeyPath:        host.KeyPath,
+		StrictHostKeyChecking: false,
+		ConnectionTimeout:     30 * time.Second,
+		CommandTimeout:        2 * time.Minute,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH client: %w", err)
+	}
+
+	if err := transport.Connect(ctx); err != nil {
+		return nil, fmt.Errorf("failed to connect to host: %w", err)
+	}
+
+	// Step 2: Select the runner binary for the host
+	targetOS, targetArch, err := detectTargetArchitecture(ctx, transport)
+	if err != nil {
+		transport.Disconnect()
+		return nil, fmt.Errorf("failed to detect target architecture: %w", err)
+	}
+
+	binaryPath, err := selectRunnerBinary(runnerBinaryPath, targetOS, targetArch)
+	if err != nil {
+		transport.Disconnect()
+		return nil, fmt.Errorf("failed to select runner binary: %w", err)
+	}
+
+	// Step 3: Start the micro-runner
+	sshClient, err := transport.GetClient()
+	if err != nil {
+		transport.Disconnect()
+		return nil, fmt.Errorf("failed to get SSH client: %w", err)
+	}
+
+	runnerConfig := &client.Config{
+		Transport:      &sshTransportAdapter{transport: transport, client: sshClient},
+		RunnerPath:     binaryPath,
+		RemotePath:     newRemoteRunnerPath(),
+		StartupTimeout: 15 * time.Second,
+	}
+
+	runnerClient, err := client.NewClient(runnerConfig)
+	if err != nil {
+		transport.Disconnect()
+		return nil, fmt.Errorf("failed to create runner client: %w", err)
+	}
+
+	if err := runnerClient.Start(ctx, runnerConfig); err != nil {
+		transport.Disconnect()
+		return nil, fmt.Errorf("failed to start micro-runner: %w", err)
+	}
+
+	return &RunnerSession{
+		transport:  transport,
+		client:     runnerClient,
+		remotePath: runnerConfig.RemotePath,
+	}, nil
+}
+
+// Execute runs a command on the micro-runner and decodes its result into out.
+// A nil out discards the result.
+func (r *RunnerSession) Execute(
+	ctx context.Context,
+	cmdType protocol.CommandType,
+	params any,
+	timeout time.Duration,
+	out any,
+) error {
+	rawParams, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s params: %w", cmdType, err)
+	}
+
+	done, err := r.client.Execute(ctx, &protocol.CommandMessage{
+		ID:      uuid.New().String(),
+		Type:    cmdType,
+		Timeout: int(timeout.Seconds()),
+		Params:  rawParams,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to execute %s: %w", cmdType, err)
+	}
+
+	if out != nil && len(done.Result) > 0 {
+		if err := json.Unmarshal(done.Result, out); err != nil {
+			return fmt.Errorf("failed to decode %s result: %w", cmdType, err)
+		}
+	}
+
+	return nil
+}
+
+// Supports reports whether the micro-runner advertised a command type when it started.
+func (r *RunnerSession) Supports(cmdType protocol.CommandType) bool {
+	ready := r.client.Ready()
+	return ready != nil && ready.Caps[string(cmdType)]
+}
+
+// ExecuteCommand runs a shell command on the micro-runner, so a session can
+// be used wherever a CommandExecutor is. A non-zero exit code is an error.
+func (r *RunnerSession) ExecuteCommand(ctx context.Context, cmd string) (string, string, error) {
+	var result protocol.ExecResult
+	err := r.Execute(ctx, protocol.CommandTypeExec, &protocol.ExecParams{
+		Command:    cmd,
+		CaptureOut: true,
+		CaptureErr: true,
+	}, runnerCommandTimeout, &result)
+	if err != nil {
+		return "", "", err
+	}
+
+	if result.ExitCode != 0 {
+		return result.Stdout, result.Stderr, fmt.Errorf("command exited with code %d", result.ExitCode)
+	}
+
+	return result.Stdout, result.Stderr, nil
+}
+
+// GatherFacts gathers fact namespaces natively on the host. The built-in
+// namespaces are gathered in one round trip; custom facts are gathered in
+// their own, with a budget covering every script, since the scripts run one
+// after another. Namespaces that failed are returned in the result's errors.
+func (r *RunnerSession) GatherFacts(ctx context.Context, namespaces []string) (*protocol.FactsGatherResult, error) {
+	result := &protocol.FactsGatherResult{
+		Facts:  make(map[string]json.RawMessage),
+		Errors: make(map[string]string),
+	}
+
+	builtin := make([]string, 0, len(namespaces))
+	custom := false
+	for _, namespace := range namespaces {
+		if namespace == protocol.CustomFactsNamespace {
+			custom = true
+			continue
+		}
+		builtin = append(builtin, namespace)
+	}
+
+	if len(builtin) > 0 {
+		if err := r.gatherFacts(ctx, builtin, runnerCommandTimeout, result); err != nil {
+			return nil, err
+		}
+	}
+
+	if custom {
+		budget, err := r.customFactsBudget(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.gatherFacts(ctx, []string{protocol.CustomFactsNamespace}, budget, result); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// gatherFacts runs one facts.gather command and adds its facts and errors to
+// the result.
+func (r *RunnerSession) gatherFacts(
+	ctx context.Context,
+	namespaces []string,
+	timeout time.Duration,
+	result *protocol.FactsGatherResult,
+) error {
+	var gathered protocol.FactsGatherResult
+	err := r.Execute(ctx, protocol.CommandTypeFactsGather, &protocol.FactsGatherParams{
+		Namespaces: namespaces,
+	}, timeout, &gathered)
+	if err != nil {
+		return err
+	}
+
+	maps.Copy(result.Facts, gathered.Facts)
+	maps.Copy(result.Errors, gathered.Errors)
+	return nil
+}
+
+// customFactsBudget returns how long gathering custom facts may take: the
+// command timeout plus the script timeout for each script in the custom
+// facts directory.
+func (r *RunnerSession) customFactsBudget(ctx context.Context) (time.Duration, error) {
+	stdout, _, err := r.ExecuteCommand(ctx, fmt.Sprintf(
+		"if [ -d %[1]s ]; then find %[1]s -maxdepth 1 -type f -perm /111 | wc -l; else echo 0; fi",
+		shellQuote(protocol.DefaultCustomFactsDir)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count custom fact scripts: %w", err)
+	}
+
+	scripts, err := strconv.Atoi(strings.TrimSpace(stdout))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count custom fact scripts: %w", err)
+	}
+
+	return runnerCommandTimeout + time.Duration(scripts)*protocol.DefaultCustomFactTimeout, nil
+}
+
+// Close stops the micro-runner and disconnects from the host.
+func (r *RunnerSession) Close(ctx context.Context) error {
+	err := r.client.Close(ctx, r.remotePath)
+	r.transport.Disconnect()
+	return err
+}
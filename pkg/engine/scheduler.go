@@ -2,6 +2,7 @@ package engine
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"sync"
@@ -11,7 +12,9 @@ import (
 )
 
 // ParallelScheduler implements parallel execution of plan units with dependency management.
-// It executes plan units level-by-level, running independent units in parallel within each level.
+// By default each unit starts as soon as its own dependencies finish, bounded by a worker pool;
+// the levels strategy instead executes level-by-level, running units in parallel within each level.
+// Handler units only execute when at least one of their notifiers reported a change.
 type ParallelScheduler struct {
 	// maxParallel is the maximum number of concurrent workers
 	maxParallel int
@@ -33,6 +36,24 @@ type ParallelScheduler struct {
 
 	// unitStatus tracks the current status of each unit
 	unitStatus map[string]PlanStatus
+
+	// notNotified tracks handler units skipped because no notifier changed anything
+	notNotified map[string]bool
+
+	// healthChecker runs canary health checks and post-apply checks
+	healthChecker HealthChecker
+
+	// concurrencyMetrics records time spent waiting on concurrency keys
+	concurrencyMetrics ConcurrencyMetrics
+
+	// limiter enforces the concurrency limits of the current run
+	limiter *concurrencyLimiter
+
+	// hookRunner runs run, batch and resource hooks
+	hookRunner HookRunner
+
+	// abortErr is set when a hook aborts the current run
+	abortErr error
 }
 
 // NewParallelScheduler creates a new parallel scheduler.
@@ -53,9 +74,26 @@ func NewParallelScheduler(
 		stateManager:   stateManager,
 		unitResults:    make(map[string]*ExecutionResult),
 		unitStatus:     make(map[string]PlanStatus),
+		notNotified:    make(map[string]bool),
 	}
 }
 
+// SetHealthChecker sets the health checker used to gate canary runs and to
+// run post-apply checks.
+func (s *ParallelScheduler) SetHealthChecker(checker HealthChecker) {
+	s.healthChecker = checker
+}
+
+// SetHookRunner sets the runner used for run, batch and resource hooks.
+func (s *ParallelScheduler) SetHookRunner(runner HookRunner) {
+	s.hookRunner = runner
+}
+
+// SetConcurrencyMetrics sets where time spent waiting on concurrency keys is recorded.
+func (s *ParallelScheduler) SetConcurrencyMetrics(metrics ConcurrencyMetrics) {
+	s.concurrencyMetrics = metrics
+}
+
 // Schedule schedules a plan for execution with the given options.
 func (s *ParallelScheduler) Schedule(
 	ctx context.Context,
@@ -72,6 +110,50 @@ func (s *ParallelScheduler) Schedule(
 			WithCode(ErrCodeValidation)
 	}
 
+	if err := opts.Strategy.Validate(); err != nil {
+		return "", err
+	}
+
+	if err := validateConcurrencyLimits(opts.ConcurrencyLimits); err != nil {
+		return "", err
+	}
+
+	if opts.Rollout != nil {
+		if err := opts.Rollout.Validate(); err != nil {
+			return "", err
+		}
+	}
+
+	if opts.Canary != nil {
+		if err := opts.Canary.Validate(); err != nil {
+			return "", err
+		}
+		if len(opts.Canary.Checks) > 0 && s.healthChecker == nil {
+			return "", NewPermanentError("canary health checks require a health checker", nil).
+				WithCode(ErrCodeValidation)
+		}
+	}
+
+	if err := validatePlanChecks(plan); err != nil {
+		return "", err
+	}
+	if planHasChecks(plan) && !opts.DryRun && s.healthChecker == nil {
+		return "", NewPermanentError("post-apply checks require a health checker", nil).
+			WithCode(ErrCodeValidation)
+	}
+	if planHasWaits(plan) && !opts.DryRun && s.healthChecker == nil {
+		return "", NewPermanentError("wait resources require a health checker", nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	if err := validatePlanHooks(plan); err != nil {
+		return "", err
+	}
+	if planHasHooks(plan) && !opts.DryRun && s.hookRunner == nil {
+		return "", NewPermanentError("hooks require a hook runner", nil).
+			WithCode(ErrCodeValidation)
+	}
+
 	// Create a new run
 	run := &Run{
 		ID:        uuid.New().String(),
@@ -134,29 +216,80 @@ func (s *ParallelScheduler) executeRun(
 		return fmt.Errorf("failed to update run status: %w", err)
 	}
 
-	// Initialize unit status map
+	// Initialize unit status map and concurrency limits
 	s.mu.Lock()
 	for _, unit := range plan.Units {
 		s.unitStatus[unit.ID] = PlanStatusPending
 	}
+	s.limiter = newConcurrencyLimiter(opts.ConcurrencyLimits, s.concurrencyMetrics)
+	s.abortErr = nil
 	s.mu.Unlock()
 
-	// Execute the plan level by level
-	err := s.executePlanLevels(ctx, run, plan, opts)
+	hooks := plan.Hooks
+	if hooks == nil {
+		hooks = &RunHooks{}
+	}
+	hookCtx := HookContext{Hosts: planHosts(plan)}
+
+	// Execute the plan, canaries first and in host batches when rolling out
+	err := s.runHooks(ctx, run, opts, HookBeforeRun, hooks.BeforeRun, hookCtx)
+	if err != nil {
+		s.takeAbortError()
+		s.cancelPendingUnits(plan)
+	} else {
+		if opts.Canary != nil {
+			err = s.executeCanary(ctx, run, plan, opts)
+		} else if opts.Rollout != nil {
+			err = s.executeRollout(ctx, run, plan, opts, nil)
+		} else {
+			err = s.executeUnits(ctx, run, plan, buildUnitMap(plan, nil), opts)
+		}
+
+		// A hook may have aborted the run while units were executing
+		if abortErr := s.takeAbortError(); abortErr != nil && err == nil {
+			err = abortErr
+		}
+
+		// Verify the applied hosts with the workspace checks
+		if err == nil {
+			s.runWorkspaceChecks(ctx, run, plan, opts)
+		}
+
+		if hookErr := s.runHooks(ctx, run, opts, HookAfterRun, hooks.AfterRun, hookCtx); hookErr != nil {
+			s.takeAbortError()
+			if err == nil {
+				err = hookErr
+			}
+		}
+	}
 
 	// Calculate final run statistics
 	s.mu.RLock()
 	summary := s.calculateRunSummary(plan.Units)
+	summary.ChecksPassed = run.Summary.ChecksPassed
+	summary.ChecksFailed = run.Summary.ChecksFailed
 	s.mu.RUnlock()
 
+	// Undo the succeeded units of a failed run unless a canary already did
+	if opts.RollbackOnFailure && (err != nil || summary.Failed > 0 || summary.ChecksFailed > 0) {
+		if _, rolledBack := run.Metadata[rollbackPlanIDKey]; !rolledBack {
+			s.publishEvent(ctx, run.ID, "", EventTypeWarning, "Run failed, rolling back", "warning")
+			if rollbackErr := s.rollbackUnits(ctx, run, plan, buildUnitMap(plan, nil), opts); rollbackErr != nil {
+				run.Metadata["rollback_error"] = rollbackErr.Error()
+				s.publishEvent(ctx, run.ID, "", EventTypeError,
+					fmt.Sprintf("Rollback failed: %v", rollbackErr), "error")
+			}
+		}
+	}
+
 	// Update final run status
 	run.Summary = summary
 	completedAt := time.Now()
 	run.CompletedAt = &completedAt
 	run.Duration = completedAt.Sub(run.StartedAt)
 
-	// Determine final run status
-	if err != nil {
+	// Determine final run status. Failed checks fail the whole run.
+	if err != nil || summary.ChecksFailed > 0 {
 		run.Status = RunStatusFailed
 	} else if summary.Failed > 0 {
 		if summary.Succeeded > 0 {
@@ -175,6 +308,12 @@ func (s *ParallelScheduler) executeRun(
 		return fmt.Errorf("failed to save final run state: %w", saveErr)
 	}
 
+	// Save the plan with its unit results so the run can be rolled back later
+	if saveErr := s.stateManager.SavePlan(ctx, plan); saveErr != nil {
+		s.publishEvent(ctx, run.ID, "", EventTypeWarning,
+			fmt.Sprintf("Failed to save plan results: %v", saveErr), "warning")
+	}
+
 	// Publish completion event
 	if run.Status == RunStatusSucceeded {
 		s.publishEvent(ctx, run.ID, "", EventTypeRunCompleted, "Run completed successfully", "info")
@@ -186,19 +325,33 @@ func (s *ParallelScheduler) executeRun(
 	return err
 }
 
-// executePlanLevels executes the plan level by level, with parallelism within each level.
+// buildUnitMap indexes the plan units accepted by the filter by ID.
+// A nil filter accepts every unit.
+func buildUnitMap(plan *Plan, filter func(*PlanUnit) bool) map[string]*PlanUnit {
+	unitMap := make(map[string]*PlanUnit)
+	for i := range plan.Units {
+		unit := &plan.Units[i]
+		if filter == nil || filter(unit) {
+			unitMap[unit.ID] = unit
+		}
+	}
+	return unitMap
+}
+
+// executePlanLevels executes the units in unitMap level by level, with parallelism within each level.
+// Handler units are held back and flushed at the end of their level or of the run,
+// depending on opts.HandlerFlush. When flushing at the end of the run, units that
+// depend on a deferred handler are deferred along with it.
 func (s *ParallelScheduler) executePlanLevels(
 	ctx context.Context,
 	run *Run,
 	plan *Plan,
+	unitMap map[string]*PlanUnit,
 	opts ScheduleOptions,
 ) error {
-	// Build unit map for quick lookups
-	unitMap := make(map[string]*PlanUnit)
-	for i := range plan.Units {
-		unit := &plan.Units[i]
-		unitMap[unit.ID] = unit
-	}
+	// Units deferred to the end of the run, grouped by level
+	deferred := make(map[string]bool)
+	deferredLevels := make([][]*PlanUnit, 0)
 
 	// Process each level in sequence
 	for level := 0; level < plan.Graph.Depth; level++ {
@@ -208,8 +361,16 @@ func (s *ParallelScheduler) executePlanLevels(
 			continue
 		}
 
-		// Execute units at this level in parallel
-		if err := s.executeLevelParallel(ctx, run, levelUnits, opts); err != nil {
+		// Hold back handlers and anything waiting on a deferred handler
+		if opts.HandlerFlush != HandlerFlushLevel {
+			var held []*PlanUnit
+			levelUnits, held = deferHandlerUnits(levelUnits, deferred)
+			if len(held) > 0 {
+				deferredLevels = append(deferredLevels, held)
+			}
+		}
+
+		if err := s.executeLevelWithHandlers(ctx, run, levelUnits, opts); err != nil {
 			if opts.FailFast {
 				return fmt.Errorf("level %d failed: %w", level, err)
 			}
@@ -224,9 +385,133 @@ func (s *ParallelScheduler) executePlanLevels(
 		}
 	}
 
+	// Flush units deferred to the end of the run, preserving level order
+	for _, units := range deferredLevels {
+		if err := s.executeLevelWithHandlers(ctx, run, units, opts); err != nil && opts.FailFast {
+			return fmt.Errorf("handlers failed: %w", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return s.handleCancellation(ctx, run, plan)
+		default:
+		}
+	}
+
 	return nil
 }
 
+// executeLevelWithHandlers executes the regular units of a level in parallel,
+// then flushes the handlers among them.
+func (s *ParallelScheduler) executeLevelWithHandlers(
+	ctx context.Context,
+	run *Run,
+	levelUnits []*PlanUnit,
+	opts ScheduleOptions,
+) error {
+	units, handlers := splitHandlerUnits(levelUnits)
+
+	var firstErr error
+	if len(units) > 0 {
+		firstErr = s.executeLevelParallel(ctx, run, units, opts)
+	}
+
+	if len(handlers) > 0 && (firstErr == nil || !opts.FailFast) {
+		if err := s.flushHandlers(ctx, run, handlers, opts); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// deferHandlerUnits splits out handler units and units depending on already
+// deferred units, recording them in the deferred set.
+func deferHandlerUnits(units []*PlanUnit, deferred map[string]bool) ([]*PlanUnit, []*PlanUnit) {
+	remaining := make([]*PlanUnit, 0, len(units))
+	held := make([]*PlanUnit, 0)
+
+	for _, unit := range units {
+		hold := unit.Handler
+		for _, dep := range unit.Dependencies {
+			if deferred[dep.TargetID] {
+				hold = true
+				break
+			}
+		}
+
+		if hold {
+			deferred[unit.ID] = true
+			held = append(held, unit)
+		} else {
+			remaining = append(remaining, unit)
+		}
+	}
+
+	return remaining, held
+}
+
+// splitHandlerUnits separates handler units from regular units.
+func splitHandlerUnits(units []*PlanUnit) ([]*PlanUnit, []*PlanUnit) {
+	regular := make([]*PlanUnit, 0, len(units))
+	handlers := make([]*PlanUnit, 0)
+
+	for _, unit := range units {
+		if unit.Handler {
+			handlers = append(handlers, unit)
+		} else {
+			regular = append(regular, unit)
+		}
+	}
+
+	return regular, handlers
+}
+
+// flushHandlers executes the notified handlers and skips the rest.
+// Each handler runs at most once per run, regardless of how many notifiers changed.
+func (s *ParallelScheduler) flushHandlers(
+	ctx context.Context,
+	run *Run,
+	handlers []*PlanUnit,
+	opts ScheduleOptions,
+) error {
+	notified := make([]*PlanUnit, 0, len(handlers))
+	for _, handler := range handlers {
+		if !s.isNotified(handler) {
+			s.markHandlerNotNotified(handler)
+			s.publishEvent(ctx, run.ID, handler.ID, EventTypeInfo,
+				fmt.Sprintf("Handler %s not notified, skipping", handler.ResourceID), "info")
+			continue
+		}
+		notified = append(notified, handler)
+	}
+
+	if len(notified) == 0 {
+		return nil
+	}
+
+	return s.executeLevelParallel(ctx, run, notified, opts)
+}
+
+// isNotified reports whether any notify dependency of the handler succeeded with changes.
+func (s *ParallelScheduler) isNotified(handler *PlanUnit) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, dep := range handler.Dependencies {
+		if dep.Type != DependencyNotify {
+			continue
+		}
+
+		result, exists := s.unitResults[dep.TargetID]
+		if exists && result.Status == PlanStatusSucceeded && result.Changed {
+			return true
+		}
+	}
+
+	return false
+}
+
 // getUnitsAtLevel returns all plan units at the specified execution level.
 func (s *ParallelScheduler) getUnitsAtLevel(
 	graph *ExecutionGraph,
@@ -247,12 +532,15 @@ func (s *ParallelScheduler) getUnitsAtLevel(
 }
 
 // executeLevelParallel executes all units at a level in parallel using a worker pool.
+// Workers only take units whose concurrency keys have a free slot.
 func (s *ParallelScheduler) executeLevelParallel(
 	ctx context.Context,
 	run *Run,
 	units []*PlanUnit,
 	opts ScheduleOptions,
 ) error {
+	limiter := s.currentLimiter()
+
 	// Determine worker count (min of maxParallel and number of units)
 	workerCount := s.maxParallel
 	if opts.MaxParallel > 0 && opts.MaxParallel < workerCount {
@@ -262,12 +550,32 @@ func (s *ParallelScheduler) executeLevelParallel(
 		workerCount = len(units)
 	}
 
-	// Create work queue
-	workQueue := make(chan *PlanUnit, len(units))
-	for _, unit := range units {
-		workQueue <- unit
+	// Create work queue, woken whenever a unit releases its concurrency keys
+	var queueMu sync.Mutex
+	queueCond := sync.NewCond(&queueMu)
+	queue := append([]*PlanUnit(nil), units...)
+
+	next := func() *PlanUnit {
+		queueMu.Lock()
+		defer queueMu.Unlock()
+
+		for len(queue) > 0 {
+			if i := limiter.admit(queue); i >= 0 {
+				unit := queue[i]
+				queue = append(queue[:i], queue[i+1:]...)
+				return unit
+			}
+			queueCond.Wait()
+		}
+		return nil
+	}
+
+	release := func(unit *PlanUnit) {
+		limiter.release(unit)
+		queueMu.Lock()
+		queueCond.Broadcast()
+		queueMu.Unlock()
 	}
-	close(workQueue)
 
 	// Create worker pool
 	var wg sync.WaitGroup
@@ -278,10 +586,18 @@ func (s *ParallelScheduler) executeLevelParallel(
 		go func() {
 			defer wg.Done()
 
-			for unit := range workQueue {
+			for unit := next(); unit != nil; unit = next() {
+				// Cancel the remaining units once a hook aborted the run
+				if s.abortError() != nil {
+					s.updateUnitStatus(unit.ID, PlanStatusCancelled)
+					release(unit)
+					continue
+				}
+
 				// Check if dependencies succeeded
 				if !s.checkDependencies(unit) {
 					s.markUnitSkipped(unit, "Dependencies failed")
+					release(unit)
 					continue
 				}
 
@@ -289,6 +605,7 @@ func (s *ParallelScheduler) executeLevelParallel(
 				if err := s.executeUnit(ctx, run, unit, opts); err != nil {
 					errChan <- fmt.Errorf("unit %s failed: %w", unit.ID, err)
 				}
+				release(unit)
 
 				// Check for cancellation
 				select {
@@ -315,6 +632,13 @@ func (s *ParallelScheduler) executeLevelParallel(
 	return firstErr
 }
 
+// currentLimiter returns the concurrency limiter of the current run.
+func (s *ParallelScheduler) currentLimiter() *concurrencyLimiter {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.limiter
+}
+
 // executeUnit executes a single plan unit with retry logic.
 func (s *ParallelScheduler) executeUnit(
 	ctx context.Context,
@@ -331,11 +655,13 @@ func (s *ParallelScheduler) executeUnit(
 
 	startTime := time.Now()
 
-	// Execute with retry logic
+	// Run the before hooks; a failed hook fails the unit without executing it
 	var result *ExecutionResult
 	var err error
+	hookErr := s.runResourceHooks(ctx, run, unit, opts, HookBeforeResource)
 
-	for attempt := 0; attempt <= unit.MaxRetries; attempt++ {
+	// Execute with retry logic
+	for attempt := 0; hookErr == nil && attempt <= unit.MaxRetries; attempt++ {
 		// Create timeout context
 		execCtx, cancel := context.WithTimeout(ctx, unit.Timeout)
 
@@ -343,6 +669,8 @@ func (s *ParallelScheduler) executeUnit(
 		if opts.DryRun {
 			result = s.simulateDryRun(unit)
 			err = nil
+		} else if unit.Wait != nil {
+			result, err = s.executeWait(execCtx, run, unit)
 		} else {
 			result, err = s.executor.ExecuteUnit(execCtx, unit)
 		}
@@ -355,7 +683,7 @@ func (s *ParallelScheduler) executeUnit(
 		}
 
 		// Check if error is retryable
-		if err != nil && !IsRetryable(err) {
+		if !s.isRetryable(unit, err) {
 			break
 		}
 
@@ -365,12 +693,10 @@ func (s *ParallelScheduler) executeUnit(
 		}
 
 		// Calculate backoff delay
-		backoff := s.calculateBackoff(attempt, err)
+		backoff := s.retryDelay(unit, attempt, err)
 
-		// Publish retry event
-		s.publishEvent(ctx, run.ID, unit.ID, EventTypeWarning,
-			fmt.Sprintf("Retrying after failure (attempt %d/%d)", attempt+1, unit.MaxRetries+1),
-			"warning")
+		// Record the failed attempt as its own event
+		s.publishRetryEvent(ctx, run.ID, unit, attempt, backoff, err)
 
 		// Wait with exponential backoff
 		select {
@@ -380,6 +706,10 @@ func (s *ParallelScheduler) executeUnit(
 		}
 	}
 
+	if hookErr != nil {
+		err = hookErr
+	}
+
 	// Store result
 	if result == nil {
 		result = &ExecutionResult{
@@ -404,10 +734,20 @@ func (s *ParallelScheduler) executeUnit(
 		s.updateUnitStatus(unit.ID, PlanStatusSucceeded)
 		s.publishEvent(ctx, run.ID, unit.ID, EventTypePlanUnitCompleted,
 			fmt.Sprintf("Completed execution of %s", unit.ResourceID), "info")
+		s.runUnitChecks(ctx, run, unit, opts)
 	} else {
 		s.updateUnitStatus(unit.ID, PlanStatusFailed)
 		s.publishEvent(ctx, run.ID, unit.ID, EventTypePlanUnitFailed,
 			fmt.Sprintf("Failed execution of %s: %v", unit.ResourceID, err), "error")
+	}
+
+	// Run the after hooks whether the unit succeeded or not, unless its before
+	// hooks failed. A failed hook aborts the run but leaves the result alone.
+	if hookErr == nil {
+		s.runResourceHooks(ctx, run, unit, opts, HookAfterResource)
+	}
+
+	if result.Status != PlanStatusSucceeded {
 		return err
 	}
 
@@ -446,6 +786,55 @@ func (s *ParallelScheduler) checkDependencies(unit *PlanUnit) bool {
 	return true
 }
 
+// isRetryable reports whether a failed attempt should be retried, using the
+// unit's retry policy when it has one.
+func (s *ParallelScheduler) isRetryable(unit *PlanUnit, err error) bool {
+	if unit.Retry != nil {
+		return unit.Retry.Retries(err)
+	}
+	return err == nil || IsRetryable(err)
+}
+
+// retryDelay returns the delay before retrying a failed attempt, using the
+// unit's retry policy when it has one.
+func (s *ParallelScheduler) retryDelay(unit *PlanUnit, attempt int, err error) time.Duration {
+	if unit.Retry != nil {
+		return unit.Retry.Delay(attempt)
+	}
+	return s.calculateBackoff(attempt, err)
+}
+
+// publishRetryEvent records a failed attempt that is about to be retried.
+func (s *ParallelScheduler) publishRetryEvent(
+	ctx context.Context,
+	runID string,
+	unit *PlanUnit,
+	attempt int,
+	delay time.Duration,
+	err error,
+) {
+	details := map[string]interface{}{
+		"attempt":      attempt + 1,
+		"max_attempts": unit.MaxRetries + 1,
+		"delay":        delay.String(),
+	}
+
+	reason := "unsuccessful result"
+	if err != nil {
+		reason = err.Error()
+		var engineErr *EngineError
+		if errors.As(err, &engineErr) {
+			details["error_class"] = engineErr.Class
+		}
+	}
+	details["error"] = reason
+
+	s.publishEventDetails(ctx, runID, unit.ID, EventTypePlanUnitRetrying,
+		fmt.Sprintf("Attempt %d/%d of %s failed, retrying in %s: %s",
+			attempt+1, unit.MaxRetries+1, unit.ResourceID, delay, reason),
+		"warning", details)
+}
+
 // calculateBackoff calculates exponential backoff with jitter.
 func (s *ParallelScheduler) calculateBackoff(attempt int, err error) time.Duration {
 	baseDelay := 1 * time.Second
@@ -498,6 +887,7 @@ func (s *ParallelScheduler) simulateDryRun(unit *PlanUnit) *ExecutionResult {
 		CompletedAt: time.Now(),
 		Duration:    0,
 		NewState:    unit.DesiredState,
+		Changed:     unit.Operation.IsMutating(),
 	}
 }
 
@@ -556,6 +946,25 @@ func (s *ParallelScheduler) markUnitSkipped(unit *PlanUnit, reason string) {
 	unit.Result = result
 }
 
+// markHandlerNotNotified marks a handler unit as skipped because nothing notified it.
+func (s *ParallelScheduler) markHandlerNotNotified(unit *PlanUnit) {
+	s.mu.Lock()
+	s.unitStatus[unit.ID] = PlanStatusSkipped
+	s.notNotified[unit.ID] = true
+	s.mu.Unlock()
+
+	result := &ExecutionResult{
+		PlanUnitID:  unit.ID,
+		Status:      PlanStatusSkipped,
+		StartedAt:   time.Now(),
+		CompletedAt: time.Now(),
+		Duration:    0,
+	}
+
+	s.storeUnitResult(unit.ID, result)
+	unit.Result = result
+}
+
 // calculateRunSummary calculates the final run summary statistics.
 func (s *ParallelScheduler) calculateRunSummary(units []PlanUnit) RunSummary {
 	summary := RunSummary{
@@ -570,11 +979,17 @@ func (s *ParallelScheduler) calculateRunSummary(units []PlanUnit) RunSummary {
 		case PlanStatusFailed:
 			summary.Failed++
 		case PlanStatusSkipped:
-			summary.Skipped++
+			if s.notNotified[unit.ID] {
+				summary.NotNotified++
+			} else {
+				summary.Skipped++
+			}
 		case PlanStatusPending, PlanStatusBlocked:
 			summary.Pending++
 		case PlanStatusRunning:
 			summary.Running++
+		case PlanStatusCancelled:
+			summary.Cancelled++
 		}
 	}
 
@@ -587,6 +1002,17 @@ func (s *ParallelScheduler) publishEvent(
 	runID, planUnitID string,
 	eventType EventType,
 	message, level string,
+) {
+	s.publishEventDetails(ctx, runID, planUnitID, eventType, message, level, nil)
+}
+
+// publishEventDetails publishes an execution event with additional details.
+func (s *ParallelScheduler) publishEventDetails(
+	ctx context.Context,
+	runID, planUnitID string,
+	eventType EventType,
+	message, level string,
+	details map[string]interface{},
 ) {
 	if s.eventPublisher == nil {
 		return
@@ -599,6 +1025,7 @@ func (s *ParallelScheduler) publishEvent(
 		RunID:      runID,
 		PlanUnitID: planUnitID,
 		Message:    message,
+		Details:    details,
 		Level:      level,
 	}
 
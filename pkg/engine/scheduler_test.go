@@ -3,6 +3,7 @@ package engine
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"sync"
 	"testing"
 	"time"
@@ -12,14 +13,18 @@ import (
 type mockExecutor struct {
 	mu             sync.Mutex
 	executionDelay time.Duration
+	unitDelays     map[string]time.Duration
 	failUnits      map[string]bool
+	unchangedUnits map[string]bool
 	executedUnits  []string
 }
 
 func newMockExecutor() *mockExecutor {
 	return &mockExecutor{
 		executionDelay: 10 * time.Millisecond,
+		unitDelays:     make(map[string]time.Duration),
 		failUnits:      make(map[string]bool),
+		unchangedUnits: make(map[string]bool),
 		executedUnits:  make([]string, 0),
 	}
 }
@@ -32,11 +37,16 @@ func (m *mockExecutor) ExecuteUnit(ctx context.Context, unit *PlanUnit) (*Execut
 	m.mu.Lock()
 	m.executedUnits = append(m.executedUnits, unit.ID)
 	shouldFail := m.failUnits[unit.ID]
+	unchanged := m.unchangedUnits[unit.ID]
+	delay, ok := m.unitDelays[unit.ID]
+	if !ok {
+		delay = m.executionDelay
+	}
 	m.mu.Unlock()
 
 	// Simulate execution time
 	select {
-	case <-time.After(m.executionDelay):
+	case <-time.After(delay):
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	}
@@ -56,6 +66,7 @@ func (m *mockExecutor) ExecuteUnit(ctx context.Context, unit *PlanUnit) (*Execut
 	}
 
 	result.Status = PlanStatusSucceeded
+	result.Changed = !unchanged && unit.Operation.IsMutating()
 	return result, nil
 }
 
@@ -428,6 +439,34 @@ func TestScheduler_Schedule_ParallelExecution(t *testing.T) {
 	}
 }
 
+func TestScheduler_ReadyQueue_FailFastCancelsRemainingUnits(t *testing.T) {
+	executor := newMockExecutor()
+	executor.failUnits["c0-0"] = true
+	stateMgr := newMockStateManager()
+	scheduler := NewParallelScheduler(5, executor, newMockEventPublisher(), stateMgr)
+
+	ctx := context.Background()
+	plan := newChainPlan(t, 2, 3)
+
+	runID, err := scheduler.Schedule(ctx, plan, ScheduleOptions{MaxParallel: 1, FailFast: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(200 * time.Millisecond)
+
+	run, err := stateMgr.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("Failed to get run: %v", err)
+	}
+
+	// The ready unit of the other chain and everything waiting never start
+	if run.Summary.Failed != 1 || run.Summary.Cancelled != 5 {
+		t.Errorf("Expected 1 failed and 5 cancelled, got %+v", run.Summary)
+	}
+}
+
 func TestScheduler_Schedule_FailedUnit(t *testing.T) {
 	executor := newMockExecutor()
 	executor.failUnits["unit2"] = true // Make unit2 fail
@@ -686,3 +725,357 @@ func TestScheduler_GetStatus_NotFound(t *testing.T) {
 		t.Fatal("Expected error for non-existent run, got nil")
 	}
 }
+
+// newHandlerPlan builds a plan where two units notify a handler and a third unit requires it.
+func newHandlerPlan(t *testing.T) *Plan {
+	t.Helper()
+
+	plan := &Plan{
+		ID:        "plan1",
+		CreatedAt: time.Now(),
+		Units: []PlanUnit{
+			{
+				ID:         "config1",
+				ResourceID: "nginx_conf",
+				Operation:  OperationUpdate,
+				Status:     PlanStatusPending,
+				Timeout:    time.Minute,
+			},
+			{
+				ID:         "config2",
+				ResourceID: "nginx_site",
+				Operation:  OperationUpdate,
+				Status:     PlanStatusPending,
+				Timeout:    time.Minute,
+			},
+			{
+				ID:         "restart",
+				ResourceID: "nginx_restart",
+				Operation:  OperationUpdate,
+				Status:     PlanStatusPending,
+				Handler:    true,
+				Dependencies: []Dependency{
+					{TargetID: "config1", Type: DependencyNotify},
+					{TargetID: "config2", Type: DependencyNotify},
+				},
+				Timeout: time.Minute,
+			},
+			{
+				ID:         "check",
+				ResourceID: "nginx_check",
+				Operation:  OperationUpdate,
+				Status:     PlanStatusPending,
+				Dependencies: []Dependency{
+					{TargetID: "restart", Type: DependencyOrder},
+				},
+				Timeout: time.Minute,
+			},
+		},
+	}
+
+	graph, err := NewDAGBuilder().BuildGraph(plan.Units)
+	if err != nil {
+		t.Fatalf("Failed to build graph: %v", err)
+	}
+	plan.Graph = graph
+
+	return plan
+}
+
+func countExecutions(executor *mockExecutor, unitID string) int {
+	executor.mu.Lock()
+	defer executor.mu.Unlock()
+
+	count := 0
+	for _, id := range executor.executedUnits {
+		if id == unitID {
+			count++
+		}
+	}
+	return count
+}
+
+func TestScheduler_Handler_RunsOnceWhenNotified(t *testing.T) {
+	executor := newMockExecutor()
+	publisher := newMockEventPublisher()
+	stateMgr := newMockStateManager()
+	scheduler := NewParallelScheduler(5, executor, publisher, stateMgr)
+
+	ctx := context.Background()
+	plan := newHandlerPlan(t)
+
+	runID, err := scheduler.Schedule(ctx, plan, ScheduleOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(200 * time.Millisecond)
+
+	if count := countExecutions(executor, "restart"); count != 1 {
+		t.Errorf("Expected handler to run once, ran %d times", count)
+	}
+
+	run, err := stateMgr.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("Failed to get run: %v", err)
+	}
+
+	if run.Status != RunStatusSucceeded {
+		t.Errorf("Expected run status SUCCEEDED, got %s", run.Status)
+	}
+
+	if run.Summary.Succeeded != 4 {
+		t.Errorf("Expected 4 succeeded units, got %d", run.Summary.Succeeded)
+	}
+}
+
+func TestScheduler_Handler_SkippedWhenNothingChanged(t *testing.T) {
+	executor := newMockExecutor()
+	executor.unchangedUnits["config1"] = true
+	executor.unchangedUnits["config2"] = true
+	publisher := newMockEventPublisher()
+	stateMgr := newMockStateManager()
+	scheduler := NewParallelScheduler(5, executor, publisher, stateMgr)
+
+	ctx := context.Background()
+	plan := newHandlerPlan(t)
+
+	runID, err := scheduler.Schedule(ctx, plan, ScheduleOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(200 * time.Millisecond)
+
+	if count := countExecutions(executor, "restart"); count != 0 {
+		t.Errorf("Expected handler not to run, ran %d times", count)
+	}
+
+	run, err := stateMgr.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("Failed to get run: %v", err)
+	}
+
+	// A handler that was not notified does not degrade the run
+	if run.Status != RunStatusSucceeded {
+		t.Errorf("Expected run status SUCCEEDED, got %s", run.Status)
+	}
+
+	if run.Summary.NotNotified != 1 {
+		t.Errorf("Expected 1 not notified handler, got %d", run.Summary.NotNotified)
+	}
+
+	if run.Summary.Skipped != 0 {
+		t.Errorf("Expected 0 skipped units, got %d", run.Summary.Skipped)
+	}
+}
+
+func TestScheduler_Handler_NotifiedByFailedUnit(t *testing.T) {
+	executor := newMockExecutor()
+	executor.failUnits["config1"] = true
+	executor.unchangedUnits["config2"] = true
+	publisher := newMockEventPublisher()
+	stateMgr := newMockStateManager()
+	scheduler := NewParallelScheduler(5, executor, publisher, stateMgr)
+
+	ctx := context.Background()
+	plan := newHandlerPlan(t)
+
+	if _, err := scheduler.Schedule(ctx, plan, ScheduleOptions{}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(200 * time.Millisecond)
+
+	// A failed notifier never triggers the handler
+	if count := countExecutions(executor, "restart"); count != 0 {
+		t.Errorf("Expected handler not to run, ran %d times", count)
+	}
+}
+
+func TestScheduler_Handler_FlushAtEndOfLevel(t *testing.T) {
+	executor := newMockExecutor()
+	publisher := newMockEventPublisher()
+	stateMgr := newMockStateManager()
+	scheduler := NewParallelScheduler(5, executor, publisher, stateMgr)
+
+	ctx := context.Background()
+	plan := newHandlerPlan(t)
+
+	_, err := scheduler.Schedule(ctx, plan, ScheduleOptions{HandlerFlush: HandlerFlushLevel})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(200 * time.Millisecond)
+
+	executor.mu.Lock()
+	executed := append([]string{}, executor.executedUnits...)
+	executor.mu.Unlock()
+
+	if len(executed) != 4 {
+		t.Fatalf("Expected 4 executed units, got %d", len(executed))
+	}
+
+	// With level flushing the handler runs before units at later levels
+	if executed[2] != "restart" || executed[3] != "check" {
+		t.Errorf("Expected handler before dependent unit, got order %v", executed)
+	}
+}
+
+// newChainPlan builds independent chains of units. The unit at position i of
+// chain c has ID "c<c>-<i>" and depends on the previous unit of its chain.
+func newChainPlan(tb testing.TB, chains, length int) *Plan {
+	tb.Helper()
+
+	plan := &Plan{
+		ID:        "plan1",
+		CreatedAt: time.Now(),
+		Units:     make([]PlanUnit, 0, chains*length),
+	}
+
+	for c := 0; c < chains; c++ {
+		for i := 0; i < length; i++ {
+			unit := PlanUnit{
+				ID:         fmt.Sprintf("c%d-%d", c, i),
+				ResourceID: fmt.Sprintf("resource_c%d_%d", c, i),
+				Operation:  OperationUpdate,
+				Status:     PlanStatusPending,
+				Timeout:    time.Minute,
+			}
+			if i > 0 {
+				unit.Dependencies = []Dependency{
+					{TargetID: fmt.Sprintf("c%d-%d", c, i-1), Type: DependencyRequire},
+				}
+			}
+			plan.Units = append(plan.Units, unit)
+		}
+	}
+
+	graph, err := NewDAGBuilder().BuildGraph(plan.Units)
+	if err != nil {
+		tb.Fatalf("Failed to build graph: %v", err)
+	}
+	plan.Graph = graph
+
+	return plan
+}
+
+func TestScheduler_ReadyQueue_StartsUnitsWhenDependenciesFinish(t *testing.T) {
+	executor := newMockExecutor()
+	executor.unitDelays["c0-0"] = 100 * time.Millisecond
+	stateMgr := newMockStateManager()
+	scheduler := NewParallelScheduler(5, executor, newMockEventPublisher(), stateMgr)
+
+	ctx := context.Background()
+	plan := newChainPlan(t, 2, 2)
+
+	runID, err := scheduler.Schedule(ctx, plan, ScheduleOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(250 * time.Millisecond)
+
+	executor.mu.Lock()
+	executed := append([]string{}, executor.executedUnits...)
+	executor.mu.Unlock()
+
+	if len(executed) != 4 {
+		t.Fatalf("Expected 4 executed units, got %d", len(executed))
+	}
+
+	// The fast chain must not wait for the slow unit at level 0
+	position := make(map[string]int)
+	for i, id := range executed {
+		position[id] = i
+	}
+	if position["c1-1"] > position["c0-1"] {
+		t.Errorf("Expected fast chain to finish first, got order %v", executed)
+	}
+
+	run, err := stateMgr.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("Failed to get run: %v", err)
+	}
+
+	if run.Status != RunStatusSucceeded {
+		t.Errorf("Expected run status SUCCEEDED, got %s", run.Status)
+	}
+}
+
+func TestScheduler_ReadyQueue_SkipsDependentsOfFailedUnit(t *testing.T) {
+	executor := newMockExecutor()
+	executor.failUnits["c0-0"] = true
+	stateMgr := newMockStateManager()
+	scheduler := NewParallelScheduler(5, executor, newMockEventPublisher(), stateMgr)
+
+	ctx := context.Background()
+	plan := newChainPlan(t, 2, 3)
+
+	runID, err := scheduler.Schedule(ctx, plan, ScheduleOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(200 * time.Millisecond)
+
+	run, err := stateMgr.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("Failed to get run: %v", err)
+	}
+
+	if run.Summary.Succeeded != 3 || run.Summary.Failed != 1 || run.Summary.Skipped != 2 {
+		t.Errorf("Expected 3 succeeded, 1 failed and 2 skipped, got %+v", run.Summary)
+	}
+}
+
+func TestScheduler_Schedule_InvalidStrategy(t *testing.T) {
+	scheduler := NewParallelScheduler(5, newMockExecutor(), newMockEventPublisher(), newMockStateManager())
+	plan := newChainPlan(t, 1, 1)
+
+	_, err := scheduler.Schedule(context.Background(), plan, ScheduleOptions{Strategy: "random"})
+	if err == nil {
+		t.Fatal("Expected error for invalid strategy, got nil")
+	}
+}
+
+// benchmarkUnevenDAG runs a wide DAG of chains in which each chain has one
+// slow unit, at a different level per chain.
+func benchmarkUnevenDAG(b *testing.B, strategy ScheduleStrategy) {
+	const (
+		chains = 8
+		length = 4
+	)
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		executor := newMockExecutor()
+		executor.executionDelay = time.Millisecond
+		for c := 0; c < chains; c++ {
+			executor.unitDelays[fmt.Sprintf("c%d-%d", c, c%length)] = 20 * time.Millisecond
+		}
+		scheduler := NewParallelScheduler(chains, executor, nil, newMockStateManager())
+		plan := newChainPlan(b, chains, length)
+		run := &Run{ID: "run1", PlanID: plan.ID, StartedAt: time.Now(), Metadata: make(map[string]interface{})}
+		b.StartTimer()
+
+		if err := scheduler.executeRun(context.Background(), run, plan, ScheduleOptions{Strategy: strategy}); err != nil {
+			b.Fatalf("Run failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkScheduler_UnevenDAG_ReadyQueue(b *testing.B) {
+	benchmarkUnevenDAG(b, ScheduleStrategyReadyQueue)
+}
+
+func BenchmarkScheduler_UnevenDAG_Levels(b *testing.B) {
+	benchmarkUnevenDAG(b, ScheduleStrategyLevels)
+}
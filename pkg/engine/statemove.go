@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/openfroyo/openfroyo/pkg/stores"
+)
+
+// stateMovePageSize is the page size used to scan resource state.
+const stateMovePageSize = 500
+
+// StateMove is one resource state renamed by MoveResourceState.
+type StateMove struct {
+	// From is the address the state was stored under.
+	From string `json:"from"`
+
+	// To is the address the state is now stored under.
+	To string `json:"to"`
+}
+
+// MoveResourceState moves the state of a resource to a new address, so that
+// a renamed or re-keyed declaration adopts the existing state instead of
+// destroying and recreating it.
+//
+// Addresses name a resource ("users") or one of its for_each instances
+// ("users[alice]"). Moving an instance moves only that instance, which
+// allows re-keying it or moving it in or out of a for_each. Moving a whole
+// resource also moves each of its instances, keeping their keys.
+//
+// Every target address must be free; nothing is moved otherwise.
+func MoveResourceState(ctx context.Context, store stores.Store, resourceType, from, to string) ([]StateMove, error) {
+	fromID, fromKey, err := ParseResourceAddress(from)
+	if err != nil {
+		return nil, err
+	}
+	toID, toKey, err := ParseResourceAddress(to)
+	if err != nil {
+		return nil, err
+	}
+
+	if from == to {
+		return nil, NewPermanentError("source and destination addresses are the same", nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	// Step 1: Find the states to move
+	states, err := listResourceStates(ctx, store, resourceType)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]bool, len(states))
+	for _, state := range states {
+		existing[state.ResourceName] = true
+	}
+
+	var moves []StateMove
+	if fromKey != "" || toKey != "" {
+		if existing[from] {
+			moves = append(moves, StateMove{From: from, To: to})
+		}
+	} else {
+		if existing[fromID] {
+			moves = append(moves, StateMove{From: fromID, To: toID})
+		}
+		for _, state := range states {
+			id, key, err := ParseResourceAddress(state.ResourceName)
+			if err == nil && id == fromID && key != "" {
+				moves = append(moves, StateMove{From: state.ResourceName, To: InstanceID(toID, key)})
+			}
+		}
+	}
+
+	if len(moves) == 0 {
+		return nil, NewPermanentError(fmt.Sprintf("no %s state found at %s", resourceType, from), nil).
+			WithCode(ErrCodeNotFound)
+	}
+
+	// Step 2: Refuse to overwrite existing state
+	for _, move := range moves {
+		if existing[move.To] {
+			return nil, NewConflictError(fmt.Sprintf("%s state already exists at %s", resourceType, move.To), nil).
+				WithCode(ErrCodeAlreadyExists)
+		}
+	}
+
+	// Step 3: Rename every state in one transaction
+	names := make(map[string]string, len(moves))
+	for _, move := range moves {
+		names[move.From] = move.To
+	}
+	if err := store.RenameResourceStates(ctx, resourceType, names); err != nil {
+		return nil, fmt.Errorf("failed to move %s to %s: %w", from, to, err)
+	}
+
+	return moves, nil
+}
+
+// listResourceStates returns all resource states of a type.
+func listResourceStates(ctx context.Context, store stores.Store, resourceType string) ([]*stores.ResourceState, error) {
+	var result []*stores.ResourceState
+	for offset := 0; ; offset += stateMovePageSize {
+		page, err := store.ListResourceStates(ctx, stateMovePageSize, offset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list resource states: %w", err)
+		}
+
+		for _, state := range page {
+			if state.ResourceType == resourceType {
+				result = append(result, state)
+			}
+		}
+
+		if len(page) < stateMovePageSize {
+			return result, nil
+		}
+	}
+}
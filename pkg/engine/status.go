@@ -248,6 +248,9 @@ const (
 	// EventTypePlanUnitFailed indicates a plan unit has failed.
 	EventTypePlanUnitFailed EventType = "plan_unit_failed"
 
+	// EventTypePlanUnitRetrying indicates a plan unit attempt failed and will be retried.
+	EventTypePlanUnitRetrying EventType = "plan_unit_retrying"
+
 	// EventTypeResourceChanged indicates a resource state has changed.
 	EventTypeResourceChanged EventType = "resource_changed"
 
@@ -257,6 +260,21 @@ const (
 	// EventTypeDriftDetected indicates drift was detected.
 	EventTypeDriftDetected EventType = "drift_detected"
 
+	// EventTypeFactChanged indicates a collected fact changed on a host.
+	EventTypeFactChanged EventType = "fact_changed"
+
+	// EventTypeHealthCheckPassed indicates a health check passed on a host.
+	EventTypeHealthCheckPassed EventType = "health_check_passed"
+
+	// EventTypeHealthCheckFailed indicates a health check failed on a host.
+	EventTypeHealthCheckFailed EventType = "health_check_failed"
+
+	// EventTypeHookSucceeded indicates a hook succeeded.
+	EventTypeHookSucceeded EventType = "hook_succeeded"
+
+	// EventTypeHookFailed indicates a hook failed.
+	EventTypeHookFailed EventType = "hook_failed"
+
 	// EventTypeError indicates an error occurred.
 	EventTypeError EventType = "error"
 
@@ -270,9 +288,9 @@ const (
 // Severity returns the severity level of the event type.
 func (e EventType) Severity() string {
 	switch e {
-	case EventTypeRunFailed, EventTypePlanUnitFailed, EventTypeError:
+	case EventTypeRunFailed, EventTypePlanUnitFailed, EventTypeHealthCheckFailed, EventTypeHookFailed, EventTypeError:
 		return "error"
-	case EventTypeWarning:
+	case EventTypeWarning, EventTypePlanUnitRetrying:
 		return "warning"
 	default:
 		return "info"
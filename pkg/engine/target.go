@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// TargetSelector selects the hosts a resource is applied to. Every criterion
+// that is set must match; All selects every host.
+type TargetSelector struct {
+	// Hosts lists host IDs or glob patterns (e.g. "web*").
+	Hosts []string `json:"hosts,omitempty"`
+
+	// Labels matches hosts with all of these labels.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Selector is a label selector expression (e.g. "env=prod,role=web").
+	Selector string `json:"selector,omitempty"`
+
+	// All selects every host.
+	All bool `json:"all,omitempty"`
+}
+
+// IsEmpty reports whether the selector selects nothing, in which case the
+// resource is not bound to any host.
+func (t *TargetSelector) IsEmpty() bool {
+	return t == nil || (len(t.Hosts) == 0 && len(t.Labels) == 0 && t.Selector == "" && !t.All)
+}
+
+// Validate checks that the host patterns and the label selector are well formed.
+func (t *TargetSelector) Validate() error {
+	for _, pattern := range t.Hosts {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return NewPermanentError(fmt.Sprintf("invalid target host pattern: %q", pattern), err).
+				WithCode(ErrCodeValidation)
+		}
+	}
+
+	if t.Selector != "" && t.Selector != "all" && len(parseSelector(t.Selector)) == 0 {
+		return NewPermanentError(fmt.Sprintf("invalid target selector: %q", t.Selector), nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	return nil
+}
+
+// Matches reports whether the selector selects the host.
+func (t *TargetSelector) Matches(host *Host) bool {
+	if t.IsEmpty() {
+		return false
+	}
+
+	if len(t.Hosts) > 0 {
+		matched := false
+		for _, pattern := range t.Hosts {
+			if ok, _ := path.Match(pattern, host.ID); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return hasLabels(host, t.Labels) && hasLabels(host, parseSelector(t.Selector))
+}
+
+// hasLabels reports whether the host has all of the labels.
+func hasLabels(host *Host, labels map[string]string) bool {
+	for key, value := range labels {
+		if host.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// HostLister lists the managed hosts that resource targets are resolved
+// against. HostRegistry implements it.
+type HostLister interface {
+	// ListHosts lists all registered hosts.
+	ListHosts(ctx context.Context) ([]*Host, error)
+}
+
+// HostResourceID returns the ID of the instance of a resource on a host.
+func HostResourceID(resourceID, hostID string) string {
+	return resourceID + "@" + hostID
+}
+
+// resourceAddresses returns the IDs a plan unit's resource is known by:
+// its own ID, the ID of its for_each resource and the ID of the resource
+// before it was expanded over hosts, most specific first. An instance of a
+// targeted for_each resource, such as users@web1[alice], is also known by
+// the addresses dependencies refer to it by: users[alice]@web1 on its host
+// and users[alice].
+func resourceAddresses(resourceID string) []string {
+	addresses := []string{resourceID}
+
+	base, key, err := ParseResourceAddress(resourceID)
+	if err != nil || key == "" {
+		base, key = resourceID, ""
+	}
+
+	id, host, targeted := strings.Cut(base, "@")
+	switch {
+	case targeted && key != "":
+		addresses = append(addresses, HostResourceID(InstanceID(id, key), host), base, InstanceID(id, key), id)
+	case targeted:
+		addresses = append(addresses, id)
+	case key != "":
+		addresses = append(addresses, base)
+	}
+
+	return addresses
+}
+
+// ExpandTargets expands a resource with a target selector into one instance
+// per selected host, in the order of hosts. Each instance gets the ID
+// "<id>@<host>" and the host as its TargetID. Resources without a target
+// selector are returned unchanged.
+func ExpandTargets(resource *Resource, hosts []*Host) ([]Resource, error) {
+	if resource.Target.IsEmpty() {
+		return []Resource{*resource}, nil
+	}
+
+	if err := resource.Target.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid target of resource %s: %w", resource.ID, err)
+	}
+
+	instances := make([]Resource, 0, len(hosts))
+	for _, host := range hosts {
+		if !resource.Target.Matches(host) {
+			continue
+		}
+
+		instance := *resource
+		instance.ID = HostResourceID(resource.ID, host.ID)
+		instance.TargetID = host.ID
+		instance.Target = nil
+		instances = append(instances, instance)
+	}
+
+	return instances, nil
+}
@@ -0,0 +1,151 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestTargetSelector_Matches(t *testing.T) {
+	host := &Host{ID: "web1", Labels: map[string]string{"env": "prod", "role": "web"}}
+
+	tests := []struct {
+		name   string
+		target *TargetSelector
+		want   bool
+	}{
+		{"nil", nil, false},
+		{"empty", &TargetSelector{}, false},
+		{"all", &TargetSelector{All: true}, true},
+		{"host id", &TargetSelector{Hosts: []string{"db1", "web1"}}, true},
+		{"host pattern", &TargetSelector{Hosts: []string{"web*"}}, true},
+		{"other host", &TargetSelector{Hosts: []string{"db*"}}, false},
+		{"labels", &TargetSelector{Labels: map[string]string{"env": "prod"}}, true},
+		{"other labels", &TargetSelector{Labels: map[string]string{"env": "staging"}}, false},
+		{"selector", &TargetSelector{Selector: "env=prod,role=web"}, true},
+		{"pattern and labels", &TargetSelector{Hosts: []string{"web*"}, Labels: map[string]string{"role": "db"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.target.Matches(host); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandTargets(t *testing.T) {
+	hosts := []*Host{
+		{ID: "db1", Labels: map[string]string{"role": "db"}},
+		{ID: "web1", Labels: map[string]string{"role": "web"}},
+		{ID: "web2", Labels: map[string]string{"role": "web"}},
+	}
+
+	resource := &Resource{ID: "nginx", Type: "linux.pkg", Target: &TargetSelector{Selector: "role=web"}}
+	instances, err := ExpandTargets(resource, hosts)
+	if err != nil {
+		t.Fatalf("Failed to expand targets: %v", err)
+	}
+
+	if len(instances) != 2 {
+		t.Fatalf("Expected 2 instances, got %d", len(instances))
+	}
+	for i, host := range []string{"web1", "web2"} {
+		if instances[i].ID != "nginx@"+host || instances[i].TargetID != host || instances[i].Target != nil {
+			t.Errorf("Unexpected instance on %s: %+v", host, instances[i])
+		}
+	}
+
+	// Resources without a target are left alone
+	instances, err = ExpandTargets(&Resource{ID: "local"}, hosts)
+	if err != nil || len(instances) != 1 || instances[0].ID != "local" {
+		t.Errorf("Expected the untargeted resource unchanged, got %+v (%v)", instances, err)
+	}
+
+	// A selector without any label pair is rejected rather than matching every host
+	if _, err := ExpandTargets(&Resource{ID: "bad", Target: &TargetSelector{Selector: "web1"}}, hosts); err == nil {
+		t.Error("Expected error for a selector without labels, got nil")
+	}
+}
+
+func TestResourceAddresses(t *testing.T) {
+	tests := map[string][]string{
+		"nginx":             {"nginx"},
+		"nginx@web1":        {"nginx@web1", "nginx"},
+		"users[alice]":      {"users[alice]", "users"},
+		"users@web1[alice]": {"users@web1[alice]", "users[alice]@web1", "users@web1", "users[alice]", "users"},
+	}
+
+	for id, want := range tests {
+		if got := resourceAddresses(id); !reflect.DeepEqual(got, want) {
+			t.Errorf("resourceAddresses(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestPlanner_BuildPlan_DependsOnTargetedForEachInstance(t *testing.T) {
+	ctx := context.Background()
+	registry := NewHostRegistry(newTestSQLiteStore(t))
+	for _, id := range []string{"web1", "web2"} {
+		if err := registry.AddHost(ctx, &Host{ID: id, Address: id}); err != nil {
+			t.Fatalf("Failed to add host: %v", err)
+		}
+	}
+
+	planner := NewPlanner(&mockProviderRegistry{providers: make(map[string]Provider)}, newMockStateManager())
+	planner.SetHosts(registry)
+
+	target := &TargetSelector{Hosts: []string{"web*"}}
+	config := &Config{
+		ID: "test-config",
+		Resources: []Resource{
+			{
+				ID:      "users",
+				Type:    "linux.user",
+				Config:  json.RawMessage(`{"name": "${each.key}"}`),
+				Target:  target,
+				ForEach: &ForEach{Items: []interface{}{"alice", "bob"}},
+			},
+			{
+				ID:           "alice_sudo",
+				Type:         "linux.file",
+				Config:       json.RawMessage(`{"path": "/etc/sudoers.d/alice"}`),
+				Target:       target,
+				Dependencies: []string{"users[alice]"},
+			},
+		},
+	}
+
+	diff, err := planner.ComputeDiff(ctx, config, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	plan, err := planner.BuildPlan(ctx, diff)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(plan.Units) != 6 {
+		t.Fatalf("Expected 6 plan units, got %d", len(plan.Units))
+	}
+
+	unitIDs := make(map[string]string, len(plan.Units))
+	for _, unit := range plan.Units {
+		unitIDs[unit.ResourceID] = unit.ID
+	}
+
+	// Each host's sudoers file waits for alice on the same host only
+	for _, host := range []string{"web1", "web2"} {
+		for _, unit := range plan.Units {
+			if unit.ResourceID != HostResourceID("alice_sudo", host) {
+				continue
+			}
+			want := unitIDs[InstanceID(HostResourceID("users", host), "alice")]
+			if len(unit.Dependencies) != 1 || unit.Dependencies[0].TargetID != want {
+				t.Errorf("Expected alice_sudo on %s to depend on %s, got %+v", host, want, unit.Dependencies)
+			}
+		}
+	}
+}
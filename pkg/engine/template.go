@@ -0,0 +1,141 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// placeholderResolver resolves the reference inside a ${...} placeholder.
+// It reports false for references it does not handle, which are left as is.
+type placeholderResolver func(ref string) (interface{}, bool, error)
+
+// renderConfig replaces the placeholders handled by resolve in a JSON config.
+func renderConfig(config json.RawMessage, resolve placeholderResolver) (json.RawMessage, error) {
+	if len(config) == 0 {
+		return config, nil
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(config, &decoded); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+
+	rendered, err := renderPlaceholders(decoded, resolve)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(rendered)
+}
+
+// renderPlaceholders replaces the placeholders handled by resolve in the
+// strings of a decoded config.
+func renderPlaceholders(config interface{}, resolve placeholderResolver) (interface{}, error) {
+	switch v := config.(type) {
+	case map[string]interface{}:
+		rendered := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			value, err := renderPlaceholders(item, resolve)
+			if err != nil {
+				return nil, err
+			}
+			rendered[key] = value
+		}
+		return rendered, nil
+	case []interface{}:
+		rendered := make([]interface{}, len(v))
+		for i, item := range v {
+			value, err := renderPlaceholders(item, resolve)
+			if err != nil {
+				return nil, err
+			}
+			rendered[i] = value
+		}
+		return rendered, nil
+	case string:
+		return renderString(v, resolve)
+	default:
+		return config, nil
+	}
+}
+
+// factsResolver resolves ${facts.<namespace>.<path>} references against the
+// facts of a host keyed by namespace.
+func factsResolver(facts map[string]any) placeholderResolver {
+	return func(ref string) (interface{}, bool, error) {
+		if !strings.HasPrefix(ref, "facts.") {
+			return nil, false, nil
+		}
+
+		path := strings.TrimPrefix(ref, "facts.")
+		value, ok := lookupFact(facts, path)
+		if !ok {
+			return nil, true, fmt.Errorf("fact %s not found", path)
+		}
+
+		return value, true, nil
+	}
+}
+
+// renderString replaces the placeholders handled by resolve in a string. A
+// string consisting of a single placeholder takes the type of its value.
+func renderString(s string, resolve placeholderResolver) (interface{}, error) {
+	if strings.HasPrefix(s, "${") && strings.IndexByte(s, '}') == len(s)-1 {
+		value, ok, err := resolve(s[2 : len(s)-1])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return value, nil
+		}
+		return s, nil
+	}
+
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			b.WriteString(s)
+			break
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			b.WriteString(s)
+			break
+		}
+
+		placeholder := s[start : start+end+1]
+		value, ok, err := resolve(placeholder[2 : len(placeholder)-1])
+		if err != nil {
+			return nil, err
+		}
+
+		b.WriteString(s[:start])
+		if ok {
+			b.WriteString(formatPlaceholderValue(value))
+		} else {
+			b.WriteString(placeholder)
+		}
+		s = s[start+end+1:]
+	}
+
+	return b.String(), nil
+}
+
+// formatPlaceholderValue formats a value substituted into a longer string.
+// Objects and lists are written as JSON.
+func formatPlaceholderValue(value interface{}) string {
+	switch v := value.(type) {
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	case nil:
+		return ""
+	default:
+		return formatFactValue(v)
+	}
+}
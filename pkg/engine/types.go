@@ -34,6 +34,38 @@ type Resource struct {
 	// Dependencies lists resource IDs that this resource depends on.
 	Dependencies []string `json:"dependencies,omitempty"`
 
+	// Handler marks the resource as a handler that only runs when notified.
+	Handler bool `json:"handler,omitempty"`
+
+	// NotifiedBy lists resource IDs whose changes trigger this handler.
+	NotifiedBy []string `json:"notified_by,omitempty"`
+
+	// Lifecycle customizes how changes to this resource are planned.
+	Lifecycle *Lifecycle `json:"lifecycle,omitempty"`
+
+	// Retry overrides how operations on this resource are retried.
+	Retry *RetryPolicy `json:"retry,omitempty"`
+
+	// When is a condition on the facts of the target host. The resource is
+	// skipped on hosts where it does not hold.
+	When *Condition `json:"when,omitempty"`
+
+	// ForEach expands the resource into one instance per entry of a collection.
+	ForEach *ForEach `json:"for_each,omitempty"`
+
+	// Checks run against the target host after the resource is applied.
+	Checks []HealthCheck `json:"checks,omitempty"`
+
+	// Hooks run before and after the resource is applied.
+	Hooks *ResourceHooks `json:"hooks,omitempty"`
+
+	// Target selects the hosts the resource is applied to. The planner
+	// expands the resource into one instance per selected host.
+	Target *TargetSelector `json:"target,omitempty"`
+
+	// TargetID is the ID of the host this resource is applied to, if any.
+	TargetID string `json:"target_id,omitempty"`
+
 	// CreatedAt is when the resource was first created.
 	CreatedAt time.Time `json:"created_at"`
 
@@ -52,6 +84,9 @@ type PlanUnit struct {
 	// ResourceID is the ID of the resource this plan unit operates on.
 	ResourceID string `json:"resource_id"`
 
+	// TargetID is the ID of the host this plan unit runs against, if any.
+	TargetID string `json:"target_id,omitempty"`
+
 	// Operation is the type of operation to perform.
 	Operation OperationType `json:"operation"`
 
@@ -88,6 +123,30 @@ type PlanUnit struct {
 	// Timeout is the maximum duration for executing this plan unit.
 	Timeout time.Duration `json:"timeout"`
 
+	// Handler marks the unit as a handler that only executes when one of its
+	// notify dependencies actually changed something.
+	Handler bool `json:"handler,omitempty"`
+
+	// Lifecycle carries the lifecycle options of the resource.
+	Lifecycle *Lifecycle `json:"lifecycle,omitempty"`
+
+	// Labels are the labels of the resource, used by label concurrency limits.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Retry is the retry policy of the resource. When nil the scheduler's
+	// default backoff is used with MaxRetries.
+	Retry *RetryPolicy `json:"retry,omitempty"`
+
+	// Checks run against the target host once the unit succeeds, unless it
+	// deletes the resource.
+	Checks []HealthCheck `json:"checks,omitempty"`
+
+	// Hooks run before and after the unit executes.
+	Hooks *ResourceHooks `json:"hooks,omitempty"`
+
+	// Wait is the condition polled instead of executing, for wait resources.
+	Wait *WaitCondition `json:"wait,omitempty"`
+
 	// Metadata contains additional plan unit metadata.
 	Metadata map[string]interface{} `json:"metadata,omitempty"`
 
@@ -95,6 +154,20 @@ type PlanUnit struct {
 	Result *ExecutionResult `json:"result,omitempty"`
 }
 
+// Lifecycle contains meta-options that control how a resource is planned.
+type Lifecycle struct {
+	// PreventDestroy rejects any plan that would delete or recreate the resource.
+	PreventDestroy bool `json:"prevent_destroy,omitempty"`
+
+	// CreateBeforeDestroy creates the replacement before destroying the
+	// existing resource when it must be recreated.
+	CreateBeforeDestroy bool `json:"create_before_destroy,omitempty"`
+
+	// IgnoreChanges lists JSON paths (e.g., "version" or "tags.owner") that
+	// are excluded from diffing.
+	IgnoreChanges []string `json:"ignore_changes,omitempty"`
+}
+
 // Dependency represents an edge in the execution DAG.
 type Dependency struct {
 	// TargetID is the ID of the plan unit this depends on.
@@ -167,6 +240,11 @@ type ExecutionResult struct {
 	// NewState is the resulting state after the operation.
 	NewState json.RawMessage `json:"new_state,omitempty"`
 
+	// Changed indicates whether the operation modified the target.
+	// Units that find their resource already converged leave this false,
+	// so they neither notify handlers nor get rolled back.
+	Changed bool `json:"changed"`
+
 	// Output contains any output data from the provider.
 	Output json.RawMessage `json:"output,omitempty"`
 
@@ -230,6 +308,19 @@ type Plan struct {
 	// Summary provides high-level statistics about the plan.
 	Summary PlanSummary `json:"summary"`
 
+	// Skipped lists the resources left out of the plan, such as resources
+	// whose condition does not hold on their host.
+	Skipped []SkippedResource `json:"skipped,omitempty"`
+
+	// DataSources records the output of each data source read while planning.
+	DataSources map[string]json.RawMessage `json:"data_sources,omitempty"`
+
+	// Checks run against every host of the plan once all units finished.
+	Checks []HealthCheck `json:"checks,omitempty"`
+
+	// Hooks run around the whole run and around each host batch.
+	Hooks *RunHooks `json:"hooks,omitempty"`
+
 	// Metadata contains additional plan metadata.
 	Metadata map[string]interface{} `json:"metadata,omitempty"`
 }
@@ -253,6 +344,9 @@ type PlanSummary struct {
 
 	// NoChange is the number of resources with no changes.
 	NoChange int `json:"no_change"`
+
+	// Skipped is the number of resources skipped by their condition.
+	Skipped int `json:"skipped,omitempty"`
 }
 
 // ExecutionGraph represents the DAG of plan units.
@@ -346,6 +440,19 @@ type RunSummary struct {
 
 	// Running is the number of plan units currently running.
 	Running int `json:"running"`
+
+	// NotNotified is the number of handler units skipped because nothing notified them.
+	NotNotified int `json:"not_notified"`
+
+	// Cancelled is the number of plan units cancelled before they ran.
+	Cancelled int `json:"cancelled"`
+
+	// ChecksPassed is the number of post-apply checks that passed.
+	ChecksPassed int `json:"checks_passed,omitempty"`
+
+	// ChecksFailed is the number of post-apply checks that failed. Any failed
+	// check fails the run.
+	ChecksFailed int `json:"checks_failed,omitempty"`
 }
 
 // DriftDetection represents drift detection results for a resource.
@@ -407,6 +514,15 @@ type Config struct {
 	// Resources are the resources defined in the configuration.
 	Resources []Resource `json:"resources"`
 
+	// DataSources are read while planning, in order, before resources are diffed.
+	DataSources []DataSource `json:"data_sources,omitempty"`
+
+	// Checks are workspace checks run against every host once a plan is applied.
+	Checks []HealthCheck `json:"checks,omitempty"`
+
+	// Hooks are workspace hooks run around runs and host batches.
+	Hooks *RunHooks `json:"hooks,omitempty"`
+
 	// Variables are the configuration variables.
 	Variables map[string]interface{} `json:"variables,omitempty"`
 
@@ -0,0 +1,284 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// WaitResourceType is the resource type of wait resources. A wait resource
+// changes nothing: its unit polls a condition on its host until it holds, so
+// dependents only run once, for example, a database accepts connections.
+const WaitResourceType = "wait"
+
+// WaitType represents the kind of condition a wait resource polls.
+type WaitType string
+
+const (
+	// WaitPort waits until a TCP port accepts connections from the host.
+	WaitPort WaitType = "port"
+
+	// WaitHTTP waits until an HTTP endpoint returns the expected status, any 2xx by default.
+	WaitHTTP WaitType = "http"
+
+	// WaitFile waits until a file exists on the host.
+	WaitFile WaitType = "file"
+
+	// WaitSystemd waits until a systemd unit is active on the host.
+	WaitSystemd WaitType = "systemd"
+
+	// WaitCommand waits until a command exits with code zero on the host.
+	WaitCommand WaitType = "command"
+)
+
+// defaultWaitTimeout is used when a wait has no timeout.
+const defaultWaitTimeout = 5 * time.Minute
+
+// defaultWaitInterval is used when a wait has no interval.
+const defaultWaitInterval = 5 * time.Second
+
+// systemdUnitPattern matches valid systemd unit names.
+var systemdUnitPattern = regexp.MustCompile(`^[A-Za-z0-9:_.@\\-]+$`)
+
+// WaitCondition is the condition polled by the unit of a wait resource.
+type WaitCondition struct {
+	// Type is the kind of condition.
+	Type WaitType `json:"type"`
+
+	// Port is the TCP port polled by port waits.
+	Port int `json:"port,omitempty"`
+
+	// Address is the address port waits connect to, as seen from the host.
+	// Defaults to 127.0.0.1.
+	Address string `json:"address,omitempty"`
+
+	// URL is the endpoint polled by HTTP waits, as seen from the host.
+	URL string `json:"url,omitempty"`
+
+	// ExpectStatus is the status code an HTTP wait expects. Zero accepts any 2xx.
+	ExpectStatus int `json:"expect_status,omitempty"`
+
+	// Path is the file polled by file waits.
+	Path string `json:"path,omitempty"`
+
+	// Unit is the systemd unit polled by systemd waits.
+	Unit string `json:"unit,omitempty"`
+
+	// Command is the shell command polled by command waits.
+	Command string `json:"command,omitempty"`
+
+	// Timeout is how long to wait for the condition before failing.
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// Interval is the delay between polls.
+	Interval time.Duration `json:"interval,omitempty"`
+}
+
+// ParseWaitCondition decodes the config of a wait resource. Timeout and
+// interval are duration strings (e.g., "2m", "5s").
+func ParseWaitCondition(config json.RawMessage) (*WaitCondition, error) {
+	var raw struct {
+		WaitCondition
+		Timeout  string `json:"timeout,omitempty"`
+		Interval string `json:"interval,omitempty"`
+	}
+	if err := json.Unmarshal(config, &raw); err != nil {
+		return nil, NewPermanentError("invalid wait config", err).
+			WithCode(ErrCodeValidation)
+	}
+
+	condition := raw.WaitCondition
+	for _, field := range []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"timeout", raw.Timeout, &condition.Timeout},
+		{"interval", raw.Interval, &condition.Interval},
+	} {
+		if field.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(field.value)
+		if err != nil {
+			return nil, NewPermanentError(fmt.Sprintf("invalid wait %s %q", field.name, field.value), err).
+				WithCode(ErrCodeValidation)
+		}
+		*field.dest = duration
+	}
+
+	if err := condition.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &condition, nil
+}
+
+// Validate checks that the wait condition has the fields its type requires.
+func (w *WaitCondition) Validate() error {
+	var missing string
+	switch w.Type {
+	case WaitPort:
+		if w.Port <= 0 || w.Port > 65535 {
+			return NewPermanentError(fmt.Sprintf("port wait has invalid port %d", w.Port), nil).
+				WithCode(ErrCodeValidation)
+		}
+	case WaitHTTP:
+		if w.URL == "" {
+			missing = "url"
+		}
+	case WaitFile:
+		if w.Path == "" {
+			missing = "path"
+		}
+	case WaitSystemd:
+		if w.Unit == "" {
+			missing = "unit"
+		} else if !systemdUnitPattern.MatchString(w.Unit) {
+			return NewPermanentError(fmt.Sprintf("systemd wait has invalid unit %q", w.Unit), nil).
+				WithCode(ErrCodeValidation)
+		}
+	case WaitCommand:
+		if w.Command == "" {
+			missing = "command"
+		}
+	default:
+		return NewPermanentError(fmt.Sprintf("invalid wait type %q", w.Type), nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	if missing != "" {
+		return NewPermanentError(fmt.Sprintf("%s wait requires %s", w.Type, missing), nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	if w.Timeout < 0 || w.Interval < 0 {
+		return NewPermanentError("wait timeout and interval must not be negative", nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	if w.Interval > 0 && w.Interval > w.timeout() {
+		return NewPermanentError("wait interval must not exceed its timeout", nil).
+			WithCode(ErrCodeValidation)
+	}
+
+	return nil
+}
+
+// timeout returns the wait timeout or the default.
+func (w *WaitCondition) timeout() time.Duration {
+	if w.Timeout > 0 {
+		return w.Timeout
+	}
+	return defaultWaitTimeout
+}
+
+// interval returns the poll interval or the default, capped at the timeout.
+func (w *WaitCondition) interval() time.Duration {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = defaultWaitInterval
+	}
+	if interval > w.timeout() {
+		interval = w.timeout()
+	}
+	return interval
+}
+
+// check returns the health check polled for the condition.
+func (w *WaitCondition) check(name string) HealthCheck {
+	check := HealthCheck{Name: name}
+	switch w.Type {
+	case WaitPort:
+		check.Type = HealthCheckPort
+		check.Port = w.Port
+		check.Address = w.Address
+	case WaitHTTP:
+		check.Type = HealthCheckHTTP
+		check.URL = w.URL
+		check.ExpectStatus = w.ExpectStatus
+	case WaitFile:
+		check.Type = HealthCheckFile
+		check.Path = w.Path
+	case WaitSystemd:
+		check.Type = HealthCheckCommand
+		check.Command = "systemctl is-active --quiet " + w.Unit
+	case WaitCommand:
+		check.Type = HealthCheckCommand
+		check.Command = w.Command
+	}
+	return check
+}
+
+// planHasWaits reports whether the plan contains wait units.
+func planHasWaits(plan *Plan) bool {
+	for i := range plan.Units {
+		if plan.Units[i].Wait != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// executeWait polls the condition of a wait unit on its host until it holds
+// or the wait times out, over one connection to the host. Every failed poll
+// is published as an event.
+func (s *ParallelScheduler) executeWait(ctx context.Context, run *Run, unit *PlanUnit) (*ExecutionResult, error) {
+	wait := unit.Wait
+	check := wait.check(unit.ResourceID)
+	startTime := time.Now()
+
+	session := s.healthChecker.NewSession(unit.TargetID)
+	defer session.Close(context.Background())
+
+	ctx, cancel := context.WithTimeout(ctx, wait.timeout())
+	defer cancel()
+
+	var message string
+	for attempt := 1; ; attempt++ {
+		result, err := session.RunCheck(ctx, check)
+		if err == nil && result.Passed {
+			completedAt := time.Now()
+			return &ExecutionResult{
+				PlanUnitID:  unit.ID,
+				Status:      PlanStatusSucceeded,
+				StartedAt:   startTime,
+				CompletedAt: completedAt,
+				Duration:    completedAt.Sub(startTime),
+				Metrics: map[string]interface{}{
+					"attempts": attempt,
+				},
+			}, nil
+		}
+
+		if err != nil {
+			message = err.Error()
+		} else {
+			message = result.Message
+		}
+
+		s.publishEventDetails(ctx, run.ID, unit.ID, EventTypeInfo,
+			fmt.Sprintf("Waiting for %s on %s: %s", unit.ResourceID, unit.TargetID, message), "info",
+			map[string]interface{}{
+				"wait":    wait.Type,
+				"host_id": unit.TargetID,
+				"attempt": attempt,
+			})
+
+		select {
+		case <-time.After(wait.interval()):
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return nil, ctx.Err()
+			}
+			return nil, NewPermanentError(
+				fmt.Sprintf("timed out after %s waiting for %s on %s: %s",
+					wait.timeout(), unit.ResourceID, unit.TargetID, message),
+				ctx.Err(),
+			).WithCode(ErrCodeTimeout).WithResource(unit.ResourceID)
+		}
+	}
+}
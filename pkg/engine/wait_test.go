@@ -0,0 +1,281 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyHealthChecker fails checks until it has been called a number of times.
+type flakyHealthChecker struct {
+	mu        sync.Mutex
+	failTimes int
+	calls     int
+	sessions  int
+	checks    []HealthCheck
+}
+
+func (f *flakyHealthChecker) RunCheck(ctx context.Context, hostID string, check HealthCheck) (*HealthCheckResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	f.checks = append(f.checks, check)
+	if f.calls <= f.failTimes {
+		return &HealthCheckResult{Name: check.Name, HostID: hostID, Message: "connection refused"}, nil
+	}
+	return &HealthCheckResult{Name: check.Name, HostID: hostID, Passed: true}, nil
+}
+
+func (f *flakyHealthChecker) RunChecks(ctx context.Context, hostID string, checks []HealthCheck) []*HealthCheckResult {
+	results := make([]*HealthCheckResult, len(checks))
+	for i, check := range checks {
+		results[i], _ = f.RunCheck(ctx, hostID, check)
+	}
+	return results
+}
+
+func (f *flakyHealthChecker) NewSession(hostID string) HealthCheckSession {
+	f.mu.Lock()
+	f.sessions++
+	f.mu.Unlock()
+
+	return &mockCheckSession{checker: f, hostID: hostID}
+}
+
+// newWaitPlan returns a plan that waits on db1 before running a migration.
+func newWaitPlan(t *testing.T, wait *WaitCondition) *Plan {
+	t.Helper()
+
+	plan := &Plan{
+		ID:        "plan1",
+		CreatedAt: time.Now(),
+		Units: []PlanUnit{
+			{
+				ID:         "db-ready",
+				ResourceID: "db_ready",
+				TargetID:   "db1",
+				Operation:  OperationCreate,
+				Status:     PlanStatusPending,
+				Timeout:    time.Minute,
+				Wait:       wait,
+			},
+			{
+				ID:         "migrate",
+				ResourceID: "migrate",
+				TargetID:   "db1",
+				Operation:  OperationUpdate,
+				Status:     PlanStatusPending,
+				Dependencies: []Dependency{
+					{TargetID: "db-ready", Type: DependencyRequire},
+				},
+				Timeout: time.Minute,
+			},
+		},
+	}
+
+	graph, err := NewDAGBuilder().BuildGraph(plan.Units)
+	if err != nil {
+		t.Fatalf("Failed to build graph: %v", err)
+	}
+	plan.Graph = graph
+
+	return plan
+}
+
+func TestParseWaitCondition(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		want    HealthCheck
+		wantErr bool
+	}{
+		{"port", `{"type": "port", "port": 5432, "timeout": "2m", "interval": "1s"}`,
+			HealthCheck{Type: HealthCheckPort, Port: 5432}, false},
+		{"http", `{"type": "http", "url": "http://localhost:8080/ready"}`,
+			HealthCheck{Type: HealthCheckHTTP, URL: "http://localhost:8080/ready"}, false},
+		{"file", `{"type": "file", "path": "/run/app.pid"}`,
+			HealthCheck{Type: HealthCheckFile, Path: "/run/app.pid"}, false},
+		{"systemd", `{"type": "systemd", "unit": "postgresql@16-main.service"}`,
+			HealthCheck{Type: HealthCheckCommand, Command: "systemctl is-active --quiet postgresql@16-main.service"}, false},
+		{"command", `{"type": "command", "command": "pg_isready"}`,
+			HealthCheck{Type: HealthCheckCommand, Command: "pg_isready"}, false},
+		{"invalid port", `{"type": "port", "port": 70000}`, HealthCheck{}, true},
+		{"missing url", `{"type": "http"}`, HealthCheck{}, true},
+		{"unsafe unit", `{"type": "systemd", "unit": "nginx; reboot"}`, HealthCheck{}, true},
+		{"invalid type", `{"type": "sleep"}`, HealthCheck{}, true},
+		{"invalid timeout", `{"type": "file", "path": "/x", "timeout": "soon"}`, HealthCheck{}, true},
+		{"interval above timeout", `{"type": "file", "path": "/x", "timeout": "1s", "interval": "5s"}`, HealthCheck{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, err := ParseWaitCondition(json.RawMessage(tt.config))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseWaitCondition() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			check := wait.check("")
+			if check.Type != tt.want.Type || check.Port != tt.want.Port || check.URL != tt.want.URL ||
+				check.Path != tt.want.Path || check.Command != tt.want.Command {
+				t.Errorf("Expected check %+v, got %+v", tt.want, check)
+			}
+			if err := check.Validate(); err != nil {
+				t.Errorf("Expected a valid check, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestPlanner_WaitResource(t *testing.T) {
+	planner := NewPlanner(&mockProviderRegistry{providers: map[string]Provider{}}, newMockStateManager())
+	ctx := context.Background()
+
+	config := &Config{
+		ID: "test-config",
+		Resources: []Resource{
+			{
+				ID:       "db_ready",
+				Type:     WaitResourceType,
+				TargetID: "db1",
+				Config:   json.RawMessage(`{"type": "port", "port": 5432, "timeout": "90s"}`),
+			},
+		},
+	}
+
+	diff, err := planner.ComputeDiff(ctx, config, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	plan, err := planner.BuildPlan(ctx, diff)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Waits are planned on every run, bounded by their own timeout
+	if len(plan.Units) != 1 || plan.Units[0].Wait == nil {
+		t.Fatalf("Expected one wait unit, got %+v", plan.Units)
+	}
+	unit := plan.Units[0]
+	if unit.Timeout != 90*time.Second || unit.MaxRetries != 0 {
+		t.Errorf("Expected a 90s timeout without retries, got %s and %d", unit.Timeout, unit.MaxRetries)
+	}
+
+	if err := planner.ValidatePlan(ctx, plan); err != nil {
+		t.Errorf("Expected a valid plan, got: %v", err)
+	}
+
+	config.Resources[0].Config = json.RawMessage(`{"type": "port"}`)
+	if _, err := planner.ComputeDiff(ctx, config, nil); err == nil {
+		t.Error("Expected error for an invalid wait, got nil")
+	}
+}
+
+func TestScheduler_Wait_PollsUntilReady(t *testing.T) {
+	checker := &flakyHealthChecker{failTimes: 2}
+	executor := newMockExecutor()
+	publisher := newMockEventPublisher()
+	stateMgr := newMockStateManager()
+	scheduler := NewParallelScheduler(5, executor, publisher, stateMgr)
+	scheduler.SetHealthChecker(checker)
+
+	ctx := context.Background()
+	plan := newWaitPlan(t, &WaitCondition{Type: WaitPort, Port: 5432, Interval: 10 * time.Millisecond})
+
+	runID, err := scheduler.Schedule(ctx, plan, ScheduleOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(200 * time.Millisecond)
+
+	run, err := stateMgr.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("Failed to get run: %v", err)
+	}
+
+	if run.Status != RunStatusSucceeded {
+		t.Errorf("Expected run status SUCCEEDED, got %s", run.Status)
+	}
+
+	checker.mu.Lock()
+	calls, sessions := checker.calls, checker.sessions
+	checker.mu.Unlock()
+	if calls != 3 {
+		t.Errorf("Expected 3 polls, got %d", calls)
+	}
+	if sessions != 1 {
+		t.Errorf("Expected the polls to share 1 session, got %d", sessions)
+	}
+
+	// The wait is polled instead of executed, and its dependent runs after it
+	executor.mu.Lock()
+	defer executor.mu.Unlock()
+	if len(executor.executedUnits) != 1 || executor.executedUnits[0] != "migrate" {
+		t.Errorf("Expected only migrate to execute, got %v", executor.executedUnits)
+	}
+
+	waiting := 0
+	for _, event := range publisher.getEvents() {
+		if event.PlanUnitID == "db-ready" && event.Type == EventTypeInfo {
+			waiting++
+		}
+	}
+	if waiting != 2 {
+		t.Errorf("Expected 2 waiting events, got %d", waiting)
+	}
+}
+
+func TestScheduler_Wait_TimesOut(t *testing.T) {
+	checker := &flakyHealthChecker{failTimes: 1000}
+	executor := newMockExecutor()
+	stateMgr := newMockStateManager()
+	scheduler := NewParallelScheduler(5, executor, newMockEventPublisher(), stateMgr)
+
+	ctx := context.Background()
+	plan := newWaitPlan(t, &WaitCondition{
+		Type:     WaitCommand,
+		Command:  "pg_isready",
+		Timeout:  50 * time.Millisecond,
+		Interval: 10 * time.Millisecond,
+	})
+
+	// Waits require a health checker
+	if _, err := scheduler.Schedule(ctx, plan, ScheduleOptions{}); err == nil {
+		t.Fatal("Expected error for a wait without a health checker, got nil")
+	}
+	scheduler.SetHealthChecker(checker)
+
+	runID, err := scheduler.Schedule(ctx, plan, ScheduleOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Wait for execution to complete
+	time.Sleep(200 * time.Millisecond)
+
+	run, err := stateMgr.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("Failed to get run: %v", err)
+	}
+
+	if run.Status != RunStatusFailed {
+		t.Errorf("Expected run status FAILED, got %s", run.Status)
+	}
+	if run.Summary.Failed != 1 || run.Summary.Skipped != 1 {
+		t.Errorf("Expected the wait to fail and the migration to be skipped, got %+v", run.Summary)
+	}
+
+	executor.mu.Lock()
+	defer executor.mu.Unlock()
+	if len(executor.executedUnits) != 0 {
+		t.Errorf("Expected no executions, got %v", executor.executedUnits)
+	}
+}
@@ -0,0 +1,217 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/openfroyo/openfroyo/pkg/stores"
+)
+
+// DefaultWorkspaceLockLease is how long a workspace lock survives without a heartbeat.
+const DefaultWorkspaceLockLease = 5 * time.Minute
+
+// WorkspaceLocker serializes plan, apply and drift reconciliation on a
+// workspace across operators through a lock persisted in the store.
+type WorkspaceLocker struct {
+	store stores.Store
+	lease time.Duration
+}
+
+// NewWorkspaceLocker creates a new workspace locker. A non-positive lease
+// defaults to DefaultWorkspaceLockLease.
+func NewWorkspaceLocker(store stores.Store, lease time.Duration) *WorkspaceLocker {
+	if lease <= 0 {
+		lease = DefaultWorkspaceLockLease
+	}
+
+	return &WorkspaceLocker{
+		store: store,
+		lease: lease,
+	}
+}
+
+// Acquire takes the workspace lock for an operation and keeps it alive with a
+// heartbeat until the returned lease is released. It fails with a conflict
+// error naming the holder when another operator holds an unexpired lock.
+//
+// The operation must run under the returned context. It is cancelled when
+// the heartbeat loses the lock, with the heartbeat error as its cause, so the
+// operation stops before another holder can take over, and when the lease is
+// released.
+func (l *WorkspaceLocker) Acquire(
+	ctx context.Context,
+	workspace string,
+	owner string,
+	operation string,
+	reason string,
+) (context.Context, *WorkspaceLease, error) {
+	now := time.Now()
+	lock := &stores.WorkspaceLock{
+		Workspace:   workspace,
+		LockID:      uuid.New().String(),
+		Owner:       owner,
+		Operation:   operation,
+		AcquiredAt:  now,
+		HeartbeatAt: now,
+		ExpiresAt:   now.Add(l.lease),
+	}
+	if reason != "" {
+		lock.Reason = &reason
+	}
+
+	acquired, err := l.store.AcquireWorkspaceLock(ctx, lock)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to lock workspace: %w", err)
+	}
+
+	if !acquired {
+		holder, err := l.store.GetWorkspaceLock(ctx, workspace)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get workspace lock holder: %w", err)
+		}
+		if holder == nil {
+			// Released between the attempt and the lookup
+			return nil, nil, NewConflictError(fmt.Sprintf("workspace %s is locked", workspace), nil).
+				WithCode(ErrCodeConflict)
+		}
+		return nil, nil, NewConflictError(DescribeWorkspaceLock(holder), nil).
+			WithCode(ErrCodeConflict)
+	}
+
+	leaseCtx, cancel := context.WithCancelCause(ctx)
+	lease := &WorkspaceLease{
+		locker: l,
+		lock:   *lock,
+		cancel: cancel,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go lease.heartbeat()
+
+	return leaseCtx, lease, nil
+}
+
+// Status returns the current lock of the workspace, which may have expired,
+// or nil when the workspace is not locked.
+func (l *WorkspaceLocker) Status(ctx context.Context, workspace string) (*stores.WorkspaceLock, error) {
+	lock, err := l.store.GetWorkspaceLock(ctx, workspace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace lock: %w", err)
+	}
+	return lock, nil
+}
+
+// ForceUnlock removes the lock of the workspace regardless of its holder and
+// returns the removed lock. The holder's heartbeat fails on its next beat.
+func (l *WorkspaceLocker) ForceUnlock(ctx context.Context, workspace string) (*stores.WorkspaceLock, error) {
+	lock, err := l.Status(ctx, workspace)
+	if err != nil {
+		return nil, err
+	}
+	if lock == nil {
+		return nil, NewPermanentError(fmt.Sprintf("workspace %s is not locked", workspace), nil).
+			WithCode(ErrCodeNotFound)
+	}
+
+	if err := l.store.ForceReleaseWorkspaceLock(ctx, workspace); err != nil {
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// DescribeWorkspaceLock returns a message naming the holder of a workspace lock.
+func DescribeWorkspaceLock(lock *stores.WorkspaceLock) string {
+	msg := fmt.Sprintf("workspace %s is locked by %s for %s since %s",
+		lock.Workspace, lock.Owner, lock.Operation, lock.AcquiredAt.Local().Format(time.RFC3339))
+	if lock.Reason != nil && *lock.Reason != "" {
+		msg += fmt.Sprintf(" (%s)", *lock.Reason)
+	}
+
+	if remaining := time.Until(lock.ExpiresAt); remaining > 0 {
+		msg += fmt.Sprintf(", lease expires in %s", remaining.Round(time.Second))
+	} else {
+		msg += ", lease expired"
+	}
+
+	return msg
+}
+
+// WorkspaceLease is a held workspace lock, renewed by a heartbeat until released.
+type WorkspaceLease struct {
+	locker *WorkspaceLocker
+	lock   stores.WorkspaceLock
+
+	// cancel cancels the context the operation runs under
+	cancel context.CancelCauseFunc
+
+	// stop ends the heartbeat and done is closed once it has exited
+	stop chan struct{}
+	done chan struct{}
+
+	// mu protects err
+	mu  sync.Mutex
+	err error
+
+	releaseOnce sync.Once
+}
+
+// Lock returns the lock held by the lease.
+func (l *WorkspaceLease) Lock() stores.WorkspaceLock {
+	return l.lock
+}
+
+// Err returns the error that made the heartbeat lose the lock, if any.
+func (l *WorkspaceLease) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Release stops the heartbeat, cancels the operation's context and releases
+// the lock. It returns the heartbeat error when the lock was lost while held.
+func (l *WorkspaceLease) Release(ctx context.Context) error {
+	var err error
+	l.releaseOnce.Do(func() {
+		close(l.stop)
+		<-l.done
+		l.cancel(nil)
+
+		if releaseErr := l.locker.store.ReleaseWorkspaceLock(ctx, l.lock.Workspace, l.lock.LockID); releaseErr != nil {
+			err = releaseErr
+			return
+		}
+		err = l.Err()
+	})
+	return err
+}
+
+// heartbeat renews the lease at a third of its duration until stopped or
+// until the lock is lost, which cancels the operation's context.
+func (l *WorkspaceLease) heartbeat() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.locker.lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			expiresAt := time.Now().Add(l.locker.lease)
+			if err := l.locker.store.RenewWorkspaceLock(context.Background(),
+				l.lock.Workspace, l.lock.LockID, expiresAt); err != nil {
+				lost := fmt.Errorf("lost workspace lock: %w", err)
+				l.mu.Lock()
+				l.err = lost
+				l.mu.Unlock()
+				l.cancel(lost)
+				return
+			}
+		}
+	}
+}
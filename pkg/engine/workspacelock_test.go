@@ -0,0 +1,161 @@
+package engine
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openfroyo/openfroyo/pkg/stores"
+)
+
+// newTestSQLiteStore creates a migrated SQLite store in a temporary directory.
+func newTestSQLiteStore(t *testing.T) *stores.SQLiteStore {
+	t.Helper()
+
+	store, err := stores.NewSQLiteStore(stores.Config{
+		Path: filepath.Join(t.TempDir(), "openfroyo.db"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := store.Init(ctx); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	if err := store.Migrate(ctx); err != nil {
+		t.Fatalf("Failed to migrate store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	return store
+}
+
+func TestWorkspaceLocker_Acquire(t *testing.T) {
+	ctx := context.Background()
+	locker := NewWorkspaceLocker(newTestSQLiteStore(t), time.Minute)
+
+	leaseCtx, lease, err := locker.Acquire(ctx, "prod", "alice@ops1", "apply", "kernel upgrade")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// A second operator is refused with a message naming the holder
+	_, _, err = locker.Acquire(ctx, "prod", "bob@ops2", "plan", "")
+	if err == nil {
+		t.Fatal("Expected conflict error, got nil")
+	}
+	if !IsConflict(err) {
+		t.Errorf("Expected conflict error, got: %v", err)
+	}
+	for _, want := range []string{"alice@ops1", "apply", "kernel upgrade"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %q, got: %v", want, err)
+		}
+	}
+
+	// Other workspaces are independent
+	_, other, err := locker.Acquire(ctx, "staging", "bob@ops2", "plan", "")
+	if err != nil {
+		t.Fatalf("Expected no error for another workspace, got: %v", err)
+	}
+	if err := other.Release(ctx); err != nil {
+		t.Errorf("Failed to release lock: %v", err)
+	}
+
+	if err := lease.Release(ctx); err != nil {
+		t.Fatalf("Failed to release lock: %v", err)
+	}
+	if leaseCtx.Err() == nil {
+		t.Error("Expected release to cancel the lease context")
+	}
+
+	lock, err := locker.Status(ctx, "prod")
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	if lock != nil {
+		t.Errorf("Expected workspace to be unlocked, got lock held by %s", lock.Owner)
+	}
+}
+
+func TestWorkspaceLocker_ExpiredLease(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLiteStore(t)
+
+	// Simulate a crashed operator whose lease has run out
+	past := time.Now().Add(-time.Hour)
+	acquired, err := store.AcquireWorkspaceLock(ctx, &stores.WorkspaceLock{
+		Workspace:   "prod",
+		LockID:      "stale",
+		Owner:       "alice@ops1",
+		Operation:   "apply",
+		AcquiredAt:  past,
+		HeartbeatAt: past,
+		ExpiresAt:   past.Add(time.Minute),
+	})
+	if err != nil || !acquired {
+		t.Fatalf("Failed to seed lock: acquired=%v, err=%v", acquired, err)
+	}
+
+	_, lease, err := NewWorkspaceLocker(store, time.Minute).Acquire(ctx, "prod", "bob@ops2", "apply", "")
+	if err != nil {
+		t.Fatalf("Expected expired lock to be taken over, got: %v", err)
+	}
+	defer func() { _ = lease.Release(ctx) }()
+
+	if lease.Lock().Owner != "bob@ops2" {
+		t.Errorf("Expected lock owner bob@ops2, got %s", lease.Lock().Owner)
+	}
+}
+
+func TestWorkspaceLease_Heartbeat(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLiteStore(t)
+	locker := NewWorkspaceLocker(store, 3*time.Second)
+
+	leaseCtx, lease, err := locker.Acquire(ctx, "prod", "alice@ops1", "apply", "")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Two heartbeats keep the lock past its original expiry
+	time.Sleep(2500 * time.Millisecond)
+
+	lock, err := locker.Status(ctx, "prod")
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	if lock == nil || !lock.ExpiresAt.After(lease.Lock().ExpiresAt) {
+		t.Fatalf("Expected heartbeat to extend the lease, got %+v", lock)
+	}
+
+	// A force-unlock makes the holder lose the lock on its next heartbeat
+	removed, err := locker.ForceUnlock(ctx, "prod")
+	if err != nil {
+		t.Fatalf("Failed to force unlock: %v", err)
+	}
+	if removed.Owner != "alice@ops1" {
+		t.Errorf("Expected removed lock owner alice@ops1, got %s", removed.Owner)
+	}
+
+	time.Sleep(1200 * time.Millisecond)
+
+	// The operation running under the lease is cancelled with the cause
+	if leaseCtx.Err() == nil {
+		t.Fatal("Expected the lost lock to cancel the lease context")
+	}
+	if cause := context.Cause(leaseCtx); cause == nil || !strings.Contains(cause.Error(), "lost workspace lock") {
+		t.Errorf("Expected the lost lock as the cancel cause, got: %v", cause)
+	}
+
+	if err := lease.Release(ctx); err == nil {
+		t.Error("Expected release to report the lost lock, got nil")
+	}
+
+	if _, err := locker.ForceUnlock(ctx, "prod"); err == nil {
+		t.Error("Expected error when force unlocking an unlocked workspace, got nil")
+	}
+}
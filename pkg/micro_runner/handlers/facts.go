@@ -0,0 +1,686 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/openfroyo/openfroyo/pkg/micro_runner/protocol"
+)
+
+// FactsGatherHandler gathers facts natively on the target host, reading
+// /proc and /etc directly instead of parsing command output.
+type FactsGatherHandler struct{}
+
+// Handle gathers the requested namespaces. A namespace that fails is
+// reported in the result's errors; the others are still returned.
+func (h *FactsGatherHandler) Handle(ctx context.Context, params *protocol.FactsGatherParams, eventCh chan<- *protocol.EventMessage) (*protocol.FactsGatherResult, error) {
+	namespaces := params.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = protocol.GatherFactNamespaces
+	}
+
+	result := &protocol.FactsGatherResult{
+		Facts:  make(map[string]json.RawMessage),
+		Errors: make(map[string]string),
+	}
+
+	for _, namespace := range namespaces {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var facts any
+		var err error
+		switch namespace {
+		case "os.basic":
+			facts, err = gatherOSFacts()
+		case "hw.cpu":
+			facts, err = gatherCPUFacts()
+		case "hw.memory":
+			facts, err = gatherMemoryFacts()
+		case "hw.disk":
+			facts, err = gatherDiskFacts()
+		case "net.ifaces":
+			facts, err = gatherNetworkFacts()
+		case "pkg.manifest":
+			facts, err = gatherPackageFacts(ctx)
+		case "svc.units":
+			facts, err = gatherServiceFacts(ctx)
+		case "os.users":
+			facts, err = gatherUserFacts()
+		case "net.ports":
+			facts, err = gatherPortFacts()
+		case "fs.mounts":
+			facts, err = gatherMountFacts()
+		case "os.sysctl":
+			facts, err = gatherSysctlFacts()
+		case "os.locale":
+			facts, err = gatherLocaleFacts()
+		case protocol.CustomFactsNamespace:
+			facts, err = gatherCustomFacts(ctx, params, result.Errors)
+		default:
+			err = fmt.Errorf("unsupported fact namespace")
+		}
+		if err != nil {
+			result.Errors[namespace] = err.Error()
+			continue
+		}
+
+		data, err := json.Marshal(facts)
+		if err != nil {
+			result.Errors[namespace] = fmt.Sprintf("failed to marshal facts: %v", err)
+			continue
+		}
+		result.Facts[namespace] = data
+	}
+
+	return result, nil
+}
+
+// gatherOSFacts reads the OS release, kernel and hostname.
+func gatherOSFacts() (*protocol.OSFacts, error) {
+	facts := &protocol.OSFacts{Arch: unameMachine()}
+
+	// Get OS name and version
+	for _, path := range []string{"/etc/os-release", "/usr/lib/os-release"} {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		release := parseKeyValues(content)
+		facts.Name = release["NAME"]
+		facts.Distro = release["ID"]
+		facts.Version = release["VERSION"]
+		break
+	}
+
+	if kernel, err := os.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		facts.Kernel = strings.TrimSpace(string(kernel))
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+	facts.Hostname = hostname
+
+	return facts, nil
+}
+
+// gatherCPUFacts reads the CPU model and count from /proc/cpuinfo.
+func gatherCPUFacts() (*protocol.CPUFacts, error) {
+	content, err := os.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read /proc/cpuinfo: %w", err)
+	}
+
+	facts := &protocol.CPUFacts{Arch: unameMachine()}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "processor":
+			facts.Cores++
+		case "model name":
+			facts.Model = strings.TrimSpace(value)
+		case "vendor_id":
+			facts.Vendor = strings.TrimSpace(value)
+		}
+	}
+
+	if facts.Cores == 0 {
+		facts.Cores = runtime.NumCPU()
+	}
+	facts.Threads = facts.Cores // Simplified - actual thread count may differ
+
+	return facts, nil
+}
+
+// gatherMemoryFacts reads memory and swap sizes from /proc/meminfo.
+func gatherMemoryFacts() (*protocol.MemoryFacts, error) {
+	content, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read /proc/meminfo: %w", err)
+	}
+
+	facts := &protocol.MemoryFacts{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		// Values are in kB
+		value, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		switch fields[0] {
+		case "MemTotal:":
+			facts.TotalMB = value / 1024
+		case "MemAvailable:":
+			facts.AvailableMB = value / 1024
+		case "SwapTotal:":
+			facts.SwapTotalMB = value / 1024
+		case "SwapFree:":
+			facts.SwapFreeMB = value / 1024
+		}
+	}
+
+	return facts, nil
+}
+
+// gatherDiskFacts reports the usage of filesystems mounted from block devices.
+func gatherDiskFacts() (*protocol.DiskFacts, error) {
+	content, err := os.ReadFile("/proc/self/mounts")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read /proc/self/mounts: %w", err)
+	}
+
+	facts := &protocol.DiskFacts{Devices: make([]protocol.DiskDevice, 0)}
+	seen := make(map[string]bool)
+
+	for _, mount := range protocol.ParseMountTable(content) {
+		if !strings.HasPrefix(mount.Device, "/") || seen[mount.MountPoint] {
+			continue
+		}
+		seen[mount.MountPoint] = true
+
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(mount.MountPoint, &stat); err != nil {
+			continue
+		}
+
+		const gb = 1 << 30
+		blockSize := uint64(stat.Bsize)
+		total := stat.Blocks * blockSize
+		available := stat.Bavail * blockSize
+		used := total - stat.Bfree*blockSize
+
+		device := protocol.DiskDevice{
+			Device:      mount.Device,
+			MountPoint:  mount.MountPoint,
+			FSType:      mount.FSType,
+			TotalGB:     int64(total / gb),
+			UsedGB:      int64(used / gb),
+			AvailableGB: int64(available / gb),
+		}
+		// Like df, usage is relative to the space available to users
+		if used+available > 0 {
+			device.UsePercent = int((used*100 + used + available - 1) / (used + available))
+		}
+
+		facts.Devices = append(facts.Devices, device)
+	}
+
+	return facts, nil
+}
+
+// gatherNetworkFacts lists the non-loopback network interfaces.
+func gatherNetworkFacts() (*protocol.NetworkFacts, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list network interfaces: %w", err)
+	}
+
+	facts := &protocol.NetworkFacts{Interfaces: make([]protocol.NetworkInterface, 0)}
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		entry := protocol.NetworkInterface{
+			Name:        iface.Name,
+			IPAddresses: make([]string, 0),
+			MACAddress:  iface.HardwareAddr.String(),
+			State:       "DOWN",
+		}
+		if iface.Flags&net.FlagUp != 0 {
+			entry.State = "UP"
+		}
+
+		addrs, err := iface.Addrs()
+		if err == nil {
+			for _, addr := range addrs {
+				if ipNet, ok := addr.(*net.IPNet); ok {
+					entry.IPAddresses = append(entry.IPAddresses, ipNet.IP.String())
+				}
+			}
+		}
+
+		facts.Interfaces = append(facts.Interfaces, entry)
+	}
+
+	return facts, nil
+}
+
+// gatherPackageFacts lists the installed packages with dpkg or rpm.
+func gatherPackageFacts(ctx context.Context) (*protocol.PackageFacts, error) {
+	facts := &protocol.PackageFacts{Packages: make([]string, 0)}
+
+	managers := []struct {
+		name string
+		args []string
+	}{
+		{"dpkg", []string{"dpkg-query", "-W", "-f=${db:Status-Abbrev} ${Package}\n"}},
+		{"rpm", []string{"rpm", "-qa"}},
+	}
+
+	for _, mgr := range managers {
+		if _, err := exec.LookPath(mgr.args[0]); err != nil {
+			continue
+		}
+
+		output, err := exec.CommandContext(ctx, mgr.args[0], mgr.args[1:]...).Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s packages: %w", mgr.name, err)
+		}
+
+		facts.Manager = mgr.name
+		for _, line := range strings.Split(string(output), "\n") {
+			fields := strings.Fields(line)
+			if mgr.name == "dpkg" {
+				// Only packages marked installed, like dpkg -l's "ii"
+				if len(fields) != 2 || fields[0] != "ii" {
+					continue
+				}
+				fields = fields[1:]
+			}
+			if len(fields) == 1 {
+				facts.Packages = append(facts.Packages, fields[0])
+			}
+		}
+		facts.Count = len(facts.Packages)
+		break
+	}
+
+	return facts, nil
+}
+
+// gatherServiceFacts lists the systemd service units and their states.
+func gatherServiceFacts(ctx context.Context) (*protocol.ServiceFacts, error) {
+	// As sd_booted(3) does
+	if _, err := os.Stat("/run/systemd/system"); err != nil {
+		return nil, fmt.Errorf("systemd is not running")
+	}
+
+	units, err := exec.CommandContext(ctx, "systemctl", "list-units", "--all", "--type=service",
+		"--plain", "--no-legend", "--no-pager").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list units: %w", err)
+	}
+
+	unitFiles, err := exec.CommandContext(ctx, "systemctl", "list-unit-files", "--type=service",
+		"--no-legend", "--no-pager").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unit files: %w", err)
+	}
+
+	return &protocol.ServiceFacts{Units: protocol.ParseSystemdUnits(string(units), string(unitFiles))}, nil
+}
+
+// gatherUserFacts reads the local users and groups.
+func gatherUserFacts() (*protocol.UserFacts, error) {
+	passwd, err := os.ReadFile("/etc/passwd")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read /etc/passwd: %w", err)
+	}
+
+	group, err := os.ReadFile("/etc/group")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read /etc/group: %w", err)
+	}
+
+	return protocol.ParseUserFacts(passwd, group), nil
+}
+
+// gatherPortFacts lists the listening TCP and bound UDP sockets from
+// /proc/net with the processes owning them. Owners are only visible for
+// processes the runner may inspect.
+func gatherPortFacts() (*protocol.PortFacts, error) {
+	owners := socketOwners()
+	facts := &protocol.PortFacts{Listening: make([]protocol.ListeningSocket, 0)}
+
+	for _, proto := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		content, err := os.ReadFile("/proc/net/" + proto)
+		if err != nil {
+			// IPv6 may be disabled
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read /proc/net/%s: %w", proto, err)
+		}
+
+		lines := strings.Split(string(content), "\n")
+		for _, line := range lines[1:] {
+			// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+			fields := strings.Fields(line)
+			if len(fields) < 10 {
+				continue
+			}
+
+			// TCP sockets must be listening (0A); UDP sockets unconnected (07)
+			if (strings.HasPrefix(proto, "tcp") && fields[3] != "0A") ||
+				(strings.HasPrefix(proto, "udp") && fields[3] != "07") {
+				continue
+			}
+
+			address, port, err := parseProcNetAddress(fields[1])
+			if err != nil {
+				continue
+			}
+
+			socket := protocol.ListeningSocket{
+				Protocol: proto,
+				Address:  address,
+				Port:     port,
+			}
+			if owner, ok := owners[fields[9]]; ok {
+				socket.PID = owner.pid
+				socket.Process = owner.process
+			}
+			facts.Listening = append(facts.Listening, socket)
+		}
+	}
+
+	return facts, nil
+}
+
+// socketOwner is the process owning a socket.
+type socketOwner struct {
+	pid     int
+	process string
+}
+
+// socketOwners maps socket inodes to the processes holding them open.
+func socketOwners() map[string]socketOwner {
+	owners := make(map[string]socketOwner)
+
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return owners
+	}
+
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil {
+			continue
+		}
+
+		fdDir := filepath.Join("/proc", proc.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+
+		var process string
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+
+			if process == "" {
+				comm, _ := os.ReadFile(filepath.Join("/proc", proc.Name(), "comm"))
+				process = strings.TrimSpace(string(comm))
+			}
+			inode := strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")
+			owners[inode] = socketOwner{pid: pid, process: process}
+		}
+	}
+
+	return owners
+}
+
+// parseProcNetAddress parses an address of /proc/net/tcp and friends: a
+// hex IP in host byte order, as 32-bit words, and a hex port.
+func parseProcNetAddress(field string) (string, int, error) {
+	hexIP, hexPort, ok := strings.Cut(field, ":")
+	if !ok {
+		return "", 0, fmt.Errorf("invalid address %q", field)
+	}
+
+	port, err := strconv.ParseUint(hexPort, 16, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port %q: %w", hexPort, err)
+	}
+
+	raw, err := hex.DecodeString(hexIP)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return "", 0, fmt.Errorf("invalid IP %q", hexIP)
+	}
+
+	// Each 32-bit word is little endian
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+
+	return ip.String(), int(port), nil
+}
+
+// gatherMountFacts reads the mounted filesystems and the fstab entries.
+func gatherMountFacts() (*protocol.MountFacts, error) {
+	mounts, err := os.ReadFile("/proc/self/mounts")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read /proc/self/mounts: %w", err)
+	}
+
+	// Hosts without an fstab have no entries
+	fstab, err := os.ReadFile("/etc/fstab")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read /etc/fstab: %w", err)
+	}
+
+	return &protocol.MountFacts{
+		Mounts: protocol.ParseMountTable(mounts),
+		Fstab:  protocol.ParseMountTable(fstab),
+	}, nil
+}
+
+// gatherSysctlFacts reads the kernel parameters under /proc/sys. Parameters
+// that cannot be read are left out, as with sysctl -a.
+func gatherSysctlFacts() (*protocol.SysctlFacts, error) {
+	const root = "/proc/sys"
+	facts := &protocol.SysctlFacts{Params: make(map[string]any)}
+
+	err := filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			// Skip directories that cannot be listed
+			if entry != nil && entry.IsDir() && path != root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil || info.Mode().Perm()&0444 == 0 {
+			return nil
+		}
+
+		value, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+
+		key := strings.ReplaceAll(strings.TrimPrefix(path, root+"/"), "/", ".")
+		facts.Set(key, string(value))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", root, err)
+	}
+
+	return facts, nil
+}
+
+// gatherLocaleFacts reads the timezone and the system locale.
+func gatherLocaleFacts() (*protocol.LocaleFacts, error) {
+	link, _ := os.Readlink("/etc/localtime")
+	timezone, _ := os.ReadFile("/etc/timezone")
+
+	var localeConf []byte
+	for _, path := range []string{"/etc/locale.conf", "/etc/default/locale"} {
+		content, err := os.ReadFile(path)
+		if err == nil {
+			localeConf = content
+			break
+		}
+	}
+
+	return protocol.ParseLocaleFacts(link, string(timezone), string(localeConf)), nil
+}
+
+// gatherCustomFacts reads the facts the host publishes in its custom facts
+// directory. Static JSON and YAML files are read as is and executable
+// scripts are run, each with a timeout, and must print JSON. A file that
+// fails is reported in errors as custom.<name> and left out.
+func gatherCustomFacts(ctx context.Context, params *protocol.FactsGatherParams, errors map[string]string) (map[string]json.RawMessage, error) {
+	dir := params.CustomFactsDir
+	if dir == "" {
+		dir = protocol.DefaultCustomFactsDir
+	}
+	timeout := protocol.DefaultCustomFactTimeout
+	if params.CustomFactTimeout > 0 {
+		timeout = time.Duration(params.CustomFactTimeout) * time.Second
+	}
+
+	facts := make(map[string]json.RawMessage)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		// Hosts without custom facts have an empty namespace
+		if os.IsNotExist(err) {
+			return facts, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		script := info.Mode()&0111 != 0
+		if !protocol.IsCustomFactFile(entry.Name(), script) {
+			continue
+		}
+
+		name, ok, err := protocol.CustomFactName(entry.Name())
+		if err != nil {
+			errors[protocol.CustomFactsNamespace+"."+entry.Name()] = err.Error()
+			continue
+		}
+		if !ok {
+			continue
+		}
+		key := protocol.CustomFactsNamespace + "." + name
+
+		if seen[name] {
+			errors[key] = fmt.Sprintf("%s is published by more than one file", name)
+			delete(facts, name)
+			continue
+		}
+		seen[name] = true
+
+		path := filepath.Join(dir, entry.Name())
+
+		var content []byte
+		if script {
+			content, err = runCustomFactScript(ctx, path, timeout)
+		} else {
+			content, err = os.ReadFile(path)
+		}
+		if err != nil {
+			errors[key] = err.Error()
+			continue
+		}
+
+		data, err := protocol.DecodeCustomFact(entry.Name(), content, script)
+		if err != nil {
+			errors[key] = fmt.Sprintf("%s: %v", entry.Name(), err)
+			continue
+		}
+		facts[name] = data
+	}
+
+	return facts, nil
+}
+
+// runCustomFactScript runs a custom fact script and returns its output.
+func runCustomFactScript(ctx context.Context, path string, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stderr = &stderr
+	// Do not wait on children that outlive a killed script
+	cmd.WaitDelay = time.Second
+
+	output, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("%s timed out after %s", filepath.Base(path), timeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %v: %s", filepath.Base(path), err, strings.TrimSpace(stderr.String()))
+	}
+
+	return output, nil
+}
+
+// parseKeyValues parses KEY=value lines, as in /etc/os-release.
+func parseKeyValues(content []byte) map[string]string {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+		values[key] = strings.Trim(value, "\"'")
+	}
+	return values
+}
+
+// unameMachine returns the machine architecture as reported by uname -m.
+func unameMachine() string {
+	switch runtime.GOARCH {
+	case "amd64":
+		return "x86_64"
+	case "arm64":
+		return "aarch64"
+	case "386":
+		return "i686"
+	case "arm":
+		return "armv7l"
+	default:
+		return runtime.GOARCH
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openfroyo/openfroyo/pkg/micro_runner/protocol"
+)
+
+// maxProbeBodyBytes limits how much of the response body is read and returned.
+const maxProbeBodyBytes = 4096
+
+// HTTPProbeHandler handles HTTP health probes run from the target host.
+type HTTPProbeHandler struct{}
+
+// Handle sends a request to the endpoint and reports whether the response is healthy.
+// An unhealthy response is not an error; only a failure to probe is.
+func (h *HTTPProbeHandler) Handle(ctx context.Context, params *protocol.HTTPProbeParams, eventCh chan<- *protocol.EventMessage) (*protocol.HTTPProbeResult, error) {
+	if params.URL == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+
+	method := params.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, params.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for key, value := range params.Headers {
+		req.Header.Set(key, value)
+	}
+
+	client := &http.Client{}
+	if params.Insecure {
+		client.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // Opt-in for self-signed endpoints
+		}
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	duration := time.Since(start).Seconds()
+	if err != nil {
+		// Connection failures are reported as unhealthy so callers can retry
+		return &protocol.HTTPProbeResult{
+			Healthy:  false,
+			Message:  err.Error(),
+			Duration: duration,
+		}, nil
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	result := &protocol.HTTPProbeResult{
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		Duration:   duration,
+	}
+
+	// Check the status code
+	if params.ExpectStatus != 0 {
+		result.Healthy = resp.StatusCode == params.ExpectStatus
+		if !result.Healthy {
+			result.Message = fmt.Sprintf("expected status %d, got %d", params.ExpectStatus, resp.StatusCode)
+		}
+	} else {
+		result.Healthy = resp.StatusCode >= 200 && resp.StatusCode < 300
+		if !result.Healthy {
+			result.Message = fmt.Sprintf("expected 2xx status, got %d", resp.StatusCode)
+		}
+	}
+
+	// Check the body
+	if result.Healthy && params.ExpectBody != "" && !strings.Contains(result.Body, params.ExpectBody) {
+		result.Healthy = false
+		result.Message = fmt.Sprintf("response body does not contain %q", params.ExpectBody)
+	}
+
+	return result, nil
+}
+
+// PortProbeHandler handles TCP port probes run from the target host.
+type PortProbeHandler struct{}
+
+// Handle connects to the port and reports whether it accepts connections.
+// A closed port is not an error; only invalid parameters are.
+func (h *PortProbeHandler) Handle(ctx context.Context, params *protocol.PortProbeParams, eventCh chan<- *protocol.EventMessage) (*protocol.PortProbeResult, error) {
+	if params.Port <= 0 || params.Port > 65535 {
+		return nil, fmt.Errorf("invalid port: %d", params.Port)
+	}
+
+	host := params.Host
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	var dialer net.Dialer
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(params.Port)))
+	duration := time.Since(start).Seconds()
+	if err != nil {
+		return &protocol.PortProbeResult{
+			Open:     false,
+			Message:  err.Error(),
+			Duration: duration,
+		}, nil
+	}
+	conn.Close()
+
+	return &protocol.PortProbeResult{
+		Open:     true,
+		Duration: duration,
+	}, nil
+}
@@ -0,0 +1,295 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CustomFactsNamespace is the namespace of the facts hosts publish
+// themselves. Each file in the custom facts directory becomes a field of
+// it, read as custom.<name>.
+const CustomFactsNamespace = "custom"
+
+// DefaultCustomFactsDir is where hosts publish custom facts.
+const DefaultCustomFactsDir = "/etc/froyo/facts.d"
+
+// DefaultCustomFactTimeout is how long a custom fact script may run.
+const DefaultCustomFactTimeout = 10 * time.Second
+
+// customFactNamePattern matches custom fact names, which must be usable as
+// fields in when conditions.
+var customFactNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// CustomFactName returns the name of the custom fact published by a file in
+// the custom facts directory: its base name without extension. It reports
+// false for hidden files, which are ignored.
+func CustomFactName(file string) (string, bool, error) {
+	base := filepath.Base(file)
+	if strings.HasPrefix(base, ".") {
+		return "", false, nil
+	}
+
+	name := strings.TrimSuffix(base, filepath.Ext(base))
+	if !customFactNamePattern.MatchString(name) {
+		return "", false, fmt.Errorf("invalid custom fact name %q: use letters, digits and underscores", name)
+	}
+
+	return name, true, nil
+}
+
+// IsCustomFactFile reports whether a file in the custom facts directory
+// publishes a fact: executable scripts do, and static files do when they
+// have a .json, .yaml or .yml extension.
+func IsCustomFactFile(file string, script bool) bool {
+	switch filepath.Ext(file) {
+	case ".json", ".yaml", ".yml":
+		return true
+	default:
+		return script
+	}
+}
+
+// DecodeCustomFact decodes the content of a custom fact file into JSON.
+// Scripts must print JSON; static files are JSON or, with a .yaml or .yml
+// extension, YAML.
+func DecodeCustomFact(file string, content []byte, script bool) (json.RawMessage, error) {
+	ext := filepath.Ext(file)
+	if script || (ext != ".yaml" && ext != ".yml") {
+		if !json.Valid(content) {
+			return nil, fmt.Errorf("output is not valid JSON")
+		}
+		return json.RawMessage(content), nil
+	}
+
+	var value any
+	if err := yaml.Unmarshal(content, &value); err != nil {
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("YAML cannot be represented as JSON: %w", err)
+	}
+	return data, nil
+}
+
+// ParseSystemdUnits parses the output of systemctl list-units --all --plain
+// --no-legend and of systemctl list-unit-files --no-legend into units.
+func ParseSystemdUnits(units, unitFiles string) []ServiceUnit {
+	fileStates := make(map[string]string)
+	for _, line := range strings.Split(unitFiles, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 {
+			fileStates[fields[0]] = fields[1]
+		}
+	}
+
+	parsed := make([]ServiceUnit, 0)
+	for _, line := range strings.Split(units, "\n") {
+		fields := strings.Fields(line)
+		// Failed and missing units are marked with a leading bullet
+		if len(fields) > 0 && fields[0] == "●" {
+			fields = fields[1:]
+		}
+		if len(fields) < 4 {
+			continue
+		}
+
+		parsed = append(parsed, ServiceUnit{
+			Name:          fields[0],
+			LoadState:     fields[1],
+			ActiveState:   fields[2],
+			SubState:      fields[3],
+			Description:   strings.Join(fields[4:], " "),
+			UnitFileState: fileStates[fields[0]],
+		})
+	}
+
+	return parsed
+}
+
+// ParseUserFacts parses the content of /etc/passwd and /etc/group. Users
+// list their primary group first, then the groups they are a member of.
+func ParseUserFacts(passwd, group []byte) *UserFacts {
+	facts := &UserFacts{
+		Users:  make([]LocalUser, 0),
+		Groups: make([]LocalGroup, 0),
+	}
+
+	groupNames := make(map[int]string)
+	memberOf := make(map[string][]string)
+	for _, line := range strings.Split(string(group), "\n") {
+		// name:password:gid:members
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) < 4 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		gid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+
+		entry := LocalGroup{Name: fields[0], GID: gid, Members: make([]string, 0)}
+		for _, member := range strings.Split(fields[3], ",") {
+			if member != "" {
+				entry.Members = append(entry.Members, member)
+				memberOf[member] = append(memberOf[member], entry.Name)
+			}
+		}
+		groupNames[gid] = entry.Name
+		facts.Groups = append(facts.Groups, entry)
+	}
+
+	for _, line := range strings.Split(string(passwd), "\n") {
+		// name:password:uid:gid:gecos:home:shell
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) < 7 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		uid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		gid, err := strconv.Atoi(fields[3])
+		if err != nil {
+			continue
+		}
+
+		user := LocalUser{
+			Name:   fields[0],
+			UID:    uid,
+			GID:    gid,
+			Home:   fields[5],
+			Shell:  fields[6],
+			Groups: make([]string, 0),
+		}
+		if primary, ok := groupNames[gid]; ok {
+			user.Groups = append(user.Groups, primary)
+		}
+		for _, name := range memberOf[user.Name] {
+			if name != groupNames[gid] {
+				user.Groups = append(user.Groups, name)
+			}
+		}
+		facts.Users = append(facts.Users, user)
+	}
+
+	return facts
+}
+
+// ParseMountTable parses a mount table in the format of /etc/fstab and
+// /proc/self/mounts. Comments and blank lines are skipped.
+func ParseMountTable(content []byte) []MountEntry {
+	entries := make([]MountEntry, 0)
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		entry := MountEntry{
+			Device:     unescapeMountField(fields[0]),
+			MountPoint: unescapeMountField(fields[1]),
+			FSType:     fields[2],
+			Options:    strings.Split(fields[3], ","),
+		}
+		if len(fields) > 4 {
+			entry.Dump, _ = strconv.Atoi(fields[4])
+		}
+		if len(fields) > 5 {
+			entry.Pass, _ = strconv.Atoi(fields[5])
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// unescapeMountField decodes the octal escapes (e.g., \040 for a space)
+// used in mount tables.
+func unescapeMountField(field string) string {
+	if !strings.Contains(field, "\\") {
+		return field
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+3 < len(field) {
+			if c, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(field[i])
+	}
+	return b.String()
+}
+
+// ParseLocaleFacts builds the locale facts from the target of the
+// /etc/localtime link, the content of /etc/timezone and the content of the
+// locale configuration (/etc/locale.conf or /etc/default/locale). Any of
+// them may be empty.
+func ParseLocaleFacts(localtimeLink, timezone, localeConf string) *LocaleFacts {
+	facts := &LocaleFacts{Vars: make(map[string]string)}
+
+	// The link points into the zoneinfo database, e.g. /usr/share/zoneinfo/Europe/Paris
+	if _, zone, ok := strings.Cut(strings.TrimSpace(localtimeLink), "zoneinfo/"); ok {
+		facts.Timezone = zone
+	} else {
+		facts.Timezone = strings.TrimSpace(timezone)
+	}
+
+	for _, line := range strings.Split(localeConf, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+		facts.Vars[key] = strings.Trim(value, "\"'")
+	}
+	facts.Lang = facts.Vars["LANG"]
+
+	return facts
+}
+
+// Set sets a kernel parameter by its dotted key, e.g. net.ipv4.ip_forward.
+// Runs of whitespace in the value are collapsed, as values like
+// net.ipv4.ip_local_port_range are separated by tabs.
+func (f *SysctlFacts) Set(key, value string) {
+	if f.Params == nil {
+		f.Params = make(map[string]any)
+	}
+
+	parts := strings.Split(key, ".")
+	node := f.Params
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := node[part].(map[string]any)
+		if !ok {
+			child = make(map[string]any)
+			node[part] = child
+		}
+		node = child
+	}
+	node[parts[len(parts)-1]] = strings.Join(strings.Fields(value), " ")
+}
+
+// Get returns a kernel parameter by its dotted key.
+func (f *SysctlFacts) Get(key string) (string, bool) {
+	var node any = f.Params
+	for _, part := range strings.Split(key, ".") {
+		params, ok := node.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		if node, ok = params[part]; !ok {
+			return "", false
+		}
+	}
+	value, ok := node.(string)
+	return value, ok
+}
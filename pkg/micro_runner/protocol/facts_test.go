@@ -0,0 +1,145 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCustomFactName(t *testing.T) {
+	tests := []struct {
+		file    string
+		want    string
+		wantOK  bool
+		wantErr bool
+	}{
+		{"app.json", "app", true, false},
+		{"rack_info.sh", "rack_info", true, false},
+		{"inventory", "inventory", true, false},
+		{".hidden.json", "", false, false},
+		{"my-app.json", "", false, true},
+		{"2fa.yaml", "", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			name, ok, err := CustomFactName(tt.file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CustomFactName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if name != tt.want || ok != tt.wantOK {
+				t.Errorf("CustomFactName() = %q, %v, want %q, %v", name, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestDecodeCustomFact(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		script  bool
+		want    string
+		wantErr bool
+	}{
+		{"json", "app.json", `{"version": "1.0"}`, false, `{"version": "1.0"}`, false},
+		{"yaml", "team.yml", "owner: payments\nsize: 4\n", false, `{"owner":"payments","size":4}`, false},
+		{"script", "rack.sh", `{"rack": "r12"}`, true, `{"rack": "r12"}`, false},
+		{"script printing yaml", "rack.yaml", "rack: r12\n", true, "", true},
+		{"invalid json", "app.json", `{"version":`, false, "", true},
+		{"invalid yaml", "team.yaml", "owner: [payments\n", false, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := DecodeCustomFact(tt.file, []byte(tt.content), tt.script)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeCustomFact() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(data) != tt.want {
+				t.Errorf("DecodeCustomFact() = %s, want %s", data, tt.want)
+			}
+		})
+	}
+
+	// Static files need a fact extension; scripts do not
+	if IsCustomFactFile("README.txt", false) || !IsCustomFactFile("rack", true) {
+		t.Error("Expected only fact files and scripts to publish facts")
+	}
+}
+
+func TestParseSystemdUnits(t *testing.T) {
+	units := "" +
+		"cron.service  loaded active running Regular background program processing daemon\n" +
+		"● nginx.service loaded failed failed  A high performance web server\n"
+	unitFiles := "" +
+		"cron.service  enabled enabled\n" +
+		"nginx.service disabled enabled\n"
+
+	parsed := ParseSystemdUnits(units, unitFiles)
+	if len(parsed) != 2 {
+		t.Fatalf("Expected 2 units, got %+v", parsed)
+	}
+
+	expected := ServiceUnit{
+		Name:          "nginx.service",
+		Description:   "A high performance web server",
+		LoadState:     "loaded",
+		ActiveState:   "failed",
+		SubState:      "failed",
+		UnitFileState: "disabled",
+	}
+	if parsed[1] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, parsed[1])
+	}
+}
+
+func TestParseUserFacts(t *testing.T) {
+	passwd := "root:x:0:0:root:/root:/bin/bash\ndeploy:x:1000:1000:Deploy,,,:/home/deploy:/bin/bash\n"
+	group := "root:x:0:\nsudo:x:27:deploy\ndeploy:x:1000:\ndocker:x:998:deploy\n"
+
+	facts := ParseUserFacts([]byte(passwd), []byte(group))
+	if len(facts.Users) != 2 || len(facts.Groups) != 4 {
+		t.Fatalf("Expected 2 users and 4 groups, got %+v", facts)
+	}
+
+	deploy := facts.Users[1]
+	if deploy.UID != 1000 || deploy.Home != "/home/deploy" {
+		t.Errorf("Unexpected user: %+v", deploy)
+	}
+	// The primary group comes first
+	if got := strings.Join(deploy.Groups, ","); got != "deploy,sudo,docker" {
+		t.Errorf("Expected groups deploy,sudo,docker, got %s", got)
+	}
+}
+
+func TestParseMountTable(t *testing.T) {
+	content := "" +
+		"# <file system> <mount point> <type> <options> <dump> <pass>\n" +
+		"UUID=1234 / ext4 errors=remount-ro 0 1\n" +
+		"\n" +
+		"//nas/share /mnt/my\\040share cifs ro,noauto\n"
+
+	entries := ParseMountTable([]byte(content))
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %+v", entries)
+	}
+	if entries[0].MountPoint != "/" || entries[0].Pass != 1 {
+		t.Errorf("Unexpected root entry: %+v", entries[0])
+	}
+	if entries[1].MountPoint != "/mnt/my share" || strings.Join(entries[1].Options, ",") != "ro,noauto" {
+		t.Errorf("Unexpected share entry: %+v", entries[1])
+	}
+}
+
+func TestParseLocaleFacts(t *testing.T) {
+	facts := ParseLocaleFacts("/usr/share/zoneinfo/Europe/Paris", "Etc/UTC", "# Locale\nLANG=\"en_US.UTF-8\"\nLC_TIME=fr_FR.UTF-8\n")
+	if facts.Timezone != "Europe/Paris" || facts.Lang != "en_US.UTF-8" || facts.Vars["LC_TIME"] != "fr_FR.UTF-8" {
+		t.Errorf("Unexpected locale facts: %+v", facts)
+	}
+
+	// Without the link, /etc/timezone is used
+	if facts := ParseLocaleFacts("", "Etc/UTC\n", ""); facts.Timezone != "Etc/UTC" {
+		t.Errorf("Expected Etc/UTC, got %q", facts.Timezone)
+	}
+}
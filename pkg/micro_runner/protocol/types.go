@@ -44,6 +44,12 @@ const (
 	CommandTypeSudoersEnsure CommandType = "sudoers.ensure"
 	// CommandTypeSSHDHarden applies SSH hardening configuration
 	CommandTypeSSHDHarden CommandType = "sshd.harden"
+	// CommandTypeHTTPProbe probes an HTTP endpoint from the target host
+	CommandTypeHTTPProbe CommandType = "http.probe"
+	// CommandTypePortProbe checks that a TCP port accepts connections from the target host
+	CommandTypePortProbe CommandType = "port.probe"
+	// CommandTypeFactsGather collects fact namespaces natively on the target host
+	CommandTypeFactsGather CommandType = "facts.gather"
 )
 
 // Message is the base message structure for all protocol messages.
@@ -128,7 +134,7 @@ type ExecParams struct {
 	CaptureOut   bool              `json:"capture_out"`
 	CaptureErr   bool              `json:"capture_err"`
 	StreamLines  bool              `json:"stream_lines"`
-	UseSudo      bool              `json:"use_sudo,omitempty"`       // execute with sudo
+	UseSudo      bool              `json:"use_sudo,omitempty"`      // execute with sudo
 	SudoPassword string            `json:"sudo_password,omitempty"` // sudo password if needed
 }
 
@@ -216,8 +222,8 @@ type SudoersEnsureParams struct {
 	User         string   `json:"user"`
 	Commands     []string `json:"commands"` // allowed commands (full paths)
 	NoPasswd     bool     `json:"no_passwd"`
-	State        string   `json:"state"` // present, absent
-	UseSudo      bool     `json:"use_sudo,omitempty"`       // execute with sudo
+	State        string   `json:"state"`                   // present, absent
+	UseSudo      bool     `json:"use_sudo,omitempty"`      // execute with sudo
 	SudoPassword string   `json:"sudo_password,omitempty"` // sudo password if needed
 }
 
@@ -245,6 +251,205 @@ type SSHDHardenResult struct {
 	ServiceAction string   `json:"service_action"` // reloaded, none
 }
 
+// HTTPProbeParams contains parameters for probing an HTTP endpoint.
+type HTTPProbeParams struct {
+	URL          string            `json:"url"`
+	Method       string            `json:"method,omitempty"`        // defaults to GET
+	Headers      map[string]string `json:"headers,omitempty"`
+	ExpectStatus int               `json:"expect_status,omitempty"` // 0 = any 2xx
+	ExpectBody   string            `json:"expect_body,omitempty"`   // substring the body must contain
+	Insecure     bool              `json:"insecure,omitempty"`      // skip TLS verification
+}
+
+// HTTPProbeResult contains the result of an HTTP probe.
+type HTTPProbeResult struct {
+	StatusCode int     `json:"status_code"`
+	Healthy    bool    `json:"healthy"`
+	Body       string  `json:"body,omitempty"` // truncated response body
+	Message    string  `json:"message,omitempty"`
+	Duration   float64 `json:"duration"`
+}
+
+// PortProbeParams contains parameters for probing a TCP port.
+type PortProbeParams struct {
+	Host string `json:"host,omitempty"` // defaults to 127.0.0.1
+	Port int    `json:"port"`
+}
+
+// PortProbeResult contains the result of a port probe.
+type PortProbeResult struct {
+	Open     bool    `json:"open"`
+	Message  string  `json:"message,omitempty"`
+	Duration float64 `json:"duration"`
+}
+
+// GatherFactNamespaces lists the fact namespaces facts.gather can collect.
+var GatherFactNamespaces = []string{
+	"os.basic", "hw.cpu", "hw.memory", "hw.disk", "net.ifaces", "pkg.manifest",
+	"svc.units", "os.users", "net.ports", "fs.mounts", "os.sysctl", "os.locale",
+	CustomFactsNamespace,
+}
+
+// FactsGatherParams contains parameters for gathering facts.
+type FactsGatherParams struct {
+	Namespaces        []string `json:"namespaces,omitempty"`          // empty = all of GatherFactNamespaces
+	CustomFactsDir    string   `json:"custom_facts_dir,omitempty"`    // defaults to DefaultCustomFactsDir
+	CustomFactTimeout int      `json:"custom_fact_timeout,omitempty"` // seconds per script, defaults to DefaultCustomFactTimeout
+}
+
+// FactsGatherResult contains the facts gathered per namespace. A namespace
+// that failed is reported in Errors rather than failing the command; custom
+// facts that failed are reported per file as custom.<name>.
+type FactsGatherResult struct {
+	Facts  map[string]json.RawMessage `json:"facts"`
+	Errors map[string]string          `json:"errors,omitempty"`
+}
+
+// OSFacts contains OS information (os.basic).
+type OSFacts struct {
+	Name     string `json:"name"`
+	Distro   string `json:"distro"`
+	Version  string `json:"version"`
+	Kernel   string `json:"kernel"`
+	Arch     string `json:"arch"`
+	Hostname string `json:"hostname"`
+}
+
+// CPUFacts contains CPU information (hw.cpu).
+type CPUFacts struct {
+	Model   string `json:"model"`
+	Cores   int    `json:"cores"`
+	Threads int    `json:"threads"`
+	Arch    string `json:"arch"`
+	Vendor  string `json:"vendor"`
+}
+
+// MemoryFacts contains memory information (hw.memory).
+type MemoryFacts struct {
+	TotalMB     int64 `json:"total_mb"`
+	AvailableMB int64 `json:"available_mb"`
+	SwapTotalMB int64 `json:"swap_total_mb"`
+	SwapFreeMB  int64 `json:"swap_free_mb"`
+}
+
+// DiskFacts contains disk information (hw.disk).
+type DiskFacts struct {
+	Devices []DiskDevice `json:"devices"`
+}
+
+// DiskDevice represents a disk device.
+type DiskDevice struct {
+	Device      string `json:"device"`
+	MountPoint  string `json:"mount_point"`
+	FSType      string `json:"fs_type"`
+	TotalGB     int64  `json:"total_gb"`
+	UsedGB      int64  `json:"used_gb"`
+	AvailableGB int64  `json:"available_gb"`
+	UsePercent  int    `json:"use_percent"`
+}
+
+// NetworkFacts contains network information (net.ifaces).
+type NetworkFacts struct {
+	Interfaces []NetworkInterface `json:"interfaces"`
+}
+
+// NetworkInterface represents a network interface.
+type NetworkInterface struct {
+	Name        string   `json:"name"`
+	IPAddresses []string `json:"ip_addresses"`
+	MACAddress  string   `json:"mac_address"`
+	State       string   `json:"state"`
+}
+
+// PackageFacts contains package information (pkg.manifest).
+type PackageFacts struct {
+	Manager  string   `json:"manager"`
+	Packages []string `json:"packages"`
+	Count    int      `json:"count"`
+}
+
+// ServiceFacts contains the systemd service units (svc.units).
+type ServiceFacts struct {
+	Units []ServiceUnit `json:"units"`
+}
+
+// ServiceUnit represents a systemd unit and its state.
+type ServiceUnit struct {
+	Name          string `json:"name"` // e.g., nginx.service
+	Description   string `json:"description,omitempty"`
+	LoadState     string `json:"load_state"`                // loaded, not-found, masked
+	ActiveState   string `json:"active_state"`              // active, inactive, failed
+	SubState      string `json:"sub_state"`                 // running, exited, dead
+	UnitFileState string `json:"unit_file_state,omitempty"` // enabled, disabled, static
+}
+
+// UserFacts contains the local users and groups (os.users).
+type UserFacts struct {
+	Users  []LocalUser  `json:"users"`
+	Groups []LocalGroup `json:"groups"`
+}
+
+// LocalUser represents a user from /etc/passwd.
+type LocalUser struct {
+	Name   string   `json:"name"`
+	UID    int      `json:"uid"`
+	GID    int      `json:"gid"`
+	Home   string   `json:"home"`
+	Shell  string   `json:"shell"`
+	Groups []string `json:"groups"` // primary group first
+}
+
+// LocalGroup represents a group from /etc/group.
+type LocalGroup struct {
+	Name    string   `json:"name"`
+	GID     int      `json:"gid"`
+	Members []string `json:"members"`
+}
+
+// PortFacts contains the listening sockets (net.ports).
+type PortFacts struct {
+	Listening []ListeningSocket `json:"listening"`
+}
+
+// ListeningSocket represents a socket accepting connections or datagrams.
+type ListeningSocket struct {
+	Protocol string `json:"protocol"` // tcp, tcp6, udp, udp6
+	Address  string `json:"address"`
+	Port     int    `json:"port"`
+	PID      int    `json:"pid,omitempty"` // 0 when the owner is not visible
+	Process  string `json:"process,omitempty"`
+}
+
+// MountFacts contains the mounted filesystems and the fstab entries (fs.mounts).
+type MountFacts struct {
+	Mounts []MountEntry `json:"mounts"`
+	Fstab  []MountEntry `json:"fstab"`
+}
+
+// MountEntry represents a line of a mount table.
+type MountEntry struct {
+	Device     string   `json:"device"`
+	MountPoint string   `json:"mount_point"`
+	FSType     string   `json:"fs_type"`
+	Options    []string `json:"options"`
+	Dump       int      `json:"dump,omitempty"`
+	Pass       int      `json:"pass,omitempty"`
+}
+
+// SysctlFacts contains the kernel parameters (os.sysctl). Params are nested
+// by the components of their keys, so net.ipv4.ip_forward is read as
+// params.net.ipv4.ip_forward.
+type SysctlFacts struct {
+	Params map[string]any `json:"params"`
+}
+
+// LocaleFacts contains the timezone and locale settings (os.locale).
+type LocaleFacts struct {
+	Timezone string            `json:"timezone"`
+	Lang     string            `json:"lang"`
+	Vars     map[string]string `json:"vars,omitempty"` // e.g., LC_TIME
+}
+
 // Validation methods
 
 // Validate checks if the message type is valid.
@@ -263,7 +468,9 @@ func (ct CommandType) Validate() error {
 	switch ct {
 	case CommandTypeExec, CommandTypeFileWrite, CommandTypeFileRead,
 		CommandTypePkgEnsure, CommandTypeServiceReload,
-		CommandTypeSudoersEnsure, CommandTypeSSHDHarden:
+		CommandTypeSudoersEnsure, CommandTypeSSHDHarden,
+		CommandTypeHTTPProbe, CommandTypePortProbe,
+		CommandTypeFactsGather:
 		return nil
 	default:
 		return fmt.Errorf("invalid command type: %s", ct)
@@ -43,6 +43,9 @@ func TestCommandTypeValidate(t *testing.T) {
 		{"valid service.reload", CommandTypeServiceReload, false},
 		{"valid sudoers.ensure", CommandTypeSudoersEnsure, false},
 		{"valid sshd.harden", CommandTypeSSHDHarden, false},
+		{"valid http.probe", CommandTypeHTTPProbe, false},
+		{"valid port.probe", CommandTypePortProbe, false},
+		{"valid facts.gather", CommandTypeFactsGather, false},
 		{"invalid type", CommandType("invalid"), true},
 		{"empty type", CommandType(""), true},
 	}
@@ -0,0 +1,11 @@
+-- Workspace locks serialize plan, apply and drift reconciliation across operators
+CREATE TABLE IF NOT EXISTS workspace_locks (
+    workspace TEXT PRIMARY KEY,
+    lock_id TEXT NOT NULL,
+    owner TEXT NOT NULL,
+    operation TEXT NOT NULL,
+    reason TEXT,
+    acquired_at TIMESTAMP NOT NULL,
+    heartbeat_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
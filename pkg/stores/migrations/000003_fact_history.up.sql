@@ -0,0 +1,12 @@
+-- fact_history: versioned snapshots of facts, one per change
+CREATE TABLE IF NOT EXISTS fact_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    target_id TEXT NOT NULL,
+    namespace TEXT NOT NULL,
+    value TEXT NOT NULL,
+    hash TEXT NOT NULL,
+    collected_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_fact_history_target_namespace ON fact_history(target_id, namespace, collected_at);
+CREATE INDEX idx_fact_history_collected_at ON fact_history(collected_at);
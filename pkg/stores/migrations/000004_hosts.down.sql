@@ -0,0 +1,27 @@
+-- Move the hosts back into the facts table as JSON blobs. Groups and status
+-- have no place there and are dropped.
+INSERT OR IGNORE INTO facts (id, target_id, namespace, key, value, ttl, created_at, updated_at)
+SELECT
+    lower(hex(randomblob(16))),
+    hosts.id,
+    'host.metadata',
+    'info',
+    json_object(
+        'id', hosts.id,
+        'address', hosts.address,
+        'port', hosts.port,
+        'user', hosts.user,
+        'key_path', hosts.key_path,
+        'labels', json((SELECT COALESCE(json_group_object(key, value), '{}') FROM host_labels WHERE host_id = hosts.id)),
+        'onboarded_at', COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', hosts.onboarded_at), '0001-01-01T00:00:00Z'),
+        'created_at', strftime('%Y-%m-%dT%H:%M:%SZ', hosts.created_at),
+        'updated_at', strftime('%Y-%m-%dT%H:%M:%SZ', hosts.updated_at)
+    ),
+    0,
+    hosts.created_at,
+    hosts.updated_at
+FROM hosts;
+
+DROP TABLE IF EXISTS host_groups;
+DROP TABLE IF EXISTS host_labels;
+DROP TABLE IF EXISTS hosts;
@@ -0,0 +1,60 @@
+-- hosts table: the managed host inventory and its connection settings
+CREATE TABLE IF NOT EXISTS hosts (
+    id TEXT PRIMARY KEY NOT NULL,
+    address TEXT NOT NULL,
+    port INTEGER NOT NULL DEFAULT 22,
+    user TEXT NOT NULL DEFAULT '',
+    key_path TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'active',
+    onboarded_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_hosts_address ON hosts(address);
+CREATE INDEX idx_hosts_status ON hosts(status);
+
+-- host_labels table: one row per label, indexed for selector queries
+CREATE TABLE IF NOT EXISTS host_labels (
+    host_id TEXT NOT NULL,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    PRIMARY KEY (host_id, key),
+    FOREIGN KEY (host_id) REFERENCES hosts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_host_labels_key_value ON host_labels(key, value);
+
+-- host_groups table: the groups a host belongs to
+CREATE TABLE IF NOT EXISTS host_groups (
+    host_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    PRIMARY KEY (host_id, name),
+    FOREIGN KEY (host_id) REFERENCES hosts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_host_groups_name ON host_groups(name);
+
+-- Move the hosts stored as JSON blobs in the facts table
+INSERT OR IGNORE INTO hosts (id, address, port, user, key_path, status, onboarded_at, created_at, updated_at)
+SELECT
+    target_id,
+    COALESCE(json_extract(value, '$.address'), ''),
+    COALESCE(NULLIF(json_extract(value, '$.port'), 0), 22),
+    COALESCE(json_extract(value, '$.user'), ''),
+    COALESCE(json_extract(value, '$.key_path'), ''),
+    'active',
+    CASE WHEN json_extract(value, '$.onboarded_at') LIKE '0001-01-01%' THEN NULL
+         ELSE strftime('%Y-%m-%d %H:%M:%S', json_extract(value, '$.onboarded_at')) END,
+    COALESCE(strftime('%Y-%m-%d %H:%M:%S', json_extract(value, '$.created_at')), created_at),
+    COALESCE(strftime('%Y-%m-%d %H:%M:%S', json_extract(value, '$.updated_at')), updated_at)
+FROM facts
+WHERE namespace = 'host.metadata' AND key = 'info' AND json_valid(value);
+
+INSERT OR IGNORE INTO host_labels (host_id, key, value)
+SELECT facts.target_id, labels.key, CAST(labels.value AS TEXT)
+FROM facts, json_each(facts.value, '$.labels') AS labels
+WHERE facts.namespace = 'host.metadata' AND facts.key = 'info'
+  AND json_valid(facts.value) AND json_type(facts.value, '$.labels') = 'object';
+
+DELETE FROM facts WHERE namespace IN ('host.metadata', 'host.labels');
@@ -6,6 +6,8 @@ import (
 	"embed"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/golang-migrate/migrate/v4"
@@ -668,6 +670,63 @@ func (s *SQLiteStore) ListResourceStates(ctx context.Context, limit, offset int)
 	return states, nil
 }
 
+// RenameResourceState moves the state of a resource to a new name. It fails
+// if no state exists under the old name or a state already exists under the new one
+func (s *SQLiteStore) RenameResourceState(ctx context.Context, resourceType, fromName, toName string) error {
+	return s.RenameResourceStates(ctx, resourceType, map[string]string{fromName: toName})
+}
+
+// RenameResourceStates moves the states of resources to new names, keyed by
+// old name, in one transaction. Either every state is moved or none is
+func (s *SQLiteStore) RenameResourceStates(ctx context.Context, resourceType string, names map[string]string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now()
+	for fromName, toName := range names {
+		var exists int
+		err := tx.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM resource_state WHERE resource_type = ? AND resource_name = ?`,
+			resourceType, toName,
+		).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to check resource state: %w", err)
+		}
+		if exists > 0 {
+			return fmt.Errorf("resource state already exists: %s/%s", resourceType, toName)
+		}
+
+		query := `
+			UPDATE resource_state
+			SET resource_name = ?, updated_at = ?
+			WHERE resource_type = ? AND resource_name = ?
+		`
+
+		result, err := tx.ExecContext(ctx, query, toName, now, resourceType, fromName)
+		if err != nil {
+			return fmt.Errorf("failed to rename resource state: %w", err)
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+
+		if rows == 0 {
+			return fmt.Errorf("resource state not found: %s/%s", resourceType, fromName)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
 // DeleteResourceState deletes a resource state by ID
 func (s *SQLiteStore) DeleteResourceState(ctx context.Context, id string) error {
 	query := `DELETE FROM resource_state WHERE id = ?`
@@ -842,6 +901,510 @@ func (s *SQLiteStore) DeleteFact(ctx context.Context, id string) error {
 	return nil
 }
 
+// AppendFactSnapshot records a new version of a fact
+func (s *SQLiteStore) AppendFactSnapshot(ctx context.Context, snapshot *FactSnapshot) error {
+	query := `
+		INSERT INTO fact_history (target_id, namespace, value, hash, collected_at)
+		VALUES (?, ?, ?, ?, ?)
+	`
+
+	result, err := s.db.ExecContext(ctx, query,
+		snapshot.TargetID,
+		snapshot.Namespace,
+		snapshot.Value,
+		snapshot.Hash,
+		snapshot.CollectedAt.UTC().Format("2006-01-02 15:04:05"),
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to append fact snapshot: %w", err)
+	}
+
+	// Get the auto-generated ID
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get fact snapshot ID: %w", err)
+	}
+
+	snapshot.ID = id
+	return nil
+}
+
+// ListFactSnapshots lists the versions of a target's facts, newest first, with
+// an optional namespace filter and pagination
+func (s *SQLiteStore) ListFactSnapshots(ctx context.Context, targetID string, namespace *string, limit, offset int) ([]*FactSnapshot, error) {
+	query := `
+		SELECT id, target_id, namespace, value, hash, collected_at
+		FROM fact_history
+		WHERE target_id = ?
+		  AND (? IS NULL OR namespace = ?)
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, targetID, namespace, namespace, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list fact snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	snapshots := []*FactSnapshot{}
+	for rows.Next() {
+		snapshot := &FactSnapshot{}
+		err := rows.Scan(
+			&snapshot.ID,
+			&snapshot.TargetID,
+			&snapshot.Namespace,
+			&snapshot.Value,
+			&snapshot.Hash,
+			&snapshot.CollectedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan fact snapshot: %w", err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating fact snapshots: %w", err)
+	}
+
+	return snapshots, nil
+}
+
+// DeleteFactSnapshotsBefore deletes the fact versions collected before a time.
+// The latest version of each fact is kept, so changes can still be diffed
+// against it.
+func (s *SQLiteStore) DeleteFactSnapshotsBefore(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+		DELETE FROM fact_history
+		WHERE datetime(collected_at) < datetime(?)
+		  AND id NOT IN (SELECT MAX(id) FROM fact_history GROUP BY target_id, namespace)
+	`
+
+	result, err := s.db.ExecContext(ctx, query, before.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete fact snapshots: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rows, nil
+}
+
+// UpsertHost inserts or updates a host, replacing its labels and groups
+func (s *SQLiteStore) UpsertHost(ctx context.Context, host *Host) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := `
+		INSERT INTO hosts (
+			id, address, port, user, key_path, status, onboarded_at, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			address = excluded.address,
+			port = excluded.port,
+			user = excluded.user,
+			key_path = excluded.key_path,
+			status = excluded.status,
+			onboarded_at = excluded.onboarded_at,
+			updated_at = excluded.updated_at
+	`
+
+	var onboardedAtStr *string
+	if host.OnboardedAt != nil {
+		formatted := host.OnboardedAt.UTC().Format("2006-01-02 15:04:05")
+		onboardedAtStr = &formatted
+	}
+
+	_, err = tx.ExecContext(ctx, query,
+		host.ID,
+		host.Address,
+		host.Port,
+		host.User,
+		host.KeyPath,
+		host.Status,
+		onboardedAtStr,
+		host.CreatedAt.UTC().Format("2006-01-02 15:04:05"),
+		host.UpdatedAt.UTC().Format("2006-01-02 15:04:05"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to upsert host: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM host_labels WHERE host_id = ?`, host.ID); err != nil {
+		return fmt.Errorf("failed to clear host labels: %w", err)
+	}
+	for key, value := range host.Labels {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO host_labels (host_id, key, value) VALUES (?, ?, ?)`,
+			host.ID, key, value,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to store host label %s: %w", key, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM host_groups WHERE host_id = ?`, host.ID); err != nil {
+		return fmt.Errorf("failed to clear host groups: %w", err)
+	}
+	for _, group := range host.Groups {
+		_, err := tx.ExecContext(ctx,
+			`INSERT OR IGNORE INTO host_groups (host_id, name) VALUES (?, ?)`,
+			host.ID, group,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to store host group %s: %w", group, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit host: %w", err)
+	}
+
+	return nil
+}
+
+// GetHost retrieves a host by ID, with its labels and groups
+func (s *SQLiteStore) GetHost(ctx context.Context, id string) (*Host, error) {
+	hosts, err := s.queryHosts(ctx, `WHERE id = ?`, []interface{}{id})
+	if err != nil {
+		return nil, err
+	}
+
+	// Wraps sql.ErrNoRows so callers can tell a missing host from a failure
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("host not found: %s: %w", id, sql.ErrNoRows)
+	}
+
+	return hosts[0], nil
+}
+
+// ListHosts lists the hosts matching a filter, ordered by ID, with pagination
+func (s *SQLiteStore) ListHosts(ctx context.Context, filter HostFilter, limit, offset int) ([]*Host, error) {
+	where := `WHERE (? IS NULL OR address = ?) AND (? IS NULL OR status = ?)`
+	args := []interface{}{filter.Address, filter.Address, filter.Status, filter.Status}
+
+	if filter.Group != nil {
+		where += ` AND EXISTS (SELECT 1 FROM host_groups g WHERE g.host_id = hosts.id AND g.name = ?)`
+		args = append(args, *filter.Group)
+	}
+
+	// Sorted so that the query text is stable
+	keys := make([]string, 0, len(filter.Labels))
+	for key := range filter.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		where += ` AND EXISTS (SELECT 1 FROM host_labels l WHERE l.host_id = hosts.id AND l.key = ? AND l.value = ?)`
+		args = append(args, key, filter.Labels[key])
+	}
+
+	return s.queryHosts(ctx, where+` ORDER BY id LIMIT ? OFFSET ?`, append(args, limit, offset))
+}
+
+// queryHosts selects hosts with the given WHERE clause and loads their labels
+// and groups
+func (s *SQLiteStore) queryHosts(ctx context.Context, where string, args []interface{}) ([]*Host, error) {
+	query := `
+		SELECT id, address, port, user, key_path, status, onboarded_at, created_at, updated_at
+		FROM hosts
+	` + where
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list hosts: %w", err)
+	}
+
+	hosts := []*Host{}
+	byID := make(map[string]*Host)
+	for rows.Next() {
+		host := &Host{
+			Labels: make(map[string]string),
+			Groups: []string{},
+		}
+		err := rows.Scan(
+			&host.ID,
+			&host.Address,
+			&host.Port,
+			&host.User,
+			&host.KeyPath,
+			&host.Status,
+			&host.OnboardedAt,
+			&host.CreatedAt,
+			&host.UpdatedAt,
+		)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan host: %w", err)
+		}
+		hosts = append(hosts, host)
+		byID[host.ID] = host
+	}
+
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, fmt.Errorf("error iterating hosts: %w", err)
+	}
+	rows.Close()
+
+	if len(hosts) == 0 {
+		return hosts, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(hosts)), ", ")
+	ids := make([]interface{}, len(hosts))
+	for i, host := range hosts {
+		ids[i] = host.ID
+	}
+
+	labelRows, err := s.db.QueryContext(ctx,
+		`SELECT host_id, key, value FROM host_labels WHERE host_id IN (`+placeholders+`)`, ids...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list host labels: %w", err)
+	}
+	defer labelRows.Close()
+
+	for labelRows.Next() {
+		var hostID, key, value string
+		if err := labelRows.Scan(&hostID, &key, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan host label: %w", err)
+		}
+		byID[hostID].Labels[key] = value
+	}
+
+	if err := labelRows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating host labels: %w", err)
+	}
+
+	groupRows, err := s.db.QueryContext(ctx,
+		`SELECT host_id, name FROM host_groups WHERE host_id IN (`+placeholders+`) ORDER BY name`, ids...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list host groups: %w", err)
+	}
+	defer groupRows.Close()
+
+	for groupRows.Next() {
+		var hostID, name string
+		if err := groupRows.Scan(&hostID, &name); err != nil {
+			return nil, fmt.Errorf("failed to scan host group: %w", err)
+		}
+		byID[hostID].Groups = append(byID[hostID].Groups, name)
+	}
+
+	if err := groupRows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating host groups: %w", err)
+	}
+
+	return hosts, nil
+}
+
+// UpdateHostStatus updates the status of a host
+func (s *SQLiteStore) UpdateHostStatus(ctx context.Context, id string, status HostStatus) error {
+	query := `UPDATE hosts SET status = ?, updated_at = ? WHERE id = ?`
+
+	result, err := s.db.ExecContext(ctx, query, status, time.Now().UTC().Format("2006-01-02 15:04:05"), id)
+	if err != nil {
+		return fmt.Errorf("failed to update host status: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("host not found: %s", id)
+	}
+
+	return nil
+}
+
+// DeleteHost deletes a host with its labels, groups, cached facts and fact
+// history
+func (s *SQLiteStore) DeleteHost(ctx context.Context, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Deleted explicitly, as foreign keys are only enforced on some connections
+	if _, err := tx.ExecContext(ctx, `DELETE FROM host_labels WHERE host_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete host labels: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM host_groups WHERE host_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete host groups: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM facts WHERE target_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete host facts: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM fact_history WHERE target_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete host fact history: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM hosts WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete host: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("host not found: %s", id)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit host deletion: %w", err)
+	}
+
+	return nil
+}
+
+// AcquireWorkspaceLock takes the lock of a workspace when it is free or its
+// lease has expired. It reports false when another holder has the lock.
+func (s *SQLiteStore) AcquireWorkspaceLock(ctx context.Context, lock *WorkspaceLock) (bool, error) {
+	query := `
+		INSERT INTO workspace_locks (
+			workspace, lock_id, owner, operation, reason, acquired_at, heartbeat_at, expires_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(workspace) DO UPDATE SET
+			lock_id = excluded.lock_id,
+			owner = excluded.owner,
+			operation = excluded.operation,
+			reason = excluded.reason,
+			acquired_at = excluded.acquired_at,
+			heartbeat_at = excluded.heartbeat_at,
+			expires_at = excluded.expires_at
+		WHERE datetime(workspace_locks.expires_at) <= datetime(excluded.acquired_at)
+	`
+
+	result, err := s.db.ExecContext(ctx, query,
+		lock.Workspace,
+		lock.LockID,
+		lock.Owner,
+		lock.Operation,
+		lock.Reason,
+		lock.AcquiredAt.UTC().Format("2006-01-02 15:04:05"),
+		lock.HeartbeatAt.UTC().Format("2006-01-02 15:04:05"),
+		lock.ExpiresAt.UTC().Format("2006-01-02 15:04:05"),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire workspace lock: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rows > 0, nil
+}
+
+// GetWorkspaceLock retrieves the lock of a workspace, including an expired one.
+// It returns nil when the workspace is not locked.
+func (s *SQLiteStore) GetWorkspaceLock(ctx context.Context, workspace string) (*WorkspaceLock, error) {
+	query := `
+		SELECT workspace, lock_id, owner, operation, reason, acquired_at, heartbeat_at, expires_at
+		FROM workspace_locks
+		WHERE workspace = ?
+	`
+
+	lock := &WorkspaceLock{}
+	err := s.db.QueryRowContext(ctx, query, workspace).Scan(
+		&lock.Workspace,
+		&lock.LockID,
+		&lock.Owner,
+		&lock.Operation,
+		&lock.Reason,
+		&lock.AcquiredAt,
+		&lock.HeartbeatAt,
+		&lock.ExpiresAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace lock: %w", err)
+	}
+
+	return lock, nil
+}
+
+// RenewWorkspaceLock records a heartbeat and extends the lease of a held lock
+func (s *SQLiteStore) RenewWorkspaceLock(ctx context.Context, workspace, lockID string, expiresAt time.Time) error {
+	query := `
+		UPDATE workspace_locks
+		SET heartbeat_at = ?, expires_at = ?
+		WHERE workspace = ? AND lock_id = ?
+	`
+
+	result, err := s.db.ExecContext(ctx, query,
+		time.Now().UTC().Format("2006-01-02 15:04:05"),
+		expiresAt.UTC().Format("2006-01-02 15:04:05"),
+		workspace,
+		lockID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to renew workspace lock: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("workspace lock no longer held: %s", workspace)
+	}
+
+	return nil
+}
+
+// ReleaseWorkspaceLock releases a held lock. Releasing a lock that was taken
+// over or force-released is not an error.
+func (s *SQLiteStore) ReleaseWorkspaceLock(ctx context.Context, workspace, lockID string) error {
+	query := `DELETE FROM workspace_locks WHERE workspace = ? AND lock_id = ?`
+
+	if _, err := s.db.ExecContext(ctx, query, workspace, lockID); err != nil {
+		return fmt.Errorf("failed to release workspace lock: %w", err)
+	}
+
+	return nil
+}
+
+// ForceReleaseWorkspaceLock removes the lock of a workspace regardless of its holder
+func (s *SQLiteStore) ForceReleaseWorkspaceLock(ctx context.Context, workspace string) error {
+	query := `DELETE FROM workspace_locks WHERE workspace = ?`
+
+	result, err := s.db.ExecContext(ctx, query, workspace)
+	if err != nil {
+		return fmt.Errorf("failed to force-release workspace lock: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("workspace lock not found: %s", workspace)
+	}
+
+	return nil
+}
+
 // CreateAuditEntry creates a new audit log entry
 func (s *SQLiteStore) CreateAuditEntry(ctx context.Context, entry *AuditEntry) error {
 	query := `
@@ -2,9 +2,16 @@ package stores
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"os"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 )
 
 // setupTestStore creates an in-memory SQLite store for testing
@@ -61,7 +68,7 @@ func TestStoreMigrations(t *testing.T) {
 	ctx := context.Background()
 
 	// Check that tables exist by querying them
-	tables := []string{"runs", "plan_units", "events", "resource_state", "facts", "audit"}
+	tables := []string{"runs", "plan_units", "events", "resource_state", "facts", "fact_history", "audit", "workspace_locks", "hosts", "host_labels", "host_groups"}
 	for _, table := range tables {
 		query := "SELECT COUNT(*) FROM " + table
 		var count int
@@ -426,6 +433,94 @@ func TestResourceStateOperations(t *testing.T) {
 }
 
 // TestFactOperations tests Fact operations including TTL
+// TestRenameResourceState tests moving resource state to a new name
+func TestRenameResourceState(t *testing.T) {
+	store := setupTestStore(t)
+	defer store.Close()
+
+	ctx := context.Background()
+	now := time.Now()
+
+	run := &Run{
+		ID:        "run-mv",
+		PlanPath:  "/plans/test.json",
+		Status:    RunStatusCompleted,
+		StartedAt: now,
+		Metadata:  `{}`,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := store.CreateRun(ctx, run); err != nil {
+		t.Fatalf("failed to create run: %v", err)
+	}
+
+	for i, name := range []string{"users[0]", "users[bob]"} {
+		state := &ResourceState{
+			ID:           "rs-mv-" + string(rune('0'+i)),
+			ResourceType: "linux.user",
+			ResourceName: name,
+			State:        `{}`,
+			Hash:         "hash",
+			LastRunID:    run.ID,
+			LastApplied:  now,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		if err := store.UpsertResourceState(ctx, state); err != nil {
+			t.Fatalf("failed to upsert resource state: %v", err)
+		}
+	}
+
+	if err := store.RenameResourceState(ctx, "linux.user", "users[0]", "users[alice]"); err != nil {
+		t.Fatalf("failed to rename resource state: %v", err)
+	}
+
+	moved, err := store.GetResourceState(ctx, "linux.user", "users[alice]")
+	if err != nil {
+		t.Fatalf("failed to get moved resource state: %v", err)
+	}
+	if moved.ID != "rs-mv-0" {
+		t.Errorf("expected moved state rs-mv-0, got %s", moved.ID)
+	}
+
+	if _, err := store.GetResourceState(ctx, "linux.user", "users[0]"); err == nil {
+		t.Error("expected old name to be gone")
+	}
+
+	// Renaming onto an existing state fails
+	if err := store.RenameResourceState(ctx, "linux.user", "users[alice]", "users[bob]"); err == nil {
+		t.Error("expected error when renaming onto an existing state")
+	}
+
+	// Renaming a missing state fails
+	if err := store.RenameResourceState(ctx, "linux.user", "users[carol]", "users[dave]"); err == nil {
+		t.Error("expected error when renaming a missing state")
+	}
+
+	// A failing rename moves none of the states renamed with it
+	err = store.RenameResourceStates(ctx, "linux.user", map[string]string{
+		"users[alice]": "admins[alice]",
+		"users[carol]": "admins[carol]",
+	})
+	if err == nil {
+		t.Fatal("expected error when one of the states is missing")
+	}
+	if _, err := store.GetResourceState(ctx, "linux.user", "users[alice]"); err != nil {
+		t.Errorf("expected users[alice] to stay in place: %v", err)
+	}
+
+	err = store.RenameResourceStates(ctx, "linux.user", map[string]string{
+		"users[alice]": "admins[alice]",
+		"users[bob]":   "admins[bob]",
+	})
+	if err != nil {
+		t.Fatalf("failed to rename resource states: %v", err)
+	}
+	if _, err := store.GetResourceState(ctx, "linux.user", "admins[bob]"); err != nil {
+		t.Errorf("expected users[bob] to be moved: %v", err)
+	}
+}
+
 func TestFactOperations(t *testing.T) {
 	store := setupTestStore(t)
 	defer store.Close()
@@ -547,6 +642,267 @@ func TestFactOperations(t *testing.T) {
 	}
 }
 
+// TestFactHistoryOperations tests fact history operations
+func TestFactHistoryOperations(t *testing.T) {
+	store := setupTestStore(t)
+	defer store.Close()
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	snapshots := []*FactSnapshot{
+		{TargetID: "host-001", Namespace: "os.basic", Value: `{"kernel":"6.1"}`, Hash: "a", CollectedAt: now.Add(-10 * 24 * time.Hour)},
+		{TargetID: "host-001", Namespace: "os.basic", Value: `{"kernel":"6.5"}`, Hash: "b", CollectedAt: now.Add(-5 * 24 * time.Hour)},
+		{TargetID: "host-001", Namespace: "hw.cpu", Value: `{"cores":4}`, Hash: "c", CollectedAt: now.Add(-20 * 24 * time.Hour)},
+		{TargetID: "host-001", Namespace: "os.basic", Value: `{"kernel":"6.8"}`, Hash: "d", CollectedAt: now},
+	}
+	for _, snapshot := range snapshots {
+		if err := store.AppendFactSnapshot(ctx, snapshot); err != nil {
+			t.Fatalf("failed to append fact snapshot: %v", err)
+		}
+		if snapshot.ID == 0 {
+			t.Error("expected snapshot ID to be set")
+		}
+	}
+
+	// Newest first
+	namespace := "os.basic"
+	listed, err := store.ListFactSnapshots(ctx, "host-001", &namespace, 10, 0)
+	if err != nil {
+		t.Fatalf("failed to list fact snapshots: %v", err)
+	}
+	if len(listed) != 3 || listed[0].Hash != "d" || listed[2].Hash != "a" {
+		t.Errorf("expected the 3 os.basic versions newest first, got %d", len(listed))
+	}
+
+	// The latest version of each fact is kept, however old
+	deleted, err := store.DeleteFactSnapshotsBefore(ctx, now.Add(-7*24*time.Hour))
+	if err != nil {
+		t.Fatalf("failed to delete fact snapshots: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("expected 1 fact snapshot deleted, got %d", deleted)
+	}
+
+	listed, err = store.ListFactSnapshots(ctx, "host-001", nil, 10, 0)
+	if err != nil {
+		t.Fatalf("failed to list fact snapshots: %v", err)
+	}
+	if len(listed) != 3 {
+		t.Errorf("expected 3 fact snapshots left, got %d", len(listed))
+	}
+}
+
+// TestHostOperations tests Host operations
+func TestHostOperations(t *testing.T) {
+	store := setupTestStore(t)
+	defer store.Close()
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	hosts := []*Host{
+		{ID: "web1", Address: "10.0.0.1", Port: 22, User: "froyo", Status: HostStatusActive,
+			Labels: map[string]string{"env": "prod", "role": "web"}, Groups: []string{"web", "frontend"},
+			OnboardedAt: &now, CreatedAt: now, UpdatedAt: now},
+		{ID: "web2", Address: "10.0.0.2", Port: 2222, User: "froyo", Status: HostStatusActive,
+			Labels: map[string]string{"env": "staging", "role": "web"}, Groups: []string{"web"},
+			CreatedAt: now, UpdatedAt: now},
+		{ID: "db1", Address: "10.0.0.3", Port: 22, User: "root", Status: HostStatusActive,
+			Labels: map[string]string{"env": "prod", "role": "db"}, CreatedAt: now, UpdatedAt: now},
+	}
+	for _, host := range hosts {
+		if err := store.UpsertHost(ctx, host); err != nil {
+			t.Fatalf("failed to upsert host: %v", err)
+		}
+	}
+
+	retrieved, err := store.GetHost(ctx, "web1")
+	if err != nil {
+		t.Fatalf("failed to get host: %v", err)
+	}
+	if retrieved.Address != "10.0.0.1" || retrieved.Labels["role"] != "web" {
+		t.Errorf("unexpected host: %+v", retrieved)
+	}
+	if len(retrieved.Groups) != 2 || retrieved.Groups[0] != "frontend" {
+		t.Errorf("expected groups [frontend web], got %v", retrieved.Groups)
+	}
+	if retrieved.OnboardedAt == nil {
+		t.Error("expected onboarded_at to be set")
+	}
+
+	if _, err := store.GetHost(ctx, "missing"); err == nil {
+		t.Error("expected error for missing host")
+	}
+
+	// Filters
+	group := "web"
+	prodWeb := map[string]string{"env": "prod", "role": "web"}
+	address := "10.0.0.3"
+	tests := []struct {
+		name   string
+		filter HostFilter
+		want   []string
+	}{
+		{"all", HostFilter{}, []string{"db1", "web1", "web2"}},
+		{"labels", HostFilter{Labels: prodWeb}, []string{"web1"}},
+		{"group", HostFilter{Group: &group}, []string{"web1", "web2"}},
+		{"address", HostFilter{Address: &address}, []string{"db1"}},
+	}
+	for _, tt := range tests {
+		listed, err := store.ListHosts(ctx, tt.filter, 100, 0)
+		if err != nil {
+			t.Fatalf("%s: failed to list hosts: %v", tt.name, err)
+		}
+		ids := make([]string, len(listed))
+		for i, host := range listed {
+			ids[i] = host.ID
+		}
+		if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: expected hosts %v, got %v", tt.name, tt.want, ids)
+		}
+	}
+
+	// Upserting replaces labels and groups
+	hosts[1].Labels = map[string]string{"env": "prod"}
+	hosts[1].Groups = nil
+	if err := store.UpsertHost(ctx, hosts[1]); err != nil {
+		t.Fatalf("failed to update host: %v", err)
+	}
+	retrieved, err = store.GetHost(ctx, "web2")
+	if err != nil {
+		t.Fatalf("failed to get host: %v", err)
+	}
+	if len(retrieved.Labels) != 1 || len(retrieved.Groups) != 0 || retrieved.Port != 2222 {
+		t.Errorf("unexpected updated host: %+v", retrieved)
+	}
+
+	// Status
+	if err := store.UpdateHostStatus(ctx, "db1", HostStatusUnreachable); err != nil {
+		t.Fatalf("failed to update host status: %v", err)
+	}
+	unreachable := HostStatusUnreachable
+	listed, err := store.ListHosts(ctx, HostFilter{Status: &unreachable}, 100, 0)
+	if err != nil {
+		t.Fatalf("failed to list hosts: %v", err)
+	}
+	if len(listed) != 1 || listed[0].ID != "db1" {
+		t.Errorf("expected only db1 to be unreachable, got %d hosts", len(listed))
+	}
+
+	// Delete, with the facts and fact history of the host
+	now = time.Now().UTC()
+	if err := store.UpsertFact(ctx, &Fact{
+		ID: "fact-web1", TargetID: "web1", Namespace: "os.basic", Key: "os.basic", Value: `{}`,
+		CreatedAt: now, UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("failed to upsert fact: %v", err)
+	}
+	if err := store.AppendFactSnapshot(ctx, &FactSnapshot{
+		TargetID: "web1", Namespace: "os.basic", Value: `{}`, Hash: "a", CollectedAt: now,
+	}); err != nil {
+		t.Fatalf("failed to append fact snapshot: %v", err)
+	}
+	if err := store.DeleteHost(ctx, "web1"); err != nil {
+		t.Fatalf("failed to delete host: %v", err)
+	}
+	if _, err := store.GetHost(ctx, "web1"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for deleted host, got %v", err)
+	}
+	for _, table := range []string{"host_labels WHERE host_id", "facts WHERE target_id", "fact_history WHERE target_id"} {
+		var count int
+		if err := store.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table+` = 'web1'`).Scan(&count); err != nil {
+			t.Fatalf("failed to count %s: %v", table, err)
+		}
+		if count != 0 {
+			t.Errorf("expected the rows of the deleted host in %s to be deleted, got %d", table, count)
+		}
+	}
+	if err := store.DeleteHost(ctx, "web1"); err == nil {
+		t.Error("expected error deleting a missing host")
+	}
+}
+
+// TestHostMigration tests that hosts stored as facts are moved to the hosts table
+func TestHostMigration(t *testing.T) {
+	store := setupTestStore(t)
+	defer store.Close()
+
+	ctx := context.Background()
+
+	sourceDriver, err := iofs.New(migrationsFS, "migrations")
+	if err != nil {
+		t.Fatalf("failed to create migration source: %v", err)
+	}
+	driver, err := sqlite3.WithInstance(store.db, &sqlite3.Config{})
+	if err != nil {
+		t.Fatalf("failed to create database driver: %v", err)
+	}
+	m, err := migrate.NewWithInstance("iofs", sourceDriver, "sqlite3", driver)
+	if err != nil {
+		t.Fatalf("failed to create migration instance: %v", err)
+	}
+
+	// Back to the schema before the hosts table, with a host stored as a fact
+	if err := m.Migrate(3); err != nil {
+		t.Fatalf("failed to migrate down: %v", err)
+	}
+
+	now := time.Now()
+	hostData := `{"id":"web1","address":"10.0.0.1","port":2222,"user":"froyo","key_path":"/keys/web1",` +
+		`"labels":{"env":"prod","role":"web"},"onboarded_at":"2025-03-01T10:00:00.123456789+02:00",` +
+		`"created_at":"2025-03-01T10:00:00Z","updated_at":"2025-03-02T10:00:00Z"}`
+	facts := []*Fact{
+		{ID: "f1", TargetID: "web1", Namespace: "host.metadata", Key: "info", Value: hostData, CreatedAt: now, UpdatedAt: now},
+		{ID: "f2", TargetID: "web1", Namespace: "host.labels", Key: "all", Value: `{"env":"prod","role":"web"}`, CreatedAt: now, UpdatedAt: now},
+		{ID: "f3", TargetID: "web1", Namespace: "os.basic", Key: "data", Value: `{"distro":"ubuntu"}`, CreatedAt: now, UpdatedAt: now},
+	}
+	for _, fact := range facts {
+		if err := store.UpsertFact(ctx, fact); err != nil {
+			t.Fatalf("failed to upsert fact: %v", err)
+		}
+	}
+
+	if err := m.Up(); err != nil {
+		t.Fatalf("failed to migrate up: %v", err)
+	}
+
+	host, err := store.GetHost(ctx, "web1")
+	if err != nil {
+		t.Fatalf("failed to get migrated host: %v", err)
+	}
+	if host.Address != "10.0.0.1" || host.Port != 2222 || host.User != "froyo" || host.KeyPath != "/keys/web1" {
+		t.Errorf("unexpected migrated host: %+v", host)
+	}
+	if host.Status != HostStatusActive || host.Labels["env"] != "prod" || host.Labels["role"] != "web" {
+		t.Errorf("unexpected migrated host status or labels: %+v", host)
+	}
+	if host.OnboardedAt == nil || !host.OnboardedAt.Equal(time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected migrated onboarded_at: %v", host.OnboardedAt)
+	}
+
+	// Only the host records leave the facts table
+	remaining, err := store.ListFacts(ctx, nil, nil, 100, 0)
+	if err != nil {
+		t.Fatalf("failed to list facts: %v", err)
+	}
+	if len(remaining) != 1 || remaining[0].Namespace != "os.basic" {
+		t.Errorf("expected only the os.basic fact to remain, got %d facts", len(remaining))
+	}
+
+	// Migrating down moves the host back
+	if err := m.Migrate(3); err != nil {
+		t.Fatalf("failed to migrate down: %v", err)
+	}
+	fact, err := store.GetFact(ctx, "web1", "host.metadata", "info")
+	if err != nil {
+		t.Fatalf("failed to get host fact: %v", err)
+	}
+	if !strings.Contains(fact.Value, `"address":"10.0.0.1"`) || !strings.Contains(fact.Value, `"role":"web"`) {
+		t.Errorf("unexpected host fact: %s", fact.Value)
+	}
+}
+
 // TestAuditOperations tests Audit operations
 func TestAuditOperations(t *testing.T) {
 	store := setupTestStore(t)
@@ -760,6 +1116,116 @@ func TestCascadeDelete(t *testing.T) {
 	}
 }
 
+// TestWorkspaceLockOperations tests workspace lock acquisition, renewal and release
+func TestWorkspaceLockOperations(t *testing.T) {
+	store := setupTestStore(t)
+	defer store.Close()
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	reason := "deploying v2"
+
+	// Get lock of an unlocked workspace
+	lock, err := store.GetWorkspaceLock(ctx, "prod")
+	if err != nil {
+		t.Fatalf("failed to get workspace lock: %v", err)
+	}
+	if lock != nil {
+		t.Fatalf("expected no lock, got %+v", lock)
+	}
+
+	// Acquire lock
+	alice := &WorkspaceLock{
+		Workspace:   "prod",
+		LockID:      "lock-001",
+		Owner:       "alice@laptop",
+		Operation:   "apply",
+		Reason:      &reason,
+		AcquiredAt:  now,
+		HeartbeatAt: now,
+		ExpiresAt:   now.Add(5 * time.Minute),
+	}
+
+	acquired, err := store.AcquireWorkspaceLock(ctx, alice)
+	if err != nil {
+		t.Fatalf("failed to acquire workspace lock: %v", err)
+	}
+	if !acquired {
+		t.Fatal("expected lock to be acquired")
+	}
+
+	// A second holder cannot take a live lock
+	bob := &WorkspaceLock{
+		Workspace:   "prod",
+		LockID:      "lock-002",
+		Owner:       "bob@desktop",
+		Operation:   "plan",
+		AcquiredAt:  now,
+		HeartbeatAt: now,
+		ExpiresAt:   now.Add(5 * time.Minute),
+	}
+
+	acquired, err = store.AcquireWorkspaceLock(ctx, bob)
+	if err != nil {
+		t.Fatalf("failed to attempt workspace lock: %v", err)
+	}
+	if acquired {
+		t.Fatal("expected lock held by alice not to be acquired")
+	}
+
+	lock, err = store.GetWorkspaceLock(ctx, "prod")
+	if err != nil {
+		t.Fatalf("failed to get workspace lock: %v", err)
+	}
+	if lock.Owner != "alice@laptop" || lock.Operation != "apply" || lock.Reason == nil || *lock.Reason != reason {
+		t.Errorf("unexpected lock holder: %+v", lock)
+	}
+
+	// Renew lock
+	if err := store.RenewWorkspaceLock(ctx, "prod", "lock-001", now.Add(10*time.Minute)); err != nil {
+		t.Fatalf("failed to renew workspace lock: %v", err)
+	}
+
+	if err := store.RenewWorkspaceLock(ctx, "prod", "lock-002", now.Add(10*time.Minute)); err == nil {
+		t.Error("expected error renewing a lock that is not held")
+	}
+
+	// An expired lock can be taken over
+	if err := store.RenewWorkspaceLock(ctx, "prod", "lock-001", now.Add(-time.Minute)); err != nil {
+		t.Fatalf("failed to expire workspace lock: %v", err)
+	}
+
+	acquired, err = store.AcquireWorkspaceLock(ctx, bob)
+	if err != nil {
+		t.Fatalf("failed to acquire expired workspace lock: %v", err)
+	}
+	if !acquired {
+		t.Fatal("expected expired lock to be acquired")
+	}
+
+	// Releasing with a stale lock ID leaves the new holder in place
+	if err := store.ReleaseWorkspaceLock(ctx, "prod", "lock-001"); err != nil {
+		t.Fatalf("failed to release workspace lock: %v", err)
+	}
+
+	lock, err = store.GetWorkspaceLock(ctx, "prod")
+	if err != nil {
+		t.Fatalf("failed to get workspace lock: %v", err)
+	}
+	if lock == nil || lock.LockID != "lock-002" {
+		t.Errorf("expected lock to be held by bob, got %+v", lock)
+	}
+
+	// Force release
+	if err := store.ForceReleaseWorkspaceLock(ctx, "prod"); err != nil {
+		t.Fatalf("failed to force-release workspace lock: %v", err)
+	}
+
+	if err := store.ForceReleaseWorkspaceLock(ctx, "prod"); err == nil {
+		t.Error("expected error force-releasing an unlocked workspace")
+	}
+}
+
 // TestMain sets up and tears down test environment
 func TestMain(m *testing.M) {
 	// Run tests
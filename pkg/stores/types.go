@@ -38,6 +38,14 @@ const (
 	EventLevelError   EventLevel = "error"
 )
 
+// HostStatus represents the reachability of a managed host
+type HostStatus string
+
+const (
+	HostStatusActive      HostStatus = "active"
+	HostStatusUnreachable HostStatus = "unreachable"
+)
+
 // Run represents an execution run
 type Run struct {
 	ID          string     `json:"id"`
@@ -108,6 +116,39 @@ type Fact struct {
 	UpdatedAt time.Time  `json:"updated_at"`
 }
 
+// FactSnapshot represents a version of a fact, recorded when its value changes
+type FactSnapshot struct {
+	ID          int64     `json:"id"`
+	TargetID    string    `json:"target_id"`
+	Namespace   string    `json:"namespace"`
+	Value       string    `json:"value"` // JSON blob
+	Hash        string    `json:"hash"`  // SHA256 of the canonical value for change detection
+	CollectedAt time.Time `json:"collected_at"`
+}
+
+// Host represents a managed host in the inventory
+type Host struct {
+	ID          string            `json:"id"`
+	Address     string            `json:"address"`
+	Port        int               `json:"port"`
+	User        string            `json:"user"`
+	KeyPath     string            `json:"key_path"`
+	Status      HostStatus        `json:"status"`
+	Labels      map[string]string `json:"labels"`
+	Groups      []string          `json:"groups"`
+	OnboardedAt *time.Time        `json:"onboarded_at,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// HostFilter selects hosts. Empty fields match every host; labels must all match
+type HostFilter struct {
+	Address *string           `json:"address,omitempty"`
+	Status  *HostStatus       `json:"status,omitempty"`
+	Group   *string           `json:"group,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
 // AuditEntry represents an audit trail entry
 type AuditEntry struct {
 	ID        int64     `json:"id"`
@@ -119,6 +160,18 @@ type AuditEntry struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
+// WorkspaceLock represents the lock serializing operations on a workspace
+type WorkspaceLock struct {
+	Workspace   string    `json:"workspace"`
+	LockID      string    `json:"lock_id"`   // identifies the holder's lease
+	Owner       string    `json:"owner"`     // e.g., "alice@laptop"
+	Operation   string    `json:"operation"` // e.g., "plan", "apply", "drift.reconcile"
+	Reason      *string   `json:"reason,omitempty"`
+	AcquiredAt  time.Time `json:"acquired_at"`
+	HeartbeatAt time.Time `json:"heartbeat_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
 // Store defines the interface for the persistence layer
 type Store interface {
 	// Lifecycle
@@ -155,6 +208,8 @@ type Store interface {
 	GetResourceState(ctx context.Context, resourceType, resourceName string) (*ResourceState, error)
 	ListResourceStates(ctx context.Context, limit, offset int) ([]*ResourceState, error)
 	DeleteResourceState(ctx context.Context, id string) error
+	RenameResourceState(ctx context.Context, resourceType, fromName, toName string) error
+	RenameResourceStates(ctx context.Context, resourceType string, names map[string]string) error
 
 	// Facts operations
 	UpsertFact(ctx context.Context, fact *Fact) error
@@ -163,6 +218,25 @@ type Store interface {
 	DeleteExpiredFacts(ctx context.Context) (int64, error)
 	DeleteFact(ctx context.Context, id string) error
 
+	// Fact history operations
+	AppendFactSnapshot(ctx context.Context, snapshot *FactSnapshot) error
+	ListFactSnapshots(ctx context.Context, targetID string, namespace *string, limit, offset int) ([]*FactSnapshot, error)
+	DeleteFactSnapshotsBefore(ctx context.Context, before time.Time) (int64, error)
+
+	// Host operations
+	UpsertHost(ctx context.Context, host *Host) error
+	GetHost(ctx context.Context, id string) (*Host, error)
+	ListHosts(ctx context.Context, filter HostFilter, limit, offset int) ([]*Host, error)
+	UpdateHostStatus(ctx context.Context, id string, status HostStatus) error
+	DeleteHost(ctx context.Context, id string) error
+
+	// Workspace lock operations
+	AcquireWorkspaceLock(ctx context.Context, lock *WorkspaceLock) (bool, error)
+	GetWorkspaceLock(ctx context.Context, workspace string) (*WorkspaceLock, error)
+	RenewWorkspaceLock(ctx context.Context, workspace, lockID string, expiresAt time.Time) error
+	ReleaseWorkspaceLock(ctx context.Context, workspace, lockID string) error
+	ForceReleaseWorkspaceLock(ctx context.Context, workspace string) error
+
 	// Audit operations
 	CreateAuditEntry(ctx context.Context, entry *AuditEntry) error
 	ListAuditEntries(ctx context.Context, action *string, actor *string, limit, offset int) ([]*AuditEntry, error)
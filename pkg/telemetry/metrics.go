@@ -21,6 +21,7 @@ type Metrics struct {
 	// Plan unit metrics
 	planUnitsExecuted *prometheus.CounterVec
 	planUnitDuration  *prometheus.HistogramVec
+	concurrencyWait   *prometheus.HistogramVec
 
 	// Resource metrics
 	resourcesManaged *prometheus.GaugeVec
@@ -110,6 +111,15 @@ func NewMetrics(cfg MetricsConfig) (*Metrics, error) {
 			},
 			[]string{"operation", "resource_type"},
 		),
+		concurrencyWait: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "concurrency_wait_seconds",
+				Help:      "Time plan units waited for a slot on a concurrency key in seconds",
+				Buckets:   buckets,
+			},
+			[]string{"scope", "key"},
+		),
 
 		// Resource metrics
 		resourcesManaged: prometheus.NewGaugeVec(
@@ -208,6 +218,7 @@ func NewMetrics(cfg MetricsConfig) (*Metrics, error) {
 		m.runDuration,
 		m.planUnitsExecuted,
 		m.planUnitDuration,
+		m.concurrencyWait,
 		m.resourcesManaged,
 		m.resourceState,
 		m.providerCalls,
@@ -255,6 +266,14 @@ func (m *Metrics) RecordPlanUnitExecution(operation, status string, duration tim
 	m.planUnitDuration.WithLabelValues(operation, resourceType).Observe(duration.Seconds())
 }
 
+// RecordConcurrencyWait records the time a plan unit waited for a slot on a concurrency key.
+func (m *Metrics) RecordConcurrencyWait(scope, key string, wait time.Duration) {
+	if m.concurrencyWait == nil {
+		return
+	}
+	m.concurrencyWait.WithLabelValues(scope, key).Observe(wait.Seconds())
+}
+
 // Resource Metrics
 
 // SetResourceCount sets the current count of managed resources.